@@ -4,7 +4,6 @@
 package api
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -17,6 +16,8 @@ import (
 
 	"github.com/cuducos/go-cnpj"
 	"github.com/cuducos/minha-receita/db"
+	"github.com/cuducos/minha-receita/export"
+	"github.com/cuducos/minha-receita/watch"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
@@ -29,126 +30,213 @@ var cacheControl = fmt.Sprintf("max-age=%d", int(cacheMaxAge.Seconds()))
 
 type database interface {
 	GetCompany(string) (string, error)
+	GetCompanies(context.Context, []string) (map[string]string, error)
 	Search(context.Context, *db.Query) (string, error)
 	MetaRead(string) (string, error)
 }
 
 type api struct {
-	db   database
-	host string
+	db         database
+	host       string
+	templates  uiTemplates     // nil when the HTML UI is disabled
+	exports    *export.Manager // nil when export jobs are disabled
+	watchlists *watch.Store    // nil when watchlists are disabled
 }
 
 // messageResponse takes a text message and a HTTP status, wraps the message into a
 // JSON output and writes it together with the proper headers to a response.
 func (app *api) messageResponse(w http.ResponseWriter, s int, m string) {
-	w.WriteHeader(s)
-	if m != "" {
-		w.Header().Set("Content-type", "application/json")
-		if _, err := io.WriteString(w, fmt.Sprintf(`{"message":"%s"}`, m)); err != nil {
-			slog.Error("could not write response message for", "status code", s, "message", m, "error", err)
-		}
-	}
-	if s == http.StatusInternalServerError {
-		slog.Error("Internal server error", "message", m)
-	}
+	writeJSON(w, s, struct {
+		Message string `json:"message"`
+	}{m})
 }
 
-func (app *api) singleCompany(pth string, w http.ResponseWriter, r *http.Request, i int64) {
+func (app *api) singleCompany(pth string, w http.ResponseWriter, r *http.Request, i int64, rep representation, m string) {
 	w.Header().Set("Content-type", "application/json")
+	w.Header().Add("Vary", "Accept")
+	l := langFor(r)
 	if !cnpj.IsValid(pth) {
-		app.messageResponse(w, http.StatusBadRequest, fmt.Sprintf("CNPJ %s inválido.", cnpj.Mask(pth[1:])))
-		registerMetric("singleCompany", r.Method, http.StatusBadRequest, i)
+		app.errorResponse(w, r, http.StatusBadRequest, errorResponse{
+			Code:    codeInvalidCNPJ,
+			Message: message(l, "invalid_cnpj", cnpj.Mask(pth[1:])),
+		})
+		registerMetric("singleCompany"+m, r.Method, http.StatusBadRequest, i)
 		return
 	}
-	s, err := getCompany(app.db, pth)
+	var s string
+	var err error
+	if v := r.URL.Query().Get(historyParam); v != "" {
+		at, err := parsePointInTime(v)
+		if err != nil {
+			app.errorResponse(w, r, http.StatusBadRequest, errorResponse{
+				Code:    codeInvalidDate,
+				Message: message(l, "invalid_date", v),
+			})
+			registerMetric("singleCompany"+m, r.Method, http.StatusBadRequest, i)
+			return
+		}
+		h, ok := app.history(w, r)
+		if !ok {
+			registerMetric("singleCompany"+m, r.Method, http.StatusNotImplemented, i)
+			return
+		}
+		s, err = h.GetCompanyAt(cnpj.Unmask(pth), at)
+		if err != nil {
+			app.errorResponse(w, r, http.StatusNotFound, errorResponse{
+				Code:    codeNotFound,
+				Message: message(l, "not_found_at", cnpj.Mask(pth), v),
+			})
+			registerMetric("singleCompany"+m, r.Method, http.StatusNotFound, i)
+			return
+		}
+	} else {
+		s, err = getCompany(app.db, pth)
+		if err != nil {
+			app.errorResponse(w, r, http.StatusNotFound, errorResponse{
+				Code:    codeNotFound,
+				Message: message(l, "not_found", cnpj.Mask(pth)),
+			})
+			registerMetric("singleCompany"+m, r.Method, http.StatusNotFound, i)
+			return
+		}
+	}
+	rep = negotiate(r, rep)
+	s, err = rep.company(s)
 	if err != nil {
-		app.messageResponse(w, http.StatusNotFound, fmt.Sprintf("CNPJ %s não encontrado.", cnpj.Mask(pth)))
-		registerMetric("singleCompany", r.Method, http.StatusNotFound, i)
+		slog.Error("could not convert company", "cnpj", pth, "error", err)
+		app.errorResponse(w, r, http.StatusInternalServerError, errorResponse{
+			Code:    codeConversionError,
+			Message: message(l, "conversion_error"),
+		})
+		registerMetric("singleCompany"+m, r.Method, http.StatusInternalServerError, i)
 		return
 	}
+	w.Header().Set("Content-type", rep.contentType)
 	w.WriteHeader(http.StatusOK)
 	if _, err := io.WriteString(w, s); err != nil {
 		slog.Error("error responding to successful single company request", "request", r, "error", err)
 	}
-	registerMetric("singleCompany", r.Method, http.StatusOK, i)
+	registerMetric("singleCompany"+m, r.Method, http.StatusOK, i)
 }
 
-func (app *api) paginatedSearch(q *db.Query, w http.ResponseWriter, r *http.Request, i int64) {
+func (app *api) paginatedSearch(q *db.Query, w http.ResponseWriter, r *http.Request, i int64, rep representation, m string) {
 	w.Header().Set("Content-type", "application/json")
+	if err := q.Validate(); err != nil {
+		c, e, _ := queryError(langFor(r), err)
+		app.errorResponse(w, r, c, e)
+		registerMetric("paginatedSearch"+m, r.Method, c, i)
+		return
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 	s, err := app.db.Search(ctx, q)
 	if errors.Is(err, context.DeadlineExceeded) {
 		slog.Error("paginated search timed out", "query", q)
-		var b bytes.Buffer
-		b.WriteString("Tempo de requisição esgotou (Timeout)")
+		l := langFor(r)
+		e := errorResponse{Code: codeSearchTimeout, Message: message(l, "search_timeout")}
 		if q.Limit/2 > 1 {
-			b.WriteString(fmt.Sprintf(
-				". Essa busca solicitou %d CNPJs, experimente um número menor utilizando o parâmetro limit=%d, por exemplo.",
-				q.Limit,
-				q.Limit/2,
-			))
+			e.Message += message(l, "search_timeout_suggestion", q.Limit, q.Limit/2)
+			e.Details = map[string]any{"limit": q.Limit / 2}
 		}
-		app.messageResponse(w, http.StatusRequestTimeout, b.String())
-		registerMetric("paginatedSearch", r.Method, http.StatusRequestTimeout, i)
+		app.errorResponse(w, r, http.StatusRequestTimeout, e)
+		registerMetric("paginatedSearch"+m, r.Method, http.StatusRequestTimeout, i)
+		return
+	}
+	if c, e, ok := queryError(langFor(r), err); ok {
+		app.errorResponse(w, r, c, e)
+		registerMetric("paginatedSearch"+m, r.Method, c, i)
 		return
 	}
 	if err != nil {
 		slog.Error("paginated search error", "error", err, "query", q)
-		app.messageResponse(w, http.StatusNotFound, "Erro inesperado na busca.")
-		registerMetric("paginatedSearch", r.Method, http.StatusNotFound, i)
+		app.errorResponse(w, r, http.StatusNotFound, errorResponse{
+			Code:    codeSearchError,
+			Message: message(langFor(r), "search_error"),
+		})
+		registerMetric("paginatedSearch"+m, r.Method, http.StatusNotFound, i)
+		return
+	}
+	s, err = rep.page(s)
+	if err != nil {
+		slog.Error("could not convert search results", "query", q, "error", err)
+		app.errorResponse(w, r, http.StatusInternalServerError, errorResponse{
+			Code:    codeConversionError,
+			Message: message(langFor(r), "conversion_error"),
+		})
+		registerMetric("paginatedSearch"+m, r.Method, http.StatusInternalServerError, i)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 	if _, err := io.WriteString(w, s); err != nil {
 		slog.Error("error responding to successful paginated search request", "query", q, "request", r, "error", err)
 	}
-	registerMetric("paginatedSearch", r.Method, http.StatusOK, i)
+	registerMetric("paginatedSearch"+m, r.Method, http.StatusOK, i)
 }
 
-func (app *api) companyHandler(w http.ResponseWriter, r *http.Request) {
+func (app *api) companies(w http.ResponseWriter, r *http.Request, pth string, rep representation, m string) {
 	i := time.Now().UnixMilli()
 	w.Header().Set("Cache-Control", cacheControl)
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding")
+	w.Header().Set("Access-Control-Allow-Headers", "Accept, Accept-Language, Content-Type, Content-Length, Accept-Encoding")
 
 	switch r.Method {
 	case http.MethodGet:
 		break
 	case http.MethodOptions:
 		w.WriteHeader(http.StatusOK)
-		registerMetric("earlyReturn", r.Method, http.StatusOK, i)
+		registerMetric("earlyReturn"+m, r.Method, http.StatusOK, i)
 		return
 	default:
-		app.messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método GET.")
-		registerMetric("earlyReturn", r.Method, http.StatusMethodNotAllowed, i)
+		app.errorResponse(w, r, http.StatusMethodNotAllowed, methodNotAllowed(langFor(r), false))
+		registerMetric("earlyReturn"+m, r.Method, http.StatusMethodNotAllowed, i)
 		return
 	}
-	pth := r.URL.Path
 	if pth == "/" {
 		q := db.NewQuery(r.URL.Query())
 		if q == nil {
-			http.Redirect(w, r, "https://docs.minhareceita.org", http.StatusFound)
-			registerMetric("redirectedToDocs", r.Method, http.StatusFound, i)
+			u := "https://docs.minhareceita.org"
+			if app.templates != nil {
+				u = uiPrefix
+			}
+			http.Redirect(w, r, u, http.StatusFound)
+			registerMetric("redirectedToDocs"+m, r.Method, http.StatusFound, i)
 			return
 		}
-		app.paginatedSearch(q, w, r, i)
+		app.paginatedSearch(q, w, r, i, rep, m)
+		return
+	}
+	if p, ok := strings.CutSuffix(pth, historyPath); ok {
+		app.companyHistory(p, w, r, i, m)
 		return
 	}
-	app.singleCompany(pth, w, r, i)
+	app.singleCompany(pth, w, r, i, rep, m)
+}
+
+func (app *api) companyHandler(w http.ResponseWriter, r *http.Request) {
+	app.companies(w, r, r.URL.Path, v1(r), "")
+}
+
+// companyV2Handler serves the same endpoints as companyHandler under the /v2/
+// prefix (or /v2/en/ for English), using the nested JSON structure.
+func (app *api) companyV2Handler(w http.ResponseWriter, r *http.Request) {
+	p, _ := v2Path(r.URL.Path)
+	app.companies(w, r, p, v2(r), "V2")
 }
 
 func (app *api) updatedHandler(w http.ResponseWriter, r *http.Request) {
 	i := time.Now().UnixMilli()
 	if r.Method != http.MethodGet {
-		app.messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas o método GET.")
+		app.errorResponse(w, r, http.StatusMethodNotAllowed, methodNotAllowed(langFor(r), false))
 		registerMetric("updated", r.Method, http.StatusMethodNotAllowed, i)
 		return
 	}
 	s, err := app.db.MetaRead("updated-at")
 	if err != nil || s == "" {
-		app.messageResponse(w, http.StatusInternalServerError, "Erro buscando data de atualização.")
+		app.errorResponse(w, r, http.StatusInternalServerError, errorResponse{
+			Code:    codeUpdatedAtError,
+			Message: message(langFor(r), "updated_at_unavailable"),
+		})
 		registerMetric("updated", r.Method, http.StatusInternalServerError, i)
 		return
 	}
@@ -160,7 +248,7 @@ func (app *api) updatedHandler(w http.ResponseWriter, r *http.Request) {
 func (app *api) healthHandler(w http.ResponseWriter, r *http.Request) {
 	i := time.Now().UnixMilli()
 	if r.Method != http.MethodHead && r.Method != http.MethodGet {
-		app.messageResponse(w, http.StatusMethodNotAllowed, "Essa URL aceita apenas os métodos GET e HEAD.")
+		app.errorResponse(w, r, http.StatusMethodNotAllowed, methodNotAllowed(langFor(r), true))
 		registerMetric("health", r.Method, http.StatusMethodNotAllowed, i)
 		return
 	}
@@ -183,21 +271,41 @@ func (app *api) allowedHostWrapper(h func(http.ResponseWriter, *http.Request)) f
 	return w
 }
 
-// Serve spins up the HTTP server.
-func Serve(db database, p string) error {
+// Serve spins up the HTTP server. If ui is true, it also serves the HTML pages
+// under /ui/. If e is not nil, it also serves the export jobs under /export.
+// If wl is not nil, it also serves the watchlists under /watchlists.
+func Serve(db database, p string, ui bool, e *export.Manager, wl *watch.Store) error {
 	if !strings.HasPrefix(p, ":") {
 		p = ":" + p
 	}
-	app := api{db, os.Getenv("ALLOWED_HOST")}
-	for _, r := range []struct {
+	app := api{db: db, host: os.Getenv("ALLOWED_HOST"), exports: e, watchlists: wl}
+	type route struct {
 		path    string
 		handler func(http.ResponseWriter, *http.Request)
-	}{
+	}
+	rs := []route{
 		{"/", app.companyHandler},
+		{"/v2/", app.companyV2Handler},
+		{checkPath, app.checkHandler},
 		{"/updated", app.updatedHandler},
 		{"/healthz", app.healthHandler},
 		{"/metrics", promhttp.Handler().ServeHTTP},
-	} {
+	}
+	if ui {
+		t, err := newUITemplates()
+		if err != nil {
+			return fmt.Errorf("could not load the html ui: %w", err)
+		}
+		app.templates = t
+		rs = append(rs, route{uiPrefix, app.uiHandler})
+	}
+	if e != nil {
+		rs = append(rs, route{exportPrefix, app.exportHandler}, route{exportPrefix + "/", app.exportHandler})
+	}
+	if wl != nil {
+		rs = append(rs, route{watchlistPrefix, app.watchlistHandler}, route{watchlistPrefix + "/", app.watchlistHandler})
+	}
+	for _, r := range rs {
 		http.HandleFunc(r.path, app.allowedHostWrapper(r.handler))
 	}
 	s := &http.Server{Addr: p, ReadTimeout: timeout * 2, WriteTimeout: timeout * 2}
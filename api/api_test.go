@@ -13,6 +13,7 @@ import (
 
 	"github.com/cuducos/go-cnpj"
 	"github.com/cuducos/minha-receita/db"
+	"github.com/cuducos/minha-receita/transform"
 )
 
 type mockDatabase struct{}
@@ -30,6 +31,16 @@ func (mockDatabase) GetCompany(n string) (string, error) {
 	return string(b), nil
 }
 
+func (m mockDatabase) GetCompanies(_ context.Context, ids []string) (map[string]string, error) {
+	cs := make(map[string]string)
+	for _, id := range ids {
+		if c, err := m.GetCompany(id); err == nil {
+			cs[id] = c
+		}
+	}
+	return cs, nil
+}
+
 func (mockDatabase) Search(ctx context.Context, q *db.Query) (string, error) { return "", nil }
 
 func (mockDatabase) MetaRead(k string) (string, error) { return "42", nil }
@@ -55,7 +66,7 @@ func TestCompanyHandler(t *testing.T) {
 			http.MethodHead,
 			"/",
 			http.StatusMethodNotAllowed,
-			`{"message":"Essa URL aceita apenas o método GET."}`,
+			`{"code":"method_not_allowed","message":"Essa URL aceita apenas o método GET."}`,
 		},
 		{
 			http.MethodOptions,
@@ -67,13 +78,13 @@ func TestCompanyHandler(t *testing.T) {
 			http.MethodHead,
 			"/",
 			http.StatusMethodNotAllowed,
-			`{"message":"Essa URL aceita apenas o método GET."}`,
+			`{"code":"method_not_allowed","message":"Essa URL aceita apenas o método GET."}`,
 		},
 		{
 			http.MethodPost,
 			"/",
 			http.StatusMethodNotAllowed,
-			`{"message":"Essa URL aceita apenas o método GET."}`,
+			`{"code":"method_not_allowed","message":"Essa URL aceita apenas o método GET."}`,
 		},
 		{
 			http.MethodGet,
@@ -85,19 +96,19 @@ func TestCompanyHandler(t *testing.T) {
 			http.MethodGet,
 			"/foobar",
 			http.StatusBadRequest,
-			`{"message":"CNPJ foobar inválido."}`,
+			`{"code":"invalid_cnpj","message":"CNPJ foobar inválido."}`,
 		},
 		{
 			http.MethodGet,
 			"/00.000.000/0001-91",
 			http.StatusNotFound,
-			`{"message":"CNPJ 00.000.000/0001-91 não encontrado."}`,
+			`{"code":"not_found","message":"CNPJ 00.000.000/0001-91 não encontrado."}`,
 		},
 		{
 			http.MethodGet,
 			"/00000000000191",
 			http.StatusNotFound,
-			`{"message":"CNPJ 00.000.000/0001-91 não encontrado."}`,
+			`{"code":"not_found","message":"CNPJ 00.000.000/0001-91 não encontrado."}`,
 		},
 		{
 			http.MethodGet,
@@ -157,7 +168,7 @@ func TestHealthHandler(t *testing.T) {
 		{
 			http.MethodPost,
 			http.StatusMethodNotAllowed,
-			`{"message":"Essa URL aceita apenas os métodos GET e HEAD."}`,
+			`{"code":"method_not_allowed","message":"Essa URL aceita apenas os métodos GET e HEAD."}`,
 		},
 		{
 			http.MethodHead,
@@ -193,9 +204,9 @@ func TestUpdatedHandler(t *testing.T) {
 		content string
 	}{
 		{http.MethodGet, http.StatusOK, `{"message":"42"}`},
-		{http.MethodPost, http.StatusMethodNotAllowed, `{"message":"Essa URL aceita apenas o método GET."}`},
-		{http.MethodHead, http.StatusMethodNotAllowed, `{"message":"Essa URL aceita apenas o método GET."}`},
-		{http.MethodOptions, http.StatusMethodNotAllowed, `{"message":"Essa URL aceita apenas o método GET."}`},
+		{http.MethodPost, http.StatusMethodNotAllowed, `{"code":"method_not_allowed","message":"Essa URL aceita apenas o método GET."}`},
+		{http.MethodHead, http.StatusMethodNotAllowed, `{"code":"method_not_allowed","message":"Essa URL aceita apenas o método GET."}`},
+		{http.MethodOptions, http.StatusMethodNotAllowed, `{"code":"method_not_allowed","message":"Essa URL aceita apenas o método GET."}`},
 	} {
 		req, err := http.NewRequest(c.method, "/updated", nil)
 		if err != nil {
@@ -240,3 +251,260 @@ func TestAllowedHostWrap(t *testing.T) {
 	}
 
 }
+
+type timeoutDatabase struct{ mockDatabase }
+
+func (timeoutDatabase) Search(ctx context.Context, q *db.Query) (string, error) {
+	if q.OrderBy != "" {
+		return "", &db.UnsupportedQueryError{Database: "the PostgreSQL structured model", Feature: "order_by"}
+	}
+	if q.Cursor != nil && *q.Cursor == "invalid" {
+		return "", db.ErrInvalidCursor
+	}
+	if q.Cursor != nil {
+		return "", fmt.Errorf("%w: cursor from the release 2026-09-13", db.ErrExpiredCursor)
+	}
+	return "", context.DeadlineExceeded
+}
+
+func (timeoutDatabase) MetaRead(k string) (string, error) { return `"quoted"`, nil }
+
+func TestErrorResponses(t *testing.T) {
+	for _, c := range []struct {
+		path     string
+		lang     string
+		status   int
+		expected string
+	}{
+		{"/foobar", "", http.StatusBadRequest, `{"code":"invalid_cnpj","message":"CNPJ foobar inválido."}`},
+		{"/foobar", "en-US,en;q=0.9", http.StatusBadRequest, `{"code":"invalid_cnpj","message":"Invalid CNPJ foobar."}`},
+		{"/foobar", "fr-FR", http.StatusBadRequest, `{"code":"invalid_cnpj","message":"CNPJ foobar inválido."}`},
+		{"/foobar", "pt-BR,en;q=0.5", http.StatusBadRequest, `{"code":"invalid_cnpj","message":"CNPJ foobar inválido."}`},
+		{"/00000000000191", "en", http.StatusNotFound, `{"code":"not_found","message":"CNPJ 00.000.000/0001-91 not found."}`},
+		{
+			"/?uf=sp&limit=8",
+			"en",
+			http.StatusRequestTimeout,
+			`{"code":"search_timeout","message":"Request timed out. This search requested 8 CNPJs, try a smaller number using the parameter limit=4, for example.","details":{"limit":4}}`,
+		},
+		{
+			"/?uf=sp&limit=2",
+			"",
+			http.StatusRequestTimeout,
+			`{"code":"search_timeout","message":"Tempo de requisição esgotou (Timeout)"}`,
+		},
+		{
+			"/?uf=sp&uf!=sp",
+			"en",
+			http.StatusBadRequest,
+			`{"code":"contradictory_filter","message":"Contradictory search: the same value was included and excluded.","details":{"reason":"invalid query: contradictory filter: uf SP both included and excluded"}}`,
+		},
+		{
+			"/?uf=sp&cnae_mode=some",
+			"en",
+			http.StatusBadRequest,
+			`{"code":"invalid_mode","message":"Invalid mode: cnae_mode and cnpf_mode accept any or all, and can only be used with cnae and cnpf.","details":{"reason":"invalid query: invalid mode: cnae_mode must be any or all, got some"}}`,
+		},
+		{
+			"/?q=uf=SP",
+			"en",
+			http.StatusBadRequest,
+			`{"code":"invalid_expression","message":"Error in the q parameter.","details":{"reason":"invalid query: invalid search expression: unexpected = at position 2, use : for equality"}}`,
+		},
+		{
+			"/?uf=sp&cursor=invalid",
+			"en",
+			http.StatusBadRequest,
+			`{"code":"invalid_cursor","message":"Invalid cursor: use the cursor returned by the previous page, with the same search parameters and order.","details":{"reason":"invalid query: invalid cursor"}}`,
+		},
+		{
+			"/?q=NOT+uf:SP",
+			"en",
+			http.StatusBadRequest,
+			`{"code":"expensive_query","message":"Search too expensive: the search needs at least one condition without NOT.","details":{"limit":"negated","reason":"expensive query: the search needs at least one condition that is not negated"}}`,
+		},
+		{
+			"/?q=((((((((((uf:SP))))))))))",
+			"",
+			http.StatusBadRequest,
+			`{"code":"expensive_query","message":"Busca muito custosa: o parâmetro q aceita até 8 níveis de parênteses ou NOT.","details":{"limit":"depth","max":8,"reason":"expensive query: search expression nested more than 8 levels"}}`,
+		},
+		{
+			"/?uf=sp&order_by=razao_social",
+			"en",
+			http.StatusBadRequest,
+			`{"code":"unsupported_query","message":"This server does not support order_by in the search.","details":{"feature":"order_by","reason":"unsupported query: the PostgreSQL structured model does not support order_by"}}`,
+		},
+		{
+			"/?uf=sp&cursor=42",
+			"en",
+			http.StatusGone,
+			`{"code":"expired_cursor","message":"Expired cursor: the data was updated since the first page, search again without the cursor."}`,
+		},
+	} {
+		t.Run(fmt.Sprintf("%s %s", c.path, c.lang), func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, c.path, nil)
+			if err != nil {
+				t.Fatal("Expected an HTTP request, but got an error.")
+			}
+			if c.lang != "" {
+				req.Header.Set("Accept-Language", c.lang)
+			}
+			app := api{db: &timeoutDatabase{}}
+			resp := httptest.NewRecorder()
+			http.HandlerFunc(app.companyHandler).ServeHTTP(resp, req)
+			if resp.Code != c.status {
+				t.Errorf("Expected %s to return %v, but got %v", c.path, c.status, resp.Code)
+			}
+			if got := strings.TrimSpace(resp.Body.String()); got != c.expected {
+				t.Errorf("\nExpected HTTP contents to be:\n\t%s\nGot:\n\t%s", c.expected, got)
+			}
+			if got := resp.Header().Get("Content-type"); got != "application/json" {
+				t.Errorf("Expected content-type to be application/json, but got %s", got)
+			}
+		})
+	}
+}
+
+func TestMessageResponseIsEscaped(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "/updated", nil)
+	if err != nil {
+		t.Fatal("Expected an HTTP request, but got an error.")
+	}
+	app := api{db: &timeoutDatabase{}}
+	resp := httptest.NewRecorder()
+	http.HandlerFunc(app.updatedHandler).ServeHTTP(resp, req)
+	expected := `{"message":"\"quoted\""}`
+	if got := strings.TrimSpace(resp.Body.String()); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
+
+func TestEnglishRepresentation(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "/19131243000197?lang=en", nil)
+	if err != nil {
+		t.Fatal("Expected an HTTP request, but got an error.")
+	}
+	app := api{db: &mockDatabase{}}
+	resp := httptest.NewRecorder()
+	http.HandlerFunc(app.companyHandler).ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Errorf("Expected English representation to return 200, got %d", resp.Code)
+	}
+	body := resp.Body.String()
+	for _, s := range []string{`"legal_name":"OPEN KNOWLEDGE BRASIL"`, `"registration_status":"ACTIVE"`} {
+		if !strings.Contains(body, s) {
+			t.Errorf("Expected English representation to contain %s, got %s", s, body)
+		}
+	}
+	if strings.Contains(body, "razao_social") {
+		t.Errorf("Expected English representation not to contain razao_social, got %s", body)
+	}
+}
+
+func TestRepresentationPage(t *testing.T) {
+	for _, c := range []struct {
+		page     string
+		expected string
+	}{
+		{`{"data":[],"cursor":null}`, `{"data":[],"cursor":null}`},
+		{
+			`{"data":[{"uf":"SP","descricao_situacao_cadastral":"BAIXADA"}],"cursor":"42"}`,
+			`{"data":[{"state":"SP","registration_status":"CLOSED"}],"cursor":"42"}`,
+		},
+	} {
+		got, err := representation{jsonContentType, transform.EnglishJSON}.page(c.page)
+		if err != nil {
+			t.Errorf("Expected no error translating %s, got %s", c.page, err)
+		}
+		if got != c.expected {
+			t.Errorf("Expected %s, got %s", c.expected, got)
+		}
+	}
+}
+
+func TestCompanyV2Handler(t *testing.T) {
+	for _, c := range []struct {
+		path     string
+		status   int
+		contains string
+	}{
+		{"/v2/foobar", http.StatusBadRequest, `{"code":"invalid_cnpj","message":"CNPJ foobar inválido."}`},
+		{"/v2/00000000000191", http.StatusNotFound, `{"code":"not_found","message":"CNPJ 00.000.000/0001-91 não encontrado."}`},
+		{"/v2/19.131.243/0001-97", http.StatusOK, `"contatos":{"telefones":[{"tipo":"telefone","ddd":"11","numero":"23851939"}],"email":null}`},
+		{"/v2/19131243000197", http.StatusOK, `"endereco":{"tipo_de_logradouro":"AVENIDA","logradouro":"PAULISTA 37"`},
+		{"/v2/19131243000197?lang=en", http.StatusOK, `"contacts":{"phones":[{"type":"phone","area_code":"11","number":"23851939"}],"email":null}`},
+		{"/v2/en/19131243000197", http.StatusOK, `"address":{"street_type":"AVENIDA","street":"PAULISTA 37"`},
+		{"/v2/en/foobar", http.StatusBadRequest, `{"code":"invalid_cnpj","message":"CNPJ foobar inválido."}`},
+	} {
+		t.Run(c.path, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, c.path, nil)
+			if err != nil {
+				t.Fatal("Expected an HTTP request, but got an error.")
+			}
+			app := api{db: &mockDatabase{}}
+			resp := httptest.NewRecorder()
+			http.HandlerFunc(app.companyV2Handler).ServeHTTP(resp, req)
+			if resp.Code != c.status {
+				t.Errorf("Expected %s to return %v, but got %v", c.path, c.status, resp.Code)
+			}
+			if body := resp.Body.String(); !strings.Contains(body, c.contains) {
+				t.Errorf("\nExpected HTTP contents to contain:\n\t%s\nGot:\n\t%s", c.contains, body)
+			}
+		})
+	}
+}
+
+func TestConversionError(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "/19131243000197", nil)
+	if err != nil {
+		t.Fatal("Expected an HTTP request, but got an error.")
+	}
+	app := api{db: &mockDatabase{}}
+	resp := httptest.NewRecorder()
+	rep := representation{jsonContentType, func([]byte) ([]byte, error) { return nil, errors.New("forty-two") }}
+	app.singleCompany(req.URL.Path, resp, req, 0, rep, "")
+	if resp.Code != http.StatusInternalServerError {
+		t.Errorf("Expected conversion error to return %v, but got %v", http.StatusInternalServerError, resp.Code)
+	}
+	exp := `{"code":"conversion_error","message":"Erro convertendo a resposta."}`
+	if got := strings.TrimSpace(resp.Body.String()); got != exp {
+		t.Errorf("\nExpected HTTP contents to be:\n\t%s\nGot:\n\t%s", exp, got)
+	}
+}
+
+func TestAlternativeRepresentations(t *testing.T) {
+	for _, c := range []struct {
+		accept      string
+		contentType string
+		contains    string
+	}{
+		{"", "application/json", `"razao_social": "OPEN KNOWLEDGE BRASIL"`},
+		{"*/*", "application/json", `"razao_social": "OPEN KNOWLEDGE BRASIL"`},
+		{"text/html,application/json;q=0.9", "application/json", `"razao_social": "OPEN KNOWLEDGE BRASIL"`},
+		{"application/ld+json", "application/ld+json", `"@type":"Organization"`},
+		{"application/json;q=0.5, application/ld+json", "application/ld+json", `"legalName":"OPEN KNOWLEDGE BRASIL"`},
+		{"text/vcard", "text/vcard; charset=utf-8", "BEGIN:VCARD\r\nVERSION:4.0\r\n"},
+		{"text/vcard;q=0.1, application/json", "application/json", `"razao_social": "OPEN KNOWLEDGE BRASIL"`},
+	} {
+		t.Run(c.accept, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/19131243000197", nil)
+			if err != nil {
+				t.Fatal("Expected an HTTP request, but got an error.")
+			}
+			req.Header.Set("Accept", c.accept)
+			app := api{db: &mockDatabase{}}
+			resp := httptest.NewRecorder()
+			http.HandlerFunc(app.companyHandler).ServeHTTP(resp, req)
+			if resp.Code != http.StatusOK {
+				t.Errorf("Expected status 200, got %d", resp.Code)
+			}
+			if got := resp.Header().Get("Content-type"); got != c.contentType {
+				t.Errorf("Expected content-type to be %s, got %s", c.contentType, got)
+			}
+			if body := resp.Body.String(); !strings.Contains(body, c.contains) {
+				t.Errorf("Expected body to contain %s, got %s", c.contains, body)
+			}
+		})
+	}
+}
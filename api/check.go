@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cuducos/minha-receita/compliance"
+)
+
+const (
+	checkPath        = "/check"
+	csvContentType   = "text/csv"
+	maxCheckListSize = 10_000  // CNPJs per request
+	maxCheckBodySize = 4 << 20 // 4MB
+)
+
+// wantsCSV checks if the report should be a CSV, via `format=csv` or via the
+// `Accept` header.
+func wantsCSV(r *http.Request) bool {
+	if f := r.FormValue("format"); f != "" {
+		return strings.EqualFold(f, "csv")
+	}
+	for v := range strings.SplitSeq(r.Header.Get("Accept"), ",") {
+		t, _, err := mime.ParseMediaType(strings.TrimSpace(v))
+		if err != nil {
+			continue
+		}
+		return t == csvContentType
+	}
+	return false
+}
+
+func (app *api) invalidCheckList(w http.ResponseWriter, r *http.Request, i int64, m string) {
+	app.errorResponse(w, r, http.StatusBadRequest, errorResponse{Code: codeInvalidCheckList, Message: m})
+	registerMetric("check", r.Method, http.StatusBadRequest, i)
+}
+
+// checkHandler takes a list of CNPJs (a TXT or CSV file as the request body,
+// or as the `file` field of a multipart form) and returns a compliance report
+// for each line.
+func (app *api) checkHandler(w http.ResponseWriter, r *http.Request) {
+	i := time.Now().UnixMilli()
+	l := langFor(r)
+	if r.Method != http.MethodPost {
+		app.errorResponse(w, r, http.StatusMethodNotAllowed, errorResponse{
+			Code:    codeMethodNotAllowed,
+			Message: message(l, "method_not_allowed_post"),
+		})
+		registerMetric("check", r.Method, http.StatusMethodNotAllowed, i)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxCheckBodySize)
+	var b io.Reader = r.Body
+	if t, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); t == "multipart/form-data" {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			app.invalidCheckList(w, r, i, message(l, "check_list_unreadable"))
+			return
+		}
+		defer f.Close()
+		b = f
+	}
+	ns, err := compliance.ParseList(b)
+	if err != nil {
+		app.invalidCheckList(w, r, i, message(l, "check_list_unreadable"))
+		return
+	}
+	if len(ns) == 0 {
+		app.invalidCheckList(w, r, i, message(l, "check_list_empty"))
+		return
+	}
+	if len(ns) > maxCheckListSize {
+		app.invalidCheckList(w, r, i, message(l, "check_list_too_long", len(ns), maxCheckListSize))
+		return
+	}
+	since, err := compliance.ParseSince(r.FormValue("since"))
+	if err != nil {
+		app.invalidCheckList(w, r, i, message(l, "check_invalid_since", r.FormValue("since")))
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	rs, err := compliance.Check(ctx, app.db, ns, since)
+	if err != nil {
+		slog.Error("could not check cnpj list", "count", len(ns), "error", err)
+		app.errorResponse(w, r, http.StatusInternalServerError, errorResponse{
+			Code:    codeCheckError,
+			Message: message(l, "check_error"),
+		})
+		registerMetric("check", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	w.Header().Add("Vary", "Accept")
+	if !wantsCSV(r) {
+		writeJSON(w, http.StatusOK, struct {
+			Data []compliance.Result `json:"data"`
+		}{rs})
+		registerMetric("check", r.Method, http.StatusOK, i)
+		return
+	}
+	w.Header().Set("Content-type", csvContentType+"; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := compliance.WriteCSV(w, rs); err != nil {
+		slog.Error("error responding to check request", "error", err)
+	}
+	registerMetric("check", r.Method, http.StatusOK, i)
+}
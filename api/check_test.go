@@ -0,0 +1,95 @@
+package api
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckHandler(t *testing.T) {
+	app := api{db: &mockDatabase{}}
+	list := "cnpj;nome\n19.131.243/0001-97;Open Knowledge\n00000000000191;Banco\n12.345.678/0001-00;?\n"
+	for _, c := range []struct {
+		name        string
+		method      string
+		path        string
+		body        string
+		accept      string
+		status      int
+		contentType string
+		contains    []string
+	}{
+		{"get", http.MethodGet, "/check", "", "", http.StatusMethodNotAllowed, "application/json", []string{`"code":"method_not_allowed"`}},
+		{"empty list", http.MethodPost, "/check", "cnpj\n", "", http.StatusBadRequest, "application/json", []string{`"code":"invalid_check_list"`, "Nenhum CNPJ"}},
+		{"invalid since", http.MethodPost, "/check?since=01/01/2024", list, "", http.StatusBadRequest, "application/json", []string{"Data 01/01/2024 inválida"}},
+		{
+			"json",
+			http.MethodPost,
+			"/check?since=2024-01-01",
+			list,
+			"",
+			http.StatusOK,
+			"application/json",
+			[]string{
+				`{"entrada":"19.131.243/0001-97","cnpj":"19131243000197","cnpj_valido":true,"encontrado":true,"razao_social":"OPEN KNOWLEDGE BRASIL","descricao_situacao_cadastral":"ATIVA","data_situacao_cadastral":"2013-10-03","situacao_irregular":false,"situacao_alterada_desde":false,`,
+				`{"entrada":"00000000000191","cnpj":"00000000000191","cnpj_valido":true,"encontrado":false,`,
+				`{"entrada":"12.345.678/0001-00","cnpj":"12345678000100","cnpj_valido":false,"encontrado":false,`,
+			},
+		},
+		{"csv via format", http.MethodPost, "/check?format=csv", list, "", http.StatusOK, "text/csv; charset=utf-8", []string{"entrada,cnpj,cnpj_valido,", "19.131.243/0001-97,19131243000197,true,true,OPEN KNOWLEDGE BRASIL,ATIVA,2013-10-03,false,"}},
+		{"csv via accept", http.MethodPost, "/check", list, "text/csv", http.StatusOK, "text/csv; charset=utf-8", []string{"00000000000191,00000000000191,true,false,"}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+			req.Header.Set("Content-Type", "text/csv")
+			if c.accept != "" {
+				req.Header.Set("Accept", c.accept)
+			}
+			resp := httptest.NewRecorder()
+			app.checkHandler(resp, req)
+			if resp.Code != c.status {
+				t.Errorf("expected status %d, got %d: %s", c.status, resp.Code, resp.Body.String())
+			}
+			if ct := resp.Header().Get("Content-type"); ct != c.contentType {
+				t.Errorf("expected content type %s, got %s", c.contentType, ct)
+			}
+			for _, s := range c.contains {
+				if !strings.Contains(resp.Body.String(), s) {
+					t.Errorf("expected response to contain %s, got %s", s, resp.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestCheckHandlerWithUpload(t *testing.T) {
+	var b bytes.Buffer
+	m := multipart.NewWriter(&b)
+	f, err := m.CreateFormFile("file", "fornecedores.txt")
+	if err != nil {
+		t.Fatalf("expected no error creating form file, got %s", err)
+	}
+	if _, err := f.Write([]byte("19131243000197\n")); err != nil {
+		t.Fatalf("expected no error writing form file, got %s", err)
+	}
+	if err := m.WriteField("format", "csv"); err != nil {
+		t.Fatalf("expected no error writing form field, got %s", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("expected no error closing multipart writer, got %s", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/check", &b)
+	req.Header.Set("Content-Type", m.FormDataContentType())
+	resp := httptest.NewRecorder()
+	app := api{db: &mockDatabase{}}
+	app.checkHandler(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if !strings.Contains(resp.Body.String(), "19131243000197,19131243000197,true,true,OPEN KNOWLEDGE BRASIL") {
+		t.Errorf("expected csv report, got %s", resp.Body.String())
+	}
+}
@@ -0,0 +1,387 @@
+package api
+
+import (
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/cuducos/minha-receita/db"
+	"golang.org/x/text/language"
+)
+
+// errorCode is a stable, machine-readable identifier for an error response.
+// Clients should rely on it instead of matching the (localized) message.
+type errorCode string
+
+const (
+	codeInvalidCNPJ        errorCode = "invalid_cnpj"
+	codeNotFound           errorCode = "not_found"
+	codeSearchTimeout      errorCode = "search_timeout"
+	codeSearchError        errorCode = "search_error"
+	codeMethodNotAllowed   errorCode = "method_not_allowed"
+	codeUpdatedAtError     errorCode = "updated_at_unavailable"
+	codeConversionError    errorCode = "conversion_error"
+	codeInvalidExport      errorCode = "invalid_export"
+	codeExportNotFound     errorCode = "export_not_found"
+	codeExportNotReady     errorCode = "export_not_ready"
+	codeExportQueueFull    errorCode = "export_queue_full"
+	codeExportError        errorCode = "export_error"
+	codeInvalidCheckList   errorCode = "invalid_check_list"
+	codeCheckError         errorCode = "check_error"
+	codeInvalidDate        errorCode = "invalid_date"
+	codeHistoryUnavailable errorCode = "history_unavailable"
+	codeInvalidWatchlist   errorCode = "invalid_watchlist"
+	codeWatchlistNotFound  errorCode = "watchlist_not_found"
+	codeWatchlistError     errorCode = "watchlist_error"
+	codeInvalidQuery       errorCode = "invalid_query"
+	codeContradictory      errorCode = "contradictory_filter"
+	codeInvalidMode        errorCode = "invalid_mode"
+	codeInvalidExpression  errorCode = "invalid_expression"
+	codeInvalidOrder       errorCode = "invalid_order"
+	codeInvalidCursor      errorCode = "invalid_cursor"
+	codeUnsupportedQuery   errorCode = "unsupported_query"
+	codeExpensiveQuery     errorCode = "expensive_query"
+	codeExpiredCursor      errorCode = "expired_cursor"
+)
+
+type lang int
+
+const (
+	portuguese lang = iota // default, so it must be the first one
+	english
+)
+
+var langMatcher = language.NewMatcher([]language.Tag{
+	language.BrazilianPortuguese,
+	language.English,
+})
+
+// langFor picks the language of the response messages based on the `lang` URL
+// parameter or on the `Accept-Language` header, defaulting to Brazilian
+// Portuguese.
+func langFor(r *http.Request) lang {
+	if isEnglish(r) {
+		return english
+	}
+	ts, _, err := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	if err != nil || len(ts) == 0 {
+		return portuguese
+	}
+	_, i, _ := langMatcher.Match(ts...)
+	return lang(i)
+}
+
+type translation [2]string // indexed by lang
+
+var messages = map[string]translation{
+	"invalid_cnpj": {
+		"CNPJ %s inválido.",
+		"Invalid CNPJ %s.",
+	},
+	"not_found": {
+		"CNPJ %s não encontrado.",
+		"CNPJ %s not found.",
+	},
+	"search_timeout": {
+		"Tempo de requisição esgotou (Timeout)",
+		"Request timed out",
+	},
+	"search_timeout_suggestion": {
+		". Essa busca solicitou %d CNPJs, experimente um número menor utilizando o parâmetro limit=%d, por exemplo.",
+		". This search requested %d CNPJs, try a smaller number using the parameter limit=%d, for example.",
+	},
+	"search_error": {
+		"Erro inesperado na busca.",
+		"Unexpected error while searching.",
+	},
+	"method_not_allowed": {
+		"Essa URL aceita apenas o método GET.",
+		"This URL accepts only the GET method.",
+	},
+	"method_not_allowed_with_head": {
+		"Essa URL aceita apenas os métodos GET e HEAD.",
+		"This URL accepts only the GET and HEAD methods.",
+	},
+	"updated_at_unavailable": {
+		"Erro buscando data de atualização.",
+		"Error retrieving the update date.",
+	},
+	"conversion_error": {
+		"Erro convertendo a resposta.",
+		"Error converting the response.",
+	},
+	"method_not_allowed_post": {
+		"Essa URL aceita apenas o método POST.",
+		"This URL accepts only the POST method.",
+	},
+	"export_query_required": {
+		"A exportação precisa de ao menos um filtro da busca (uf, municipio, cnae etc.).",
+		"The export needs at least one search filter (uf, municipio, cnae etc.).",
+	},
+	"export_invalid_format": {
+		"Formato de exportação %s inválido, use csv, ndjson ou parquet.",
+		"Invalid export format %s, use csv, ndjson or parquet.",
+	},
+	"export_queue_full": {
+		"Fila de exportação cheia, tente novamente mais tarde.",
+		"Export queue is full, try again later.",
+	},
+	"export_error": {
+		"Erro inesperado criando a exportação.",
+		"Unexpected error while creating the export.",
+	},
+	"export_not_found": {
+		"Exportação %s não encontrada.",
+		"Export %s not found.",
+	},
+	"export_not_ready": {
+		"Exportação %s ainda não está pronta.",
+		"Export %s is not ready yet.",
+	},
+	"check_list_unreadable": {
+		"Não foi possível ler a lista de CNPJs, envie um arquivo TXT ou CSV.",
+		"Could not read the CNPJ list, send a TXT or CSV file.",
+	},
+	"check_list_empty": {
+		"Nenhum CNPJ encontrado na lista.",
+		"No CNPJ found in the list.",
+	},
+	"check_list_too_long": {
+		"A lista tem %d CNPJs, o máximo é %d.",
+		"The list has %d CNPJs, the maximum is %d.",
+	},
+	"check_invalid_since": {
+		"Data %s inválida, use o formato AAAA-MM-DD.",
+		"Invalid date %s, use the YYYY-MM-DD format.",
+	},
+	"check_error": {
+		"Erro inesperado verificando a lista de CNPJs.",
+		"Unexpected error while checking the CNPJ list.",
+	},
+	"invalid_date": {
+		"Data %s inválida, use o formato AAAA-MM ou AAAA-MM-DD.",
+		"Invalid date %s, use the YYYY-MM or YYYY-MM-DD format.",
+	},
+	"history_unavailable": {
+		"Esse servidor não guarda o histórico dos CNPJs.",
+		"This server does not keep the history of the CNPJs.",
+	},
+	"not_found_at": {
+		"CNPJ %s não encontrado em %s.",
+		"CNPJ %s not found at %s.",
+	},
+	"method_not_allowed_get_post": {
+		"Essa URL aceita apenas os métodos GET e POST.",
+		"This URL accepts only the GET and POST methods.",
+	},
+	"method_not_allowed_get_delete": {
+		"Essa URL aceita apenas os métodos GET e DELETE.",
+		"This URL accepts only the GET and DELETE methods.",
+	},
+	"invalid_watchlist": {
+		"Lista de monitoramento inválida, envie um JSON com name, cnpjs (CNPJs válidos) e, opcionalmente, webhook (URL http ou https) e secret.",
+		"Invalid watchlist, send a JSON with name, cnpjs (valid CNPJs) and, optionally, webhook (http or https URL) and secret.",
+	},
+	"watchlist_not_found": {
+		"Lista de monitoramento %s não encontrada.",
+		"Watchlist %s not found.",
+	},
+	"watchlist_error": {
+		"Erro inesperado na lista de monitoramento.",
+		"Unexpected error in the watchlist.",
+	},
+	"invalid_query": {
+		"Busca inválida.",
+		"Invalid search.",
+	},
+	"contradictory_filter": {
+		"Busca contraditória: um mesmo valor foi incluído e excluído.",
+		"Contradictory search: the same value was included and excluded.",
+	},
+	"invalid_mode": {
+		"Modo inválido: cnae_mode e cnpf_mode aceitam any ou all, e só podem ser usados com cnae e cnpf.",
+		"Invalid mode: cnae_mode and cnpf_mode accept any or all, and can only be used with cnae and cnpf.",
+	},
+	"invalid_expression": {
+		"Erro no parâmetro q.",
+		"Error in the q parameter.",
+	},
+	"invalid_order": {
+		"Ordenação inválida: order_by aceita capital_social, data_inicio_atividade ou razao_social, com :asc ou :desc.",
+		"Invalid order: order_by accepts capital_social, data_inicio_atividade or razao_social, with :asc or :desc.",
+	},
+	"invalid_cursor": {
+		"Cursor inválido: use o cursor retornado pela página anterior, com os mesmos parâmetros de busca e a mesma ordenação.",
+		"Invalid cursor: use the cursor returned by the previous page, with the same search parameters and order.",
+	},
+	"unsupported_query": {
+		"Esse servidor não suporta essa busca.",
+		"This server does not support this search.",
+	},
+	"unsupported_negation": {
+		"Esse servidor não suporta negação na busca.",
+		"This server does not support negation in the search.",
+	},
+	"unsupported_all_mode": {
+		"Esse servidor não suporta o modo all na busca.",
+		"This server does not support the all mode in the search.",
+	},
+	"unsupported_q": {
+		"Esse servidor não suporta o parâmetro q na busca.",
+		"This server does not support the q parameter in the search.",
+	},
+	"unsupported_order_by": {
+		"Esse servidor não suporta order_by na busca.",
+		"This server does not support order_by in the search.",
+	},
+	"unsupported_field": {
+		"Esse servidor não suporta o campo %s na busca.",
+		"This server does not support the field %s in the search.",
+	},
+	"expensive_query": {
+		"Busca muito custosa.",
+		"Search too expensive.",
+	},
+	"expensive_length": {
+		"Busca muito custosa: o parâmetro q aceita até %d caracteres.",
+		"Search too expensive: the q parameter accepts up to %d characters.",
+	},
+	"expensive_values": {
+		"Busca muito custosa: o parâmetro q aceita até %d valores.",
+		"Search too expensive: the q parameter accepts up to %d values.",
+	},
+	"expensive_depth": {
+		"Busca muito custosa: o parâmetro q aceita até %d níveis de parênteses ou NOT.",
+		"Search too expensive: the q parameter accepts up to %d levels of parenthesis or NOT.",
+	},
+	"expensive_negated": {
+		"Busca muito custosa: a busca precisa de ao menos uma condição sem NOT.",
+		"Search too expensive: the search needs at least one condition without NOT.",
+	},
+	"expired_cursor": {
+		"Cursor expirado: os dados foram atualizados desde a primeira página, refaça a busca sem o cursor.",
+		"Expired cursor: the data was updated since the first page, search again without the cursor.",
+	},
+}
+
+// message returns the translated message for key k formatted with args.
+func message(l lang, k string, args ...any) string {
+	t, ok := messages[k]
+	if !ok {
+		slog.Error("missing translation", "key", k)
+		return ""
+	}
+	if len(args) == 0 {
+		return t[l]
+	}
+	return fmt.Sprintf(t[l], args...)
+}
+
+type errorResponse struct {
+	Code    errorCode      `json:"code"`
+	Message string         `json:"message"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// writeJSON serializes v (with sorted map keys, so details are stable) and
+// writes it together with the proper headers to a response.
+func writeJSON(w http.ResponseWriter, s int, v any) {
+	b, err := json.Marshal(v, json.Deterministic(true))
+	if err != nil {
+		slog.Error("could not serialize response", "status code", s, "value", v, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(s)
+	if _, err := w.Write(b); err != nil {
+		slog.Error("could not write response", "status code", s, "value", v, "error", err)
+	}
+}
+
+// errorResponse writes a JSON error with a stable code and a message localized
+// according to the request `Accept-Language` header.
+func (app *api) errorResponse(w http.ResponseWriter, r *http.Request, s int, e errorResponse) {
+	w.Header().Add("Vary", "Accept-Language")
+	writeJSON(w, s, e)
+	if s == http.StatusInternalServerError {
+		slog.Error("Internal server error", "code", e.Code, "message", e.Message)
+	}
+}
+
+// queryError returns the HTTP status and the error response for invalid or
+// unsupported search queries, and false for any other error.
+func queryError(l lang, err error) (int, errorResponse, bool) {
+	for _, c := range []struct {
+		err  error
+		code errorCode
+	}{
+		{db.ErrContradictoryFilter, codeContradictory},
+		{db.ErrInvalidMode, codeInvalidMode},
+		{db.ErrInvalidExpression, codeInvalidExpression},
+		{db.ErrInvalidOrder, codeInvalidOrder},
+		{db.ErrInvalidCursor, codeInvalidCursor},
+		{db.ErrInvalidQuery, codeInvalidQuery},
+	} {
+		if errors.Is(err, c.err) {
+			return http.StatusBadRequest, errorResponse{
+				Code:    c.code,
+				Message: message(l, string(c.code)),
+				Details: map[string]any{"reason": err.Error()},
+			}, true
+		}
+	}
+	var u *db.UnsupportedQueryError
+	var e *db.ExpensiveQueryError
+	switch {
+	case errors.As(err, &e):
+		d := map[string]any{"limit": e.Limit, "reason": err.Error()}
+		var args []any
+		if e.Max > 0 {
+			d["max"] = e.Max
+			args = append(args, e.Max)
+		}
+		return http.StatusBadRequest, errorResponse{
+			Code:    codeExpensiveQuery,
+			Message: message(l, "expensive_"+e.Limit, args...),
+			Details: d,
+		}, true
+	case errors.Is(err, db.ErrExpensiveQuery):
+		return http.StatusBadRequest, errorResponse{
+			Code:    codeExpensiveQuery,
+			Message: message(l, "expensive_query"),
+			Details: map[string]any{"reason": err.Error()},
+		}, true
+	case errors.As(err, &u):
+		d := map[string]any{"feature": u.Feature, "reason": err.Error()}
+		var args []any
+		if u.Field != "" {
+			d["field"] = u.Field
+			args = append(args, u.Field)
+		}
+		return http.StatusBadRequest, errorResponse{
+			Code:    codeUnsupportedQuery,
+			Message: message(l, "unsupported_"+u.Feature, args...),
+			Details: d,
+		}, true
+	case errors.Is(err, db.ErrUnsupportedQuery):
+		return http.StatusBadRequest, errorResponse{
+			Code:    codeUnsupportedQuery,
+			Message: message(l, "unsupported_query"),
+			Details: map[string]any{"reason": err.Error()},
+		}, true
+	case errors.Is(err, db.ErrExpiredCursor):
+		return http.StatusGone, errorResponse{Code: codeExpiredCursor, Message: message(l, "expired_cursor")}, true
+	}
+	return 0, errorResponse{}, false
+}
+
+func methodNotAllowed(l lang, head bool) errorResponse {
+	k := "method_not_allowed"
+	if head {
+		k = "method_not_allowed_with_head"
+	}
+	return errorResponse{Code: codeMethodNotAllowed, Message: message(l, k)}
+}
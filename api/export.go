@@ -0,0 +1,194 @@
+package api
+
+import (
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cuducos/minha-receita/db"
+	"github.com/cuducos/minha-receita/export"
+)
+
+const (
+	exportPrefix = "/export"
+	sseInterval  = 500 * time.Millisecond
+)
+
+func (app *api) exportNotFound(w http.ResponseWriter, r *http.Request, id string, i int64) {
+	app.errorResponse(w, r, http.StatusNotFound, errorResponse{
+		Code:    codeExportNotFound,
+		Message: message(langFor(r), "export_not_found", id),
+	})
+	registerMetric("export", r.Method, http.StatusNotFound, i)
+}
+
+// createExport takes the same filters as the paginated search (as URL or form
+// parameters) and a `format`, and queues an export job.
+func (app *api) createExport(w http.ResponseWriter, r *http.Request, i int64) {
+	l := langFor(r)
+	if err := r.ParseForm(); err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, errorResponse{
+			Code:    codeInvalidExport,
+			Message: message(l, "export_query_required"),
+		})
+		registerMetric("export", r.Method, http.StatusBadRequest, i)
+		return
+	}
+	q := db.NewQuery(r.Form)
+	if q == nil {
+		app.errorResponse(w, r, http.StatusBadRequest, errorResponse{
+			Code:    codeInvalidExport,
+			Message: message(l, "export_query_required"),
+		})
+		registerMetric("export", r.Method, http.StatusBadRequest, i)
+		return
+	}
+	if err := q.Validate(); err != nil {
+		c, e, _ := queryError(l, err)
+		app.errorResponse(w, r, c, e)
+		registerMetric("export", r.Method, c, i)
+		return
+	}
+	f, err := export.ParseFormat(r.Form.Get("format"))
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, errorResponse{
+			Code:    codeInvalidExport,
+			Message: message(l, "export_invalid_format", r.Form.Get("format")),
+		})
+		registerMetric("export", r.Method, http.StatusBadRequest, i)
+		return
+	}
+	j, err := app.exports.Submit(*q, f)
+	if errors.Is(err, export.ErrQueueFull) {
+		w.Header().Set("Retry-After", "60")
+		app.errorResponse(w, r, http.StatusServiceUnavailable, errorResponse{
+			Code:    codeExportQueueFull,
+			Message: message(l, "export_queue_full"),
+		})
+		registerMetric("export", r.Method, http.StatusServiceUnavailable, i)
+		return
+	}
+	if err != nil {
+		slog.Error("could not create export job", "query", q, "error", err)
+		app.errorResponse(w, r, http.StatusInternalServerError, errorResponse{
+			Code:    codeExportError,
+			Message: message(l, "export_error"),
+		})
+		registerMetric("export", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s/%s", exportPrefix, j.ID))
+	writeJSON(w, http.StatusAccepted, j)
+	registerMetric("export", r.Method, http.StatusAccepted, i)
+}
+
+// exportEvents streams the job as server-sent events every time it changes,
+// until it is finished.
+func (app *api) exportEvents(w http.ResponseWriter, r *http.Request, j export.Job, i int64) {
+	c := http.NewResponseController(w)
+	if err := c.SetWriteDeadline(time.Time{}); err != nil {
+		slog.Warn("could not disable write deadline for export events", "error", err)
+	}
+	w.Header().Set("Content-type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	t := time.NewTicker(sseInterval)
+	defer t.Stop()
+	var prev string
+	for {
+		b, err := json.Marshal(j)
+		if err != nil {
+			slog.Error("could not serialize export job", "id", j.ID, "error", err)
+			return
+		}
+		if s := string(b); s != prev {
+			if _, err := fmt.Fprintf(w, "event: progress\ndata: %s\n\n", s); err != nil {
+				slog.Error("could not write export event", "id", j.ID, "error", err)
+				return
+			}
+			if err := c.Flush(); err != nil {
+				slog.Error("could not flush export event", "id", j.ID, "error", err)
+				return
+			}
+			prev = s
+		}
+		if j.Finished() {
+			registerMetric("exportEvents", r.Method, http.StatusOK, i)
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-t.C:
+		}
+		var ok bool
+		if j, ok = app.exports.Job(j.ID); !ok {
+			return
+		}
+	}
+}
+
+func (app *api) exportDownload(w http.ResponseWriter, r *http.Request, j export.Job, i int64) {
+	if j.Status != export.Done {
+		app.errorResponse(w, r, http.StatusConflict, errorResponse{
+			Code:    codeExportNotReady,
+			Message: message(langFor(r), "export_not_ready", j.ID),
+			Details: map[string]any{"status": j.Status},
+		})
+		registerMetric("exportDownload", r.Method, http.StatusConflict, i)
+		return
+	}
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		slog.Warn("could not disable write deadline for export download", "error", err)
+	}
+	w.Header().Set("Content-type", j.Format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, j.FileName()))
+	http.ServeFile(w, r, app.exports.Path(j))
+	registerMetric("exportDownload", r.Method, http.StatusOK, i)
+}
+
+// exportHandler serves the export jobs: POST /export creates a job, GET
+// /export/<id> shows its progress, GET /export/<id>/events streams its progress
+// and GET /export/<id>/download serves the exported file.
+func (app *api) exportHandler(w http.ResponseWriter, r *http.Request) {
+	i := time.Now().UnixMilli()
+	pth := strings.Trim(strings.TrimPrefix(r.URL.Path, exportPrefix), "/")
+	if pth == "" {
+		if r.Method != http.MethodPost {
+			app.errorResponse(w, r, http.StatusMethodNotAllowed, errorResponse{
+				Code:    codeMethodNotAllowed,
+				Message: message(langFor(r), "method_not_allowed_post"),
+			})
+			registerMetric("export", r.Method, http.StatusMethodNotAllowed, i)
+			return
+		}
+		app.createExport(w, r, i)
+		return
+	}
+	if r.Method != http.MethodGet {
+		app.errorResponse(w, r, http.StatusMethodNotAllowed, methodNotAllowed(langFor(r), false))
+		registerMetric("export", r.Method, http.StatusMethodNotAllowed, i)
+		return
+	}
+	id, act, _ := strings.Cut(pth, "/")
+	j, ok := app.exports.Job(id)
+	if !ok {
+		app.exportNotFound(w, r, id, i)
+		return
+	}
+	switch act {
+	case "":
+		writeJSON(w, http.StatusOK, j)
+		registerMetric("export", r.Method, http.StatusOK, i)
+	case "events":
+		app.exportEvents(w, r, j, i)
+	case "download":
+		app.exportDownload(w, r, j, i)
+	default:
+		app.exportNotFound(w, r, pth, i)
+	}
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cuducos/minha-receita/db"
+	"github.com/cuducos/minha-receita/export"
+)
+
+// exportDatabase returns a single page of results and keeps the meta storage
+// in memory.
+type exportDatabase struct {
+	mockDatabase
+	mu   sync.Mutex
+	meta map[string]string
+}
+
+func (*exportDatabase) Search(_ context.Context, _ *db.Query) (string, error) {
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`{"data":[%s],"cursor":null}`, b), nil
+}
+
+func (e *exportDatabase) MetaSave(k, v string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.meta[k] = v
+	return nil
+}
+
+func (e *exportDatabase) MetaRead(k string) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	v, ok := e.meta[k]
+	if !ok {
+		return "", fmt.Errorf("metadata key %s not found", k)
+	}
+	return v, nil
+}
+
+func (e *exportDatabase) MetaDelete(k string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.meta, k)
+	return nil
+}
+
+func newExportAPI(t *testing.T, start bool) *api {
+	d := &exportDatabase{meta: make(map[string]string)}
+	m, err := export.New(d, export.Config{Dir: t.TempDir(), Workers: 1, QueueSize: 1, Retention: time.Hour})
+	if err != nil {
+		t.Fatalf("expected no error creating export manager, got %s", err)
+	}
+	if start {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		m.Start(ctx)
+	}
+	return &api{db: d, exports: m}
+}
+
+func TestExportHandler(t *testing.T) {
+	app := newExportAPI(t, true)
+	for _, c := range []struct {
+		method   string
+		path     string
+		status   int
+		contains string
+	}{
+		{http.MethodGet, "/export", http.StatusMethodNotAllowed, `"code":"method_not_allowed"`},
+		{http.MethodPost, "/export", http.StatusBadRequest, `"code":"invalid_export"`},
+		{http.MethodPost, "/export?uf=sp&format=xlsx", http.StatusBadRequest, "Formato de exportação xlsx inválido"},
+		{http.MethodGet, "/export/42", http.StatusNotFound, `"code":"export_not_found"`},
+	} {
+		req := httptest.NewRequest(c.method, c.path, nil)
+		resp := httptest.NewRecorder()
+		app.exportHandler(resp, req)
+		if resp.Code != c.status {
+			t.Errorf("expected %s %s to return %d, got %d", c.method, c.path, c.status, resp.Code)
+		}
+		if !strings.Contains(resp.Body.String(), c.contains) {
+			t.Errorf("expected %s %s to contain %s, got %s", c.method, c.path, c.contains, resp.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/export", strings.NewReader("uf=sp&format=ndjson"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp := httptest.NewRecorder()
+	app.exportHandler(resp, req)
+	if resp.Code != http.StatusAccepted {
+		t.Fatalf("expected export to be accepted, got %d: %s", resp.Code, resp.Body.String())
+	}
+	loc := resp.Header().Get("Location")
+	if !strings.HasPrefix(loc, "/export/") {
+		t.Fatalf("expected location to be an export job, got %s", loc)
+	}
+	if !strings.Contains(resp.Body.String(), `"query":{"uf":["SP"]}`) {
+		t.Errorf("expected job to have the query, got %s", resp.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, loc+"/events", nil)
+	resp = httptest.NewRecorder()
+	app.exportHandler(resp, req) // returns once the job is finished
+	if ct := resp.Header().Get("Content-type"); ct != "text/event-stream" {
+		t.Errorf("expected event stream content type, got %s", ct)
+	}
+	if !strings.Contains(resp.Body.String(), "event: progress\ndata: {") || !strings.Contains(resp.Body.String(), `"status":"done"`) {
+		t.Errorf("expected progress events until the job is done, got %s", resp.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, loc+"/download", nil)
+	resp = httptest.NewRecorder()
+	app.exportHandler(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected download to return 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if ct := resp.Header().Get("Content-type"); ct != "application/x-ndjson" {
+		t.Errorf("expected ndjson content type, got %s", ct)
+	}
+	if cd := resp.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, `attachment; filename="minha-receita-`) {
+		t.Errorf("expected attachment content disposition, got %s", cd)
+	}
+	if !strings.HasPrefix(resp.Body.String(), `{"uf":"SP"`) {
+		t.Errorf("expected exported company, got %s", resp.Body.String())
+	}
+}
+
+func TestExportDownloadNotReady(t *testing.T) {
+	app := newExportAPI(t, false)
+	j, err := app.exports.Submit(db.Query{Params: db.Params{UF: []string{"SP"}}}, export.CSV)
+	if err != nil {
+		t.Fatalf("expected no error submitting job, got %s", err)
+	}
+	for _, c := range []struct {
+		path     string
+		status   int
+		contains string
+	}{
+		{"/export/" + j.ID, http.StatusOK, `"status":"queued"`},
+		{"/export/" + j.ID + "/download", http.StatusConflict, `"code":"export_not_ready"`},
+	} {
+		req := httptest.NewRequest(http.MethodGet, c.path, nil)
+		resp := httptest.NewRecorder()
+		app.exportHandler(resp, req)
+		if resp.Code != c.status {
+			t.Errorf("expected %s to return %d, got %d", c.path, c.status, resp.Code)
+		}
+		if !strings.Contains(resp.Body.String(), c.contains) {
+			t.Errorf("expected %s to contain %s, got %s", c.path, c.contains, resp.Body.String())
+		}
+	}
+	req := httptest.NewRequest(http.MethodPost, "/export?uf=sp", nil)
+	resp := httptest.NewRecorder()
+	app.exportHandler(resp, req)
+	if resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected full queue to return 503, got %d", resp.Code)
+	}
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/cuducos/go-cnpj"
+)
+
+const (
+	historyPath  = "/historico"
+	historyParam = "em"
+)
+
+// historyDatabase is implemented by the databases that keep the previous
+// versions of the companies (PostgreSQL with incremental updates).
+type historyDatabase interface {
+	GetCompanyAt(string, time.Time) (string, error)
+	GetCompanyHistory(string) (string, error)
+}
+
+// parsePointInTime parses the `em` URL parameter, either a date (YYYY-MM-DD)
+// or a month (YYYY-MM), meaning its last day.
+func parsePointInTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01", v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %s: %w", v, err)
+	}
+	return t.AddDate(0, 1, -1), nil
+}
+
+// history returns the database as a historyDatabase, writing an error response
+// if it does not keep the previous versions of the companies.
+func (app *api) history(w http.ResponseWriter, r *http.Request) (historyDatabase, bool) {
+	h, ok := app.db.(historyDatabase)
+	if !ok {
+		app.errorResponse(w, r, http.StatusNotImplemented, errorResponse{
+			Code:    codeHistoryUnavailable,
+			Message: message(langFor(r), "history_unavailable"),
+		})
+	}
+	return h, ok
+}
+
+func (app *api) companyHistory(pth string, w http.ResponseWriter, r *http.Request, i int64, m string) {
+	l := langFor(r)
+	if !cnpj.IsValid(pth) {
+		app.errorResponse(w, r, http.StatusBadRequest, errorResponse{
+			Code:    codeInvalidCNPJ,
+			Message: message(l, "invalid_cnpj", cnpj.Mask(pth[1:])),
+		})
+		registerMetric("companyHistory"+m, r.Method, http.StatusBadRequest, i)
+		return
+	}
+	h, ok := app.history(w, r)
+	if !ok {
+		registerMetric("companyHistory"+m, r.Method, http.StatusNotImplemented, i)
+		return
+	}
+	s, err := h.GetCompanyHistory(cnpj.Unmask(pth))
+	if err != nil {
+		app.errorResponse(w, r, http.StatusNotFound, errorResponse{
+			Code:    codeNotFound,
+			Message: message(l, "not_found", cnpj.Mask(pth)),
+		})
+		registerMetric("companyHistory"+m, r.Method, http.StatusNotFound, i)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.WriteString(w, s); err != nil {
+		slog.Error("error responding to successful company history request", "request", r, "error", err)
+	}
+	registerMetric("companyHistory"+m, r.Method, http.StatusOK, i)
+}
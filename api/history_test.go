@@ -0,0 +1,89 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockHistoryDatabase struct {
+	mockDatabase
+}
+
+func (m mockHistoryDatabase) GetCompanyAt(n string, at time.Time) (string, error) {
+	if at.Before(time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)) {
+		return "", errors.New("Company not found")
+	}
+	return m.GetCompany(n)
+}
+
+func (mockHistoryDatabase) GetCompanyHistory(n string) (string, error) {
+	if n != "19131243000197" {
+		return "", errors.New("Company not found")
+	}
+	return `[{"data":"2024-03-15","mudanca":"inclusao"}]`, nil
+}
+
+func TestParsePointInTime(t *testing.T) {
+	for _, tc := range []struct {
+		value    string
+		expected string
+	}{
+		{"2024-03-15", "2024-03-15"},
+		{"2024-03", "2024-03-31"},
+		{"2024-02", "2024-02-29"},
+		{"2024-12", "2024-12-31"},
+	} {
+		got, err := parsePointInTime(tc.value)
+		if err != nil {
+			t.Errorf("expected no error parsing %s, got %s", tc.value, err)
+		}
+		if got.Format(time.DateOnly) != tc.expected {
+			t.Errorf("expected %s to be %s, got %s", tc.value, tc.expected, got.Format(time.DateOnly))
+		}
+	}
+	for _, v := range []string{"03/2024", "2024", "2024-13"} {
+		if _, err := parsePointInTime(v); err == nil {
+			t.Errorf("expected error parsing %s, got nil", v)
+		}
+	}
+}
+
+func TestCompanyHistory(t *testing.T) {
+	for _, tc := range []struct {
+		db      database
+		path    string
+		status  int
+		content string
+	}{
+		{mockHistoryDatabase{}, "/19131243000197/historico", http.StatusOK, `[{"data":"2024-03-15","mudanca":"inclusao"}]`},
+		{mockHistoryDatabase{}, "/v2/19131243000197/historico", http.StatusOK, `[{"data":"2024-03-15","mudanca":"inclusao"}]`},
+		{mockHistoryDatabase{}, "/00000000000191/historico", http.StatusNotFound, `"code":"not_found"`},
+		{mockHistoryDatabase{}, "/foobar/historico", http.StatusBadRequest, `"code":"invalid_cnpj"`},
+		{mockHistoryDatabase{}, "/19131243000197?em=2024-03", http.StatusOK, `"razao_social": "OPEN KNOWLEDGE BRASIL"`},
+		{mockHistoryDatabase{}, "/19131243000197?em=2024-02", http.StatusNotFound, `"message":"CNPJ 19.131.243/0001-97 não encontrado em 2024-02."`},
+		{mockHistoryDatabase{}, "/19131243000197?em=ontem", http.StatusBadRequest, `"code":"invalid_date"`},
+		{mockDatabase{}, "/19131243000197/historico", http.StatusNotImplemented, `"code":"history_unavailable"`},
+		{mockDatabase{}, "/19131243000197?em=2024-03", http.StatusNotImplemented, `"code":"history_unavailable"`},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			resp := httptest.NewRecorder()
+			app := api{db: tc.db}
+			h := app.companyHandler
+			if strings.HasPrefix(tc.path, "/v2/") {
+				h = app.companyV2Handler
+			}
+			h(resp, req)
+			if resp.Code != tc.status {
+				t.Errorf("expected %s to return %d, got %d", tc.path, tc.status, resp.Code)
+			}
+			if b := resp.Body.String(); !strings.Contains(b, tc.content) {
+				t.Errorf("expected %s to contain %s, got %s", tc.path, tc.content, b)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cuducos/minha-receita/transform"
+)
+
+const jsonContentType = "application/json"
+
+// representation converts the JSON of a company, as stored in the database,
+// into what is served by an endpoint. A nil convert function serves the stored
+// JSON as it is.
+type representation struct {
+	contentType string
+	convert     func([]byte) ([]byte, error)
+}
+
+var (
+	jsonLD = representation{"application/ld+json", transform.JSONLD}
+	vCard  = representation{"text/vcard; charset=utf-8", transform.VCard}
+)
+
+// alternatives maps media types that can be requested via the `Accept` header
+// to the alternative representations of a single company.
+var alternatives = map[string]representation{
+	"application/ld+json": jsonLD,
+	"text/vcard":          vCard,
+}
+
+// negotiate picks the representation of a single company according to the
+// `Accept` header, falling back to rep (JSON) when no alternative
+// representation is preferred by the client.
+func negotiate(r *http.Request, rep representation) representation {
+	var best representation
+	var q float64
+	for v := range strings.SplitSeq(r.Header.Get("Accept"), ",") {
+		t, ps, err := mime.ParseMediaType(strings.TrimSpace(v))
+		if err != nil {
+			continue
+		}
+		w := 1.0
+		if s, ok := ps["q"]; ok {
+			if w, err = strconv.ParseFloat(s, 64); err != nil {
+				continue
+			}
+		}
+		if w <= q {
+			continue
+		}
+		if a, ok := alternatives[t]; ok {
+			best, q = a, w
+		} else if t == jsonContentType {
+			best, q = rep, w
+		}
+	}
+	if best.contentType == "" {
+		return rep
+	}
+	return best
+}
+
+// isEnglish checks if the client asked for the English representation of the
+// companies (field names and enumerations), which is opt-in via `lang=en`.
+func isEnglish(r *http.Request) bool {
+	return strings.EqualFold(r.URL.Query().Get("lang"), "en")
+}
+
+// v1 is the flat JSON as stored in the database, optionally in English.
+func v1(r *http.Request) representation {
+	if isEnglish(r) {
+		return representation{jsonContentType, transform.EnglishJSON}
+	}
+	return representation{jsonContentType, nil}
+}
+
+// v2Path strips the `/v2/` prefix from the URL path, as well as the `/v2/en/`
+// one, which is an alternative to `lang=en` in the nested JSON. It returns
+// true if the path asks for English.
+func v2Path(p string) (string, bool) {
+	p = strings.TrimPrefix(p, "/v2")
+	if p != "/en" && !strings.HasPrefix(p, "/en/") {
+		return p, false
+	}
+	return "/" + strings.TrimPrefix(strings.TrimPrefix(p, "/en"), "/"), true
+}
+
+// v2 is the nested JSON (see transform.CompanyV2), optionally in English.
+func v2(r *http.Request) representation {
+	if _, en := v2Path(r.URL.Path); en || isEnglish(r) {
+		return representation{jsonContentType, transform.EnglishV2JSON}
+	}
+	return representation{jsonContentType, transform.V2JSON}
+}
+
+func (rep representation) company(s string) (string, error) {
+	if rep.convert == nil {
+		return s, nil
+	}
+	b, err := rep.convert([]byte(s))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// page converts each company in a paginated search response, keeping the
+// cursor untouched.
+func (rep representation) page(s string) (string, error) {
+	if rep.convert == nil {
+		return s, nil
+	}
+	var p struct {
+		Data   []jsontext.Value `json:"data"`
+		Cursor *string          `json:"cursor"`
+	}
+	if err := json.Unmarshal([]byte(s), &p); err != nil {
+		return "", fmt.Errorf("error parsing search results: %w", err)
+	}
+	for i, c := range p.Data {
+		b, err := rep.convert(c)
+		if err != nil {
+			return "", err
+		}
+		p.Data[i] = b
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return "", fmt.Errorf("error serializing search results: %w", err)
+	}
+	return string(b), nil
+}
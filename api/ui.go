@@ -0,0 +1,214 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json/v2"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/cuducos/go-cnpj"
+	"github.com/cuducos/minha-receita/db"
+	"github.com/cuducos/minha-receita/transform"
+)
+
+const uiPrefix = "/ui/"
+
+//go:embed html
+var html embed.FS
+
+var uiFuncs = template.FuncMap{
+	"cnpj": cnpj.Mask,
+	"cnae": func(n int) string { // e.g. 9430-8/00
+		s := fmt.Sprintf("%07d", n)
+		return fmt.Sprintf("%s-%s/%s", s[:4], s[4:5], s[5:])
+	},
+	"date": func(v any) string { // e.g. 31/01/2024
+		r := reflect.ValueOf(v)
+		if !r.IsValid() || (r.Kind() == reflect.Pointer && r.IsNil()) {
+			return ""
+		}
+		s, ok := v.(fmt.Stringer)
+		if !ok {
+			return ""
+		}
+		t, err := time.Parse("2006-01-02", s.String())
+		if err != nil {
+			return s.String()
+		}
+		return t.Format("02/01/2006")
+	},
+}
+
+// uiTemplates holds one template per page, each one combining the page with
+// the common layout.
+type uiTemplates map[string]*template.Template
+
+func newUITemplates() (uiTemplates, error) {
+	ls, err := html.ReadDir("html")
+	if err != nil {
+		return nil, fmt.Errorf("error looking for html templates: %w", err)
+	}
+	ts := make(uiTemplates)
+	for _, f := range ls {
+		if f.Name() == "layout.html" {
+			continue
+		}
+		t, err := template.New("layout.html").Funcs(uiFuncs).ParseFS(html, "html/layout.html", "html/"+f.Name())
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s template: %w", f.Name(), err)
+		}
+		ts[strings.TrimSuffix(f.Name(), ".html")] = t
+	}
+	return ts, nil
+}
+
+func (app *api) renderHTML(w http.ResponseWriter, s int, page string, data any) {
+	t, ok := app.templates[page]
+	if !ok {
+		slog.Error("html template not found", "page", page)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		slog.Error("could not render html template", "page", page, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-type", "text/html; charset=utf-8")
+	w.WriteHeader(s)
+	if _, err := w.Write(b.Bytes()); err != nil {
+		slog.Error("could not write html response", "page", page, "error", err)
+	}
+}
+
+func (app *api) uiError(w http.ResponseWriter, s int, m string) {
+	app.renderHTML(w, s, "error", struct{ Message string }{m})
+}
+
+type uiSearch struct {
+	Params    url.Values
+	Companies []transform.Company
+	Next      template.URL
+	Searched  bool
+	Error     string
+}
+
+func (app *api) uiSearchHandler(w http.ResponseWriter, r *http.Request, i int64) {
+	d := uiSearch{Params: r.URL.Query()}
+	q := db.NewQuery(d.Params)
+	if q == nil {
+		app.renderHTML(w, http.StatusOK, "search", d)
+		registerMetric("uiSearch", r.Method, http.StatusOK, i)
+		return
+	}
+	d.Searched = true
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	err := q.Validate()
+	var s string
+	if err == nil {
+		s, err = app.db.Search(ctx, q)
+	}
+	if c, e, ok := queryError(langFor(r), err); ok {
+		d.Error = e.Message
+		app.renderHTML(w, c, "search", d)
+		registerMetric("uiSearch", r.Method, c, i)
+		return
+	}
+	if err != nil {
+		slog.Error("ui search error", "error", err, "query", q)
+		d.Error = message(langFor(r), "search_error")
+		app.renderHTML(w, http.StatusInternalServerError, "search", d)
+		registerMetric("uiSearch", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	var p struct {
+		Data   []transform.Company `json:"data"`
+		Cursor *string             `json:"cursor"`
+	}
+	if err := json.Unmarshal([]byte(s), &p); err != nil {
+		slog.Error("could not parse search results", "error", err, "query", q)
+		app.uiError(w, http.StatusInternalServerError, message(langFor(r), "search_error"))
+		registerMetric("uiSearch", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	d.Companies = p.Data
+	if p.Cursor != nil {
+		n := url.Values{}
+		for k, v := range d.Params {
+			n[k] = v
+		}
+		n.Set("cursor", *p.Cursor)
+		d.Next = template.URL(uiPrefix + "busca?" + n.Encode()) // safe: values are encoded by url.Values
+	}
+	app.renderHTML(w, http.StatusOK, "search", d)
+	registerMetric("uiSearch", r.Method, http.StatusOK, i)
+}
+
+func (app *api) uiCompanyHandler(w http.ResponseWriter, r *http.Request, n string, i int64) {
+	l := langFor(r)
+	if !cnpj.IsValid(n) {
+		app.uiError(w, http.StatusBadRequest, message(l, "invalid_cnpj", n))
+		registerMetric("uiCompany", r.Method, http.StatusBadRequest, i)
+		return
+	}
+	s, err := getCompany(app.db, n)
+	if err != nil {
+		app.uiError(w, http.StatusNotFound, message(l, "not_found", cnpj.Mask(n)))
+		registerMetric("uiCompany", r.Method, http.StatusNotFound, i)
+		return
+	}
+	var c transform.Company
+	if err := json.Unmarshal([]byte(s), &c); err != nil {
+		slog.Error("could not parse company", "cnpj", n, "error", err)
+		app.uiError(w, http.StatusInternalServerError, message(l, "conversion_error"))
+		registerMetric("uiCompany", r.Method, http.StatusInternalServerError, i)
+		return
+	}
+	app.renderHTML(w, http.StatusOK, "company", c)
+	registerMetric("uiCompany", r.Method, http.StatusOK, i)
+}
+
+// uiHandler serves the HTML pages: the CNPJ lookup form (/ui/), the search
+// page (/ui/busca) and the company page (/ui/<CNPJ>).
+func (app *api) uiHandler(w http.ResponseWriter, r *http.Request) {
+	i := time.Now().UnixMilli()
+	if r.Method != http.MethodGet {
+		app.errorResponse(w, r, http.StatusMethodNotAllowed, methodNotAllowed(langFor(r), false))
+		registerMetric("ui", r.Method, http.StatusMethodNotAllowed, i)
+		return
+	}
+	pth := strings.TrimPrefix(r.URL.Path, uiPrefix)
+	switch pth {
+	case "":
+		n := r.URL.Query().Get("cnpj")
+		if n == "" {
+			app.renderHTML(w, http.StatusOK, "index", struct{ CNPJ, Error string }{})
+			registerMetric("ui", r.Method, http.StatusOK, i)
+			return
+		}
+		if !cnpj.IsValid(n) {
+			app.renderHTML(w, http.StatusBadRequest, "index", struct{ CNPJ, Error string }{
+				n,
+				message(langFor(r), "invalid_cnpj", n),
+			})
+			registerMetric("ui", r.Method, http.StatusBadRequest, i)
+			return
+		}
+		http.Redirect(w, r, uiPrefix+cnpj.Unmask(n), http.StatusFound)
+		registerMetric("ui", r.Method, http.StatusFound, i)
+	case "busca":
+		app.uiSearchHandler(w, r, i)
+	default:
+		app.uiCompanyHandler(w, r, pth, i)
+	}
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+type searchableDatabase struct{ mockDatabase }
+
+func (searchableDatabase) Search(_ context.Context, q *db.Query) (string, error) {
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`{"data":[%s],"cursor":"42"}`, b), nil
+}
+
+func TestUIHandler(t *testing.T) {
+	ts, err := newUITemplates()
+	if err != nil {
+		t.Fatalf("expected no error loading templates, got %s", err)
+	}
+	app := api{db: &searchableDatabase{}, templates: ts}
+	for _, c := range []struct {
+		path     string
+		status   int
+		contains []string
+	}{
+		{"/ui/", http.StatusOK, []string{`<form action="/ui/"`, `name="cnpj"`}},
+		{"/ui/?cnpj=foobar", http.StatusBadRequest, []string{"CNPJ foobar inválido."}},
+		{"/ui/?cnpj=19.131.243/0001-97", http.StatusFound, nil},
+		{"/ui/foobar", http.StatusBadRequest, []string{"CNPJ foobar inválido."}},
+		{"/ui/00000000000191", http.StatusNotFound, []string{"CNPJ 00.000.000/0001-91 não encontrado."}},
+		{
+			"/ui/19131243000197",
+			http.StatusOK,
+			[]string{
+				"19.131.243/0001-97 MATRIZ",
+				"OPEN KNOWLEDGE BRASIL",
+				"03/10/2013",
+				"9430-8/00 - Atividades de associações de defesa de direitos sociais",
+				"6204-0/00 - Consultoria em tecnologia da informação",
+				"HAYDEE SVAB",
+				"27/02/2024",
+			},
+		},
+		{"/ui/busca", http.StatusOK, []string{`<form action="/ui/busca"`}},
+		{
+			"/ui/busca?uf=sp",
+			http.StatusOK,
+			[]string{
+				`<a href="/ui/19131243000197">19.131.243/0001-97</a>`,
+				`<a href="/ui/busca?cursor=42&amp;uf=sp">`,
+				`name="uf" value="sp"`,
+			},
+		},
+	} {
+		t.Run(c.path, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, c.path, nil)
+			if err != nil {
+				t.Fatal("Expected an HTTP request, but got an error.")
+			}
+			resp := httptest.NewRecorder()
+			http.HandlerFunc(app.uiHandler).ServeHTTP(resp, req)
+			if resp.Code != c.status {
+				t.Errorf("Expected %s to return %d, got %d", c.path, c.status, resp.Code)
+			}
+			body := resp.Body.String()
+			for _, s := range c.contains {
+				if !strings.Contains(body, s) {
+					t.Errorf("Expected %s to contain %s, got %s", c.path, s, body)
+				}
+			}
+		})
+	}
+}
+
+func TestRedirectToUI(t *testing.T) {
+	ts, err := newUITemplates()
+	if err != nil {
+		t.Fatalf("expected no error loading templates, got %s", err)
+	}
+	for _, c := range []struct {
+		templates uiTemplates
+		expected  string
+	}{
+		{nil, "https://docs.minhareceita.org"},
+		{ts, "/ui/"},
+	} {
+		req, err := http.NewRequest(http.MethodGet, "/", nil)
+		if err != nil {
+			t.Fatal("Expected an HTTP request, but got an error.")
+		}
+		app := api{db: &mockDatabase{}, templates: c.templates}
+		resp := httptest.NewRecorder()
+		http.HandlerFunc(app.companyHandler).ServeHTTP(resp, req)
+		if got := resp.Header().Get("Location"); got != c.expected {
+			t.Errorf("Expected redirect to %s, got %s", c.expected, got)
+		}
+	}
+}
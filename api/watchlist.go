@@ -0,0 +1,110 @@
+package api
+
+import (
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cuducos/minha-receita/watch"
+)
+
+const (
+	watchlistPrefix  = "/watchlists"
+	maxWatchlistBody = 1 << 20
+)
+
+func (app *api) watchlistError(w http.ResponseWriter, r *http.Request, err error, i int64) {
+	l := langFor(r)
+	switch {
+	case errors.Is(err, watch.ErrNotFound):
+		app.errorResponse(w, r, http.StatusNotFound, errorResponse{
+			Code:    codeWatchlistNotFound,
+			Message: message(l, "watchlist_not_found", strings.Trim(strings.TrimPrefix(r.URL.Path, watchlistPrefix), "/")),
+		})
+		registerMetric("watchlist", r.Method, http.StatusNotFound, i)
+	case errors.Is(err, watch.ErrInvalid):
+		app.errorResponse(w, r, http.StatusBadRequest, errorResponse{
+			Code:    codeInvalidWatchlist,
+			Message: message(l, "invalid_watchlist"),
+			Details: map[string]any{"error": err.Error()},
+		})
+		registerMetric("watchlist", r.Method, http.StatusBadRequest, i)
+	default:
+		slog.Error("watchlist error", "path", r.URL.Path, "error", err)
+		app.errorResponse(w, r, http.StatusInternalServerError, errorResponse{
+			Code:    codeWatchlistError,
+			Message: message(l, "watchlist_error"),
+		})
+		registerMetric("watchlist", r.Method, http.StatusInternalServerError, i)
+	}
+}
+
+// createWatchlist takes a JSON body with name, cnpjs and, optionally, webhook
+// and secret. The response is the only one including the secret.
+func (app *api) createWatchlist(w http.ResponseWriter, r *http.Request, i int64) {
+	var n watch.Watchlist
+	if err := json.UnmarshalRead(http.MaxBytesReader(w, r.Body, maxWatchlistBody), &n); err != nil {
+		app.watchlistError(w, r, fmt.Errorf("%w: %w", watch.ErrInvalid, err), i)
+		return
+	}
+	n, err := app.watchlists.Create(n) // id and creation date are always set by the store
+	if err != nil {
+		app.watchlistError(w, r, err, i)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s/%s", watchlistPrefix, n.ID))
+	writeJSON(w, http.StatusCreated, n)
+	registerMetric("watchlist", r.Method, http.StatusCreated, i)
+}
+
+// watchlistHandler serves the watchlists: GET /watchlists lists them, POST
+// /watchlists creates one, GET /watchlists/<id> shows one and DELETE
+// /watchlists/<id> removes it.
+func (app *api) watchlistHandler(w http.ResponseWriter, r *http.Request) {
+	i := time.Now().UnixMilli()
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, watchlistPrefix), "/")
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		ws, err := app.watchlists.List()
+		if err != nil {
+			app.watchlistError(w, r, err, i)
+			return
+		}
+		for n, l := range ws {
+			ws[n] = l.WithoutSecret()
+		}
+		writeJSON(w, http.StatusOK, ws)
+		registerMetric("watchlist", r.Method, http.StatusOK, i)
+	case id == "" && r.Method == http.MethodPost:
+		app.createWatchlist(w, r, i)
+	case id != "" && r.Method == http.MethodGet:
+		l, err := app.watchlists.Get(id)
+		if err != nil {
+			app.watchlistError(w, r, err, i)
+			return
+		}
+		writeJSON(w, http.StatusOK, l.WithoutSecret())
+		registerMetric("watchlist", r.Method, http.StatusOK, i)
+	case id != "" && r.Method == http.MethodDelete:
+		if err := app.watchlists.Delete(id); err != nil {
+			app.watchlistError(w, r, err, i)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		registerMetric("watchlist", r.Method, http.StatusNoContent, i)
+	default:
+		k := "method_not_allowed_get_post"
+		if id != "" {
+			k = "method_not_allowed_get_delete"
+		}
+		app.errorResponse(w, r, http.StatusMethodNotAllowed, errorResponse{
+			Code:    codeMethodNotAllowed,
+			Message: message(langFor(r), k),
+		})
+		registerMetric("watchlist", r.Method, http.StatusMethodNotAllowed, i)
+	}
+}
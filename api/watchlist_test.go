@@ -0,0 +1,73 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cuducos/minha-receita/watch"
+)
+
+func TestWatchlistHandler(t *testing.T) {
+	d := &exportDatabase{meta: make(map[string]string)}
+	app := &api{db: d, watchlists: watch.NewStore(d)}
+	for _, c := range []struct {
+		method   string
+		path     string
+		body     string
+		status   int
+		contains string
+	}{
+		{http.MethodGet, "/watchlists", "", http.StatusOK, "[]"},
+		{http.MethodPut, "/watchlists", "", http.StatusMethodNotAllowed, "GET e POST"},
+		{http.MethodPost, "/watchlists", "not json", http.StatusBadRequest, `"code":"invalid_watchlist"`},
+		{http.MethodPost, "/watchlists", `{"name":"suppliers","cnpjs":["42"]}`, http.StatusBadRequest, "invalid cnpj 42"},
+		{http.MethodGet, "/watchlists/42", "", http.StatusNotFound, `"code":"watchlist_not_found"`},
+		{http.MethodDelete, "/watchlists/42", "", http.StatusNotFound, "Lista de monitoramento 42 não encontrada."},
+	} {
+		req := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+		resp := httptest.NewRecorder()
+		app.watchlistHandler(resp, req)
+		if resp.Code != c.status {
+			t.Errorf("expected %s %s to return %d, got %d", c.method, c.path, c.status, resp.Code)
+		}
+		if !strings.Contains(resp.Body.String(), c.contains) {
+			t.Errorf("expected %s %s to contain %s, got %s", c.method, c.path, c.contains, resp.Body.String())
+		}
+	}
+
+	body := `{"name":"suppliers","cnpjs":["19.131.243/0001-97"],"webhook":"https://example.com/hook","secret":"s3cr3t"}`
+	req := httptest.NewRequest(http.MethodPost, "/watchlists", strings.NewReader(body))
+	resp := httptest.NewRecorder()
+	app.watchlistHandler(resp, req)
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("expected watchlist to be created, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if !strings.Contains(resp.Body.String(), `"secret":"s3cr3t"`) || !strings.Contains(resp.Body.String(), `"cnpjs":["19131243000197"]`) {
+		t.Errorf("expected created watchlist with its secret, got %s", resp.Body.String())
+	}
+	loc := resp.Header().Get("Location")
+	if !strings.HasPrefix(loc, "/watchlists/") {
+		t.Fatalf("expected location to be a watchlist, got %s", loc)
+	}
+
+	for _, pth := range []string{"/watchlists", loc} {
+		req = httptest.NewRequest(http.MethodGet, pth, nil)
+		resp = httptest.NewRecorder()
+		app.watchlistHandler(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Errorf("expected %s to return 200, got %d", pth, resp.Code)
+		}
+		if !strings.Contains(resp.Body.String(), `"name":"suppliers"`) || strings.Contains(resp.Body.String(), "s3cr3t") {
+			t.Errorf("expected %s to show the watchlist without its secret, got %s", pth, resp.Body.String())
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, loc, nil)
+	resp = httptest.NewRecorder()
+	app.watchlistHandler(resp, req)
+	if resp.Code != http.StatusNoContent {
+		t.Errorf("expected watchlist to be deleted, got %d", resp.Code)
+	}
+}
@@ -1,16 +1,23 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/cuducos/minha-receita/api"
+	"github.com/cuducos/minha-receita/export"
+	"github.com/cuducos/minha-receita/watch"
 	"github.com/spf13/cobra"
 )
 
 const (
-	defaultPort = "8000"
-	apiHelper   = `
+	defaultPort            = "8000"
+	defaultExportWorkers   = 2
+	defaultExportQueueSize = 16
+	defaultExportRetention = 24 * time.Hour
+	apiHelper              = `
 Starts the web API.
 
 Using GODEBUG environment variable changes the HTTP server verbosity (for
@@ -23,10 +30,31 @@ reports to New Relic. Otherwise, the New Relic wrappers are just ignored.
 
 The HTTP server is prepared to do a host header validation against the value of
 ALLOWED_HOST environment variable. If this variable is not set, this validation
-is skipped.`
+is skipped.
+
+With --ui the HTTP server also serves HTML pages under /ui/ to look up a CNPJ,
+search companies and print a company card.
+
+With --export-dir the HTTP server accepts export jobs under /export: they run
+the same searches as the API in the background, saving all the results as CSV,
+NDJSON or Parquet in this directory, where they are kept for the retention
+period. Job state is saved in the database metadata, so unfinished jobs start
+again after a restart.
+
+With --watchlists the HTTP server lets clients create, list and remove
+watchlists under /watchlists (see the watchlist command). There is no
+authentication, so only use it in private servers.`
 )
 
-var port string
+var (
+	port            string
+	ui              bool
+	exportDir       string
+	exportWorkers   int
+	exportQueueSize int
+	exportRetention time.Duration
+	watchlists      bool
+)
 
 var apiCmd = &cobra.Command{
 	Use:   "api",
@@ -45,7 +73,29 @@ var apiCmd = &cobra.Command{
 			return fmt.Errorf("could not find database: %w", err)
 		}
 		defer db.Close()
-		return api.Serve(db, port)
+		if err := assertSchema(db); err != nil {
+			return err
+		}
+		var e *export.Manager
+		if exportDir != "" {
+			e, err = export.New(db, export.Config{
+				Dir:       exportDir,
+				Workers:   exportWorkers,
+				QueueSize: exportQueueSize,
+				Retention: exportRetention,
+			})
+			if err != nil {
+				return fmt.Errorf("could not start export jobs: %w", err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			e.Start(ctx)
+		}
+		var wl *watch.Store
+		if watchlists {
+			wl = watch.NewStore(db)
+		}
+		return api.Serve(db, port, ui, e, wl)
 	},
 }
 
@@ -58,5 +108,12 @@ func apiCLI() *cobra.Command {
 		"",
 		fmt.Sprintf("web server port (default PORT environment variable or %s)", defaultPort),
 	)
+	apiCmd.Flags().BoolVarP(&ui, "ui", "", ui, "serve HTML pages to look up and search companies under /ui/")
+	apiCmd.Flags().BoolVarP(&structured, "structured", "", structured, "read companies from the structured tables instead of the JSON table, PostgreSQL only")
+	apiCmd.Flags().StringVarP(&exportDir, "export-dir", "", "", "directory to save export jobs results (export jobs are disabled if empty)")
+	apiCmd.Flags().IntVarP(&exportWorkers, "export-workers", "", defaultExportWorkers, "number of export jobs running at the same time")
+	apiCmd.Flags().IntVarP(&exportQueueSize, "export-queue-size", "", defaultExportQueueSize, "maximum number of export jobs waiting to run")
+	apiCmd.Flags().DurationVarP(&exportRetention, "export-retention", "", defaultExportRetention, "how long finished export jobs and their files are kept")
+	apiCmd.Flags().BoolVarP(&watchlists, "watchlists", "", watchlists, "serve the watchlists under /watchlists (no authentication, private servers only)")
 	return apiCmd
 }
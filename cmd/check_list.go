@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json/v2"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cuducos/minha-receita/compliance"
+	"github.com/spf13/cobra"
+)
+
+const checkListHelper = `
+Checks a list of CNPJs (e.g. suppliers) against the database and writes a
+report with, for each line of the list: whether the CNPJ is valid and was
+found, its situação cadastral (flagging BAIXADA, INAPTA and SUSPENSA), and
+its Simples and MEI status.
+
+The list can be a TXT file with one CNPJ per line, or a CSV file with the CNPJ
+in the first column. Use - to read the list from the standard input.`
+
+var (
+	checkListSince  string
+	checkListOutput string
+	checkListFormat string
+)
+
+func checkList(pth string) error {
+	var r io.Reader = os.Stdin
+	if pth != "-" {
+		f, err := os.Open(pth)
+		if err != nil {
+			return fmt.Errorf("could not open %s: %w", pth, err)
+		}
+		defer f.Close()
+		r = f
+	}
+	ns, err := compliance.ParseList(r)
+	if err != nil {
+		return err
+	}
+	since, err := compliance.ParseSince(checkListSince)
+	if err != nil {
+		return err
+	}
+	db, err := loadDatabase()
+	if err != nil {
+		return fmt.Errorf("could not find database: %w", err)
+	}
+	defer db.Close()
+	rs, err := compliance.Check(context.Background(), db, ns, since)
+	if err != nil {
+		return err
+	}
+	var w io.Writer = os.Stdout
+	if checkListOutput != "" {
+		f, err := os.Create(checkListOutput)
+		if err != nil {
+			return fmt.Errorf("could not create %s: %w", checkListOutput, err)
+		}
+		defer f.Close()
+		w = f
+	}
+	switch checkListFormat {
+	case "csv":
+		return compliance.WriteCSV(w, rs)
+	case "json":
+		if err := json.MarshalWrite(w, rs); err != nil {
+			return fmt.Errorf("could not write json report: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid format %s, use csv or json", checkListFormat)
+}
+
+var checkListCmd = &cobra.Command{
+	Use:   "check-list <file>",
+	Short: "Checks the situação cadastral and Simples/MEI status of a list of CNPJs",
+	Long:  checkListHelper,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		return checkList(args[0])
+	},
+}
+
+func checkListCLI() *cobra.Command {
+	checkListCmd = addDatabase(checkListCmd)
+	checkListCmd.Flags().StringVarP(&checkListSince, "since", "", "", "flags companies whose situação cadastral changed since this date, format YYYY-MM-DD")
+	checkListCmd.Flags().StringVarP(&checkListOutput, "output", "o", "", "file to write the report to (default standard output)")
+	checkListCmd.Flags().StringVarP(&checkListFormat, "format", "f", "csv", "report format: csv or json")
+	return checkListCmd
+}
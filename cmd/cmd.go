@@ -21,16 +21,18 @@ See --help for more details.
 
 var dir string
 
-func assertDirExists() error {
-	i, err := os.Stat(dir)
+func assertDirExists() error { return assertIsDir(dir) }
+
+func assertIsDir(pth string) error {
+	i, err := os.Stat(pth)
 	if os.IsNotExist(err) {
-		return fmt.Errorf("directory %s does not exist", dir)
+		return fmt.Errorf("directory %s does not exist", pth)
 	}
 	if err != nil {
 		return err
 	}
 	if !i.Mode().IsDir() {
-		return fmt.Errorf("%s is not a directory", dir)
+		return fmt.Errorf("%s is not a directory", pth)
 	}
 	return nil
 }
@@ -67,6 +69,26 @@ var dropCmd = &cobra.Command{
 	},
 }
 
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Swaps the live data with the previous release loaded with transform --shadow",
+	RunE: func(_ *cobra.Command, _ []string) error {
+		db, err := loadDatabase()
+		if err != nil {
+			return fmt.Errorf("could not find database: %w", err)
+		}
+		defer db.Close()
+		s, err := loadShadowDatabase(db)
+		if err != nil {
+			return err
+		}
+		if err := s.Rollback(); err != nil {
+			return err
+		}
+		return checkWatchlists(db)
+	},
+}
+
 func addDataDir(c *cobra.Command) *cobra.Command {
 	c.Flags().StringVarP(&dir, "directory", "d", defaultDataDir, "directory of the downloaded files")
 	return c
@@ -94,18 +116,25 @@ var createExtraIndexesCmd = &cobra.Command{
 
 // CLI returns the root command from Cobra CLI tool.
 func CLI() *cobra.Command {
-	for _, c := range []*cobra.Command{createCmd, dropCmd, createExtraIndexesCmd} {
+	for _, c := range []*cobra.Command{createCmd, dropCmd, createExtraIndexesCmd, rollbackCmd} {
 		addDatabase(c)
 	}
+	addWatch(rollbackCmd)
+	createCmd.Flags().BoolVarP(&structured, "structured", "", structured, "also create the structured tables (business, socios_cnpj, lookups, etc.), PostgreSQL only")
 	rootCmd.AddCommand(
 		apiCLI(),
 		downloadCLI(),
 		urlsCLI(),
 		checkCLI(),
+		checkListCLI(),
 		createCmd,
 		dropCmd,
 		createExtraIndexesCmd,
+		rollbackCmd,
+		migrateCLI(),
 		transformCLI(),
+		diffCLI(),
+		watchlistCLI(),
 		sampleCLI(),
 	)
 	if os.Getenv("DEBUG") != "" {
@@ -28,8 +28,26 @@ type database interface {
 	CreateExtraIndexes(idxs []string) error
 	// api
 	GetCompany(string) (string, error)
+	GetCompanies(context.Context, []string) (map[string]string, error)
 	Search(context.Context, *db.Query) (string, error)
 	MetaRead(string) (string, error)
+	MetaDelete(string) error
+}
+
+// shadowDatabase is implemented by the databases that can load a release into
+// a shadow table and swap it with the live one.
+type shadowDatabase interface {
+	UseShadow(string) error
+	Swap() error
+	Rollback() error
+}
+
+func loadShadowDatabase(db database) (shadowDatabase, error) {
+	s, ok := db.(shadowDatabase)
+	if !ok {
+		return nil, fmt.Errorf("shadow releases are only supported by PostgreSQL and MongoDB")
+	}
+	return s, nil
 }
 
 func loadDatabase() (database, error) {
@@ -44,11 +62,31 @@ func loadDatabase() (database, error) {
 	}
 	if strings.HasPrefix(u, "postgres://") || strings.HasPrefix(u, "postgresql://") {
 		db, err := db.NewPostgreSQL(u, postgresSchema)
+		db.Structured = structured
 		return &db, err
 	}
 	if strings.HasPrefix(u, "mongodb://") {
 		db, err := db.NewMongoDB(u)
 		return &db, err
 	}
-	return nil, fmt.Errorf("database uri does not seem to be a valid Postgres or MongoDB URI")
+	if strings.HasPrefix(u, "mysql://") {
+		db, err := db.NewMySQL(u)
+		return &db, err
+	}
+	if strings.HasPrefix(u, "opensearch://") || strings.HasPrefix(u, "elasticsearch://") {
+		db, err := db.NewOpenSearch(u)
+		return &db, err
+	}
+	if strings.HasPrefix(u, "sqlite://") {
+		db, err := db.NewSQLite(u)
+		return &db, err
+	}
+	if strings.HasPrefix(u, "badger://") {
+		db, err := db.NewBadger(u)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	}
+	return nil, fmt.Errorf("database uri does not seem to be a valid Postgres, MongoDB, MySQL, OpenSearch, SQLite or Badger URI")
 }
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cuducos/minha-receita/transform"
+	"github.com/spf13/cobra"
+)
+
+const diffHelper = `
+Compares two directories with files downloaded from the Federal Revenue, an
+older and a newer release, and writes what changed between them as NDJSON:
+one line per added, removed or changed CNPJ, with the fields that changed
+(and, for lists such as qsa, the items added and removed).
+
+Each release goes through the same pipeline used by transform, so the
+comparison scales to the full dataset using the disk instead of memory.`
+
+var (
+	diffOutput    string
+	diffNoPrivacy bool
+)
+
+func diff(older, newer string) error {
+	for _, d := range []string{older, newer} {
+		if err := assertIsDir(d); err != nil {
+			return err
+		}
+	}
+	var w io.Writer = os.Stdout
+	if diffOutput != "" {
+		f, err := os.Create(diffOutput)
+		if err != nil {
+			return fmt.Errorf("could not create %s: %w", diffOutput, err)
+		}
+		defer f.Close()
+		w = f
+	}
+	b := bufio.NewWriter(w)
+	if err := transform.Diff(older, newer, b, maxParallelDBQueries, maxParallelKVWrites, batchSize, !diffNoPrivacy); err != nil {
+		return err
+	}
+	if err := b.Flush(); err != nil {
+		return fmt.Errorf("could not write the change log: %w", err)
+	}
+	return nil
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <older-directory> <newer-directory>",
+	Short: "Writes the changes between two releases as NDJSON",
+	Long:  diffHelper,
+	Args:  cobra.ExactArgs(2),
+	RunE: func(_ *cobra.Command, args []string) error {
+		return diff(args[0], args[1])
+	},
+}
+
+func diffCLI() *cobra.Command {
+	diffCmd.Flags().StringVarP(&diffOutput, "output", "o", "", "file to write the change log to (default standard output)")
+	diffCmd.Flags().IntVarP(&maxParallelDBQueries, "max-parallel-db-queries", "m", transform.MaxParallelDBQueries, "maximum parallel batches being compared")
+	diffCmd.Flags().IntVarP(&maxParallelKVWrites, "max-parallel-kv-writes", "k", transform.MaxParallelKVWrites, "maximum parallel writes to the key-value storage")
+	diffCmd.Flags().IntVarP(&batchSize, "batch-size", "b", transform.BatchSize, "size of the batch to compare")
+	diffCmd.Flags().BoolVarP(&diffNoPrivacy, "no-privacy", "p", diffNoPrivacy, "include email addresses, CPF and other PII in the change log")
+	return diffCmd
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/cuducos/minha-receita/db"
+	"github.com/spf13/cobra"
+)
+
+const migrateHelper = `
+Manages the schema version of the database, PostgreSQL and MongoDB only.
+
+Databases created with the create command (or transform --clean-up) start in
+the latest schema version. Databases created by previous versions of Minha
+Receita need the pending migrations to be applied with migrate up: the api
+command refuses to start, and transform refuses to load data without
+--clean-up, while the schema is not in the latest version.`
+
+// migrationDatabase is implemented by the databases with versioned schema
+// migrations.
+type migrationDatabase interface {
+	SchemaStatus() (db.SchemaStatus, error)
+	MigrateUp() error
+}
+
+func loadMigrationDatabase(d database) (migrationDatabase, error) {
+	m, ok := d.(migrationDatabase)
+	if !ok {
+		return nil, fmt.Errorf("schema migrations are only supported by PostgreSQL and MongoDB")
+	}
+	return m, nil
+}
+
+// assertSchema makes sure the database schema is in the latest version, for
+// the databases with migrations.
+func assertSchema(d database) error {
+	m, ok := d.(migrationDatabase)
+	if !ok {
+		return nil
+	}
+	s, err := m.SchemaStatus()
+	if err != nil {
+		return err
+	}
+	return s.Check()
+}
+
+func printSchemaStatus(s db.SchemaStatus) {
+	fmt.Printf("Schema version %d (latest is %d)\n", s.Current, s.Latest)
+	for _, m := range s.Pending {
+		fmt.Printf("Pending: %s\n", m)
+	}
+}
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Manages the schema version of the database",
+	Long:  migrateHelper,
+}
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Applies the pending schema migrations",
+	RunE: func(_ *cobra.Command, _ []string) error {
+		d, err := loadDatabase()
+		if err != nil {
+			return fmt.Errorf("could not find database: %w", err)
+		}
+		defer d.Close()
+		m, err := loadMigrationDatabase(d)
+		if err != nil {
+			return err
+		}
+		if err := m.MigrateUp(); err != nil {
+			return err
+		}
+		s, err := m.SchemaStatus()
+		if err != nil {
+			return err
+		}
+		printSchemaStatus(s)
+		return nil
+	},
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Shows the schema version and the pending migrations",
+	RunE: func(_ *cobra.Command, _ []string) error {
+		d, err := loadDatabase()
+		if err != nil {
+			return fmt.Errorf("could not find database: %w", err)
+		}
+		defer d.Close()
+		m, err := loadMigrationDatabase(d)
+		if err != nil {
+			return err
+		}
+		s, err := m.SchemaStatus()
+		if err != nil {
+			return err
+		}
+		printSchemaStatus(s)
+		return nil
+	},
+}
+
+func migrateCLI() *cobra.Command {
+	for _, c := range []*cobra.Command{migrateUpCmd, migrateStatusCmd} {
+		addDatabase(c)
+	}
+	migrateCmd.AddCommand(migrateUpCmd, migrateStatusCmd)
+	return migrateCmd
+}
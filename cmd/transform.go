@@ -2,7 +2,11 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 
+	"github.com/cuducos/minha-receita/db"
+	"github.com/cuducos/minha-receita/download"
 	"github.com/cuducos/minha-receita/transform"
 	"github.com/spf13/cobra"
 )
@@ -24,8 +28,20 @@ var (
 	cleanUp              bool
 	noPrivacy            bool
 	structured           bool
+	shadow               bool
+	incremental          bool
+	sortIndexes          bool
 )
 
+func release() (string, error) {
+	p := filepath.Join(dir, download.FederalRevenueUpdatedAt)
+	v, err := os.ReadFile(p)
+	if err != nil {
+		return "", fmt.Errorf("error reading %s: %w", p, err)
+	}
+	return db.ReleaseFromUpdatedAt(string(v))
+}
+
 var transformCmd = &cobra.Command{
 	Use:   "transform",
 	Short: "Transforms the CSV files into database records",
@@ -34,11 +50,42 @@ var transformCmd = &cobra.Command{
 		if err := assertDirExists(); err != nil {
 			return err
 		}
+		if shadow && cleanUp {
+			return fmt.Errorf("--shadow and --clean-up cannot be used together")
+		}
+		if incremental && (shadow || cleanUp || structured) {
+			return fmt.Errorf("--incremental cannot be used with --shadow, --clean-up or --structured")
+		}
 		db, err := loadDatabase()
 		if err != nil {
 			return fmt.Errorf("could not find database: %w", err)
 		}
 		defer db.Close()
+		if !cleanUp {
+			if err := assertSchema(db); err != nil {
+				return err
+			}
+		}
+		if shadow {
+			s, err := loadShadowDatabase(db)
+			if err != nil {
+				return err
+			}
+			r, err := release()
+			if err != nil {
+				return err
+			}
+			if err := s.UseShadow(r); err != nil {
+				return err
+			}
+			if err := transform.Transform(dir, db, maxParallelDBQueries, maxParallelKVWrites, batchSize, !noPrivacy, structured, incremental, sortIndexes); err != nil {
+				return err
+			}
+			if err := s.Swap(); err != nil {
+				return err
+			}
+			return checkWatchlists(db)
+		}
 		if cleanUp {
 			err = db.Drop()
 			if err != nil {
@@ -49,7 +96,9 @@ var transformCmd = &cobra.Command{
 				return err
 			}
 		}
-		return transform.Transform(dir, db, maxParallelDBQueries, maxParallelKVWrites, batchSize, !noPrivacy, structured)
+		return transform.Transform(dir, db, maxParallelDBQueries, maxParallelKVWrites, batchSize, !noPrivacy, structured, incremental, sortIndexes, func() error {
+			return checkWatchlists(db)
+		})
 	},
 }
 
@@ -71,8 +120,11 @@ func transformCLI() *cobra.Command {
 		"the default is optimized for high throughput SATA SSD. Recommended values are between 64 and 128 for HDD, 256 and 1,024 for SSD, and 4,096 and 16,384 for NVMe SSD.",
 	)
 	transformCmd.Flags().IntVarP(&batchSize, "batch-size", "b", transform.BatchSize, "size of the batch to save to the database")
-	transformCmd.Flags().BoolVarP(&cleanUp, "clean-up", "c", cleanUp, "drop & recreate the database table before starting")
+	transformCmd.Flags().BoolVarP(&cleanUp, "clean-up", "c", cleanUp, "drop & recreate the database table before starting, including the history of previous versions")
 	transformCmd.Flags().BoolVarP(&noPrivacy, "no-privacy", "p", noPrivacy, "include email addresses, CPF and other PII in the JSON data")
-	transformCmd.Flags().BoolVarP(&structured, "structured", "", structured, "save data to structured tables (business and business_partners) instead of JSON table")
-	return transformCmd
+	transformCmd.Flags().BoolVarP(&structured, "structured", "", structured, "save data to structured tables (business, socios_cnpj, lookups, etc.) instead of JSON table, PostgreSQL only")
+	transformCmd.Flags().BoolVarP(&shadow, "shadow", "", shadow, "load the data into a new table and swap it with the live one once it is complete (archiving the previous version of changed companies in PostgreSQL), PostgreSQL and MongoDB only")
+	transformCmd.Flags().BoolVarP(&incremental, "incremental", "", incremental, "update the companies of a previous load, writing only new and changed ones and removing the ones absent from the downloaded files, PostgreSQL only")
+	transformCmd.Flags().BoolVarP(&sortIndexes, "sort-indexes", "", sortIndexes, "also create the indexes to sort searches by data_inicio_atividade and razao_social (order_by), which make the load slower and the database larger, PostgreSQL and MongoDB only")
+	return addWatch(transformCmd)
 }
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json/v2"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cuducos/minha-receita/compliance"
+	"github.com/cuducos/minha-receita/watch"
+	"github.com/spf13/cobra"
+)
+
+const watchlistHelper = `
+Manages watchlists of CNPJs. After each transform (or rollback), the watched
+companies are compared with the version seen in the previous load, and the
+changes of each watchlist are sent to its webhook as a POST request signed with
+HMAC-SHA256 (header X-Minha-Receita-Signature: sha256=<hex digest of the body
+using the watchlist secret>), with retries and exponential backoff.
+
+Changes of watchlists without a webhook, or whose delivery failed, are appended
+as NDJSON to the file set in --watch-outbox, if any. If a delivery fails and
+there is no outbox, the changes are delivered again in the next check.`
+
+var (
+	watchOutbox  string
+	watchRetries uint
+	watchBackoff time.Duration
+	watchFile    string
+	watchWebhook string
+	watchSecret  string
+)
+
+// checkWatchlists delivers the changes in watched companies after a load.
+func checkWatchlists(db database) error {
+	cfg := watch.Config{Outbox: watchOutbox, Retries: watchRetries, Backoff: watchBackoff}
+	if err := watch.Check(context.Background(), db, cfg); err != nil {
+		return fmt.Errorf("error checking watchlists: %w", err)
+	}
+	return nil
+}
+
+func addWatch(c *cobra.Command) *cobra.Command {
+	c.Flags().StringVarP(&watchOutbox, "watch-outbox", "", "", "NDJSON file to write changes in watched companies without webhook or whose delivery failed")
+	c.Flags().UintVarP(&watchRetries, "watch-retries", "", watch.Retries, "number of retries for each webhook delivery")
+	c.Flags().DurationVarP(&watchBackoff, "watch-backoff", "", watch.Backoff, "delay before the first retry of a webhook delivery, doubled at each retry")
+	return c
+}
+
+func printJSON(v any) error {
+	if err := json.MarshalWrite(os.Stdout, v); err != nil {
+		return fmt.Errorf("could not write json: %w", err)
+	}
+	fmt.Println()
+	return nil
+}
+
+var watchlistCmd = &cobra.Command{
+	Use:   "watchlist",
+	Short: "Manages watchlists of CNPJs with change notifications",
+	Long:  watchlistHelper,
+}
+
+var watchlistAddCmd = &cobra.Command{
+	Use:   "add <name> [cnpj …]",
+	Short: "Creates a watchlist, printing it including its webhook secret",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		ns := args[1:]
+		if watchFile != "" {
+			f, err := os.Open(watchFile)
+			if err != nil {
+				return fmt.Errorf("could not open %s: %w", watchFile, err)
+			}
+			defer f.Close()
+			l, err := compliance.ParseList(f)
+			if err != nil {
+				return err
+			}
+			ns = append(ns, l...)
+		}
+		db, err := loadDatabase()
+		if err != nil {
+			return fmt.Errorf("could not find database: %w", err)
+		}
+		defer db.Close()
+		w, err := watch.NewStore(db).Create(watch.Watchlist{
+			Name:    args[0],
+			CNPJs:   ns,
+			Webhook: watchWebhook,
+			Secret:  watchSecret,
+		})
+		if err != nil {
+			return err
+		}
+		return printJSON(w)
+	},
+}
+
+var watchlistListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the watchlists",
+	RunE: func(_ *cobra.Command, _ []string) error {
+		db, err := loadDatabase()
+		if err != nil {
+			return fmt.Errorf("could not find database: %w", err)
+		}
+		defer db.Close()
+		ws, err := watch.NewStore(db).List()
+		if err != nil {
+			return err
+		}
+		for i, w := range ws {
+			ws[i] = w.WithoutSecret()
+		}
+		return printJSON(ws)
+	},
+}
+
+var watchlistRemoveCmd = &cobra.Command{
+	Use:   "remove <id>",
+	Short: "Removes a watchlist",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		db, err := loadDatabase()
+		if err != nil {
+			return fmt.Errorf("could not find database: %w", err)
+		}
+		defer db.Close()
+		return watch.NewStore(db).Delete(args[0])
+	},
+}
+
+var watchlistCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Compares the watched companies with the previous check and delivers the changes",
+	RunE: func(_ *cobra.Command, _ []string) error {
+		db, err := loadDatabase()
+		if err != nil {
+			return fmt.Errorf("could not find database: %w", err)
+		}
+		defer db.Close()
+		return checkWatchlists(db)
+	},
+}
+
+func watchlistCLI() *cobra.Command {
+	for _, c := range []*cobra.Command{watchlistAddCmd, watchlistListCmd, watchlistRemoveCmd, watchlistCheckCmd} {
+		addDatabase(c)
+	}
+	addWatch(watchlistCheckCmd)
+	watchlistAddCmd.Flags().StringVarP(&watchFile, "file", "f", "", "TXT file with one CNPJ per line, or CSV file with the CNPJ in the first column")
+	watchlistAddCmd.Flags().StringVarP(&watchWebhook, "webhook", "w", "", "URL to POST the changes to (changes go to the outbox if empty)")
+	watchlistAddCmd.Flags().StringVarP(&watchSecret, "secret", "", "", "secret to sign the webhook requests (random if empty)")
+	watchlistCmd.AddCommand(watchlistAddCmd, watchlistListCmd, watchlistRemoveCmd, watchlistCheckCmd)
+	return watchlistCmd
+}
@@ -0,0 +1,232 @@
+// Package compliance builds reports for lists of CNPJs (e.g. suppliers),
+// flagging companies that are not active, that were excluded from Simples or
+// MEI, or that changed their situação cadastral recently.
+package compliance
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json/v2"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cuducos/go-cnpj"
+	"github.com/cuducos/minha-receita/transform"
+)
+
+const (
+	batchSize  = 1024 // CNPJs looked up in the database at once
+	dateFormat = "2006-01-02"
+)
+
+// situação cadastral codes of companies that cannot operate regularly
+var irregular = map[int]bool{
+	3: true, // SUSPENSA
+	4: true, // INAPTA
+	8: true, // BAIXADA
+}
+
+type database interface {
+	GetCompanies(context.Context, []string) (map[string]string, error)
+}
+
+// Result is the report for a single line of the list.
+type Result struct {
+	Entrada                    string  `json:"entrada"` // as it was in the list
+	CNPJ                       string  `json:"cnpj"`
+	CNPJValido                 bool    `json:"cnpj_valido"`
+	Encontrado                 bool    `json:"encontrado"`
+	RazaoSocial                string  `json:"razao_social,omitempty"`
+	DescricaoSituacaoCadastral *string `json:"descricao_situacao_cadastral"`
+	DataSituacaoCadastral      *string `json:"data_situacao_cadastral"`
+	SituacaoIrregular          bool    `json:"situacao_irregular"` // BAIXADA, INAPTA or SUSPENSA
+	AlteradaDesde              *bool   `json:"situacao_alterada_desde,omitempty"`
+	OpcaoPeloSimples           *bool   `json:"opcao_pelo_simples"`
+	DataExclusaoDoSimples      *string `json:"data_exclusao_do_simples"`
+	ExcluidaDoSimples          bool    `json:"excluida_do_simples"`
+	OpcaoPeloMEI               *bool   `json:"opcao_pelo_mei"`
+	DataExclusaoDoMEI          *string `json:"data_exclusao_do_mei"`
+	ExcluidaDoMEI              bool    `json:"excluida_do_mei"`
+}
+
+// ParseList reads a TXT (one CNPJ per line) or a CSV (CNPJ in the first column,
+// separated by comma, semicolon or tab) file. Lines without any digit in the
+// first column, such as headers and blank lines, are ignored.
+func ParseList(r io.Reader) ([]string, error) {
+	var ns []string
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fs := strings.FieldsFunc(s.Text(), func(r rune) bool { return r == ',' || r == ';' || r == '\t' })
+		if len(fs) == 0 {
+			continue
+		}
+		n := strings.Trim(fs[0], "\"' \ufeff") // \ufeff is the BOM of some CSV files
+		if !strings.ContainsAny(n, "0123456789") {
+			continue
+		}
+		ns = append(ns, n)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("could not read cnpj list: %w", err)
+	}
+	return ns, nil
+}
+
+func dateOf[T fmt.Stringer](d *T) *string {
+	if d == nil {
+		return nil
+	}
+	s := (*d).String()
+	return &s
+}
+
+func newResult(n string, c *transform.Company, since *time.Time) Result {
+	r := Result{Entrada: n, CNPJ: cnpj.Unmask(n), CNPJValido: cnpj.IsValid(n)}
+	if c == nil {
+		return r
+	}
+	r.Encontrado = true
+	r.RazaoSocial = c.RazaoSocial
+	r.DescricaoSituacaoCadastral = c.DescricaoSituacaoCadastral
+	r.DataSituacaoCadastral = dateOf(c.DataSituacaoCadastral)
+	r.SituacaoIrregular = c.SituacaoCadastral != nil && irregular[*c.SituacaoCadastral]
+	r.OpcaoPeloSimples = c.OpcaoPeloSimples
+	r.DataExclusaoDoSimples = dateOf(c.DataExclusaoDoSimples)
+	r.ExcluidaDoSimples = r.DataExclusaoDoSimples != nil && (c.OpcaoPeloSimples == nil || !*c.OpcaoPeloSimples)
+	r.OpcaoPeloMEI = c.OpcaoPeloMEI
+	r.DataExclusaoDoMEI = dateOf(c.DataExclusaoDoMEI)
+	r.ExcluidaDoMEI = r.DataExclusaoDoMEI != nil && (c.OpcaoPeloMEI == nil || !*c.OpcaoPeloMEI)
+	if since != nil {
+		var a bool
+		if r.DataSituacaoCadastral != nil {
+			t, err := time.Parse(dateFormat, *r.DataSituacaoCadastral)
+			a = err == nil && !t.Before(*since)
+		}
+		r.AlteradaDesde = &a
+	}
+	return r
+}
+
+// Check builds the report for a list of CNPJs, in the same order as the list.
+// If since is not nil, the report says whether the situação cadastral changed
+// since that date.
+func Check(ctx context.Context, db database, ns []string, since *time.Time) ([]Result, error) {
+	var ids []string
+	seen := make(map[string]struct{})
+	for _, n := range ns {
+		if !cnpj.IsValid(n) {
+			continue
+		}
+		id := cnpj.Unmask(n)
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		ids = append(ids, id)
+	}
+	cs := make(map[string]*transform.Company, len(ids))
+	for i := 0; i < len(ids); i += batchSize {
+		b := ids[i:min(i+batchSize, len(ids))]
+		m, err := db.GetCompanies(ctx, b)
+		if err != nil {
+			return nil, fmt.Errorf("error looking up cnpjs: %w", err)
+		}
+		for id, s := range m {
+			var c transform.Company
+			if err := json.Unmarshal([]byte(s), &c); err != nil {
+				return nil, fmt.Errorf("error parsing company %s: %w", id, err)
+			}
+			cs[id] = &c
+		}
+	}
+	rs := make([]Result, len(ns))
+	for i, n := range ns {
+		var c *transform.Company
+		if cnpj.IsValid(n) {
+			c = cs[cnpj.Unmask(n)]
+		}
+		rs[i] = newResult(n, c, since)
+	}
+	return rs, nil
+}
+
+// ParseSince validates the date (YYYY-MM-DD) used to check if the situação
+// cadastral changed. An empty string means no date.
+func ParseSince(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(dateFormat, s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %s, expected YYYY-MM-DD: %w", s, err)
+	}
+	return &t, nil
+}
+
+var csvHeader = []string{
+	"entrada",
+	"cnpj",
+	"cnpj_valido",
+	"encontrado",
+	"razao_social",
+	"descricao_situacao_cadastral",
+	"data_situacao_cadastral",
+	"situacao_irregular",
+	"situacao_alterada_desde",
+	"opcao_pelo_simples",
+	"data_exclusao_do_simples",
+	"excluida_do_simples",
+	"opcao_pelo_mei",
+	"data_exclusao_do_mei",
+	"excluida_do_mei",
+}
+
+func str(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func boolean(b *bool) string {
+	if b == nil {
+		return ""
+	}
+	return strconv.FormatBool(*b)
+}
+
+// WriteCSV writes the report as CSV, using empty cells for null values.
+func WriteCSV(w io.Writer, rs []Result) error {
+	c := csv.NewWriter(w)
+	if err := c.Write(csvHeader); err != nil {
+		return fmt.Errorf("could not write csv header: %w", err)
+	}
+	for _, r := range rs {
+		err := c.Write([]string{
+			r.Entrada,
+			r.CNPJ,
+			strconv.FormatBool(r.CNPJValido),
+			strconv.FormatBool(r.Encontrado),
+			r.RazaoSocial,
+			str(r.DescricaoSituacaoCadastral),
+			str(r.DataSituacaoCadastral),
+			strconv.FormatBool(r.SituacaoIrregular),
+			boolean(r.AlteradaDesde),
+			boolean(r.OpcaoPeloSimples),
+			str(r.DataExclusaoDoSimples),
+			strconv.FormatBool(r.ExcluidaDoSimples),
+			boolean(r.OpcaoPeloMEI),
+			str(r.DataExclusaoDoMEI),
+			strconv.FormatBool(r.ExcluidaDoMEI),
+		})
+		if err != nil {
+			return fmt.Errorf("could not write csv line for %s: %w", r.Entrada, err)
+		}
+	}
+	c.Flush()
+	return c.Error()
+}
@@ -0,0 +1,164 @@
+package compliance
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeDatabase has two companies: the one in the test data (ATIVA) and a
+// variation of it that is BAIXADA and was excluded from Simples.
+type fakeDatabase struct {
+	companies map[string]string
+	batches   [][]string
+}
+
+func newFakeDatabase(t *testing.T) *fakeDatabase {
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		t.Fatalf("expected no error reading test data, got %s", err)
+	}
+	c := string(b)
+	r := strings.NewReplacer(
+		`"cnpj": "19131243000197"`, `"cnpj": "33683111000280"`,
+		`"situacao_cadastral": 2`, `"situacao_cadastral": 8`,
+		`"descricao_situacao_cadastral": "ATIVA"`, `"descricao_situacao_cadastral": "BAIXADA"`,
+		`"data_situacao_cadastral": "2013-10-03"`, `"data_situacao_cadastral": "2024-05-01"`,
+		`"opcao_pelo_simples": null`, `"opcao_pelo_simples": false`,
+		`"data_exclusao_do_simples": null`, `"data_exclusao_do_simples": "2020-01-01"`,
+	)
+	return &fakeDatabase{companies: map[string]string{
+		"19131243000197": c,
+		"33683111000280": r.Replace(c),
+	}}
+}
+
+func (f *fakeDatabase) GetCompanies(_ context.Context, ids []string) (map[string]string, error) {
+	f.batches = append(f.batches, ids)
+	cs := make(map[string]string)
+	for _, id := range ids {
+		if c, ok := f.companies[id]; ok {
+			cs[id] = c
+		}
+	}
+	return cs, nil
+}
+
+func TestParseList(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		content string
+	}{
+		{"txt", "19131243000197\n\n33.683.111/0002-80\n"},
+		{"csv with header", "cnpj,nome\n19131243000197,Open Knowledge\n\"33.683.111/0002-80\",Serpro\n"},
+		{"csv with semicolon and bom", "\ufeffCNPJ;Nome\r\n19131243000197;Open Knowledge\r\n33.683.111/0002-80;Serpro\r\n"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := ParseList(strings.NewReader(c.content))
+			if err != nil {
+				t.Fatalf("expected no error parsing list, got %s", err)
+			}
+			if len(got) != 2 || got[0] != "19131243000197" || got[1] != "33.683.111/0002-80" {
+				t.Errorf("expected the two cnpjs, got %q", got)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	db := newFakeDatabase(t)
+	since, err := ParseSince("2024-01-01")
+	if err != nil {
+		t.Fatalf("expected no error parsing since, got %s", err)
+	}
+	ns := []string{"19131243000197", "33.683.111/0002-80", "00000000000191", "foobar", "19.131.243/0001-97"}
+	rs, err := Check(context.Background(), db, ns, since)
+	if err != nil {
+		t.Fatalf("expected no error checking list, got %s", err)
+	}
+	if len(rs) != len(ns) {
+		t.Fatalf("expected %d results, got %d", len(ns), len(rs))
+	}
+	if len(db.batches) != 1 || len(db.batches[0]) != 3 {
+		t.Errorf("expected one batch with the 3 unique valid cnpjs, got %v", db.batches)
+	}
+
+	r := rs[0]
+	if !r.CNPJValido || !r.Encontrado || r.SituacaoIrregular || r.ExcluidaDoSimples {
+		t.Errorf("expected active company found and regular, got %+v", r)
+	}
+	if *r.DescricaoSituacaoCadastral != "ATIVA" || *r.DataSituacaoCadastral != "2013-10-03" || *r.AlteradaDesde {
+		t.Errorf("expected ATIVA since 2013-10-03 and not changed since 2024, got %+v", r)
+	}
+
+	r = rs[1]
+	if r.CNPJ != "33683111000280" || !r.Encontrado || !r.SituacaoIrregular || !r.ExcluidaDoSimples {
+		t.Errorf("expected BAIXADA company excluded from Simples, got %+v", r)
+	}
+	if *r.DataExclusaoDoSimples != "2020-01-01" || !*r.AlteradaDesde {
+		t.Errorf("expected exclusion date and change since 2024, got %+v", r)
+	}
+
+	if r = rs[2]; !r.CNPJValido || r.Encontrado || r.DescricaoSituacaoCadastral != nil {
+		t.Errorf("expected valid cnpj not found, got %+v", r)
+	}
+	if r = rs[3]; r.CNPJValido || r.Encontrado {
+		t.Errorf("expected invalid cnpj, got %+v", r)
+	}
+	if r = rs[4]; r.Entrada != "19.131.243/0001-97" || !r.Encontrado {
+		t.Errorf("expected repeated cnpj to be reported again, got %+v", r)
+	}
+}
+
+func TestCheckWithoutSince(t *testing.T) {
+	rs, err := Check(context.Background(), newFakeDatabase(t), []string{"19131243000197"}, nil)
+	if err != nil {
+		t.Fatalf("expected no error checking list, got %s", err)
+	}
+	if rs[0].AlteradaDesde != nil {
+		t.Errorf("expected no change flag without a date, got %t", *rs[0].AlteradaDesde)
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	if s, err := ParseSince(""); s != nil || err != nil {
+		t.Errorf("expected no date and no error for empty string, got %v and %v", s, err)
+	}
+	s, err := ParseSince("2024-01-31")
+	if err != nil || !s.Equal(time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected 2024-01-31, got %v and %v", s, err)
+	}
+	if _, err := ParseSince("31/01/2024"); err == nil {
+		t.Error("expected error for invalid date, got nil")
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	rs, err := Check(context.Background(), newFakeDatabase(t), []string{"33683111000280", "foobar"}, nil)
+	if err != nil {
+		t.Fatalf("expected no error checking list, got %s", err)
+	}
+	var b bytes.Buffer
+	if err := WriteCSV(&b, rs); err != nil {
+		t.Fatalf("expected no error writing csv, got %s", err)
+	}
+	ls, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatalf("expected no error reading csv, got %s", err)
+	}
+	if len(ls) != 3 {
+		t.Fatalf("expected header and 2 lines, got %d", len(ls))
+	}
+	exp := []string{"33683111000280", "33683111000280", "true", "true", "OPEN KNOWLEDGE BRASIL", "BAIXADA", "2024-05-01", "true", "", "false", "2020-01-01", "true", "", "", "false"}
+	if strings.Join(ls[1], ",") != strings.Join(exp, ",") {
+		t.Errorf("expected %q, got %q", exp, ls[1])
+	}
+	if ls[2][2] != "false" || ls[2][3] != "false" {
+		t.Errorf("expected invalid and not found, got %q", ls[2])
+	}
+}
@@ -0,0 +1,577 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cuducos/minha-receita/transform"
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Keys in the Badger database are made of parts separated by a null byte:
+//
+//	c␀<cnpj>                         company JSON
+//	m␀<key>                          metadata value
+//	x␀<index>                        marks an extra index as created
+//	i␀<index>␀<value>␀<cnpj>         secondary index entry (empty value)
+//
+// Secondary index entries of the same value are sorted by CNPJ, so searches
+// are an intersection of sorted key ranges and the CNPJ works as the cursor.
+const (
+	badgerSep           = "\x00"
+	badgerCompanyPrefix = "c" + badgerSep
+	badgerMetaPrefix    = "m" + badgerSep
+	badgerIndexPrefix   = "i" + badgerSep
+	badgerMarkPrefix    = "x" + badgerSep
+)
+
+// searchIndexes maps the filters in Query to the extra indexes (created by
+// `transform`) used to search for them.
+var searchIndexes = map[string][]string{
+	"uf":                {"uf"},
+	"municipio":         {"codigo_municipio", "codigo_municipio_ibge"},
+	"natureza_juridica": {"codigo_natureza_juridica"},
+	"cnae_fiscal":       {"cnae_fiscal"},
+	"cnae":              {"cnae_fiscal", "cnaes_secundarios.codigo"},
+	"cnpf":              {"qsa.cnpj_cpf_do_socio"},
+}
+
+func badgerIndexKey(idx, v, id string) []byte {
+	return []byte(badgerIndexPrefix + idx + badgerSep + v + badgerSep + id)
+}
+
+// Badger is an embedded key-value database, so a single binary and a data
+// directory are enough to serve the API.
+type Badger struct {
+	db      *badger.DB
+	path    string
+	mu      sync.RWMutex
+	indexes []string // extra indexes already created
+}
+
+// Close closes the Badger database.
+func (b *Badger) Close() {
+	if err := b.db.Close(); err != nil {
+		slog.Error("Error closing Badger", "path", b.path, "error", err)
+	}
+}
+
+// Create is a no-op since the Badger database is created when opened.
+func (b *Badger) Create() error {
+	slog.Info("Using", "path", b.path)
+	return nil
+}
+
+// Drop deletes all the data in the Badger database.
+func (b *Badger) Drop() error {
+	slog.Info("Dropping all data", "path", b.path)
+	if err := b.db.DropAll(); err != nil {
+		return fmt.Errorf("error dropping badger data: %w", err)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.indexes = nil
+	return nil
+}
+
+// PreLoad is a no-op for Badger.
+func (b *Badger) PreLoad() error { return nil }
+
+// PostLoad runs the garbage collector of the value log after loading data.
+func (b *Badger) PostLoad() error {
+	for {
+		err := b.db.RunValueLogGC(0.5)
+		if errors.Is(err, badger.ErrNoRewrite) || errors.Is(err, badger.ErrRejected) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error running badger garbage collection: %w", err)
+		}
+	}
+}
+
+// indexValues returns the values of an index (e.g. `uf` or `qsa.nome_socio`)
+// in a company as strings, following arrays in nested indexes.
+func indexValues(c map[string]any, idx string) []string {
+	var vs []string
+	var walk func(any, []string)
+	walk = func(v any, path []string) {
+		switch t := v.(type) {
+		case []any:
+			for _, i := range t {
+				walk(i, path)
+			}
+			return
+		case map[string]any:
+			if len(path) > 0 {
+				walk(t[path[0]], path[1:])
+			}
+			return
+		}
+		if len(path) > 0 {
+			return
+		}
+		switch t := v.(type) {
+		case string:
+			vs = append(vs, t)
+		case float64:
+			vs = append(vs, strconv.FormatFloat(t, 'f', -1, 64))
+		case bool:
+			vs = append(vs, strconv.FormatBool(t))
+		}
+	}
+	walk(c, strings.Split(idx, "."))
+	return vs
+}
+
+func (b *Badger) indexKeys(id, j string, idxs []string) ([][]byte, error) {
+	if len(idxs) == 0 {
+		return nil, nil
+	}
+	var c map[string]any
+	if err := json.Unmarshal([]byte(j), &c); err != nil {
+		return nil, fmt.Errorf("error parsing company %s: %w", id, err)
+	}
+	var ks [][]byte
+	for _, idx := range idxs {
+		for _, v := range indexValues(c, idx) {
+			ks = append(ks, badgerIndexKey(idx, v, id))
+		}
+	}
+	return ks, nil
+}
+
+// staleIndexKeys returns the index keys of the current version of a company
+// that are not in the new one.
+func (b *Badger) staleIndexKeys(txn *badger.Txn, id string, new [][]byte, idxs []string) ([][]byte, error) {
+	i, err := txn.Get([]byte(badgerCompanyPrefix + id))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading cnpj %s: %w", id, err)
+	}
+	j, err := i.ValueCopy(nil)
+	if err != nil {
+		return nil, fmt.Errorf("error reading cnpj %s: %w", id, err)
+	}
+	old, err := b.indexKeys(id, string(j), idxs)
+	if err != nil {
+		return nil, err
+	}
+	var ks [][]byte
+	for _, k := range old {
+		if !slices.ContainsFunc(new, func(n []byte) bool { return bytes.Equal(k, n) }) {
+			ks = append(ks, k)
+		}
+	}
+	return ks, nil
+}
+
+// CreateCompanies saves a batch of companies, keeping the extra indexes
+// already created up to date. It expects an array and each item should be
+// another array with only two items: the ID and the JSON field values.
+func (b *Badger) CreateCompanies(batch [][]string) error {
+	b.mu.RLock()
+	idxs := b.indexes
+	b.mu.RUnlock()
+	w := b.db.NewWriteBatch()
+	defer w.Cancel()
+	for _, r := range batch {
+		ks, err := b.indexKeys(r[0], r[1], idxs)
+		if err != nil {
+			return err
+		}
+		if len(idxs) > 0 {
+			var stale [][]byte
+			err := b.db.View(func(txn *badger.Txn) error {
+				var err error
+				stale, err = b.staleIndexKeys(txn, r[0], ks, idxs)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			for _, k := range stale {
+				if err := w.Delete(k); err != nil {
+					return fmt.Errorf("error deleting index of cnpj %s: %w", r[0], err)
+				}
+			}
+		}
+		if err := w.Set([]byte(badgerCompanyPrefix+r[0]), []byte(r[1])); err != nil {
+			return fmt.Errorf("error saving cnpj %s to badger: %w", r[0], err)
+		}
+		for _, k := range ks {
+			if err := w.Set(k, nil); err != nil {
+				return fmt.Errorf("error saving index of cnpj %s: %w", r[0], err)
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error while importing data to badger: %w", err)
+	}
+	return nil
+}
+
+// CreateCompaniesStructured is not supported for Badger (it is implemented
+// only for PostgreSQL)
+func (b *Badger) CreateCompaniesStructured(batch [][]string) error {
+	return fmt.Errorf("CreateCompaniesStructured is not supported for Badger - use PostgreSQL for structured tables")
+}
+
+func (b *Badger) get(txn *badger.Txn, k string) (string, error) {
+	i, err := txn.Get([]byte(k))
+	if err != nil {
+		return "", err
+	}
+	v, err := i.ValueCopy(nil)
+	if err != nil {
+		return "", err
+	}
+	return string(v), nil
+}
+
+// GetCompany returns the JSON of a company based on a CNPJ number.
+func (b *Badger) GetCompany(id string) (string, error) {
+	var j string
+	err := b.db.View(func(txn *badger.Txn) error {
+		var err error
+		j, err = b.get(txn, badgerCompanyPrefix+id)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("error looking for cnpj %s: %w", id, err)
+	}
+	return j, nil
+}
+
+// GetCompanies returns the JSON of the companies found for a batch of CNPJ
+// numbers, indexed by CNPJ. CNPJs not found are not in the map.
+func (b *Badger) GetCompanies(ctx context.Context, ids []string) (map[string]string, error) {
+	cs := make(map[string]string)
+	err := b.db.View(func(txn *badger.Txn) error {
+		for _, id := range ids {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			j, err := b.get(txn, badgerCompanyPrefix+id)
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			cs[id] = j
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error looking for %d cnpjs: %w", len(ids), err)
+	}
+	return cs, nil
+}
+
+// keyRange iterates over the CNPJs at the end of the keys with a prefix.
+type keyRange struct {
+	it     *badger.Iterator
+	prefix []byte
+}
+
+func (r *keyRange) id() (string, bool) {
+	if !r.it.ValidForPrefix(r.prefix) {
+		return "", false
+	}
+	return string(r.it.Item().Key()[len(r.prefix):]), true
+}
+
+func (r *keyRange) seek(id string) {
+	if c, ok := r.id(); ok && c >= id {
+		return
+	}
+	r.it.Seek(append(slices.Clone(r.prefix), id...))
+}
+
+// keyUnion merges ranges, e.g. all the companies in any of the UFs searched.
+type keyUnion []*keyRange
+
+func (u keyUnion) id() (string, bool) {
+	var m string
+	var found bool
+	for _, r := range u {
+		if id, ok := r.id(); ok && (!found || id < m) {
+			m = id
+			found = true
+		}
+	}
+	return m, found
+}
+
+func (u keyUnion) seek(id string) {
+	for _, r := range u {
+		r.seek(id)
+	}
+}
+
+// intersect returns up to `n` CNPJs greater than or equal to `start` present in
+// all the unions, leapfrogging each union to the highest CNPJ seen so far.
+func intersect(us []keyUnion, start string, n int) []string {
+	var ids []string
+	t := start
+	for len(ids) < n {
+		agreed := true
+		for _, u := range us {
+			u.seek(t)
+			id, ok := u.id()
+			if !ok {
+				return ids
+			}
+			if id != t {
+				t = id
+				agreed = false
+				break
+			}
+		}
+		if agreed {
+			ids = append(ids, t)
+			t += badgerSep
+		}
+	}
+	return ids
+}
+
+func (b *Badger) searchUnions(txn *badger.Txn, q *Query) ([]keyUnion, func(), error) {
+	var its []*badger.Iterator
+	closeAll := func() {
+		for _, it := range its {
+			it.Close()
+		}
+	}
+	newRange := func(p string) *keyRange {
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: []byte(p)})
+		its = append(its, it)
+		return &keyRange{it: it, prefix: []byte(p)}
+	}
+	str := func(vs []uint32) []string {
+		r := make([]string, len(vs))
+		for i, v := range vs {
+			r[i] = strconv.FormatUint(uint64(v), 10)
+		}
+		return r
+	}
+	b.mu.RLock()
+	created := b.indexes
+	b.mu.RUnlock()
+	var us []keyUnion
+	for _, f := range []struct {
+		name   string
+		values []string
+	}{
+		{"uf", q.UF},
+		{"municipio", str(q.Municipio)},
+		{"natureza_juridica", str(q.NaturezaJuridica)},
+		{"cnae_fiscal", str(q.CNAEFiscal)},
+		{"cnae", str(q.CNAE)},
+		{"cnpf", q.CNPF},
+	} {
+		if len(f.values) == 0 {
+			continue
+		}
+		var u keyUnion
+		for _, idx := range searchIndexes[f.name] {
+			if !slices.Contains(created, idx) {
+				closeAll()
+				return nil, nil, fmt.Errorf("index %s required to search by %s was not created", idx, f.name)
+			}
+			for _, v := range f.values {
+				u = append(u, newRange(badgerIndexPrefix+idx+badgerSep+v+badgerSep))
+			}
+		}
+		us = append(us, u)
+	}
+	if len(us) == 0 {
+		us = append(us, keyUnion{newRange(badgerCompanyPrefix)})
+	}
+	return us, closeAll, nil
+}
+
+// Search returns paginated results with JSON for companies bases on a search
+// query
+func (b *Badger) Search(ctx context.Context, q *Query) (string, error) {
+	if err := q.checkSupported("Badger"); err != nil {
+		return "", err
+	}
+	var cs []string
+	var cur string
+	err := b.db.View(func(txn *badger.Txn) error {
+		us, closeAll, err := b.searchUnions(txn, q)
+		if err != nil {
+			return err
+		}
+		var start string
+		if q.Cursor != nil && *q.Cursor != "" {
+			start = *q.Cursor + badgerSep
+		}
+		ids := intersect(us, start, int(q.Limit))
+		closeAll()
+		for _, id := range ids {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			j, err := b.get(txn, badgerCompanyPrefix+id)
+			if err != nil {
+				return fmt.Errorf("error reading cnpj %s: %w", id, err)
+			}
+			cs = append(cs, j)
+		}
+		if len(ids) == int(q.Limit) {
+			cur = ids[len(ids)-1]
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("error searching for %#v: %w", q, err)
+	}
+	return newPage(cs, cur), nil
+}
+
+// MetaSave saves a key/value pair in the metadata table.
+func (b *Badger) MetaSave(k, v string) error {
+	err := b.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(badgerMetaPrefix+k), []byte(v))
+	})
+	if err != nil {
+		return fmt.Errorf("error saving %s to metadata: %w", k, err)
+	}
+	return nil
+}
+
+// MetaRead reads a key/value pair from the metadata table.
+func (b *Badger) MetaRead(k string) (string, error) {
+	var v string
+	err := b.db.View(func(txn *badger.Txn) error {
+		var err error
+		v, err = b.get(txn, badgerMetaPrefix+k)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("error reading for metadata key %s: %w", k, err)
+	}
+	return v, nil
+}
+
+// MetaDelete removes a key/value pair from the metadata table.
+func (b *Badger) MetaDelete(k string) error {
+	err := b.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(badgerMetaPrefix + k))
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting %s from metadata: %w", k, err)
+	}
+	return nil
+}
+
+// CreateExtraIndexes writes secondary index keys for every company and marks
+// the indexes as created, so later calls to `CreateCompanies` keep them up to
+// date.
+func (b *Badger) CreateExtraIndexes(idxs []string) error {
+	if err := transform.ValidateIndexes(idxs); err != nil {
+		return fmt.Errorf("index name error: %w", err)
+	}
+	w := b.db.NewWriteBatch()
+	defer w.Cancel()
+	err := b.db.View(func(txn *badger.Txn) error {
+		p := []byte(badgerCompanyPrefix)
+		it := txn.NewIterator(badger.IteratorOptions{PrefetchValues: true, PrefetchSize: 1024, Prefix: p})
+		defer it.Close()
+		for it.Seek(p); it.ValidForPrefix(p); it.Next() {
+			i := it.Item()
+			id := string(i.Key()[len(p):])
+			err := i.Value(func(j []byte) error {
+				ks, err := b.indexKeys(id, string(j), idxs)
+				if err != nil {
+					return err
+				}
+				for _, k := range ks {
+					if err := w.Set(k, nil); err != nil {
+						return fmt.Errorf("error saving index of cnpj %s: %w", id, err)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error creating indexes: %w", err)
+	}
+	for _, idx := range idxs {
+		if err := w.Set([]byte(badgerMarkPrefix+idx), nil); err != nil {
+			return fmt.Errorf("error marking index %s as created: %w", idx, err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error saving indexes to badger: %w", err)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, idx := range idxs {
+		if !slices.Contains(b.indexes, idx) {
+			b.indexes = append(b.indexes, idx)
+		}
+	}
+	slog.Info(fmt.Sprintf("%d Indexes successfully created in %s", len(idxs), b.path))
+	return nil
+}
+
+func (b *Badger) loadIndexes() error {
+	return b.db.View(func(txn *badger.Txn) error {
+		p := []byte(badgerMarkPrefix)
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: p})
+		defer it.Close()
+		for it.Seek(p); it.ValidForPrefix(p); it.Next() {
+			b.indexes = append(b.indexes, string(it.Item().Key()[len(p):]))
+		}
+		return nil
+	})
+}
+
+type badgerLogger struct{}
+
+func (*badgerLogger) Errorf(f string, a ...any)   { slog.Error(fmt.Sprintf(f, a...)) }
+func (*badgerLogger) Warningf(f string, a ...any) { slog.Warn(fmt.Sprintf(f, a...)) }
+func (*badgerLogger) Infof(f string, a ...any)    { slog.Debug(fmt.Sprintf(f, a...)) }
+func (*badgerLogger) Debugf(f string, a ...any)   { slog.Debug(fmt.Sprintf(f, a...)) }
+
+// NewBadger opens (or creates) a Badger database in a directory. The URI is
+// the path to the directory prefixed by `badger://` (e.g.
+// `badger://minha-receita` or `badger:///var/lib/minha-receita`).
+func NewBadger(uri string) (*Badger, error) {
+	pth := strings.TrimPrefix(uri, "badger://")
+	if pth == "" {
+		return nil, fmt.Errorf("missing the path to the badger directory in %s", uri)
+	}
+	if err := os.MkdirAll(pth, 0755); err != nil {
+		return nil, fmt.Errorf("could not create badger directory %s: %w", pth, err)
+	}
+	db, err := badger.Open(badger.DefaultOptions(pth).WithLogger(&badgerLogger{}))
+	if err != nil {
+		return nil, fmt.Errorf("could not open badger at %s: %w", pth, err)
+	}
+	b := &Badger{db: db, path: pth}
+	if err := b.loadIndexes(); err != nil {
+		return nil, fmt.Errorf("could not read indexes from badger at %s: %w", pth, err)
+	}
+	return b, nil
+}
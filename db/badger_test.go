@@ -0,0 +1,171 @@
+package db
+
+import (
+	"context"
+	"encoding/json/v2"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func setUpBadger(t *testing.T, id, c string) (*Badger, string) {
+	pth := filepath.Join(t.TempDir(), "badger")
+	db, err := NewBadger("badger://" + pth)
+	if err != nil {
+		t.Fatalf("expected no error opening badger, got %s", err)
+	}
+	t.Cleanup(db.Close)
+	if err := db.Create(); err != nil {
+		t.Fatalf("expected no error creating badger, got %s", err)
+	}
+	if err := db.PreLoad(); err != nil {
+		t.Fatalf("expected no error pre load on badger, got %s", err)
+	}
+	if err := db.CreateCompanies([][]string{{id, c}}); err != nil {
+		t.Fatalf("expected no error saving a company to badger, got %s", err)
+	}
+	if err := db.PostLoad(); err != nil {
+		t.Fatalf("expected no error post load on badger, got %s", err)
+	}
+	if err := db.CreateExtraIndexes(searchIndexesForTest); err != nil {
+		t.Fatalf("expected no error creating indexes, got %s", err)
+	}
+	return db, pth
+}
+
+func TestBadgerRetrieve(t *testing.T) {
+	c := loadCompany(t)
+	db, _ := setUpBadger(t, "33683111000280", c)
+	got, err := db.GetCompany("33683111000280")
+	if err != nil {
+		t.Errorf("expected no error getting a company, got %s", err)
+	}
+	assertCompaniesAreEqual(t, got, c)
+	if _, err := db.GetCompany("19131243000197"); err == nil {
+		t.Error("expected error getting a company that does not exist, got nil")
+	}
+	cs, err := db.GetCompanies(context.Background(), []string{"33683111000280", "19131243000197"})
+	if err != nil {
+		t.Errorf("expected no error getting companies, got %s", err)
+	}
+	if len(cs) != 1 {
+		t.Errorf("expected 1 company, got %d", len(cs))
+	}
+	assertCompaniesAreEqual(t, cs["33683111000280"], c)
+	if err := db.MetaSave("answer", "42"); err != nil {
+		t.Errorf("expected no error writing to the metadata table, got %s", err)
+	}
+	if err := db.MetaSave("answer", "forty-two"); err != nil {
+		t.Errorf("expected no error re-writing to the metadata table, got %s", err)
+	}
+	m, err := db.MetaRead("answer")
+	if err != nil {
+		t.Errorf("expected no error getting metadata, got %s", err)
+	}
+	if m != "forty-two" {
+		t.Errorf("expected forty-two as the answer, got %s", m)
+	}
+	if _, err := db.MetaRead("question"); err == nil {
+		t.Error("expected error reading a missing metadata key, got nil")
+	}
+	if err := db.MetaDelete("answer"); err != nil {
+		t.Errorf("expected no error deleting metadata, got %s", err)
+	}
+	if _, err := db.MetaRead("answer"); err == nil {
+		t.Error("expected error reading a deleted metadata key, got nil")
+	}
+	if err := db.MetaDelete("question"); err != nil {
+		t.Errorf("expected no error deleting a missing metadata key, got %s", err)
+	}
+	if err := db.CreateExtraIndexes([]string{"teste.index1"}); err == nil {
+		t.Error("expected errors running extra indexes, got nil")
+	}
+}
+
+func TestBadgerSearch(t *testing.T) {
+	db, _ := setUpBadger(t, "33683111000280", loadCompany(t))
+	for _, tc := range searchCases {
+		t.Run(tc.name(db), func(t *testing.T) {
+			s, err := db.Search(context.Background(), NewQuery(tc.params))
+			if err != nil {
+				t.Errorf("expected no error searching, got %s", err)
+				return
+			}
+			assertSearchCount(t, s, tc)
+		})
+	}
+}
+
+func TestBadgerSearchPagination(t *testing.T) {
+	c := loadCompany(t)
+	db, _ := setUpBadger(t, "33683111000280", c)
+	rj := strings.Replace(c, `"uf": "SP"`, `"uf": "RJ"`, 1)
+	if err := db.CreateCompanies([][]string{{"33683111000199", c}, {"33683111000300", rj}, {"33683111000400", c}}); err != nil {
+		t.Fatalf("expected no error saving companies to badger, got %s", err)
+	}
+	q := NewQuery(map[string][]string{"uf": {"sp"}, "cnae": {"6204000"}, "limit": {"2"}})
+	for i, exp := range []struct {
+		count  int
+		cursor string
+	}{
+		{2, "33683111000280"},
+		{1, ""},
+	} {
+		s, err := db.Search(context.Background(), q)
+		if err != nil {
+			t.Fatalf("expected no error searching page %d, got %s", i+1, err)
+		}
+		var p page
+		if err := json.Unmarshal([]byte(s), &p); err != nil {
+			t.Fatalf("expected no error deserializing page %d, got %s", i+1, err)
+		}
+		if len(p.Data) != exp.count {
+			t.Errorf("expected %d results in page %d, got %d", exp.count, i+1, len(p.Data))
+		}
+		var c string
+		if p.Cursor != nil {
+			c = *p.Cursor
+		}
+		if c != exp.cursor {
+			t.Errorf("expected cursor %q in page %d, got %q", exp.cursor, i+1, c)
+		}
+		q.Cursor = p.Cursor
+	}
+}
+
+func TestBadgerIndexesAreUpdated(t *testing.T) {
+	c := loadCompany(t)
+	db, pth := setUpBadger(t, "33683111000280", c)
+	rj := strings.Replace(c, `"uf": "SP"`, `"uf": "RJ"`, 1)
+	if err := db.CreateCompanies([][]string{{"33683111000280", rj}}); err != nil {
+		t.Fatalf("expected no error updating a company in badger, got %s", err)
+	}
+	db.Close()
+	db, err := NewBadger("badger://" + pth)
+	if err != nil {
+		t.Fatalf("expected no error re-opening badger, got %s", err)
+	}
+	defer db.Close()
+	for _, tc := range []testCase{
+		{map[string][]string{"uf": {"sp"}}, 0},
+		{map[string][]string{"uf": {"rj"}}, 1},
+	} {
+		s, err := db.Search(context.Background(), NewQuery(tc.params))
+		if err != nil {
+			t.Fatalf("expected no error searching, got %s", err)
+		}
+		assertSearchCount(t, s, tc)
+	}
+}
+
+func TestBadgerSearchWithoutIndexes(t *testing.T) {
+	db, err := NewBadger("badger://" + filepath.Join(t.TempDir(), "badger"))
+	if err != nil {
+		t.Fatalf("expected no error opening badger, got %s", err)
+	}
+	defer db.Close()
+	q := NewQuery(map[string][]string{"uf": {"sp"}})
+	if _, err := db.Search(context.Background(), q); err == nil {
+		t.Error("expected error searching without indexes, got nil")
+	}
+}
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrExpiredCursor is returned for cursors created before the current release
+// of the data was loaded, since they would point to different companies.
+var ErrExpiredCursor = errors.New("expired cursor")
+
+// cursorSecret signs the cursors. It comes from the CURSOR_SECRET environment
+// variable, so cursors work across restarts and instances of the API, or it is
+// random otherwise.
+var cursorSecret = sync.OnceValue(func() []byte {
+	if s := os.Getenv("CURSOR_SECRET"); s != "" {
+		return []byte(s)
+	}
+	slog.Warn("CURSOR_SECRET not set, search cursors are valid only until the API restarts")
+	b := make([]byte, 32)
+	rand.Read(b)
+	return b
+})
+
+// releaseCacheTTL is how long a release is kept in memory. Swaps and rollbacks
+// run by another process (e.g. the command line) are seen after it expires.
+const releaseCacheTTL = time.Minute
+
+// releaseCache keeps the live release in memory, so signing and checking
+// cursors does not read it from the metadata on every search.
+type releaseCache struct {
+	mu      sync.Mutex
+	release string
+	expires time.Time
+}
+
+// get returns the cached release, using read to refresh it once expired. A nil
+// cache always reads the release.
+func (c *releaseCache) get(read func() (string, error)) (string, error) {
+	if c == nil {
+		return read()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Now().Before(c.expires) {
+		return c.release, nil
+	}
+	r, err := read()
+	if err != nil {
+		return "", err
+	}
+	c.release = r
+	c.expires = time.Now().Add(releaseCacheTTL)
+	return r, nil
+}
+
+// reset makes the next get read the release again.
+func (c *releaseCache) reset() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expires = time.Time{}
+}
+
+// cursor points to the last company of a page of search results. It is
+// exposed as an opaque, signed token, and it is only valid for the same
+// database backend, order and release of the data.
+type cursor struct {
+	Backend string `json:"b"`
+	Release string `json:"r"`
+	OrderBy string `json:"o,omitempty"`
+	Key     []any  `json:"k"` // value of the order_by field (if any) and CNPJ
+}
+
+// CNPJ of the last company of the page.
+func (c *cursor) CNPJ() string {
+	s, _ := c.Key[len(c.Key)-1].(string)
+	return s
+}
+
+// Value of the order_by field of the last company of the page.
+func (c *cursor) Value() any { return c.Key[0] }
+
+func signCursor(p []byte) []byte {
+	h := hmac.New(sha256.New, cursorSecret())
+	h.Write(p)
+	return h.Sum(nil)
+}
+
+func (c *cursor) encode() (string, error) {
+	p, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("error encoding cursor: %w", err)
+	}
+	e := base64.RawURLEncoding
+	return e.EncodeToString(p) + "." + e.EncodeToString(signCursor(p)), nil
+}
+
+// newCursor creates the cursor for the next page from the CNPJ and the JSON of
+// the last company in the page.
+func newCursor(backend, release string, q *Query, cnpj, company string) (string, error) {
+	c := cursor{Backend: backend, Release: release, OrderBy: q.OrderBy, Key: []any{cnpj}}
+	o, err := q.order()
+	if err != nil {
+		return "", err
+	}
+	if o != nil {
+		var m map[string]any
+		if err := json.Unmarshal([]byte(company), &m); err != nil {
+			return "", fmt.Errorf("error reading %s for the cursor: %w", o.Field, err)
+		}
+		c.Key = []any{m[o.Field], cnpj}
+	}
+	return c.encode()
+}
+
+// cursor decodes the cursor of the query, returning nil for the first page. It
+// returns ErrInvalidCursor (or an error wrapping it) if the cursor was not created by
+// this API for the same backend and order, and wrapping ErrExpiredCursor if it
+// was created for another release of the data.
+func (q *Query) cursor(backend, release string) (*cursor, error) {
+	if q.Cursor == nil || *q.Cursor == "" {
+		return nil, nil
+	}
+	e := base64.RawURLEncoding
+	p, s, ok := strings.Cut(*q.Cursor, ".")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	b, err := e.DecodeString(p)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	sig, err := e.DecodeString(s)
+	if err != nil || !hmac.Equal(sig, signCursor(b)) {
+		return nil, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	n := 1
+	if c.OrderBy != "" {
+		n = 2
+	}
+	if c.Backend != backend || c.OrderBy != q.OrderBy || len(c.Key) != n || c.CNPJ() == "" {
+		return nil, fmt.Errorf("%w: from another search", ErrInvalidCursor)
+	}
+	if c.Release != release {
+		return nil, fmt.Errorf("%w: cursor from the release %s, the current one is %s", ErrExpiredCursor, c.Release, release)
+	}
+	return &c, nil
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCursor(t *testing.T) {
+	for _, c := range []struct {
+		orderBy  string
+		company  string
+		expected []any
+	}{
+		{"", `{"razao_social":"ACME LTDA"}`, []any{"33683111000280"}},
+		{"razao_social", `{"razao_social":"ACME LTDA"}`, []any{"ACME LTDA", "33683111000280"}},
+		{"capital_social:desc", `{"capital_social":100000}`, []any{float64(100000), "33683111000280"}},
+		{"capital_social", `{"capital_social":null}`, []any{nil, "33683111000280"}},
+	} {
+		q := NewQuery(map[string][]string{"uf": {"sp"}, "order_by": {c.orderBy}})
+		s, err := newCursor(postgresBackend, "2026-09-13", q, "33683111000280", c.company)
+		if err != nil {
+			t.Fatalf("expected no error creating cursor, got %s", err)
+		}
+		q.Cursor = &s
+		got, err := q.cursor(postgresBackend, "2026-09-13")
+		if err != nil {
+			t.Fatalf("expected no error reading cursor %s, got %s", s, err)
+		}
+		if !reflect.DeepEqual(got.Key, c.expected) {
+			t.Errorf("expected %#v, got %#v", c.expected, got.Key)
+		}
+		if got.CNPJ() != "33683111000280" {
+			t.Errorf("expected cnpj 33683111000280, got %s", got.CNPJ())
+		}
+	}
+}
+
+func TestCursorErrors(t *testing.T) {
+	q := NewQuery(map[string][]string{"uf": {"sp"}})
+	s, err := newCursor(postgresBackend, "2026-09-13", q, "33683111000280", `{}`)
+	if err != nil {
+		t.Fatalf("expected no error creating cursor, got %s", err)
+	}
+	p, sig, _ := strings.Cut(s, ".")
+	for _, c := range []struct {
+		desc     string
+		cursor   string
+		orderBy  string
+		backend  string
+		release  string
+		expected error
+	}{
+		{"raw cursor", "42", "", postgresBackend, "2026-09-13", ErrInvalidCursor},
+		{"tampered payload", "e30." + sig, "", postgresBackend, "2026-09-13", ErrInvalidCursor},
+		{"tampered signature", p + ".e30", "", postgresBackend, "2026-09-13", ErrInvalidCursor},
+		{"another backend", s, "", mongoBackend, "2026-09-13", ErrInvalidCursor},
+		{"another order", s, "razao_social", postgresBackend, "2026-09-13", ErrInvalidCursor},
+		{"another release", s, "", postgresBackend, "2026-10-12", ErrExpiredCursor},
+	} {
+		t.Run(c.desc, func(t *testing.T) {
+			q := NewQuery(map[string][]string{"uf": {"sp"}, "order_by": {c.orderBy}, "cursor": {c.cursor}})
+			if _, err := q.cursor(c.backend, c.release); !errors.Is(err, c.expected) {
+				t.Errorf("expected %s, got %v", c.expected, err)
+			}
+		})
+	}
+}
+
+func TestReleaseCache(t *testing.T) {
+	var n int
+	r := "2026-09-13"
+	read := func() (string, error) {
+		n++
+		return r, nil
+	}
+	var c releaseCache
+	for range 3 {
+		if got, err := c.get(read); err != nil || got != "2026-09-13" {
+			t.Errorf("expected 2026-09-13, got %s (%v)", got, err)
+		}
+	}
+	if n != 1 {
+		t.Errorf("expected the release to be read once, got %d", n)
+	}
+	r = "2026-10-11"
+	c.reset()
+	if got, err := c.get(read); err != nil || got != "2026-10-11" {
+		t.Errorf("expected 2026-10-11 after a reset, got %s (%v)", got, err)
+	}
+	c.expires = time.Now()
+	if _, err := c.get(func() (string, error) { return "", errors.New("boom") }); err == nil {
+		t.Error("expected an error reading an expired release, got nil")
+	}
+	if got, _ := c.get(read); got != "2026-10-11" || n != 3 {
+		t.Errorf("expected the release to be read again after an error, got %s after %d reads", got, n)
+	}
+	var nc *releaseCache
+	if got, err := nc.get(read); err != nil || got != "2026-10-11" || n != 4 {
+		t.Errorf("expected a nil cache to read the release, got %s after %d reads (%v)", got, n, err)
+	}
+}
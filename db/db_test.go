@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"encoding/json/v2"
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
@@ -22,12 +23,14 @@ type database interface {
 
 	CreateCompanies([][]string) error
 	GetCompany(string) (string, error)
+	GetCompanies(context.Context, []string) (map[string]string, error)
 
 	CreateExtraIndexes([]string) error
 	Search(context.Context, *Query) (string, error)
 
 	MetaSave(string, string) error
 	MetaRead(string) (string, error)
+	MetaDelete(string) error
 }
 
 type testCase struct {
@@ -35,6 +38,72 @@ type testCase struct {
 	expected int
 }
 
+// searchIndexesForTest are the extra indexes created by `transform` with
+// `--sort-indexes`, used for searches and sorting.
+var searchIndexesForTest = []string{
+	"capital_social",
+	"cnae_fiscal",
+	"cnaes_secundarios.codigo",
+	"codigo_municipio",
+	"codigo_municipio_ibge",
+	"codigo_natureza_juridica",
+	"data_inicio_atividade",
+	"qsa.cnpj_cpf_do_socio",
+	"razao_social",
+	"situacao_cadastral",
+	"uf",
+}
+
+var searchCases = []testCase{
+	{map[string][]string{"uf": {"sc"}}, 0},
+	{map[string][]string{"uf": {"sp"}}, 1},
+	{map[string][]string{"uf": {"sp", "sc"}}, 1},
+	{map[string][]string{"municipio": {"6105"}}, 0},
+	{map[string][]string{"municipio": {"3500303"}}, 0},
+	{map[string][]string{"municipio": {"7107"}}, 1},
+	{map[string][]string{"municipio": {"3550308"}}, 1},
+	{map[string][]string{"municipio": {"3550308", "3500303"}}, 1},
+	{map[string][]string{"municipio": {"6105", "7107"}}, 1},
+	{map[string][]string{"natureza_juridica": {"2143"}}, 0},
+	{map[string][]string{"natureza_juridica": {"3999"}}, 1},
+	{map[string][]string{"natureza_juridica": {"3999", "2143"}}, 1},
+	{map[string][]string{"cnae_fiscal": {"6204000"}}, 0},
+	{map[string][]string{"cnae_fiscal": {"9430800"}}, 1},
+	{map[string][]string{"cnae_fiscal": {"9430800", "6204000"}}, 1},
+	{map[string][]string{"cnae": {"722702"}}, 0},
+	{map[string][]string{"cnae": {"6204000"}}, 1},
+	{map[string][]string{"cnae": {"9430800", "6204000"}}, 1},
+	{map[string][]string{"cnpf": {"21449073000135"}}, 0},
+	{map[string][]string{"cnpf": {"***112108**"}}, 1},
+	{map[string][]string{"cnpf": {"21449073000135", "***112108**"}}, 1},
+	{map[string][]string{"municipio": {"7107"}, "cnae": {"6204000"}}, 1},
+	{map[string][]string{"municipio": {"7107"}, "cnae": {"722702"}}, 0},
+	{map[string][]string{"municipio": {"6105"}, "cnae": {"6204000"}}, 0},
+	{map[string][]string{"uf": {"sp"}, "cnae_fiscal": {"9430800"}, "cnpf": {"***112108**"}}, 1},
+	{map[string][]string{"uf": {"sp"}, "cnae_fiscal": {"6204000"}, "cnpf": {"***112108**"}}, 0},
+}
+
+// negationCases use negation, the all mode, search expressions and sorting,
+// supported only by the databases compiling the query through Filter.
+var negationCases = []testCase{
+	{map[string][]string{"cnae": {"6204000"}, "uf!": {"sp"}}, 0},
+	{map[string][]string{"cnae": {"6204000"}, "not_uf": {"sc"}}, 1},
+	{map[string][]string{"uf": {"sp"}, "not_cnae": {"722702"}}, 1},
+	{map[string][]string{"uf": {"sp"}, "not_cnae": {"6204000"}}, 0},
+	{map[string][]string{"uf": {"sp"}, "not_municipio": {"3550308"}}, 0},
+	{map[string][]string{"uf": {"sp"}, "cnpf!": {"***112108**"}}, 0},
+	{map[string][]string{"cnae": {"9430800", "6204000"}, "cnae_mode": {"all"}}, 1},
+	{map[string][]string{"cnae": {"9430800", "722702"}, "cnae_mode": {"all"}}, 0},
+	{map[string][]string{"cnpf": {"21449073000135", "***112108**"}, "cnpf_mode": {"all"}}, 0},
+	{map[string][]string{"q": {"uf:SP AND (cnae_fiscal:6201501 OR cnae:6204000) AND NOT situacao:BAIXADA"}}, 1},
+	{map[string][]string{"q": {"uf:SP AND situacao:ATIVA AND capital_social>100000"}}, 0},
+	{map[string][]string{"q": {"capital_social<=0 AND cnpf:***112108**"}}, 1},
+	{map[string][]string{"uf": {"sp"}, "q": {"municipio:6105 OR cnae:722702"}}, 0},
+	{map[string][]string{"uf": {"sp"}, "order_by": {"razao_social"}}, 1},
+	{map[string][]string{"uf": {"sp"}, "order_by": {"capital_social:desc"}}, 1},
+	{map[string][]string{"uf": {"sc"}, "order_by": {"data_inicio_atividade"}}, 0},
+}
+
 func (tc *testCase) name(db database) string {
 	return fmt.Sprintf("%T %s expecting %d", db, tc.params.Encode(), tc.expected)
 }
@@ -99,13 +168,32 @@ func TestRetrieve(t *testing.T) {
 		}
 		m.Close()
 	}()
-	for _, db := range []database{pg, m} {
+	my, err := setUpMySQL(id, c)
+	if err != nil {
+		t.Errorf("expected no error setting up mysql, got %s", err)
+		return
+	}
+	defer func() {
+		if err := my.Drop(); err != nil {
+			t.Errorf("expected no error dropping the tables, got %s", err)
+		}
+		my.Close()
+	}()
+	for _, db := range []database{pg, m, my} {
 		t.Run(fmt.Sprintf("%T", db), func(t *testing.T) {
 			got, err := db.GetCompany("33683111000280")
 			if err != nil {
 				t.Errorf("expected no error getting a company, got %s", err)
 			}
 			assertCompaniesAreEqual(t, got, c)
+			cs, err := db.GetCompanies(context.Background(), []string{"33683111000280", "19131243000197"})
+			if err != nil {
+				t.Errorf("expected no error getting companies, got %s", err)
+			}
+			if len(cs) != 1 {
+				t.Errorf("expected 1 company, got %d", len(cs))
+			}
+			assertCompaniesAreEqual(t, cs["33683111000280"], c)
 			if err := db.MetaSave("answer", "42"); err != nil {
 				t.Errorf("expected no error writing to the metadata table, got %s", err)
 			}
@@ -126,6 +214,12 @@ func TestRetrieve(t *testing.T) {
 			if m2 != "forty-two" {
 				t.Errorf("expected foruty-two as the answer, got %s", m2)
 			}
+			if err := db.MetaDelete("answer"); err != nil {
+				t.Errorf("expected no error deleting metadata, got %s", err)
+			}
+			if _, err := db.MetaRead("answer"); err == nil {
+				t.Error("expected error reading a deleted metadata key, got nil")
+			}
 			if err := db.CreateExtraIndexes([]string{"teste.index1"}); err == nil {
 				t.Error("expected errors running extra indexes, got nil")
 			}
@@ -162,29 +256,31 @@ func TestSearch(t *testing.T) {
 		}
 		m.Close()
 	}()
-	for _, tc := range []testCase{
-		{map[string][]string{"uf": {"sc"}}, 0},
-		{map[string][]string{"uf": {"sp"}}, 1},
-		{map[string][]string{"uf": {"sp", "sc"}}, 1},
-		{map[string][]string{"municipio": {"6105"}}, 0},
-		{map[string][]string{"municipio": {"3500303"}}, 0},
-		{map[string][]string{"municipio": {"7107"}}, 1},
-		{map[string][]string{"municipio": {"3550308"}}, 1},
-		{map[string][]string{"municipio": {"3550308", "3500303"}}, 1},
-		{map[string][]string{"municipio": {"6105", "7107"}}, 1},
-		{map[string][]string{"natureza_juridica": {"2143"}}, 0},
-		{map[string][]string{"natureza_juridica": {"3999"}}, 1},
-		{map[string][]string{"natureza_juridica": {"3999", "2143"}}, 1},
-		{map[string][]string{"cnae_fiscal": {"6204000"}}, 0},
-		{map[string][]string{"cnae_fiscal": {"9430800"}}, 1},
-		{map[string][]string{"cnae_fiscal": {"9430800", "6204000"}}, 1},
-		{map[string][]string{"cnae": {"722702"}}, 0},
-		{map[string][]string{"cnae": {"6204000"}}, 1},
-		{map[string][]string{"cnae": {"9430800", "6204000"}}, 1},
-		{map[string][]string{"cnpf": {"21449073000135"}}, 0},
-		{map[string][]string{"cnpf": {"***112108**"}}, 1},
-		{map[string][]string{"cnpf": {"21449073000135", "***112108**"}}, 1},
-	} {
+	my, err := setUpMySQL(id, c)
+	if err != nil {
+		t.Errorf("expected no error setting up mysql, got %s", err)
+		return
+	}
+	defer func() {
+		if err := my.Drop(); err != nil {
+			t.Errorf("expected no error dropping the tables, got %s", err)
+		}
+		my.Close()
+	}()
+	for _, tc := range searchCases {
+		for _, db := range []database{pg, m, my} {
+			t.Run(tc.name(db), func(t *testing.T) {
+				q := NewQuery(tc.params)
+				s, err := db.Search(context.Background(), q)
+				if err != nil {
+					t.Errorf("expected no error searching, got %s", err)
+					return
+				}
+				assertSearchCount(t, s, tc)
+			})
+		}
+	}
+	for _, tc := range negationCases {
 		for _, db := range []database{pg, m} {
 			t.Run(tc.name(db), func(t *testing.T) {
 				q := NewQuery(tc.params)
@@ -197,4 +293,10 @@ func TestSearch(t *testing.T) {
 			})
 		}
 	}
+	t.Run("unsupported", func(t *testing.T) {
+		q := NewQuery(negationCases[0].params)
+		if _, err := my.Search(context.Background(), q); !errors.Is(err, ErrUnsupportedQuery) {
+			t.Errorf("expected unsupported query error, got %v", err)
+		}
+	})
 }
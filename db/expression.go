@@ -0,0 +1,380 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/cuducos/minha-receita/transform"
+)
+
+// The search expression (the `q` parameter) is a small query language such as
+// `uf:SP AND (cnae_fiscal:6201501 OR cnae:6202300) AND NOT situacao:BAIXADA`,
+// compiled to the same filters as the other search parameters. Conditions are
+// a field, an operator (`:` for equality, with comma-separated values, or one
+// of `>`, `>=`, `<` and `<=`) and a value, combined with AND, OR, NOT and
+// parenthesis. Fields are limited to the extra indexes created by `transform`
+// (and aliases to them, as the URL parameters), so every search uses indexes.
+
+const (
+	maxExpressionLength = 1024
+	maxExpressionTerms  = 32 // values compared, across all conditions
+	maxExpressionDepth  = 8  // nested parenthesis and NOT
+)
+
+// expressionAliases are fields that are not indexes themselves, but are
+// compiled to filters on indexes, as the URL parameters with the same names.
+var expressionAliases = []string{"cnae", "cnpf", "municipio", "natureza_juridica", "situacao"}
+
+// situacoes maps the descriptions of the situacao_cadastral codes to the codes.
+var situacoes = map[string]uint32{"NULA": 1, "ATIVA": 2, "SUSPENSA": 3, "INAPTA": 4, "BAIXADA": 8}
+
+// companyFieldKind returns the kind of a field (e.g. qsa.cnpj_cpf_do_socio)
+// of `transform.Company`, or reflect.Invalid if there is no such field.
+func companyFieldKind(f string) reflect.Kind {
+	t := reflect.TypeFor[transform.Company]()
+	for n := range strings.SplitSeq(f, ".") {
+		for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return reflect.Invalid
+		}
+		var found bool
+		for i := range t.NumField() {
+			f := t.Field(i)
+			if strings.Split(f.Tag.Get("json"), ",")[0] == n {
+				t = f.Type
+				found = true
+				break
+			}
+		}
+		if !found {
+			return reflect.Invalid
+		}
+	}
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t.Kind()
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenOperator
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func isWordRune(r rune) bool {
+	return !unicode.IsSpace(r) && !strings.ContainsRune("():<>=", r)
+}
+
+func tokenize(s string) ([]token, error) {
+	var ts []token
+	rs := []rune(s)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			ts = append(ts, token{tokenOpen, "(", i})
+			i++
+		case r == ')':
+			ts = append(ts, token{tokenClose, ")", i})
+			i++
+		case r == ':':
+			ts = append(ts, token{tokenOperator, ":", i})
+			i++
+		case r == '<' || r == '>':
+			op := string(r)
+			if i+1 < len(rs) && rs[i+1] == '=' {
+				op += "="
+			}
+			ts = append(ts, token{tokenOperator, op, i})
+			i += len(op)
+		case r == '=':
+			return nil, fmt.Errorf("%w: unexpected = at position %d, use : for equality", ErrInvalidExpression, i)
+		default:
+			j := i
+			for j < len(rs) && isWordRune(rs[j]) {
+				j++
+			}
+			ts = append(ts, token{tokenWord, string(rs[i:j]), i})
+			i = j
+		}
+	}
+	return ts, nil
+}
+
+type expressionParser struct {
+	tokens []token
+	pos    int
+	depth  int
+	terms  int
+}
+
+func (p *expressionParser) peek() *token {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+	return &p.tokens[p.pos]
+}
+
+func (p *expressionParser) keyword(k string) bool {
+	t := p.peek()
+	if t == nil || t.kind != tokenWord || !strings.EqualFold(t.text, k) {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+func (p *expressionParser) unexpected() error {
+	t := p.peek()
+	if t == nil {
+		return fmt.Errorf("%w: unexpected end of the search expression", ErrInvalidExpression)
+	}
+	return fmt.Errorf("%w: unexpected %s at position %d", ErrInvalidExpression, t.text, t.pos)
+}
+
+func (p *expressionParser) nest() error {
+	p.depth++
+	if p.depth > maxExpressionDepth {
+		return &ExpensiveQueryError{Limit: "depth", Max: maxExpressionDepth}
+	}
+	return nil
+}
+
+func (p *expressionParser) or() (Filter, error) {
+	f, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	o := Or{f}
+	for p.keyword("OR") {
+		f, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		o = append(o, f)
+	}
+	if len(o) == 1 {
+		return o[0], nil
+	}
+	return o, nil
+}
+
+func (p *expressionParser) and() (Filter, error) {
+	f, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	a := And{f}
+	for p.keyword("AND") {
+		f, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, f)
+	}
+	if len(a) == 1 {
+		return a[0], nil
+	}
+	return a, nil
+}
+
+func (p *expressionParser) unary() (Filter, error) {
+	if p.keyword("NOT") {
+		if err := p.nest(); err != nil {
+			return nil, err
+		}
+		f, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		p.depth--
+		return Not{f}, nil
+	}
+	t := p.peek()
+	if t != nil && t.kind == tokenOpen {
+		p.pos++
+		if err := p.nest(); err != nil {
+			return nil, err
+		}
+		f, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.peek(); t == nil || t.kind != tokenClose {
+			return nil, p.unexpected()
+		}
+		p.pos++
+		p.depth--
+		return f, nil
+	}
+	return p.condition()
+}
+
+func (p *expressionParser) condition() (Filter, error) {
+	var ts [3]token
+	for i, k := range []tokenKind{tokenWord, tokenOperator, tokenWord} {
+		t := p.peek()
+		if t == nil || t.kind != k {
+			return nil, p.unexpected()
+		}
+		ts[i] = *t
+		p.pos++
+	}
+	f, op, v := strings.ToLower(ts[0].text), ts[1].text, ts[2].text
+	vs := []string{v}
+	if op == ":" {
+		vs = strings.Split(v, ",")
+	}
+	p.terms += len(vs)
+	if p.terms > maxExpressionTerms {
+		return nil, &ExpensiveQueryError{Limit: "values", Max: maxExpressionTerms}
+	}
+	return expressionFilter(f, op, vs)
+}
+
+// expressionFilter is the filter for a condition of the search expression.
+func expressionFilter(f, op string, vs []string) (Filter, error) {
+	switch f {
+	case "cnae":
+		if op != ":" {
+			return nil, fmt.Errorf("%w: cnae only accepts :", ErrInvalidExpression)
+		}
+		ns, err := expressionValues("cnae_fiscal", vs)
+		if err != nil {
+			return nil, err
+		}
+		return Or{match("cnae_fiscal", ns), Contains{"cnaes_secundarios", "codigo", ns}}, nil
+	case "municipio": // IBGE or SIAFI
+		a, err := expressionFilter("codigo_municipio", op, vs)
+		if err != nil {
+			return nil, err
+		}
+		b, err := expressionFilter("codigo_municipio_ibge", op, vs)
+		if err != nil {
+			return nil, err
+		}
+		return Or{a, b}, nil
+	case "natureza_juridica":
+		f = "codigo_natureza_juridica"
+	case "cnpf":
+		f = "qsa.cnpj_cpf_do_socio"
+	case "situacao":
+		f = "situacao_cadastral"
+	}
+	if !slices.Contains(transform.ExtraIndexes(), f) {
+		return nil, fmt.Errorf(
+			"%w: %s cannot be searched, use one of: %s",
+			ErrInvalidExpression,
+			f,
+			strings.Join(slices.Sorted(slices.Values(slices.Concat(transform.ExtraIndexes(), expressionAliases))), ", "),
+		)
+	}
+	as, err := expressionValues(f, vs)
+	if err != nil {
+		return nil, err
+	}
+	if a, n, ok := strings.Cut(f, "."); ok {
+		if op != ":" {
+			return nil, fmt.Errorf("%w: %s only accepts :", ErrInvalidExpression, f)
+		}
+		return Contains{a, n, as}, nil
+	}
+	switch op {
+	case ">":
+		return Range{Field: f, Gt: as[0]}, nil
+	case ">=":
+		return Range{Field: f, Gte: as[0]}, nil
+	case "<":
+		return Range{Field: f, Lt: as[0]}, nil
+	case "<=":
+		return Range{Field: f, Lte: as[0]}, nil
+	}
+	return match(f, as), nil
+}
+
+// expressionValues converts the values to the type of the field in
+// `transform.Company`.
+func expressionValues(f string, vs []string) ([]any, error) {
+	k := companyFieldKind(f)
+	r := make([]any, len(vs))
+	for i, v := range vs {
+		v = strings.ToUpper(strings.TrimSpace(v))
+		if v == "" {
+			return nil, fmt.Errorf("%w: empty value for %s", ErrInvalidExpression, f)
+		}
+		switch k {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if c, ok := situacoes[v]; ok && f == "situacao_cadastral" {
+				r[i] = c
+				continue
+			}
+			n, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s expects a number, got %s", ErrInvalidExpression, f, v)
+			}
+			r[i] = uint32(n)
+		case reflect.Float32, reflect.Float64:
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s expects a number, got %s", ErrInvalidExpression, f, v)
+			}
+			r[i] = n
+		default:
+			r[i] = v
+		}
+	}
+	return r, nil
+}
+
+// selective tells if a filter narrows the search down using an index, i.e. it
+// is not only made of negations, which would scan every company.
+func selective(f Filter) bool {
+	switch f := f.(type) {
+	case And:
+		return slices.ContainsFunc(f, selective)
+	case Or:
+		return len(f) > 0 && !slices.ContainsFunc(f, func(f Filter) bool { return !selective(f) })
+	case Not, nil:
+		return false
+	}
+	return true
+}
+
+// parseExpression compiles a search expression into a filter.
+func parseExpression(s string) (Filter, error) {
+	if len(s) > maxExpressionLength {
+		return nil, &ExpensiveQueryError{Limit: "length", Max: maxExpressionLength}
+	}
+	ts, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := expressionParser{tokens: ts}
+	f, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != nil {
+		return nil, p.unexpected()
+	}
+	return f, nil
+}
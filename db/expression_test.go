@@ -0,0 +1,95 @@
+package db
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseExpression(t *testing.T) {
+	for _, c := range []struct {
+		expression string
+		expected   Filter
+	}{
+		{"uf:sp", Eq{"uf", "SP"}},
+		{"uf:SP,rj", In{"uf", []any{"SP", "RJ"}}},
+		{"capital_social>100000", Range{Field: "capital_social", Gt: float64(100000)}},
+		{"capital_social <= 1.5", Range{Field: "capital_social", Lte: 1.5}},
+		{"situacao:BAIXADA", Eq{"situacao_cadastral", uint32(8)}},
+		{"situacao_cadastral:2", Eq{"situacao_cadastral", uint32(2)}},
+		{"natureza_juridica:2062", Eq{"codigo_natureza_juridica", uint32(2062)}},
+		{"cnpf:***112108**", Contains{"qsa", "cnpj_cpf_do_socio", []any{"***112108**"}}},
+		{"cnae:6202300", Or{Eq{"cnae_fiscal", uint32(6202300)}, Contains{"cnaes_secundarios", "codigo", []any{uint32(6202300)}}}},
+		{"municipio:7107", Or{Eq{"codigo_municipio", uint32(7107)}, Eq{"codigo_municipio_ibge", uint32(7107)}}},
+		{"uf:SP or uf:RJ and not situacao:8", Or{Eq{"uf", "SP"}, And{Eq{"uf", "RJ"}, Not{Eq{"situacao_cadastral", uint32(8)}}}}},
+		{
+			"uf:SP AND (cnae_fiscal:6201501 OR cnae:6202300) AND NOT situacao:BAIXADA AND capital_social>100000",
+			And{
+				Eq{"uf", "SP"},
+				Or{
+					Eq{"cnae_fiscal", uint32(6201501)},
+					Or{Eq{"cnae_fiscal", uint32(6202300)}, Contains{"cnaes_secundarios", "codigo", []any{uint32(6202300)}}},
+				},
+				Not{Eq{"situacao_cadastral", uint32(8)}},
+				Range{Field: "capital_social", Gt: float64(100000)},
+			},
+		},
+	} {
+		t.Run(c.expression, func(t *testing.T) {
+			got, err := parseExpression(c.expression)
+			if err != nil {
+				t.Fatalf("expected no error parsing %s, got %s", c.expression, err)
+			}
+			if !reflect.DeepEqual(got, c.expected) {
+				t.Errorf("expected %#v, got %#v", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	for _, c := range []struct {
+		expression string
+		expected   error
+	}{
+		{"", ErrInvalidExpression},
+		{"uf", ErrInvalidExpression},
+		{"uf:", ErrInvalidExpression},
+		{"uf=SP", ErrInvalidExpression},
+		{"uf:SP AND", ErrInvalidExpression},
+		{"(uf:SP", ErrInvalidExpression},
+		{"uf:SP)", ErrInvalidExpression},
+		{"uf:SP uf:RJ", ErrInvalidExpression},
+		{"nome_fantasia:ACME", ErrInvalidExpression},
+		{"cnae_fiscal:abc", ErrInvalidExpression},
+		{"cnae>6201501", ErrInvalidExpression},
+		{"cnpf>1", ErrInvalidExpression},
+		{"uf:" + strings.Repeat("SP,", 400) + "RJ", ErrExpensiveQuery},
+		{strings.Repeat("uf:SP OR ", 32) + "uf:RJ", ErrExpensiveQuery},
+		{strings.Repeat("(", 9) + "uf:SP" + strings.Repeat(")", 9), ErrExpensiveQuery},
+	} {
+		t.Run(c.expression, func(t *testing.T) {
+			if _, err := parseExpression(c.expression); !errors.Is(err, c.expected) {
+				t.Errorf("expected %s, got %v", c.expected, err)
+			}
+		})
+	}
+}
+
+func TestQueryFilterExpression(t *testing.T) {
+	q := NewQuery(map[string][]string{"uf": {"sp"}, "q": {"capital_social>=1000"}})
+	exp := And{Eq{"uf", "SP"}, Range{Field: "capital_social", Gte: float64(1000)}}
+	if f := filter(t, q); !reflect.DeepEqual(f, exp) {
+		t.Errorf("expected %#v, got %#v", exp, f)
+	}
+	for _, e := range []string{"NOT uf:SP", "NOT uf:SP OR uf:RJ", "NOT (uf:SP AND uf:RJ)"} {
+		q := NewQuery(map[string][]string{"q": {e}})
+		if err := q.Validate(); !errors.Is(err, ErrExpensiveQuery) {
+			t.Errorf("expected %s to be too expensive, got %v", e, err)
+		}
+	}
+	if err := NewQuery(map[string][]string{"uf": {"sp"}, "q": {"NOT cnae:6201501"}}).Validate(); err != nil {
+		t.Errorf("expected negation with another parameter to be valid, got %s", err)
+	}
+}
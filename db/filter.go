@@ -0,0 +1,147 @@
+package db
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Filter is a node of the expression tree a search query is compiled to
+// before being compiled again, by each database backend, into its own query
+// language (e.g. parameterized SQL or BSON). Fields are the names of the keys
+// in the company JSON.
+type Filter interface{ filter() }
+
+// And matches companies matching all of its filters.
+type And []Filter
+
+// Or matches companies matching any of its filters.
+type Or []Filter
+
+// Not matches companies not matching its filter.
+type Not struct{ Filter Filter }
+
+// Eq matches companies whose field is equal to the value.
+type Eq struct {
+	Field string
+	Value any
+}
+
+// In matches companies whose field is equal to any of the values.
+type In struct {
+	Field  string
+	Values []any
+}
+
+// Range matches companies whose field is within the bounds (nil means no
+// bound).
+type Range struct {
+	Field            string
+	Gt, Gte, Lt, Lte any
+}
+
+// Contains matches companies having, in the list Array, any item whose Field
+// is equal to any of the values (e.g. a secondary CNAE among a list of CNAEs).
+type Contains struct {
+	Array  string
+	Field  string
+	Values []any
+}
+
+func (And) filter()      {}
+func (Or) filter()       {}
+func (Not) filter()      {}
+func (Eq) filter()       {}
+func (In) filter()       {}
+func (Range) filter()    {}
+func (Contains) filter() {}
+
+// fields are interpolated in the queries of some backends (e.g. JSON paths in
+// PostgreSQL), so they are restricted to JSON key names.
+var fieldRegex = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+func validField(f string) error {
+	if !fieldRegex.MatchString(f) {
+		return fmt.Errorf("invalid field name %q", f)
+	}
+	return nil
+}
+
+// match is the filter for a single field with one or more values.
+func match[T any](f string, vs []T) Filter {
+	if len(vs) == 1 {
+		return Eq{f, vs[0]}
+	}
+	return In{f, inArgs(vs)}
+}
+
+// cnae matches the companies with any of the CNAEs, primary or secondary.
+func cnae(vs []uint32) Filter {
+	return Or{match("cnae_fiscal", vs), Contains{"cnaes_secundarios", "codigo", inArgs(vs)}}
+}
+
+// filters returns one filter per parameter, with its values combined with OR,
+// except for the array parameters in the all mode, which get one filter per
+// value.
+func (p *Params) filters(cnaeMode, cnpfMode Mode) []Filter {
+	var fs []Filter
+	if len(p.UF) > 0 {
+		fs = append(fs, match("uf", p.UF))
+	}
+	if len(p.Municipio) > 0 { // IBGE or SIAFI
+		fs = append(fs, Or{match("codigo_municipio", p.Municipio), match("codigo_municipio_ibge", p.Municipio)})
+	}
+	if len(p.NaturezaJuridica) > 0 {
+		fs = append(fs, match("codigo_natureza_juridica", p.NaturezaJuridica))
+	}
+	if len(p.CNAEFiscal) > 0 {
+		fs = append(fs, match("cnae_fiscal", p.CNAEFiscal))
+	}
+	if len(p.CNAE) > 0 { // primary or secondary
+		if cnaeMode == ModeAll {
+			for _, v := range p.CNAE {
+				fs = append(fs, cnae([]uint32{v}))
+			}
+		} else {
+			fs = append(fs, cnae(p.CNAE))
+		}
+	}
+	if len(p.CNPF) > 0 {
+		if cnpfMode == ModeAll {
+			for _, v := range p.CNPF {
+				fs = append(fs, Contains{"qsa", "cnpj_cpf_do_socio", []any{v}})
+			}
+		} else {
+			fs = append(fs, Contains{"qsa", "cnpj_cpf_do_socio", inArgs(p.CNPF)})
+		}
+	}
+	return fs
+}
+
+// Filter compiles the query parameters into a filter: values within a
+// parameter are combined with OR (or AND in the all mode), parameters are
+// combined with AND, and excluded parameters are negated (i.e. companies
+// matching any of the excluded values are left out). The search expression is
+// combined with AND as well. It returns nil if there are no parameters.
+func (q *Query) Filter() (Filter, error) {
+	a := And(q.Params.filters(q.CNAEMode, q.CNPFMode))
+	for _, f := range q.Not.filters(ModeAny, ModeAny) {
+		a = append(a, Not{f})
+	}
+	if q.Expression != "" {
+		f, err := parseExpression(q.Expression)
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, f)
+		if !selective(a) {
+			return nil, &ExpensiveQueryError{Limit: "negated"}
+		}
+	}
+	switch len(a) {
+	case 0:
+		return nil, nil
+	case 1:
+		return a[0], nil
+	}
+	return a, nil
+}
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/huandu/go-sqlbuilder"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// combined has two filters compiled to OR in the same query (municipio and
+// cnae), which used to overwrite each other in MongoDB.
+var combined = map[string][]string{"uf": {"sp"}, "municipio": {"7107"}, "cnae": {"6204000", "722702"}}
+
+// filter compiles the query, failing the test in case of error.
+func filter(t *testing.T, q *Query) Filter {
+	f, err := q.Filter()
+	if err != nil {
+		t.Fatalf("expected no error compiling the query, got %s", err)
+	}
+	return f
+}
+
+func TestQueryFilter(t *testing.T) {
+	if f := filter(t, NewQuery(map[string][]string{"uf": {"sp"}})); !reflect.DeepEqual(f, Eq{"uf", "SP"}) {
+		t.Errorf("expected a single equality, got %#v", f)
+	}
+	exp := And{
+		Eq{"uf", "SP"},
+		Or{Eq{"codigo_municipio", uint32(7107)}, Eq{"codigo_municipio_ibge", uint32(7107)}},
+		Or{
+			In{"cnae_fiscal", []any{uint32(6204000), uint32(722702)}},
+			Contains{"cnaes_secundarios", "codigo", []any{uint32(6204000), uint32(722702)}},
+		},
+	}
+	if f := filter(t, NewQuery(combined)); !reflect.DeepEqual(f, exp) {
+		t.Errorf("expected %#v, got %#v", exp, f)
+	}
+}
+
+func TestQueryFilterNegationAndModes(t *testing.T) {
+	q := NewQuery(map[string][]string{"cnae": {"6201501", "6204000"}, "cnae_mode": {"all"}, "uf!": {"sp"}, "not_uf": {"rj"}})
+	exp := And{
+		Or{Eq{"cnae_fiscal", uint32(6201501)}, Contains{"cnaes_secundarios", "codigo", []any{uint32(6201501)}}},
+		Or{Eq{"cnae_fiscal", uint32(6204000)}, Contains{"cnaes_secundarios", "codigo", []any{uint32(6204000)}}},
+		Not{In{"uf", []any{"RJ", "SP"}}},
+	}
+	if f := filter(t, q); !reflect.DeepEqual(f, exp) {
+		t.Errorf("expected %#v, got %#v", exp, f)
+	}
+	if f := filter(t, NewQuery(map[string][]string{"not_cnpf": {"***112108**"}})); !reflect.DeepEqual(f, Not{Contains{"qsa", "cnpj_cpf_do_socio", []any{"***112108**"}}}) {
+		t.Errorf("expected a single negation, got %#v", f)
+	}
+}
+
+func TestQueryValidate(t *testing.T) {
+	for _, c := range []struct {
+		params map[string][]string
+		valid  bool
+	}{
+		{map[string][]string{"cnae": {"6201501"}, "uf!": {"sp"}}, true},
+		{map[string][]string{"cnae": {"6201501", "6204000"}, "cnae_mode": {"ALL"}}, true},
+		{map[string][]string{"cnpf": {"***112108**"}, "cnpf_mode": {"any"}}, true},
+		{map[string][]string{"uf": {"sp"}, "uf!": {"sp"}}, false},
+		{map[string][]string{"municipio": {"7107"}, "not_municipio": {"7107"}}, false},
+		{map[string][]string{"cnae_fiscal": {"6201501"}, "not_cnae": {"6201501"}}, false},
+		{map[string][]string{"uf": {"sp"}, "cnae_mode": {"all"}}, false},
+		{map[string][]string{"cnae": {"6201501"}, "cnae_mode": {"some"}}, false},
+	} {
+		err := NewQuery(c.params).Validate()
+		if c.valid && err != nil {
+			t.Errorf("expected %v to be valid, got %s", c.params, err)
+		}
+		if !c.valid && !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("expected %v to be invalid, got %v", c.params, err)
+		}
+	}
+}
+
+func TestQueryCheckSupported(t *testing.T) {
+	for _, c := range []struct {
+		params  map[string][]string
+		feature string
+	}{
+		{map[string][]string{"uf": {"sp"}, "cnae": {"6201501", "6204000"}}, ""},
+		{map[string][]string{"uf": {"sp"}, "not_cnae": {"6201501"}, "order_by": {"razao_social"}}, "negation"},
+		{map[string][]string{"cnpf": {"***112108**"}, "cnpf_mode": {"all"}}, "all_mode"},
+		{map[string][]string{"q": {"uf:SP"}}, "q"},
+		{map[string][]string{"uf": {"sp"}, "order_by": {"razao_social"}}, "order_by"},
+	} {
+		err := NewQuery(c.params).checkSupported("MySQL")
+		if c.feature == "" {
+			if err != nil {
+				t.Errorf("expected %v to be supported, got %s", c.params, err)
+			}
+			continue
+		}
+		var u *UnsupportedQueryError
+		if !errors.As(err, &u) || !errors.Is(err, ErrUnsupportedQuery) || u.Feature != c.feature {
+			t.Errorf("expected %v to be unsupported because of %s, got %v", c.params, c.feature, err)
+		}
+	}
+}
+
+func TestPostgresCompileFilter(t *testing.T) {
+	p := PostgreSQL{JSONFieldName: "json"}
+	b := sqlbuilder.PostgreSQL.NewSelectBuilder()
+	c, err := p.compileFilter(b, filter(t, NewQuery(combined)))
+	if err != nil {
+		t.Fatalf("expected no error compiling filter, got %s", err)
+	}
+	s, a := b.Select("json").From("cnpj").Where(c).Build()
+	for _, exp := range []string{
+		"json -> 'uf' = $1::jsonb",
+		"(json -> 'codigo_municipio' = $2::jsonb OR json -> 'codigo_municipio_ibge' = $3::jsonb)",
+		"json -> 'cnae_fiscal' IN ($4::jsonb, $5::jsonb)",
+		"jsonb_path_query_array(json, '$.cnaes_secundarios[*].codigo') @> $6::jsonb",
+		"jsonb_path_query_array(json, '$.cnaes_secundarios[*].codigo') @> $7::jsonb",
+	} {
+		if !strings.Contains(s, exp) {
+			t.Errorf("expected query to contain %s, got %s", exp, s)
+		}
+	}
+	exp := []any{`"SP"`, "7107", "7107", "6204000", "722702", "[6204000]", "[722702]"}
+	if fmt.Sprint(a) != fmt.Sprint(exp) {
+		t.Errorf("expected args %v, got %v", exp, a)
+	}
+
+	for _, f := range []Filter{Eq{"uf'; DROP TABLE cnpj; --", "SP"}, And{}, Range{Field: "capital_social"}} {
+		if _, err := p.compileFilter(b, f); err == nil {
+			t.Errorf("expected error compiling %#v", f)
+		}
+	}
+}
+
+func TestMongoCompileFilter(t *testing.T) {
+	got, err := compileMongoFilter(filter(t, NewQuery(combined)))
+	if err != nil {
+		t.Fatalf("expected no error compiling filter, got %s", err)
+	}
+	vs := bson.A{uint32(6204000), uint32(722702)}
+	exp := bson.M{"$and": bson.A{
+		bson.M{"json.uf": "SP"},
+		bson.M{"$or": bson.A{bson.M{"json.codigo_municipio": uint32(7107)}, bson.M{"json.codigo_municipio_ibge": uint32(7107)}}},
+		bson.M{"$or": bson.A{
+			bson.M{"json.cnae_fiscal": bson.M{"$in": []any(vs)}},
+			bson.M{"json.cnaes_secundarios.codigo": bson.M{"$in": []any(vs)}},
+		}},
+	}}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	got, err = compileMongoFilter(Not{Range{Field: "capital_social", Gt: 100000}})
+	if err != nil {
+		t.Fatalf("expected no error compiling filter, got %s", err)
+	}
+	exp = bson.M{"$nor": bson.A{bson.M{"json.capital_social": bson.M{"$gt": 100000}}}}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
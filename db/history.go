@@ -0,0 +1,70 @@
+package db
+
+import (
+	"encoding/json/v2"
+	"fmt"
+	"time"
+)
+
+// Changes listed in the history of a company.
+const (
+	Inclusion = "inclusao"
+	Change    = "alteracao"
+	Exclusion = "exclusao"
+)
+
+// HistoryEntry is a release in which a company was included, changed or
+// excluded.
+type HistoryEntry struct {
+	Date   string `json:"data"`
+	Change string `json:"mudanca"`
+}
+
+// version is a period in which a company had the same data: since is nil for
+// versions loaded before the history was kept, and until is nil for the
+// current version.
+type version struct {
+	since *time.Time
+	until *time.Time
+}
+
+// history lists the releases in which a company changed, given its versions
+// sorted from the oldest to the current one.
+func history(vs []version) []HistoryEntry {
+	var h []HistoryEntry
+	add := func(t *time.Time, c string) {
+		if t != nil {
+			h = append(h, HistoryEntry{t.Format(time.DateOnly), c})
+		}
+	}
+	for i, v := range vs {
+		switch {
+		case i == 0:
+			add(v.since, Inclusion)
+		case vs[i-1].until != nil && v.since != nil && vs[i-1].until.Equal(*v.since):
+			add(v.since, Change)
+		default:
+			add(vs[i-1].until, Exclusion)
+			add(v.since, Inclusion)
+		}
+	}
+	if len(vs) > 0 {
+		add(vs[len(vs)-1].until, Exclusion)
+	}
+	return h
+}
+
+func historyJSON(id string, vs []version) (string, error) {
+	if len(vs) == 0 {
+		return "", fmt.Errorf("cnpj %s not found", id)
+	}
+	h := history(vs)
+	if h == nil {
+		h = []HistoryEntry{}
+	}
+	b, err := json.Marshal(h)
+	if err != nil {
+		return "", fmt.Errorf("error serializing the history of cnpj %s: %w", id, err)
+	}
+	return string(b), nil
+}
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistoryJSON(t *testing.T) {
+	d := func(s string) *time.Time {
+		t, _ := time.Parse(time.DateOnly, s)
+		return &t
+	}
+	for _, tc := range []struct {
+		desc     string
+		versions []version
+		expected string
+	}{
+		{"loaded before the history", []version{{nil, nil}}, `[]`},
+		{"included", []version{{d("2024-03-15"), nil}}, `[{"data":"2024-03-15","mudanca":"inclusao"}]`},
+		{
+			"changed",
+			[]version{{nil, d("2024-03-15")}, {d("2024-03-15"), d("2024-05-10")}, {d("2024-05-10"), nil}},
+			`[{"data":"2024-03-15","mudanca":"alteracao"},{"data":"2024-05-10","mudanca":"alteracao"}]`,
+		},
+		{
+			"excluded",
+			[]version{{d("2024-03-15"), d("2024-05-10")}},
+			`[{"data":"2024-03-15","mudanca":"inclusao"},{"data":"2024-05-10","mudanca":"exclusao"}]`,
+		},
+		{
+			"excluded and included again",
+			[]version{{nil, d("2024-03-15")}, {d("2024-06-14"), nil}},
+			`[{"data":"2024-03-15","mudanca":"exclusao"},{"data":"2024-06-14","mudanca":"inclusao"}]`,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := historyJSON("33683111000280", tc.versions)
+			if err != nil {
+				t.Errorf("expected no error, got %s", err)
+			}
+			if got != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, got)
+			}
+		})
+	}
+	if _, err := historyJSON("33683111000280", nil); err == nil {
+		t.Error("expected error for a cnpj without versions, got nil")
+	}
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Migrations are embedded files in the migrations directory of each database
+// backend (e.g. postgres/migrations/0002_history.sql), applied in the order of
+// their version number. The version of the last migration applied is saved in
+// the metadata, and databases created from scratch run all the migrations at
+// once, starting in the latest version. Migrations must be safe to run against
+// databases created before the migrations existed (version 0).
+
+// SchemaVersionKey is the metadata key with the version of the last migration
+// applied to the database.
+const SchemaVersionKey = "schema-version"
+
+//go:embed postgres/migrations mongodb/migrations
+var migrationFiles embed.FS
+
+var (
+	migrationRegex    = regexp.MustCompile(`^([0-9]{4})_([a-z0-9_]+)\.(sql|json)$`)
+	ErrSchemaMismatch = errors.New("database schema version mismatch")
+)
+
+// Migration is a file changing the schema of a database.
+type Migration struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	path    string
+}
+
+func (m Migration) String() string { return fmt.Sprintf("%04d_%s", m.Version, m.Name) }
+
+// loadMigrations lists the migrations of a database backend (e.g. postgres),
+// making sure their versions start at 1 and have no gaps.
+func loadMigrations(dir string) ([]Migration, error) {
+	dir = path.Join(dir, "migrations")
+	ls, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error looking for migrations: %w", err)
+	}
+	var ms []Migration
+	for _, f := range ls { // ReadDir returns the files sorted by name
+		g := migrationRegex.FindStringSubmatch(f.Name())
+		if g == nil {
+			return nil, fmt.Errorf("invalid migration file name %s", f.Name())
+		}
+		v, err := strconv.Atoi(g[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version %s: %w", f.Name(), err)
+		}
+		if v != len(ms)+1 {
+			return nil, fmt.Errorf("expected migration version %d, got %s", len(ms)+1, f.Name())
+		}
+		ms = append(ms, Migration{Version: v, Name: g[2], path: path.Join(dir, f.Name())})
+	}
+	return ms, nil
+}
+
+func parseSchemaVersion(v string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version %q: %w", v, err)
+	}
+	return n, nil
+}
+
+// SchemaStatus is the schema version of a database compared to the migrations
+// available.
+type SchemaStatus struct {
+	Current int         `json:"current"`
+	Latest  int         `json:"latest"`
+	Pending []Migration `json:"pending"`
+}
+
+func newSchemaStatus(current int, ms []Migration) SchemaStatus {
+	s := SchemaStatus{Current: current, Latest: len(ms)}
+	for _, m := range ms {
+		if m.Version > current {
+			s.Pending = append(s.Pending, m)
+		}
+	}
+	return s
+}
+
+// Check returns an error if the database schema is not in the latest version.
+func (s SchemaStatus) Check() error {
+	if s.Current > s.Latest {
+		return fmt.Errorf("%w: database is in version %d, newer than the latest migration known by this binary (%d)", ErrSchemaMismatch, s.Current, s.Latest)
+	}
+	if s.Current < s.Latest {
+		return fmt.Errorf("%w: database is in version %d, the latest is %d, run `minha-receita migrate up`", ErrSchemaMismatch, s.Current, s.Latest)
+	}
+	return nil
+}
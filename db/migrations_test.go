@@ -0,0 +1,149 @@
+package db
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	for _, tc := range []struct {
+		dir      string
+		expected []string
+	}{
+		{"postgres", []string{"0001_initial", "0002_history", "0003_meta_key"}},
+		{"mongodb", []string{"0001_initial"}},
+	} {
+		ms, err := loadMigrations(tc.dir)
+		if err != nil {
+			t.Fatalf("expected no error loading %s migrations, got %s", tc.dir, err)
+		}
+		if len(ms) != len(tc.expected) {
+			t.Fatalf("expected %d %s migrations, got %d", len(tc.expected), tc.dir, len(ms))
+		}
+		for i, m := range ms {
+			if m.String() != tc.expected[i] {
+				t.Errorf("expected %s migration %d to be %s, got %s", tc.dir, i, tc.expected[i], m)
+			}
+		}
+	}
+}
+
+func TestSchemaStatus(t *testing.T) {
+	ms := []Migration{{Version: 1, Name: "initial"}, {Version: 2, Name: "history"}}
+	for _, tc := range []struct {
+		current  int
+		pending  int
+		mismatch bool
+	}{
+		{0, 2, true},
+		{1, 1, true},
+		{2, 0, false},
+		{3, 0, true},
+	} {
+		s := newSchemaStatus(tc.current, ms)
+		if s.Latest != 2 {
+			t.Errorf("expected latest version to be 2, got %d", s.Latest)
+		}
+		if len(s.Pending) != tc.pending {
+			t.Errorf("expected %d pending migrations from version %d, got %d", tc.pending, tc.current, len(s.Pending))
+		}
+		if err := s.Check(); errors.Is(err, ErrSchemaMismatch) != tc.mismatch {
+			t.Errorf("expected mismatch to be %t from version %d, got %v", tc.mismatch, tc.current, err)
+		}
+	}
+}
+
+func TestPostgresMigrationTemplates(t *testing.T) {
+	p := PostgreSQL{
+		schema:           "public",
+		CompanyTableName: "cnpj",
+		MetaTableName:    "meta",
+		CursorFieldName:  "cursor",
+		IDFieldName:      "id",
+		JSONFieldName:    "json",
+		HashFieldName:    "hash",
+		SinceFieldName:   "since",
+		UntilFieldName:   "until",
+		KeyFieldName:     "key",
+		ValueFieldName:   "value",
+	}
+	ms, err := loadMigrations("postgres")
+	if err != nil {
+		t.Fatalf("expected no error loading migrations, got %s", err)
+	}
+	for i, expected := range []string{
+		"CREATE UNIQUE INDEX IF NOT EXISTS cnpj_id ON public.cnpj (id);",
+		"ALTER TABLE public.cnpj ADD COLUMN IF NOT EXISTS hash char(64);",
+		"ALTER TABLE public.meta ALTER COLUMN key TYPE text;",
+	} {
+		s, err := p.renderMigration(ms[i])
+		if err != nil {
+			t.Errorf("expected no error rendering %s, got %s", ms[i], err)
+		}
+		if !strings.Contains(s, expected) {
+			t.Errorf("expected %s to contain %q, got %s", ms[i], expected, s)
+		}
+	}
+	s, err := p.migrationsSQL()
+	if err != nil {
+		t.Fatalf("expected no error rendering the migrations, got %s", err)
+	}
+	for _, m := range ms {
+		r, err := p.renderMigration(m)
+		if err != nil {
+			t.Fatalf("expected no error rendering %s, got %s", m, err)
+		}
+		if !strings.Contains(s, r) {
+			t.Errorf("expected the schema to include %s", m)
+		}
+	}
+}
+
+func TestMongoMigrations(t *testing.T) {
+	ms, err := loadMigrations("mongodb")
+	if err != nil {
+		t.Fatalf("expected no error loading migrations, got %s", err)
+	}
+	for _, m := range ms {
+		b, err := migrationFiles.ReadFile(m.path)
+		if err != nil {
+			t.Fatalf("expected no error reading %s, got %s", m, err)
+		}
+		var g mongoMigration
+		if err := bson.UnmarshalExtJSON(b, false, &g); err != nil {
+			t.Errorf("expected no error parsing %s, got %s", m, err)
+		}
+		if len(g.Commands) == 0 {
+			t.Errorf("expected commands in %s", m)
+		}
+	}
+	b, err := migrationFiles.ReadFile(ms[0].path)
+	if err != nil {
+		t.Fatalf("expected no error reading %s, got %s", ms[0], err)
+	}
+	var g struct {
+		Commands []struct {
+			Collection string `bson:"createIndexes"`
+			Indexes    []struct {
+				Key bson.D `bson:"key"`
+			} `bson:"indexes"`
+		} `bson:"commands"`
+	}
+	if err := bson.UnmarshalExtJSON(b, false, &g); err != nil {
+		t.Fatalf("expected no error parsing %s, got %s", ms[0], err)
+	}
+	got := make(map[string]string)
+	for _, c := range g.Commands {
+		for _, i := range c.Indexes {
+			got[c.Collection] = i.Key[0].Key
+		}
+	}
+	m := MongoDB{companies: companyTableName}
+	if expected := m.baseIndexes(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %s to create the indexes %v, got %v", ms[0], expected, got)
+	}
+}
@@ -3,8 +3,11 @@ package db
 import (
 	"context"
 	"encoding/json/v2"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/cuducos/minha-receita/transform"
@@ -20,8 +23,11 @@ type mongoRecord struct {
 }
 
 type MongoDB struct {
-	client *mongo.Client
-	db     *mongo.Database
+	client    *mongo.Client
+	db        *mongo.Database
+	companies string // name of the companies collection
+	shadow    string // release being loaded, see shadow.go
+	releases  *releaseCache
 }
 
 // NewMongoDB initializes a new MongoDB connection wrapped in a structure.
@@ -41,29 +47,36 @@ func NewMongoDB(uri string) (MongoDB, error) {
 	if n == "" || strings.Contains(n, "@") { // ensure the database name is valid
 		return MongoDB{}, fmt.Errorf("no database name found in the uri")
 	}
-	return MongoDB{client: c, db: c.Database(n)}, nil
+	return MongoDB{client: c, db: c.Database(n), companies: companyTableName, releases: &releaseCache{}}, nil
 }
 
 // Create creates the required collections.
 func (m *MongoDB) Create() error {
-	for _, c := range []string{companyTableName, metaTableName} {
+	for _, c := range []string{m.companies, metaTableName} {
 		slog.Info("Creating", "collection", c)
 		if err := m.db.CreateCollection(context.Background(), c); err != nil {
 			return fmt.Errorf("error creating collection %s: %w", c, err)
 		}
 	}
+	ms, err := loadMigrations("mongodb")
+	if err != nil {
+		return err
+	}
+	if err := m.MetaSave(SchemaVersionKey, strconv.Itoa(len(ms))); err != nil {
+		return fmt.Errorf("error saving the schema version: %w", err)
+	}
 	return nil
 }
 
+// baseIndexes maps each collection to its indexed field. The initial migration
+// creates the same indexes, and TestMongoMigrations keeps both in sync.
+func (m *MongoDB) baseIndexes() map[string]string {
+	return map[string]string{m.companies: idFieldName, metaTableName: keyFieldName}
+}
+
 func (m *MongoDB) createIndexes() error {
-	for _, n := range []string{companyTableName, metaTableName} {
+	for n, k := range m.baseIndexes() {
 		c := m.db.Collection(n)
-		var k string
-		if n == metaTableName {
-			k = keyFieldName
-		} else {
-			k = idFieldName
-		}
 		i := []mongo.IndexModel{{Keys: bson.D{{Key: k, Value: 1}}}}
 		_, err := c.Indexes().CreateMany(context.Background(), i)
 		if err != nil {
@@ -75,7 +88,7 @@ func (m *MongoDB) createIndexes() error {
 
 // Drop deletes the collectiosn created by `Create`.
 func (m *MongoDB) Drop() error {
-	for _, n := range []string{companyTableName, metaTableName} {
+	for _, n := range []string{m.companies, metaTableName} {
 		slog.Info("Deleting", "collection", n)
 		c := m.db.Collection(n)
 		if err := c.Drop(context.Background()); err != nil {
@@ -95,7 +108,7 @@ func (m *MongoDB) CreateCompanies(batch [][]string) error {
 	if m == nil {
 		return fmt.Errorf("mongodb connection not initialized")
 	}
-	coll := m.db.Collection(companyTableName)
+	coll := m.db.Collection(m.companies)
 	var cs []any // required by MongoDb pkg
 	for _, c := range batch {
 		if len(c) < 2 {
@@ -122,9 +135,7 @@ func (m *MongoDB) CreateCompanies(batch [][]string) error {
 // MetaSave inserts if the key doesn't exist, or updates the value if it does.
 func (m *MongoDB) MetaSave(k, v string) error {
 	c := m.db.Collection(metaTableName)
-	if len(k) > 16 {
-		return fmt.Errorf("the key can have a maximum of 16 characters")
-	}
+	k = shadowMetaKey(m.shadow != "", k)
 	f := bson.M{"key": k}
 	o := options.Update().SetUpsert(true) // if it does not exist, creates it
 	upd := bson.M{"$set": bson.M{"key": k, "value": v}}
@@ -132,6 +143,9 @@ func (m *MongoDB) MetaSave(k, v string) error {
 	if err != nil {
 		return fmt.Errorf("error saving %s in the meta collection: %w", k, err)
 	}
+	if k == updatedAtKey {
+		m.releases.reset()
+	}
 	return nil
 }
 
@@ -144,13 +158,22 @@ func (m *MongoDB) MetaRead(k string) (string, error) {
 	err := c.FindOne(context.Background(), bson.M{"key": k}).Decode(&result)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return "", fmt.Errorf("metadata key %s not found", k)
+			return "", fmt.Errorf("metadata key %s not found: %w", k, err)
 		}
 		return "", fmt.Errorf("error looking for metadata key %s: %w", k, err)
 	}
 	return result.Value, nil
 }
 
+// MetaDelete removes a key/value pair from the metadata collection.
+func (m *MongoDB) MetaDelete(k string) error {
+	c := m.db.Collection(metaTableName)
+	if _, err := c.DeleteOne(context.Background(), bson.M{"key": k}); err != nil {
+		return fmt.Errorf("error deleting %s from the meta collection: %w", k, err)
+	}
+	return nil
+}
+
 // Close terminates the connection to MongoDB.
 func (m *MongoDB) Close() {
 	if err := m.client.Disconnect(context.Background()); err != nil {
@@ -167,7 +190,7 @@ func (m *MongoDB) PreLoad() error {
 // creates indexes.
 func (m *MongoDB) PostLoad() error {
 	ctx := context.Background()
-	coll := m.db.Collection(companyTableName)
+	coll := m.db.Collection(m.companies)
 	p := mongo.Pipeline{
 		{{Key: "$group", Value: bson.D{
 			{Key: "_id", Value: fmt.Sprintf("$%s", idFieldName)},
@@ -212,7 +235,7 @@ func (m *MongoDB) PostLoad() error {
 }
 
 func (m *MongoDB) GetCompany(id string) (string, error) {
-	coll := m.db.Collection(companyTableName)
+	coll := m.db.Collection(m.companies)
 	var r bson.Raw
 	err := coll.FindOne(context.Background(), bson.M{idFieldName: id}).Decode(&r)
 	if err != nil {
@@ -232,69 +255,131 @@ func (m *MongoDB) GetCompany(id string) (string, error) {
 	return string(b), nil
 }
 
-// Search returns paginated results with JSON for companies bases on a search
-// query
-func (m *MongoDB) Search(ctx context.Context, q *Query) (string, error) {
-	coll := m.db.Collection(companyTableName)
-	f := bson.M{}
-	if len(q.UF) > 0 {
-		if len(q.UF) == 1 {
-			f["json.uf"] = q.UF[0]
-		} else {
-			f["json.uf"] = bson.M{"$in": q.UF}
-		}
-	}
-	if len(q.Municipio) > 0 {
-		if len(q.Municipio) == 1 {
-			f["$or"] = []bson.M{
-				{"json.codigo_municipio": q.Municipio[0]},
-				{"json.codigo_municipio_ibge": q.Municipio[0]},
-			}
-		} else {
-			f["$or"] = []bson.M{
-				{"json.codigo_municipio": bson.M{"$in": q.Municipio}},
-				{"json.codigo_municipio_ibge": bson.M{"$in": q.Municipio}},
-			}
+// GetCompanies returns the JSON of the companies found for a batch of CNPJ
+// numbers, indexed by CNPJ. CNPJs not found are not in the map.
+func (m *MongoDB) GetCompanies(ctx context.Context, ids []string) (map[string]string, error) {
+	coll := m.db.Collection(m.companies)
+	c, err := coll.Find(ctx, bson.M{idFieldName: bson.M{"$in": ids}})
+	if err != nil {
+		return nil, fmt.Errorf("error looking for %d cnpjs: %w", len(ids), err)
+	}
+	defer func() {
+		if err := c.Close(ctx); err != nil {
+			slog.Error("could not close database connection", "error", err)
 		}
+	}()
+	var rs []bson.Raw
+	if err := c.All(ctx, &rs); err != nil {
+		return nil, fmt.Errorf("error decoding results: %w", err)
 	}
-	if len(q.NaturezaJuridica) > 0 {
-		if len(q.NaturezaJuridica) == 1 {
-			f["json.codigo_natureza_juridica"] = q.NaturezaJuridica[0]
-		} else {
-			f["json.codigo_natureza_juridica"] = bson.M{"$in": q.NaturezaJuridica}
+	cs := make(map[string]string, len(rs))
+	for _, r := range rs {
+		id, ok := r.Lookup(idFieldName).StringValueOK()
+		if !ok {
+			return nil, fmt.Errorf("error getting id from result: %s", r)
+		}
+		v, err := r.LookupErr("json")
+		if err != nil {
+			return nil, fmt.Errorf("error getting json for company %s: %w", id, err)
+		}
+		b, err := bson.MarshalExtJSON(v, false, false)
+		if err != nil {
+			return nil, fmt.Errorf("error marshalling json for company %s: %w", id, err)
 		}
+		cs[id] = string(b)
 	}
-	if len(q.CNAEFiscal) > 0 {
-		if len(q.CNAEFiscal) == 1 {
-			f["json.cnae_fiscal"] = q.CNAEFiscal[0]
-		} else {
-			f["json.cnae_fiscal"] = bson.M{"$in": q.CNAEFiscal}
+	return cs, nil
+}
+
+// mongoBackend identifies MongoDB in the search cursors.
+const mongoBackend = "mongodb"
+
+// mongoKeyset is the filter for the companies after the cursor of a sorted
+// search. MongoDB only compares values of the same type with $gt and $lt, so
+// null values (sorted first) are handled explicitly.
+func mongoKeyset(o *order, c *cursor) bson.M {
+	f, v, id := "json."+o.Field, c.Value(), c.CNPJ()
+	switch {
+	case o.Desc && v == nil:
+		return bson.M{f: nil, idFieldName: bson.M{"$lt": id}}
+	case o.Desc:
+		return bson.M{"$or": bson.A{
+			bson.M{f: bson.M{"$lt": v}},
+			bson.M{f: nil},
+			bson.M{f: v, idFieldName: bson.M{"$lt": id}},
+		}}
+	case v == nil:
+		return bson.M{"$or": bson.A{
+			bson.M{f: bson.M{"$ne": nil}},
+			bson.M{f: nil, idFieldName: bson.M{"$gt": id}},
+		}}
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{f: bson.M{"$gt": v}},
+		bson.M{f: v, idFieldName: bson.M{"$gt": id}},
+	}}
+}
+
+// liveRelease is the updated at date of the data being served, or an empty
+// string if the data was not loaded yet.
+func (m *MongoDB) liveRelease() (string, error) {
+	return m.releases.get(func() (string, error) {
+		r, err := m.MetaRead(updatedAtKey)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", nil
 		}
+		return r, err
+	})
+}
+
+// Search returns paginated results with JSON for companies bases on a search
+// query
+func (m *MongoDB) Search(ctx context.Context, q *Query) (string, error) {
+	coll := m.db.Collection(m.companies)
+	o, err := q.order()
+	if err != nil {
+		return "", err
 	}
-	if len(q.CNAE) > 0 {
-		if len(q.CNAE) == 1 {
-			f["$or"] = []bson.M{
-				{"json.cnae_fiscal": q.CNAE[0]},
-				{"json.cnaes_secundarios.codigo": bson.M{"$in": q.CNAE}},
-			}
-		} else {
-			f["$or"] = []bson.M{
-				{"json.cnae_fiscal": bson.M{"$in": q.CNAE}},
-				{"json.cnaes_secundarios.codigo": bson.M{"$in": q.CNAE}},
-			}
+	var r string
+	if q.Cursor != nil && *q.Cursor != "" {
+		if r, err = m.liveRelease(); err != nil {
+			return "", err
 		}
 	}
-	if len(q.CNPF) > 0 {
-		f["json.qsa.cnpj_cpf_do_socio"] = bson.M{"$in": q.CNPF}
+	cur, err := q.cursor(mongoBackend, r)
+	if err != nil {
+		return "", err
+	}
+	var a bson.A
+	qf, err := q.Filter()
+	if err != nil {
+		return "", err
 	}
-	if q.Cursor != nil {
-		id, err := primitive.ObjectIDFromHex(*q.Cursor)
+	if qf != nil {
+		c, err := compileMongoFilter(qf)
 		if err != nil {
-			return "", fmt.Errorf("error parsing cursor: %w", err)
+			return "", fmt.Errorf("error compiling search filter: %w", err)
 		}
-		f["_id"] = bson.M{"$gt": id}
+		a = append(a, c)
 	}
-	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(q.Limit))
+	sort := bson.D{{Key: idFieldName, Value: 1}}
+	if o != nil {
+		d := 1
+		if o.Desc {
+			d = -1
+		}
+		sort = bson.D{{Key: "json." + o.Field, Value: d}, {Key: idFieldName, Value: d}}
+		if cur != nil {
+			a = append(a, mongoKeyset(o, cur))
+		}
+	} else if cur != nil {
+		a = append(a, bson.M{idFieldName: bson.M{"$gt": cur.CNPJ()}})
+	}
+	f := bson.M{}
+	if len(a) > 0 {
+		f["$and"] = a
+	}
+	opts := options.Find().SetSort(sort).SetLimit(int64(q.Limit))
 	c, err := coll.Find(ctx, f, opts)
 	if err != nil {
 		return "", fmt.Errorf("error running query %#v: %w", q, err)
@@ -320,12 +405,20 @@ func (m *MongoDB) Search(ctx context.Context, q *Query) (string, error) {
 		}
 		cs = append(cs, string(b))
 	}
-	var cur string
+	var next string
 	if len(rs) == int(q.Limit) {
-		i := rs[len(rs)-1].Lookup("_id").ObjectID()
-		cur = i.Hex()
+		id, ok := rs[len(rs)-1].Lookup(idFieldName).StringValueOK()
+		if !ok {
+			return "", fmt.Errorf("error getting %s from the last result", idFieldName)
+		}
+		if r, err = m.liveRelease(); err != nil {
+			return "", err
+		}
+		if next, err = newCursor(mongoBackend, r, q, id, cs[len(cs)-1]); err != nil {
+			return "", err
+		}
 	}
-	return newPage(cs, cur), nil
+	return newPage(cs, next), nil
 }
 
 func (m *MongoDB) CreateExtraIndexes(idxs []string) error {
@@ -333,11 +426,15 @@ func (m *MongoDB) CreateExtraIndexes(idxs []string) error {
 		return fmt.Errorf("index name error: %w", err)
 	}
 	slog.Info("Creating the indexes…")
-	c := m.db.Collection(companyTableName)
+	c := m.db.Collection(m.companies)
 	var i []mongo.IndexModel
 	for _, v := range idxs {
+		k := bson.D{{Key: fmt.Sprintf("json.%s", v), Value: 1}}
+		if slices.Contains(sortableFields, v) { // supports order_by
+			k = append(k, bson.E{Key: idFieldName, Value: 1})
+		}
 		i = append(i, mongo.IndexModel{
-			Keys:    bson.D{{Key: fmt.Sprintf("json.%s", v), Value: 1}},
+			Keys:    k,
 			Options: options.Index().SetName(fmt.Sprintf("idx_json.%s", v)),
 		})
 	}
@@ -349,6 +446,221 @@ func (m *MongoDB) CreateExtraIndexes(idxs []string) error {
 	if len(i) > 1 {
 		l = "indexes"
 	}
-	slog.Info(fmt.Sprintf("%d %s successfully created in the collection %s", len(r), l, companyTableName))
+	slog.Info(fmt.Sprintf("%d %s successfully created in the collection %s", len(r), l, m.companies))
+	return nil
+}
+
+func (m *MongoDB) collectionExists(ctx context.Context, n string) (bool, error) {
+	ns, err := m.db.ListCollectionNames(ctx, bson.M{"name": n})
+	if err != nil {
+		return false, fmt.Errorf("error looking for collection %s: %w", n, err)
+	}
+	return len(ns) > 0, nil
+}
+
+func (m *MongoDB) renameCollection(ctx context.Context, from, to string) error {
+	cmd := bson.D{
+		{Key: "renameCollection", Value: fmt.Sprintf("%s.%s", m.db.Name(), from)},
+		{Key: "to", Value: fmt.Sprintf("%s.%s", m.db.Name(), to)},
+		{Key: "dropTarget", Value: true},
+	}
+	if err := m.client.Database("admin").RunCommand(ctx, cmd).Err(); err != nil {
+		return fmt.Errorf("error renaming collection %s to %s: %w", from, to, err)
+	}
+	return nil
+}
+
+// swapCollections renames the live collection (if it exists) to cnpj_previous
+// and the shadow one to cnpj. Unlike the single transaction in PostgreSQL, there
+// is a short window between the two renames with no live collection, and if
+// the second one fails, cnpj_previous is renamed back to cnpj.
+func swapCollections(rename func(string, string) error, shadow string, live bool) error {
+	if live {
+		if err := rename(companyTableName, previousTableName); err != nil {
+			return err
+		}
+	}
+	err := rename(shadow, companyTableName)
+	if err == nil || !live {
+		return err
+	}
+	if e := rename(previousTableName, companyTableName); e != nil {
+		return errors.Join(err, fmt.Errorf("could not restore the live collection: %w", e))
+	}
+	return err
+}
+
+// UseShadow makes the data load write to the collection of a release instead
+// of the live one, creating it from scratch (see shadow.go).
+func (m *MongoDB) UseShadow(r string) error {
+	n, err := shadowTableName(r)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	slog.Info("Loading a shadow release", "collection", n)
+	if err := m.db.Collection(n).Drop(ctx); err != nil {
+		return fmt.Errorf("error deleting collection %s: %w", n, err)
+	}
+	if err := m.db.CreateCollection(ctx, n); err != nil {
+		return fmt.Errorf("error creating collection %s: %w", n, err)
+	}
+	m.shadow = r
+	m.companies = n
+	return nil
+}
+
+// Swap validates the shadow release and, if it is valid, replaces the live
+// collection with it. The former live collection is kept as cnpj_previous.
+func (m *MongoDB) Swap() error {
+	if m.shadow == "" {
+		return fmt.Errorf("no shadow release loaded")
+	}
+	next, err := m.MetaRead(nextUpdatedAtKey)
+	if err != nil {
+		return fmt.Errorf("shadow release %s has no updated at date, was it fully loaded? %w", m.shadow, err)
+	}
+	live, err := m.MetaRead(updatedAtKey)
+	if err != nil {
+		live = "" // no live data yet
+	}
+	if err := validateShadowUpdatedAt(m.shadow, next, live); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	c, err := m.db.Collection(m.companies).CountDocuments(ctx, bson.M{}, options.Count().SetLimit(1))
+	if err != nil {
+		return fmt.Errorf("error checking shadow collection %s: %w", m.companies, err)
+	}
+	if c == 0 {
+		return fmt.Errorf("shadow collection %s is empty", m.companies)
+	}
+	ok, err := m.collectionExists(ctx, companyTableName)
+	if err != nil {
+		return err
+	}
+	slog.Info("Swapping", "live", m.companies, "previous", previousTableName)
+	rename := func(from, to string) error { return m.renameCollection(ctx, from, to) }
+	if err := swapCollections(rename, m.companies, ok); err != nil {
+		return err
+	}
+	m.shadow = ""
+	m.companies = companyTableName
+	if err := m.MetaSave(updatedAtKey, next); err != nil {
+		return err
+	}
+	if live != "" {
+		if err := m.MetaSave(previousUpdatedAtKey, live); err != nil {
+			return err
+		}
+	}
+	if _, err := m.db.Collection(metaTableName).DeleteOne(ctx, bson.M{"key": nextUpdatedAtKey}); err != nil {
+		return fmt.Errorf("error deleting %s from the meta collection: %w", nextUpdatedAtKey, err)
+	}
+	return nil
+}
+
+// Rollback replaces the live collection with the previous release, and
+// vice-versa.
+func (m *MongoDB) Rollback() error {
+	ctx := context.Background()
+	ok, err := m.collectionExists(ctx, previousTableName)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("there is no previous release to roll back to")
+	}
+	live, err := m.MetaRead(updatedAtKey)
+	if err != nil {
+		return fmt.Errorf("error reading the release being rolled back: %w", err)
+	}
+	prev, err := m.MetaRead(previousUpdatedAtKey)
+	if err != nil {
+		return fmt.Errorf("error reading the release to roll back to: %w", err)
+	}
+	slog.Info("Rolling back", "live", companyTableName, "previous", previousTableName)
+	for _, r := range [][2]string{
+		{companyTableName, swapTableName},
+		{previousTableName, companyTableName},
+		{swapTableName, previousTableName},
+	} {
+		if err := m.renameCollection(ctx, r[0], r[1]); err != nil {
+			return err
+		}
+	}
+	if err := m.MetaSave(updatedAtKey, prev); err != nil {
+		return err
+	}
+	return m.MetaSave(previousUpdatedAtKey, live)
+}
+
+// schemaVersion reads the version of the last migration applied, which is 0
+// for databases created before the migrations existed (or not created yet).
+func (m *MongoDB) schemaVersion(ctx context.Context) (int, error) {
+	var r struct {
+		Value string `bson:"value"`
+	}
+	err := m.db.Collection(metaTableName).FindOne(ctx, bson.M{"key": SchemaVersionKey}).Decode(&r)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error reading the schema version: %w", err)
+	}
+	return parseSchemaVersion(r.Value)
+}
+
+// SchemaStatus compares the schema version of the database to the migrations
+// available.
+func (m *MongoDB) SchemaStatus() (SchemaStatus, error) {
+	ms, err := loadMigrations("mongodb")
+	if err != nil {
+		return SchemaStatus{}, err
+	}
+	v, err := m.schemaVersion(context.Background())
+	if err != nil {
+		return SchemaStatus{}, err
+	}
+	return newSchemaStatus(v, ms), nil
+}
+
+// mongoMigration is the content of a migration file: database commands run in
+// order (e.g. createIndexes).
+type mongoMigration struct {
+	Commands []bson.D `bson:"commands"`
+}
+
+// MigrateUp applies the pending migrations, saving the schema version after
+// each one. MongoDB commands are not transactional, so migrations have to be
+// safe to run again if one fails midway.
+func (m *MongoDB) MigrateUp() error {
+	s, err := m.SchemaStatus()
+	if err != nil {
+		return err
+	}
+	if s.Current > s.Latest {
+		return s.Check()
+	}
+	ctx := context.Background()
+	for _, n := range s.Pending {
+		b, err := migrationFiles.ReadFile(n.path)
+		if err != nil {
+			return fmt.Errorf("error reading migration %s: %w", n, err)
+		}
+		var g mongoMigration
+		if err := bson.UnmarshalExtJSON(b, false, &g); err != nil {
+			return fmt.Errorf("error parsing migration %s: %w", n, err)
+		}
+		slog.Info("Applying migration", "migration", n.String())
+		for _, c := range g.Commands {
+			if err := m.db.RunCommand(ctx, c).Err(); err != nil {
+				return fmt.Errorf("error applying migration %s: %w", n, err)
+			}
+		}
+		if err := m.MetaSave(SchemaVersionKey, strconv.Itoa(n.Version)); err != nil {
+			return fmt.Errorf("error saving schema version %d: %w", n.Version, err)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func compileMongoFilters(fs []Filter) (bson.A, error) {
+	if len(fs) == 0 {
+		return nil, fmt.Errorf("empty list of filters")
+	}
+	a := make(bson.A, len(fs))
+	for i, f := range fs {
+		c, err := compileMongoFilter(f)
+		if err != nil {
+			return nil, err
+		}
+		a[i] = c
+	}
+	return a, nil
+}
+
+// compileMongoFilter compiles a filter into a BSON query document on the
+// company JSON (stored under the json key). Logical operators are always
+// explicit, so filters on the same field (or two $or) do not overwrite each
+// other.
+func compileMongoFilter(f Filter) (bson.M, error) {
+	field := func(n string) (string, error) {
+		if err := validField(n); err != nil {
+			return "", err
+		}
+		return "json." + n, nil
+	}
+	switch f := f.(type) {
+	case And:
+		a, err := compileMongoFilters(f)
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{"$and": a}, nil
+	case Or:
+		a, err := compileMongoFilters(f)
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{"$or": a}, nil
+	case Not:
+		c, err := compileMongoFilter(f.Filter)
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{"$nor": bson.A{c}}, nil
+	case Eq:
+		n, err := field(f.Field)
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{n: f.Value}, nil
+	case In:
+		n, err := field(f.Field)
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{n: bson.M{"$in": f.Values}}, nil
+	case Range:
+		n, err := field(f.Field)
+		if err != nil {
+			return nil, err
+		}
+		r := bson.M{}
+		for op, v := range map[string]any{"$gt": f.Gt, "$gte": f.Gte, "$lt": f.Lt, "$lte": f.Lte} {
+			if v != nil {
+				r[op] = v
+			}
+		}
+		if len(r) == 0 {
+			return nil, fmt.Errorf("range on %s without bounds", f.Field)
+		}
+		return bson.M{n: r}, nil
+	case Contains:
+		if err := validField(f.Array); err != nil {
+			return nil, err
+		}
+		if err := validField(f.Field); err != nil {
+			return nil, err
+		}
+		return bson.M{fmt.Sprintf("json.%s.%s", f.Array, f.Field): bson.M{"$in": f.Values}}, nil
+	}
+	return nil, fmt.Errorf("unknown filter %T", f)
+}
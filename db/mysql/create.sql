@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS `{{ .CompanyTableName }}` (
+    `{{ .CursorFieldName }}` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    `{{ .IDFieldName }}` CHAR(14) NOT NULL,
+    `{{ .JSONFieldName }}` JSON NOT NULL,
+    UNIQUE INDEX `{{ .CompanyTableName }}_id` (`{{ .IDFieldName }}`)
+);
+CREATE TABLE IF NOT EXISTS `{{ .MetaTableName }}` (
+    `{{ .KeyFieldName }}` VARCHAR(255) NOT NULL PRIMARY KEY,
+    `{{ .ValueFieldName }}` TEXT NOT NULL
+);
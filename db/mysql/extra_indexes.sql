@@ -0,0 +1,4 @@
+{{ $tableName := .CompanyTableName }}
+{{ range .ExtraIndexes }}
+    CREATE INDEX `idx_{{ .Name }}` ON `{{ $tableName }}` ((CAST({{ .Expression }} AS {{ .Type }} ARRAY)));
+{{ end }}
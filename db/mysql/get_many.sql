@@ -0,0 +1,3 @@
+SELECT c.`{{ .IDFieldName }}`, c.`{{ .JSONFieldName }}`
+FROM JSON_TABLE(?, '$[*]' COLUMNS (`{{ .IDFieldName }}` CHAR(14) PATH '$')) AS ids
+JOIN `{{ .CompanyTableName }}` AS c ON c.`{{ .IDFieldName }}` = ids.`{{ .IDFieldName }}`;
@@ -0,0 +1,2 @@
+DELETE FROM `{{ .MetaTableName }}`
+WHERE `{{ .KeyFieldName }}` = ?;
@@ -0,0 +1,3 @@
+SELECT `{{ .ValueFieldName }}`
+FROM `{{ .MetaTableName }}`
+WHERE `{{ .KeyFieldName }}` = ?;
@@ -0,0 +1,3 @@
+INSERT INTO `{{ .MetaTableName }}` (`{{ .KeyFieldName }}`, `{{ .ValueFieldName }}`)
+VALUES (?, ?)
+ON DUPLICATE KEY UPDATE `{{ .ValueFieldName }}` = VALUES(`{{ .ValueFieldName }}`);
@@ -0,0 +1,2 @@
+ALTER TABLE `{{ .CompanyTableName }}` ADD UNIQUE INDEX `{{ .CompanyTableName }}_id` (`{{ .IDFieldName }}`);
+ANALYZE TABLE `{{ .CompanyTableName }}`;
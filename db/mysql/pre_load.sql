@@ -0,0 +1 @@
+ALTER TABLE `{{ .CompanyTableName }}` DROP INDEX `{{ .CompanyTableName }}_id`;
@@ -0,0 +1,380 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeOpenSearch implements the bits of the OpenSearch REST API used by the
+// backend, keeping documents in memory.
+type fakeOpenSearch struct {
+	mu       sync.Mutex
+	indexes  map[string]map[string]jsontext.Value
+	mappings map[string]map[string]any
+	refresh  []any
+	auth     []string
+}
+
+func newFakeOpenSearch(t *testing.T) (*fakeOpenSearch, string) {
+	f := &fakeOpenSearch{
+		indexes:  make(map[string]map[string]jsontext.Value),
+		mappings: make(map[string]map[string]any),
+	}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, strings.Replace(srv.URL, "http://", "opensearch://admin:secret@", 1) + "/cnpj"
+}
+
+func (f *fakeOpenSearch) write(w http.ResponseWriter, s int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(s)
+	if err := json.MarshalWrite(w, v); err != nil {
+		panic(err)
+	}
+}
+
+func fakeValue(v any) string {
+	if n, ok := v.(float64); ok {
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	return v.(string)
+}
+
+func (f *fakeOpenSearch) matches(c map[string]any, doc map[string]any) bool {
+	if b, ok := c["bool"].(map[string]any); ok {
+		fs, _ := b["filter"].([]any)
+		for _, i := range fs {
+			if !f.matches(i.(map[string]any), doc) {
+				return false
+			}
+		}
+		if s, ok := b["should"].([]any); ok {
+			return slices.ContainsFunc(s, func(i any) bool { return f.matches(i.(map[string]any), doc) })
+		}
+		return true
+	}
+	for fld, vs := range c["terms"].(map[string]any) {
+		got := indexValues(doc, fld)
+		for _, v := range vs.([]any) {
+			if slices.Contains(got, fakeValue(v)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (f *fakeOpenSearch) search(idx string, req map[string]any) []map[string]any {
+	type doc struct {
+		id   string
+		cnpj string
+		data map[string]any
+	}
+	var ds []doc
+	for id, j := range f.indexes[idx] {
+		var d map[string]any
+		if err := json.Unmarshal(j, &d); err != nil {
+			panic(err)
+		}
+		ds = append(ds, doc{id, d["cnpj"].(string), d})
+	}
+	slices.SortFunc(ds, func(a, b doc) int { return strings.Compare(a.cnpj, b.cnpj) })
+	var after string
+	if a, ok := req["search_after"].([]any); ok {
+		after = a[0].(string)
+	}
+	var hs []map[string]any
+	for _, d := range ds {
+		if d.cnpj <= after || !f.matches(req["query"].(map[string]any), d.data) {
+			continue
+		}
+		hs = append(hs, map[string]any{"_id": d.id, "_source": f.indexes[idx][d.id], "sort": []string{d.cnpj}})
+		if len(hs) == int(req["size"].(float64)) {
+			break
+		}
+	}
+	return hs
+}
+
+func (f *fakeOpenSearch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	u, p, _ := r.BasicAuth()
+	f.auth = append(f.auth, u+":"+p)
+	var body bytes.Buffer
+	if _, err := body.ReadFrom(r.Body); err != nil {
+		panic(err)
+	}
+	decode := func() map[string]any {
+		var m map[string]any
+		if err := json.Unmarshal(body.Bytes(), &m); err != nil {
+			panic(err)
+		}
+		return m
+	}
+	ps := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	idx := ps[0]
+	_, exists := f.indexes[idx]
+	switch {
+	case r.URL.Path == "/":
+		f.write(w, http.StatusOK, map[string]any{"version": map[string]string{"distribution": "opensearch"}})
+	case idx == "_bulk":
+		s := bufio.NewScanner(&body)
+		s.Buffer(make([]byte, 1<<20), 1<<20)
+		var items []any
+		for s.Scan() {
+			var a map[string]map[string]string
+			if err := json.Unmarshal(s.Bytes(), &a); err != nil {
+				panic(err)
+			}
+			s.Scan()
+			i := a["index"]
+			f.indexes[i["_index"]][i["_id"]] = slices.Clone(jsontext.Value(s.Bytes()))
+			items = append(items, map[string]any{"index": map[string]any{"_id": i["_id"], "status": 201}})
+		}
+		f.write(w, http.StatusOK, map[string]any{"errors": false, "items": items})
+	case len(ps) == 1 && r.Method == http.MethodHead:
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case len(ps) == 1 && r.Method == http.MethodPut:
+		f.indexes[idx] = make(map[string]jsontext.Value)
+		f.mappings[idx] = decode()["mappings"].(map[string]any)
+		f.write(w, http.StatusOK, map[string]any{"acknowledged": true})
+	case len(ps) == 1 && r.Method == http.MethodDelete:
+		if !exists {
+			f.write(w, http.StatusNotFound, map[string]any{"error": "index_not_found_exception"})
+			return
+		}
+		delete(f.indexes, idx)
+		f.write(w, http.StatusOK, map[string]any{"acknowledged": true})
+	case !exists:
+		f.write(w, http.StatusNotFound, map[string]any{"error": "index_not_found_exception"})
+	case ps[1] == "_settings":
+		f.refresh = append(f.refresh, decode()["index"].(map[string]any)["refresh_interval"])
+		f.write(w, http.StatusOK, map[string]any{"acknowledged": true})
+	case ps[1] == "_refresh":
+		f.write(w, http.StatusOK, map[string]any{})
+	case ps[1] == "_doc" && r.Method == http.MethodDelete:
+		if _, ok := f.indexes[idx][ps[2]]; !ok {
+			f.write(w, http.StatusNotFound, map[string]any{"_id": ps[2], "result": "not_found"})
+			return
+		}
+		delete(f.indexes[idx], ps[2])
+		f.write(w, http.StatusOK, map[string]any{"_id": ps[2], "result": "deleted"})
+	case ps[1] == "_doc" && r.Method == http.MethodPut:
+		f.indexes[idx][ps[2]] = slices.Clone(jsontext.Value(body.Bytes()))
+		f.write(w, http.StatusCreated, map[string]any{"result": "created"})
+	case ps[1] == "_doc":
+		d, ok := f.indexes[idx][ps[2]]
+		if !ok {
+			f.write(w, http.StatusNotFound, map[string]any{"_id": ps[2], "found": false})
+			return
+		}
+		f.write(w, http.StatusOK, map[string]any{"_id": ps[2], "found": true, "_source": d})
+	case ps[1] == "_mget":
+		var docs []any
+		for _, id := range decode()["ids"].([]any) {
+			d, ok := f.indexes[idx][id.(string)]
+			docs = append(docs, map[string]any{"_id": id, "found": ok, "_source": d})
+		}
+		f.write(w, http.StatusOK, map[string]any{"docs": docs})
+	case ps[1] == "_search":
+		f.write(w, http.StatusOK, map[string]any{"hits": map[string]any{"hits": f.search(idx, decode())}})
+	default:
+		f.write(w, http.StatusBadRequest, map[string]any{"error": "unexpected request " + r.Method + " " + r.URL.String()})
+	}
+}
+
+func setUpOpenSearch(t *testing.T, id, c string) (*OpenSearch, *fakeOpenSearch) {
+	f, u := newFakeOpenSearch(t)
+	db, err := NewOpenSearch(u)
+	if err != nil {
+		t.Fatalf("expected no error connecting to opensearch, got %s", err)
+	}
+	t.Cleanup(db.Close)
+	if err := db.Drop(); err != nil {
+		t.Fatalf("expected no error dropping the indexes, got %s", err)
+	}
+	if err := db.Create(); err != nil {
+		t.Fatalf("expected no error creating the indexes, got %s", err)
+	}
+	if err := db.Create(); err != nil {
+		t.Fatalf("expected no error creating the indexes twice, got %s", err)
+	}
+	if err := db.PreLoad(); err != nil {
+		t.Fatalf("expected no error pre load on opensearch, got %s", err)
+	}
+	if err := db.CreateCompanies([][]string{{id, c}}); err != nil {
+		t.Fatalf("expected no error saving a company to opensearch, got %s", err)
+	}
+	if err := db.PostLoad(); err != nil {
+		t.Fatalf("expected no error post load on opensearch, got %s", err)
+	}
+	if err := db.CreateExtraIndexes(searchIndexesForTest); err != nil {
+		t.Fatalf("expected no error creating indexes on opensearch, got %s", err)
+	}
+	return &db, f
+}
+
+func TestOpenSearchRetrieve(t *testing.T) {
+	c := loadCompany(t)
+	db, f := setUpOpenSearch(t, "33683111000280", c)
+	got, err := db.GetCompany("33683111000280")
+	if err != nil {
+		t.Errorf("expected no error getting a company, got %s", err)
+	}
+	assertCompaniesAreEqual(t, got, c)
+	if _, err := db.GetCompany("19131243000197"); err == nil {
+		t.Error("expected error getting a company that does not exist, got nil")
+	}
+	cs, err := db.GetCompanies(context.Background(), []string{"33683111000280", "19131243000197"})
+	if err != nil {
+		t.Errorf("expected no error getting companies, got %s", err)
+	}
+	if len(cs) != 1 {
+		t.Errorf("expected 1 company, got %d", len(cs))
+	}
+	assertCompaniesAreEqual(t, cs["33683111000280"], c)
+	if err := db.MetaSave("answer", "42"); err != nil {
+		t.Errorf("expected no error writing to the metadata index, got %s", err)
+	}
+	if err := db.MetaSave("answer", "forty-two"); err != nil {
+		t.Errorf("expected no error re-writing to the metadata index, got %s", err)
+	}
+	m, err := db.MetaRead("answer")
+	if err != nil {
+		t.Errorf("expected no error getting metadata, got %s", err)
+	}
+	if m != "forty-two" {
+		t.Errorf("expected forty-two as the answer, got %s", m)
+	}
+	if _, err := db.MetaRead("question"); err == nil {
+		t.Error("expected error reading a missing metadata key, got nil")
+	}
+	if err := db.MetaDelete("answer"); err != nil {
+		t.Errorf("expected no error deleting metadata, got %s", err)
+	}
+	if _, err := db.MetaRead("answer"); err == nil {
+		t.Error("expected error reading a deleted metadata key, got nil")
+	}
+	if err := db.MetaDelete("question"); err != nil {
+		t.Errorf("expected no error deleting a missing metadata key, got %s", err)
+	}
+	if err := db.CreateExtraIndexes([]string{"teste.index1"}); err == nil {
+		t.Error("expected errors running extra indexes, got nil")
+	}
+	if len(f.refresh) != 2 || f.refresh[0] != "-1" || f.refresh[1] != nil {
+		t.Errorf("expected refresh interval to be disabled and restored, got %v", f.refresh)
+	}
+	for _, a := range f.auth {
+		if a != "admin:secret" {
+			t.Errorf("expected requests to use the credentials from the uri, got %s", a)
+		}
+	}
+}
+
+func TestOpenSearchMapping(t *testing.T) {
+	_, f := setUpOpenSearch(t, "33683111000280", loadCompany(t))
+	m := f.mappings["cnpj"]
+	if m["dynamic"] != false {
+		t.Errorf("expected dynamic mapping to be disabled, got %v", m["dynamic"])
+	}
+	ps := m["properties"].(map[string]any)
+	for _, tc := range []struct {
+		path     []string
+		expected string
+	}{
+		{[]string{"uf"}, "keyword"},
+		{[]string{"cnae_fiscal"}, "long"},
+		{[]string{"capital_social"}, "double"},
+		{[]string{"opcao_pelo_simples"}, "boolean"},
+		{[]string{"data_inicio_atividade"}, "date"},
+		{[]string{"qsa", "cnpj_cpf_do_socio"}, "keyword"},
+		{[]string{"cnaes_secundarios", "codigo"}, "long"},
+	} {
+		p := ps
+		for _, n := range tc.path[:len(tc.path)-1] {
+			p = p[n].(map[string]any)["properties"].(map[string]any)
+		}
+		f := p[tc.path[len(tc.path)-1]].(map[string]any)
+		if f["type"] != tc.expected {
+			t.Errorf("expected %s to be %s, got %v", strings.Join(tc.path, "."), tc.expected, f["type"])
+		}
+	}
+	if _, ok := ps["razao_social"].(map[string]any)["fields"].(map[string]any)["text"]; !ok {
+		t.Error("expected razao_social to have a text sub-field")
+	}
+}
+
+func TestOpenSearchSearch(t *testing.T) {
+	db, _ := setUpOpenSearch(t, "33683111000280", loadCompany(t))
+	for _, tc := range searchCases {
+		t.Run(tc.name(db), func(t *testing.T) {
+			s, err := db.Search(context.Background(), NewQuery(tc.params))
+			if err != nil {
+				t.Errorf("expected no error searching, got %s", err)
+				return
+			}
+			assertSearchCount(t, s, tc)
+		})
+	}
+}
+
+func TestOpenSearchSearchPagination(t *testing.T) {
+	c := loadCompany(t)
+	db, _ := setUpOpenSearch(t, "33683111000280", c)
+	cs := [][]string{
+		{"33683111000199", strings.Replace(c, `"cnpj": "19131243000197"`, `"cnpj": "33683111000199"`, 1)},
+		{"33683111000400", strings.Replace(c, `"cnpj": "19131243000197"`, `"cnpj": "33683111000400"`, 1)},
+	}
+	if err := db.CreateCompanies(cs); err != nil {
+		t.Fatalf("expected no error saving companies to opensearch, got %s", err)
+	}
+	q := NewQuery(map[string][]string{"uf": {"sp"}, "limit": {"2"}})
+	for i, exp := range []struct {
+		count  int
+		cursor string
+	}{
+		{2, "33683111000199"},
+		{1, ""},
+	} {
+		s, err := db.Search(context.Background(), q)
+		if err != nil {
+			t.Fatalf("expected no error searching page %d, got %s", i+1, err)
+		}
+		var p page
+		if err := json.Unmarshal([]byte(s), &p); err != nil {
+			t.Fatalf("expected no error deserializing page %d, got %s", i+1, err)
+		}
+		if len(p.Data) != exp.count {
+			t.Errorf("expected %d results in page %d, got %d", exp.count, i+1, len(p.Data))
+		}
+		var c string
+		if p.Cursor != nil {
+			c = *p.Cursor
+		}
+		if c != exp.cursor {
+			t.Errorf("expected cursor %q in page %d, got %q", exp.cursor, i+1, c)
+		}
+		q.Cursor = p.Cursor
+	}
+}
+
+func TestNewOpenSearchInvalidURI(t *testing.T) {
+	if _, err := NewOpenSearch("postgres://localhost:9200/cnpj"); err == nil {
+		t.Error("expected error with a postgres uri, got nil")
+	}
+}
@@ -0,0 +1,38 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// sortableFields are the fields search results can be sorted by, each one
+// backed by an extra index including the CNPJ as a tie breaker.
+var sortableFields = []string{"capital_social", "data_inicio_atividade", "razao_social"}
+
+// order is how search results are sorted: by a field of the company JSON,
+// followed by the CNPJ for companies with the same value.
+type order struct {
+	Field string
+	Desc  bool
+}
+
+// order parses the `order_by` parameter, such as `razao_social` or
+// `capital_social:desc`. It returns nil if the results are in the default
+// order (by CNPJ).
+func (q *Query) order() (*order, error) {
+	if q.OrderBy == "" {
+		return nil, nil
+	}
+	f, d, _ := strings.Cut(q.OrderBy, ":")
+	if !slices.Contains(sortableFields, f) {
+		return nil, fmt.Errorf("%w: order_by accepts %s, got %s", ErrInvalidOrder, strings.Join(sortableFields, ", "), f)
+	}
+	switch d {
+	case "", "asc":
+		return &order{f, false}, nil
+	case "desc":
+		return &order{f, true}, nil
+	}
+	return nil, fmt.Errorf("%w: order_by direction must be asc or desc, got %s", ErrInvalidOrder, d)
+}
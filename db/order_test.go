@@ -0,0 +1,105 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/huandu/go-sqlbuilder"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestQueryOrder(t *testing.T) {
+	for _, c := range []struct {
+		orderBy  string
+		expected *order
+	}{
+		{"", nil},
+		{"razao_social", &order{"razao_social", false}},
+		{"Capital_Social:ASC", &order{"capital_social", false}},
+		{"data_inicio_atividade:desc", &order{"data_inicio_atividade", true}},
+	} {
+		q := NewQuery(map[string][]string{"uf": {"sp"}, "order_by": {c.orderBy}})
+		got, err := q.order()
+		if err != nil {
+			t.Errorf("expected no error for order_by=%s, got %s", c.orderBy, err)
+		}
+		if !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("expected %#v for order_by=%s, got %#v", c.expected, c.orderBy, got)
+		}
+	}
+	for _, o := range []string{"uf", "razao_social:up"} {
+		q := NewQuery(map[string][]string{"uf": {"sp"}, "order_by": {o}})
+		if err := q.Validate(); !errors.Is(err, ErrInvalidOrder) {
+			t.Errorf("expected order_by=%s to be invalid, got %v", o, err)
+		}
+	}
+}
+
+func TestPostgresSortedSearchQuery(t *testing.T) {
+	p := PostgreSQL{JSONFieldName: "json", IDFieldName: "id"}
+	q := NewQuery(map[string][]string{"uf": {"sp"}, "order_by": {"capital_social:desc"}})
+	b, err := p.searchQuery(q, &cursor{OrderBy: q.OrderBy, Key: []any{float64(1000), "33683111000280"}})
+	if err != nil {
+		t.Fatalf("expected no error building query, got %s", err)
+	}
+	s, a := b.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	for _, exp := range []string{
+		"(json -> 'capital_social', id) < ($1::jsonb, $2)",
+		"ORDER BY json -> 'capital_social' DESC, id DESC",
+	} {
+		if !strings.Contains(s, exp) {
+			t.Errorf("expected query to contain %s, got %s", exp, s)
+		}
+	}
+	if exp := []any{"1000", "33683111000280"}; fmt.Sprint(a[:2]) != fmt.Sprint(exp) {
+		t.Errorf("expected args to start with %v, got %v", exp, a)
+	}
+}
+
+func TestMongoKeyset(t *testing.T) {
+	id := "33683111000280"
+	for _, c := range []struct {
+		order    order
+		value    any
+		expected bson.M
+	}{
+		{
+			order{"razao_social", false},
+			"ACME",
+			bson.M{"$or": bson.A{
+				bson.M{"json.razao_social": bson.M{"$gt": "ACME"}},
+				bson.M{"json.razao_social": "ACME", idFieldName: bson.M{"$gt": id}},
+			}},
+		},
+		{
+			order{"capital_social", false},
+			nil,
+			bson.M{"$or": bson.A{
+				bson.M{"json.capital_social": bson.M{"$ne": nil}},
+				bson.M{"json.capital_social": nil, idFieldName: bson.M{"$gt": id}},
+			}},
+		},
+		{
+			order{"capital_social", true},
+			float64(1000),
+			bson.M{"$or": bson.A{
+				bson.M{"json.capital_social": bson.M{"$lt": float64(1000)}},
+				bson.M{"json.capital_social": nil},
+				bson.M{"json.capital_social": float64(1000), idFieldName: bson.M{"$lt": id}},
+			}},
+		},
+		{
+			order{"capital_social", true},
+			nil,
+			bson.M{"json.capital_social": nil, idFieldName: bson.M{"$lt": id}},
+		},
+	} {
+		got := mongoKeyset(&c.order, &cursor{Key: []any{c.value, id}})
+		if !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("expected %v, got %v", c.expected, got)
+		}
+	}
+}
@@ -1,9 +1,11 @@
 package db
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -51,47 +53,240 @@ func parseURLParamsToUInt(q []string) []uint32 {
 	return r
 }
 
+// Params are the search filters: values within a parameter are combined with
+// OR (unless the parameter is in the all mode), and parameters are combined
+// with AND.
+type Params struct {
+	CNAE             []uint32 `json:"cnae,omitempty"`
+	CNAEFiscal       []uint32 `json:"cnae_fiscal,omitempty"`
+	CNPF             []string `json:"cnpf,omitempty"`      // CNPJ or CPF in the QSA
+	Municipio        []uint32 `json:"municipio,omitempty"` // IBGE or SIAFI
+	NaturezaJuridica []uint32 `json:"natureza_juridica,omitempty"`
+	UF               []string `json:"uf,omitempty"`
+}
+
+func (p *Params) empty() bool {
+	return len(p.CNAE) == 0 &&
+		len(p.CNAEFiscal) == 0 &&
+		len(p.CNPF) == 0 &&
+		len(p.Municipio) == 0 &&
+		len(p.NaturezaJuridica) == 0 &&
+		len(p.UF) == 0
+}
+
+// Mode is how the values of a multi-valued array filter (cnae and cnpf) are
+// combined: companies matching any of them, or all of them.
+type Mode string
+
+const (
+	ModeAny Mode = "any" // default
+	ModeAll Mode = "all"
+)
+
 type Query struct {
-	CNAE             []uint32
-	CNAEFiscal       []uint32
-	CNPF             []string // CNPJ or CPF in the QSA
-	Municipio        []uint32 // IBGE or SIAFI
-	NaturezaJuridica []uint32
-	UF               []string
-	Cursor           *string
-	Limit            uint32
+	Params
+	Not        Params  `json:"not,omitzero"` // excluded values
+	CNAEMode   Mode    `json:"cnae_mode,omitempty"`
+	CNPFMode   Mode    `json:"cnpf_mode,omitempty"`
+	Expression string  `json:"q,omitempty"` // see parseExpression
+	OrderBy    string  `json:"order_by,omitempty"`
+	Cursor     *string `json:"cursor,omitempty"`
+	Limit      uint32  `json:"limit,omitzero"`
 }
 
 func (q *Query) empty() bool {
-	return len(q.CNAE) == 0 &&
-		len(q.CNAEFiscal) == 0 &&
-		len(q.CNPF) == 0 &&
-		len(q.Municipio) == 0 &&
-		len(q.NaturezaJuridica) == 0 &&
-		len(q.UF) == 0
+	return q.Params.empty() && q.Not.empty() && q.Expression == ""
+}
+
+// ErrInvalidQuery is returned for contradictory or malformed search queries.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// Causes of ErrInvalidQuery, wrapping it, so they can be told apart.
+var (
+	ErrContradictoryFilter = fmt.Errorf("%w: contradictory filter", ErrInvalidQuery)
+	ErrInvalidMode         = fmt.Errorf("%w: invalid mode", ErrInvalidQuery)
+	ErrInvalidExpression   = fmt.Errorf("%w: invalid search expression", ErrInvalidQuery)
+	ErrInvalidOrder        = fmt.Errorf("%w: invalid order", ErrInvalidQuery)
+	ErrInvalidCursor       = fmt.Errorf("%w: invalid cursor", ErrInvalidQuery)
+)
+
+// ErrUnsupportedQuery is returned by databases that cannot run a search query
+// (e.g. negation outside PostgreSQL and MongoDB).
+var ErrUnsupportedQuery = errors.New("unsupported query")
+
+// ErrExpensiveQuery is returned for search expressions that are too long, too
+// complex or that would not use any index.
+var ErrExpensiveQuery = errors.New("expensive query")
+
+// UnsupportedQueryError wraps ErrUnsupportedQuery with the feature of the
+// search query the database cannot run: negation, all_mode (the all mode), q
+// (search expressions), order_by or field (a field not available in the
+// PostgreSQL structured tables, named in Field).
+type UnsupportedQueryError struct {
+	Database string
+	Feature  string
+	Field    string
+}
+
+func (e *UnsupportedQueryError) Error() string {
+	f := map[string]string{
+		"negation": "negation",
+		"all_mode": "the all mode",
+		"q":        "search expressions",
+		"order_by": "order_by",
+		"field":    "the field " + e.Field,
+	}[e.Feature]
+	return fmt.Sprintf("%s: %s does not support %s", ErrUnsupportedQuery, e.Database, f)
+}
+
+func (e *UnsupportedQueryError) Unwrap() error { return ErrUnsupportedQuery }
+
+// ExpensiveQueryError wraps ErrExpensiveQuery with the limit of the search
+// expression that was exceeded: length (characters), values (compared across
+// all conditions), depth (nested parenthesis and NOT) or negated (only
+// negated conditions, which would not use any index). Max is the limit, if
+// any.
+type ExpensiveQueryError struct {
+	Limit string
+	Max   int
 }
 
-func (q *Query) CursorAsInt() (int, error) {
-	if q.Cursor == nil {
-		return 0, nil
+func (e *ExpensiveQueryError) Error() string {
+	var s string
+	switch e.Limit {
+	case "length":
+		s = fmt.Sprintf("search expression longer than %d characters", e.Max)
+	case "values":
+		s = fmt.Sprintf("search expression compares more than %d values", e.Max)
+	case "depth":
+		s = fmt.Sprintf("search expression nested more than %d levels", e.Max)
+	case "negated":
+		s = "the search needs at least one condition that is not negated"
 	}
-	c := *q.Cursor
-	if c == "" {
-		return 0, nil
+	return fmt.Sprintf("%s: %s", ErrExpensiveQuery, s)
+}
+
+func (e *ExpensiveQueryError) Unwrap() error { return ErrExpensiveQuery }
+
+// checkSupported returns an UnsupportedQueryError if the query uses negation,
+// the all mode, a search expression or sorting, which are only supported by
+// the databases compiling the query through Filter.
+func (q *Query) checkSupported(db string) error {
+	var f string
+	switch {
+	case !q.Not.empty():
+		f = "negation"
+	case q.CNAEMode == ModeAll || q.CNPFMode == ModeAll:
+		f = "all_mode"
+	case q.Expression != "":
+		f = "q"
+	case q.OrderBy != "":
+		f = "order_by"
+	default:
+		return nil
 	}
-	return strconv.Atoi(c)
+	return &UnsupportedQueryError{Database: db, Feature: f}
+}
+
+func intersection[T comparable](a, b []T) []T {
+	var r []T
+	for _, v := range a {
+		if slices.Contains(b, v) {
+			r = append(r, v)
+		}
+	}
+	return r
+}
+
+func formatUints(vs []uint32) []string {
+	r := make([]string, len(vs))
+	for i, v := range vs {
+		r[i] = strconv.FormatUint(uint64(v), 10)
+	}
+	return r
+}
+
+// Validate returns an error wrapping ErrInvalidQuery (through one of its
+// causes) if the query cannot match any company, if it has an unknown mode, an
+// invalid search expression or an invalid order, or wrapping ErrExpensiveQuery if the search expression
+// is too expensive.
+func (q *Query) Validate() error {
+	for _, m := range []struct {
+		name string
+		mode Mode
+		used bool
+	}{
+		{"cnae_mode", q.CNAEMode, len(q.CNAE) > 0},
+		{"cnpf_mode", q.CNPFMode, len(q.CNPF) > 0},
+	} {
+		if m.mode != "" && m.mode != ModeAny && m.mode != ModeAll {
+			return fmt.Errorf("%w: %s must be %s or %s, got %s", ErrInvalidMode, m.name, ModeAny, ModeAll, m.mode)
+		}
+		if m.mode != "" && !m.used {
+			return fmt.Errorf("%w: %s without %s", ErrInvalidMode, m.name, strings.TrimSuffix(m.name, "_mode"))
+		}
+	}
+	for _, c := range []struct {
+		name string
+		vs   []string
+	}{
+		{"uf", intersection(q.UF, q.Not.UF)},
+		{"municipio", formatUints(intersection(q.Municipio, q.Not.Municipio))},
+		{"natureza_juridica", formatUints(intersection(q.NaturezaJuridica, q.Not.NaturezaJuridica))},
+		{"cnae_fiscal", formatUints(intersection(q.CNAEFiscal, q.Not.CNAEFiscal))},
+		{"cnae", formatUints(intersection(q.CNAE, q.Not.CNAE))},
+		{"cnae_fiscal", formatUints(intersection(q.CNAEFiscal, q.Not.CNAE))}, // not_cnae excludes the primary CNAE too
+		{"cnpf", intersection(q.CNPF, q.Not.CNPF)},
+	} {
+		if len(c.vs) > 0 {
+			return fmt.Errorf("%w: %s %s both included and excluded", ErrContradictoryFilter, c.name, strings.Join(c.vs, ","))
+		}
+	}
+	if q.Expression != "" {
+		if _, err := q.Filter(); err != nil {
+			return err
+		}
+	}
+	if _, err := q.order(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// negated returns the values of the negated form of a URL parameter, either
+// not_<name>=<value> or <name>!=<value>.
+func negated(v url.Values, k string) []string {
+	return slices.Concat(v["not_"+k], v[k+"!"])
+}
+
+func parseMode(v url.Values, k string) Mode {
+	return Mode(strings.ToLower(strings.TrimSpace(v.Get(k))))
 }
 
 func NewQuery(v url.Values) *Query {
 	q := Query{
-		UF:               parseURLParams(v["uf"]),
-		Municipio:        parseURLParamsToUInt(v["municipio"]),
-		CNPF:             parseURLParams(v["cnpf"]),
-		CNAE:             parseURLParamsToUInt(v["cnae"]),
-		CNAEFiscal:       parseURLParamsToUInt(v["cnae_fiscal"]),
-		NaturezaJuridica: parseURLParamsToUInt(v["natureza_juridica"]),
-		Limit:            defaultLimit,
-		Cursor:           nil,
+		Params: Params{
+			UF:               parseURLParams(v["uf"]),
+			Municipio:        parseURLParamsToUInt(v["municipio"]),
+			CNPF:             parseURLParams(v["cnpf"]),
+			CNAE:             parseURLParamsToUInt(v["cnae"]),
+			CNAEFiscal:       parseURLParamsToUInt(v["cnae_fiscal"]),
+			NaturezaJuridica: parseURLParamsToUInt(v["natureza_juridica"]),
+		},
+		Not: Params{
+			UF:               parseURLParams(negated(v, "uf")),
+			Municipio:        parseURLParamsToUInt(negated(v, "municipio")),
+			CNPF:             parseURLParams(negated(v, "cnpf")),
+			CNAE:             parseURLParamsToUInt(negated(v, "cnae")),
+			CNAEFiscal:       parseURLParamsToUInt(negated(v, "cnae_fiscal")),
+			NaturezaJuridica: parseURLParamsToUInt(negated(v, "natureza_juridica")),
+		},
+		CNAEMode:   parseMode(v, "cnae_mode"),
+		CNPFMode:   parseMode(v, "cnpf_mode"),
+		Expression: strings.TrimSpace(v.Get("q")),
+		OrderBy:    strings.ToLower(strings.TrimSpace(v.Get("order_by"))),
+		Limit:      defaultLimit,
+		Cursor:     nil,
 	}
 	if q.empty() {
 		return nil
@@ -4,14 +4,12 @@ import (
 	"bytes"
 	"context"
 	"embed"
-	"encoding/json/v2"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log/slog"
 	"path/filepath"
-	"reflect"
-	"regexp"
-	"strconv"
+	"slices"
 	"strings"
 	"text/template"
 	"time"
@@ -28,12 +26,15 @@ const (
 	cursorFieldName  = "cursor"
 	idFieldName      = "id"
 	jsonFieldName    = "json"
+	hashFieldName    = "hash"
+	sinceFieldName   = "since"
+	untilFieldName   = "until"
 	keyFieldName     = "key"
 	valueFieldName   = "value"
 )
 
-//go:embed postgres
-var sql embed.FS
+//go:embed postgres sqlite mysql
+var sqlFiles embed.FS
 
 type sqlTemplate struct {
 	path         fs.DirEntry
@@ -41,31 +42,50 @@ type sqlTemplate struct {
 	key          string
 }
 
-func (s *sqlTemplate) render(p *PostgreSQL) (string, error) {
-	t, err := template.ParseFS(sql, s.embeddedPath)
+// render executes the template using the database (e.g. *PostgreSQL) as data.
+func (s *sqlTemplate) render(db any) (string, error) {
+	t, err := template.ParseFS(sqlFiles, s.embeddedPath)
 	if err != nil {
 		return "", fmt.Errorf("error parsing %s template: %w", s.path, err)
 	}
 	var b bytes.Buffer
-	if err = t.Execute(&b, p); err != nil {
+	if err = t.Execute(&b, db); err != nil {
 		return "", fmt.Errorf("error rendering %s template: %w", s.path, err)
 	}
 	return b.String(), nil
 
 }
 
-func newSQLTemplate(f fs.DirEntry) sqlTemplate {
+func newSQLTemplate(dir string, f fs.DirEntry) sqlTemplate {
 	return sqlTemplate{
 		path:         f,
-		embeddedPath: "postgres/" + f.Name(),
+		embeddedPath: dir + "/" + f.Name(),
 		key:          strings.TrimSuffix(f.Name(), filepath.Ext(f.Name())),
 	}
 }
 
+// renderSQLTemplate renders the template named key (the file name without the
+// extension) from the directory of a database backend (e.g. postgres).
+func renderSQLTemplate(dir, key string, db any) (string, error) {
+	ls, err := sqlFiles.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("error looking for templates: %w", err)
+	}
+	for _, f := range ls {
+		s := newSQLTemplate(dir, f)
+		if s.key != key {
+			continue
+		}
+		return s.render(db)
+	}
+	return "", fmt.Errorf("template %s not found", key)
+}
+
 type ExtraIndex struct {
-	IsRoot bool
-	Name   string
-	Value  string
+	IsRoot   bool
+	Sortable bool // includes the CNPJ to support order_by
+	Name     string
+	Value    string
 }
 
 func (e *ExtraIndex) NestedPath() string {
@@ -83,34 +103,40 @@ func (e *ExtraIndex) NestedPath() string {
 
 // PostgreSQL database interface.
 type PostgreSQL struct {
-	pool             *pgxpool.Pool
-	uri              string
-	schema           string
-	getCompanyQuery  string
-	metaReadQuery    string
-	CompanyTableName string
-	MetaTableName    string
-	CursorFieldName  string
-	IDFieldName      string
-	JSONFieldName    string
-	KeyFieldName     string
-	ValueFieldName   string
-	ExtraIndexes     []ExtraIndex
+	pool              *pgxpool.Pool
+	uri               string
+	schema            string
+	getCompanyQuery   string
+	getManyQuery      string
+	metaReadQuery     string
+	stageQuery        string
+	mergeQuery        string
+	updateStageQuery  string
+	updateMergeQuery  string
+	updateRemoveQuery string
+	getAtQuery        string
+	historyQuery      string
+	getStructured     string
+	getManyStructured string
+	CompanyTableName  string
+	MetaTableName     string
+	CursorFieldName   string
+	IDFieldName       string
+	JSONFieldName     string
+	HashFieldName     string
+	SinceFieldName    string
+	UntilFieldName    string
+	KeyFieldName      string
+	ValueFieldName    string
+	ExtraIndexes      []ExtraIndex
+	Structured        bool
+	shadow            string // release being loaded, see shadow.go
+	release           string // updated at date of an incremental update
+	releases          *releaseCache
 }
 
 func (p *PostgreSQL) renderTemplate(key string) (string, error) {
-	ls, err := sql.ReadDir("postgres")
-	if err != nil {
-		return "", fmt.Errorf("error looking for templates: %w", err)
-	}
-	for _, f := range ls {
-		s := newSQLTemplate(f)
-		if s.key != key {
-			continue
-		}
-		return s.render(p)
-	}
-	return "", fmt.Errorf("template %s not found", key)
+	return renderSQLTemplate("postgres", key, p)
 }
 
 // Close closes the PostgreSQL connection
@@ -121,6 +147,17 @@ func (p *PostgreSQL) CompanyTableFullName() string {
 	return fmt.Sprintf("%s.%s", p.schema, p.CompanyTableName)
 }
 
+// HistoryTableFullName is the name of the schema and of the table with the
+// previous versions of the companies.
+func (p *PostgreSQL) HistoryTableFullName() string {
+	return p.TableFullName(companyTableName + "_history")
+}
+
+// TableFullName is the name of the schema and of any table in dot-notation.
+func (p *PostgreSQL) TableFullName(t string) string {
+	return fmt.Sprintf("%s.%s", p.schema, t)
+}
+
 // MetaTableFullName is the name of the schame and table in dot-notation.
 func (p *PostgreSQL) MetaTableFullName() string {
 	return fmt.Sprintf("%s.%s", p.schema, p.MetaTableName)
@@ -129,25 +166,42 @@ func (p *PostgreSQL) MetaTableFullName() string {
 // Create creates the required database table.
 func (p *PostgreSQL) Create() error {
 	slog.Info("Creating", "table", p.CompanyTableFullName())
-	s, err := p.renderTemplate("create")
+	s, err := p.migrationsSQL()
 	if err != nil {
-		return fmt.Errorf("error rendering create template: %w", err)
+		return fmt.Errorf("error rendering the migrations: %w", err)
 	}
 	if _, err := p.pool.Exec(context.Background(), s); err != nil {
 		return fmt.Errorf("error creating table with: %s\n%w", s, err)
 	}
+	if err := p.saveSchemaVersion(); err != nil {
+		return fmt.Errorf("error saving the schema version: %w", err)
+	}
+	if !p.Structured {
+		return nil
+	}
+	slog.Info("Creating structured tables", "schema", p.schema)
+	s, err = p.renderTemplate("structured_create")
+	if err != nil {
+		return fmt.Errorf("error rendering structured create template: %w", err)
+	}
+	if _, err := p.pool.Exec(context.Background(), s); err != nil {
+		return fmt.Errorf("error creating structured tables with: %s\n%w", s, err)
+	}
 	return nil
 }
 
-// Drop drops the database table created by `Create`.
+// Drop drops the database tables created by `Create`, including the
+// structured ones if they exist.
 func (p *PostgreSQL) Drop() error {
 	slog.Info("Dropping", "table", p.CompanyTableFullName())
-	s, err := p.renderTemplate("drop")
-	if err != nil {
-		return fmt.Errorf("error rendering drop template: %w", err)
-	}
-	if _, err := p.pool.Exec(context.Background(), s); err != nil {
-		return fmt.Errorf("error dropping table with: %s\n%w", s, err)
+	for _, k := range []string{"drop", "structured_drop"} {
+		s, err := p.renderTemplate(k)
+		if err != nil {
+			return fmt.Errorf("error rendering %s template: %w", k, err)
+		}
+		if _, err := p.pool.Exec(context.Background(), s); err != nil {
+			return fmt.Errorf("error dropping table with: %s\n%w", s, err)
+		}
 	}
 	return nil
 }
@@ -158,12 +212,12 @@ func (p *PostgreSQL) Drop() error {
 func (p *PostgreSQL) CreateCompanies(batch [][]string) error {
 	b := make([][]any, len(batch))
 	for i, r := range batch {
-		b[i] = []any{r[0], r[1]}
+		b[i] = []any{r[0], r[1], transform.ContentHash(r[1])}
 	}
 	_, err := p.pool.CopyFrom(
 		context.Background(),
 		pgx.Identifier{p.CompanyTableName},
-		[]string{idFieldName, jsonFieldName},
+		[]string{idFieldName, jsonFieldName, hashFieldName},
 		pgx.CopyFromRows(b),
 	)
 	if err != nil {
@@ -172,419 +226,149 @@ func (p *PostgreSQL) CreateCompanies(batch [][]string) error {
 	return nil
 }
 
-// removeNonDigits removes all non-digit characters from a string
-func removeNonDigits(s string) string {
-	re := regexp.MustCompile(`\D`)
-	return re.ReplaceAllString(s, "")
-}
-
-// formatPhones concatenates valid phone numbers separated by comma
-func formatPhones(company *transform.Company) string {
-	var phones []string
-	if company.Telefone1 != "" {
-		phones = append(phones, company.Telefone1)
-	}
-	if company.Telefone2 != "" {
-		phones = append(phones, company.Telefone2)
-	}
-	if company.Fax != "" {
-		phones = append(phones, company.Fax)
-	}
-	return strings.Join(phones, ",")
-}
-
-// formatSecondaryCNAEs concatenates CNAE codes separated by comma
-func formatSecondaryCNAEs(cnaes []transform.CNAE) string {
-	if len(cnaes) == 0 {
-		return ""
+// GetCompany returns the JSON of a company based on a CNPJ number.
+func (p *PostgreSQL) GetCompany(id string) (string, error) {
+	ctx := context.Background()
+	q := p.getCompanyQuery
+	if p.Structured {
+		q = p.getStructured
 	}
-	var codes []string
-	for _, cnae := range cnaes {
-		codes = append(codes, strconv.Itoa(cnae.Codigo))
+	rows, err := p.pool.Query(ctx, q, id)
+	if err != nil {
+		return "", fmt.Errorf("error looking for cnpj %s: %w", id, err)
 	}
-	return strings.Join(codes, ",")
-}
-
-// formatCNAEPrincipal formats CNAE principal as 7-digit string
-func formatCNAEPrincipal(cnae *int) string {
-	if cnae == nil {
-		return ""
+	j, err := pgx.CollectOneRow(rows, pgx.RowTo[string])
+	if err != nil {
+		return "", fmt.Errorf("error reading cnpj %s: %w", id, err)
 	}
-	return fmt.Sprintf("%07d", *cnae)
+	return j, nil
 }
 
-// situacaoCadastralToString converts situacao cadastral code to string
-func situacaoCadastralToString(code *int) string {
-	if code == nil {
-		return ""
-	}
-	switch *code {
-	case 1:
-		return "NULA"
-	case 2:
-		return "ATIVA"
-	case 3:
-		return "SUSPENSA"
-	case 4:
-		return "INAPTA"
-	case 8:
-		return "BAIXADA"
-	default:
-		return ""
+// GetCompanies returns the JSON of the companies found for a batch of CNPJ
+// numbers, indexed by CNPJ. CNPJs not found are not in the map.
+func (p *PostgreSQL) GetCompanies(ctx context.Context, ids []string) (map[string]string, error) {
+	q := p.getManyQuery
+	if p.Structured {
+		q = p.getManyStructured
 	}
-}
-
-// CreateCompaniesStructured inserts companies into business and business_partners tables
-func (p *PostgreSQL) CreateCompaniesStructured(batch [][]string) error {
-	ctx := context.Background()
-	
-	// Begin transaction
-	tx, err := p.pool.Begin(ctx)
+	rows, err := p.pool.Query(ctx, q, ids)
 	if err != nil {
-		return fmt.Errorf("error beginning transaction: %w", err)
+		return nil, fmt.Errorf("error looking for %d cnpjs: %w", len(ids), err)
 	}
-	defer tx.Rollback(ctx)
-
-	// Prepare statements
-	insertBusinessSQL := `INSERT INTO business (
-		cnpj, razao_social, nome_fantasia, situacao_cadastral,
-		cnae_principal, tipo_cnae_principal, cnaes_secundarios,
-		capital_social, natureza_juridica, qualificacao_responsavel,
-		porte_empresa, identificador_matriz_filial,
-		data_situacao_cadastral, motivo_situacao_cadastral,
-		data_inicio_atividade, email,
-		endereco_cep, endereco_numero, endereco_logradouro,
-		endereco_bairro, endereco_cidade, endereco_uf,
-		endereco_tipo, endereco_complemento, telefones
-	) VALUES (
-		$1, $2, $3, $4, $5, $6, $7, $8, $9, $10,
-		$11, $12, $13, $14, $15, $16, $17, $18, $19,
-		$20, $21, $22, $23, $24, $25
-	)
-	ON CONFLICT (cnpj) 
-	DO UPDATE SET 
-		razao_social = EXCLUDED.razao_social,
-		nome_fantasia = EXCLUDED.nome_fantasia,
-		situacao_cadastral = EXCLUDED.situacao_cadastral,
-		cnae_principal = EXCLUDED.cnae_principal,
-		tipo_cnae_principal = EXCLUDED.tipo_cnae_principal,
-		cnaes_secundarios = EXCLUDED.cnaes_secundarios,
-		capital_social = EXCLUDED.capital_social,
-		natureza_juridica = EXCLUDED.natureza_juridica,
-		qualificacao_responsavel = EXCLUDED.qualificacao_responsavel,
-		porte_empresa = EXCLUDED.porte_empresa,
-		identificador_matriz_filial = EXCLUDED.identificador_matriz_filial,
-		data_situacao_cadastral = EXCLUDED.data_situacao_cadastral,
-		motivo_situacao_cadastral = EXCLUDED.motivo_situacao_cadastral,
-		data_inicio_atividade = EXCLUDED.data_inicio_atividade,
-		email = EXCLUDED.email,
-		endereco_cep = EXCLUDED.endereco_cep,
-		endereco_numero = EXCLUDED.endereco_numero,
-		endereco_logradouro = EXCLUDED.endereco_logradouro,
-		endereco_bairro = EXCLUDED.endereco_bairro,
-		endereco_cidade = EXCLUDED.endereco_cidade,
-		endereco_uf = EXCLUDED.endereco_uf,
-		endereco_tipo = EXCLUDED.endereco_tipo,
-		endereco_complemento = EXCLUDED.endereco_complemento,
-		telefones = EXCLUDED.telefones,
-		updated_at = now()
-	RETURNING id`
-
-	// Delete existing partners for companies being updated
-	deletePartnersSQL := `DELETE FROM socios_cnpj WHERE business_id = $1`
-
-	for _, record := range batch {
-		if len(record) < 2 {
-			slog.Warn("skipping invalid record", "record", record)
-			continue
-		}
-
-		// Parse JSON
-		var company transform.Company
-		if err := json.Unmarshal([]byte(record[1]), &company); err != nil {
-			slog.Error("error parsing company JSON", "cnpj", record[0], "error", err)
-			continue
-		}
-
-		// Clean CNPJ
-		cleanCNPJ := removeNonDigits(company.CNPJ)
-		if len(cleanCNPJ) != 14 {
-			slog.Warn("invalid CNPJ length", "cnpj", cleanCNPJ)
-			continue
-		}
-
-		// Prepare business data
-		var capitalSocial *float64
-		if company.CapitalSocial != nil {
-			cs := float64(*company.CapitalSocial)
-			capitalSocial = &cs
-		}
-
-		var naturezaJuridica string
-		if company.CodigoNaturezaJuridica != nil {
-			naturezaJuridica = strconv.Itoa(*company.CodigoNaturezaJuridica)
-		}
-
-		var qualificacaoResponsavel string
-		if company.QualificacaoDoResponsavel != nil {
-			qualificacaoResponsavel = strconv.Itoa(*company.QualificacaoDoResponsavel)
-		}
-
-		var porteEmpresa string
-		if company.CodigoPorte != nil {
-			porteEmpresa = strconv.Itoa(*company.CodigoPorte)
-		}
-
-		identificadorMatrizFilial := "MATRIZ"
-		if company.DescricaoMatrizFilial != nil {
-			identificadorMatrizFilial = *company.DescricaoMatrizFilial
-		} else if company.IdentificadorMatrizFilial != nil && *company.IdentificadorMatrizFilial == 2 {
-			identificadorMatrizFilial = "FILIAL"
-		}
-
-		var motivoSituacaoCadastral string
-		if company.MotivoSituacaoCadastral != nil {
-			motivoSituacaoCadastral = strconv.Itoa(*company.MotivoSituacaoCadastral)
-		}
-
-		cleanCEP := removeNonDigits(company.CEP)
-		if len(cleanCEP) > 8 {
-			cleanCEP = cleanCEP[:8]
-		}
-
-		var enderecoTipo int16 = 0
-		// Map logradouro type to numeric (simplified - can be enhanced)
-		if company.DescricaoTipoDeLogradouro != "" {
-			// Default to 0, can be enhanced with proper mapping
-			enderecoTipo = 0
-		}
-
-		var municipio string
-		if company.Municipio != nil {
-			municipio = *company.Municipio
-		}
-
-		// Insert/Update business
-		var businessID int64
-		err := tx.QueryRow(ctx, insertBusinessSQL,
-			cleanCNPJ,                                    // cnpj
-			company.RazaoSocial,                         // razao_social
-			company.NomeFantasia,                        // nome_fantasia
-			situacaoCadastralToString(company.SituacaoCadastral), // situacao_cadastral
-			formatCNAEPrincipal(company.CNAEFiscal),     // cnae_principal
-			getStringValue(company.CNAEFiscalDescricao), // tipo_cnae_principal
-			formatSecondaryCNAEs(company.CNAESecundarios), // cnaes_secundarios
-			capitalSocial,                               // capital_social
-			naturezaJuridica,                            // natureza_juridica
-			qualificacaoResponsavel,                      // qualificacao_responsavel
-			porteEmpresa,                                // porte_empresa
-			identificadorMatrizFilial,                   // identificador_matriz_filial
-			convertDate(company.DataSituacaoCadastral),  // data_situacao_cadastral
-			motivoSituacaoCadastral,                     // motivo_situacao_cadastral
-			convertDate(company.DataInicioAtividade),     // data_inicio_atividade
-			getStringValue(company.Email),               // email
-			cleanCEP,                                    // endereco_cep
-			company.Numero,                              // endereco_numero
-			company.Logradouro,                          // endereco_logradouro
-			company.Bairro,                              // endereco_bairro
-			municipio,                                   // endereco_cidade
-			company.UF,                                  // endereco_uf
-			enderecoTipo,                                // endereco_tipo
-			company.Complemento,                         // endereco_complemento
-			formatPhones(&company),                      // telefones
-		).Scan(&businessID)
-
-		if err != nil {
-			slog.Error("error inserting business", "cnpj", cleanCNPJ, "error", err)
-			continue
-		}
-
-		// Delete existing partners before inserting new ones
-		// This ensures we don't have duplicates and handles NULL people_id correctly
-		_, err = tx.Exec(ctx, deletePartnersSQL, businessID)
-		if err != nil {
-			slog.Warn("error deleting existing partners", "business_id", businessID, "error", err)
-			// Continue anyway
-		}
-
-		// Insert partners into socios_cnpj table
-		for _, partner := range company.QuadroSocietario {
-			var dataEntrada *time.Time
-			if partner.DataEntradaSociedade != nil {
-				dt := time.Time(*partner.DataEntradaSociedade)
-				dataEntrada = &dt
-			}
-
-			var qualificacao string
-			if partner.QualificaoSocio != nil {
-				qualificacao = *partner.QualificaoSocio
-			}
-
-			// Extract CPF from partner (may be masked like ***220050**)
-			cpfSocio := partner.CNPJCPFDoSocio
-			cleanCPFSocio := removeNonDigits(cpfSocio)
-			// If CPF is not valid (not 11 digits), set to NULL
-			if len(cleanCPFSocio) != 11 {
-				cleanCPFSocio = ""
-			}
-
-			// Insert partner into socios_cnpj
-			var cpfSocioValue interface{}
-			if cleanCPFSocio != "" {
-				cpfSocioValue = cleanCPFSocio
-			} else {
-				cpfSocioValue = nil
-			}
-
-			_, err = tx.Exec(ctx, `INSERT INTO socios_cnpj (
-				business_id, cnpj, nome_socio, cpf_socio, data_entrada_sociedade, qualificacao
-			) VALUES ($1, $2, $3, $4, $5, $6)`,
-				businessID,    // business_id
-				cleanCNPJ,     // cnpj (CNPJ da empresa)
-				partner.NomeSocio, // nome_socio
-				cpfSocioValue, // cpf_socio (pode ser NULL)
-				dataEntrada,   // data_entrada_sociedade
-				qualificacao,  // qualificacao
-			)
-			if err != nil {
-				slog.Warn("error inserting partner", "business_id", businessID, "partner", partner.NomeSocio, "error", err)
-				// Continue with next partner
-			}
-		}
+	type row struct {
+		ID   string
+		JSON string
 	}
-
-	// Commit transaction
-	if err := tx.Commit(ctx); err != nil {
-		return fmt.Errorf("error committing transaction: %w", err)
+	rs, err := pgx.CollectRows(rows, pgx.RowToStructByPos[row])
+	if err != nil {
+		return nil, fmt.Errorf("error reading %d cnpjs: %w", len(ids), err)
 	}
-
-	return nil
-}
-
-// Helper functions
-func getStringValue(s *string) string {
-	if s == nil {
-		return ""
+	cs := make(map[string]string, len(rs))
+	for _, r := range rs {
+		cs[r.ID] = r.JSON
 	}
-	return *s
+	return cs, nil
 }
 
-func convertDate(d interface{}) *time.Time {
-	if d == nil {
+// postgresBackend identifies PostgreSQL in the search cursors.
+const postgresBackend = "postgres"
+
+// sortedSearchQuery sorts the results by the field, using the CNPJ as a tie
+// breaker, and starts after the value and the CNPJ of the last result of the
+// previous page (keyset pagination).
+func (p *PostgreSQL) sortedSearchQuery(b *sqlbuilder.SelectBuilder, o *order, c *cursor) error {
+	f := fmt.Sprintf("%s -> '%s'", p.JSONFieldName, o.Field)
+	op := ">"
+	if o.Desc {
+		op = "<"
+		b.OrderByDesc(f).OrderByDesc(p.IDFieldName)
+	} else {
+		b.OrderByAsc(f).OrderByAsc(p.IDFieldName)
+	}
+	if c == nil {
 		return nil
 	}
-	// date is type date time.Time (an alias), so we can convert it
-	// Use reflection to get the underlying time.Time value
-	v := reflect.ValueOf(d)
-	if v.Kind() == reflect.Ptr {
-		if v.IsNil() {
-			return nil
-		}
-		v = v.Elem()
-	}
-	// date is an alias for time.Time, so convert to time.Time
-	// Since date is not exported, we use reflection to access the underlying value
-	if v.CanInterface() {
-		// date is essentially time.Time, so we can convert it
-		if v.CanConvert(reflect.TypeOf(time.Time{})) {
-			t := v.Convert(reflect.TypeOf(time.Time{})).Interface().(time.Time)
-			return &t
-		}
-		// Try direct conversion if it's already time.Time
-		if t, ok := v.Interface().(time.Time); ok {
-			return &t
-		}
+	v, err := jsonbVar(b, c.Value())
+	if err != nil {
+		return err
 	}
+	b.Where(fmt.Sprintf("(%s, %s) %s (%s, %s)", f, p.IDFieldName, op, v, b.Var(c.CNPJ())))
 	return nil
 }
 
-// GetCompany returns the JSON of a company based on a CNPJ number.
-func (p *PostgreSQL) GetCompany(id string) (string, error) {
-	ctx := context.Background()
-	rows, err := p.pool.Query(ctx, p.getCompanyQuery, id)
-	if err != nil {
-		return "", fmt.Errorf("error looking for cnpj %s: %w", id, err)
-	}
-	j, err := pgx.CollectOneRow(rows, pgx.RowTo[string])
+func (p *PostgreSQL) searchQuery(q *Query, c *cursor) (*sqlbuilder.SelectBuilder, error) {
+	o, err := q.order()
 	if err != nil {
-		return "", fmt.Errorf("error reading cnpj %s: %w", id, err)
+		return nil, err
 	}
-	return j, nil
-}
-
-func (p *PostgreSQL) searchQuery(q *Query) *sqlbuilder.SelectBuilder {
 	b := sqlbuilder.PostgreSQL.NewSelectBuilder()
-	b.Select(p.CursorFieldName, p.JSONFieldName)
+	b.Select(p.IDFieldName, p.JSONFieldName)
 	b.From(p.CompanyTableFullName())
-	b.OrderByAsc(p.CursorFieldName)
 	b.Limit(int(q.Limit))
-	if q.Cursor != nil {
-		c, err := q.CursorAsInt()
-		if err == nil {
-			b.Where(b.GreaterThan(p.CursorFieldName, c))
+	if o != nil {
+		if err := p.sortedSearchQuery(b, o, c); err != nil {
+			return nil, err
 		}
-	}
-	if len(q.UF) > 0 {
-		c := make([]string, len(q.UF))
-		for i, v := range q.UF {
-			c[i] = fmt.Sprintf(`json -> 'uf' = '"%s"'::jsonb`, v)
+	} else {
+		b.OrderByAsc(p.IDFieldName)
+		if c != nil {
+			b.Where(b.GreaterThan(p.IDFieldName, c.CNPJ()))
 		}
-		b.Where(b.Or(c...))
 	}
-	if len(q.Municipio) > 0 {
-		c := make([]string, len(q.Municipio)*2)
-		for i, v := range q.Municipio {
-			c[i] = fmt.Sprintf("json -> 'codigo_municipio' = '%d'::jsonb", v)
-			c[i+len(q.Municipio)] = fmt.Sprintf("json -> 'codigo_municipio_ibge' = '%d'::jsonb", v)
-		}
-		b.Where(b.Or(c...))
-	}
-	if len(q.NaturezaJuridica) > 0 {
-		c := make([]string, len(q.NaturezaJuridica))
-		for i, v := range q.NaturezaJuridica {
-			c[i] = fmt.Sprintf("json -> 'codigo_natureza_juridica' = '%d'::jsonb", v)
-		}
-		b.Where(b.Or(c...))
+	f, err := q.Filter()
+	if err != nil {
+		return nil, err
 	}
-	if len(q.CNAEFiscal) > 0 {
-		c := make([]string, len(q.CNAEFiscal))
-		for i, v := range q.CNAEFiscal {
-			c[i] = fmt.Sprintf("json -> 'cnae_fiscal' = '%d'::jsonb", v)
-		}
-		b.Where(b.Or(c...))
-	}
-	if len(q.CNAE) > 0 {
-		c := make([]string, len(q.CNAE)+1)
-		s := make([]string, len(q.CNAE))
-		for i, v := range q.CNAE {
-			s[i] = fmt.Sprintf("%d", v)
-			c[i] = fmt.Sprintf("json -> 'cnae_fiscal' = '%d'::jsonb", v)
-		}
-		c[len(q.CNAE)] = fmt.Sprintf(
-			"jsonb_path_query_array(json, '$.cnaes_secundarios[*].codigo') @> '[%s]'",
-			strings.Join(s, ","),
-		)
-		b.Where(b.Or(c...))
-	}
-	if len(q.CNPF) > 0 {
-		c := make([]string, len(q.CNPF))
-		for i, v := range q.CNPF {
-			c[i] = fmt.Sprintf(`jsonb_path_query_array(json, '$.qsa[*].cnpj_cpf_do_socio') @> '["%s"]'`, v)
+	if f != nil {
+		c, err := p.compileFilter(b, f)
+		if err != nil {
+			return nil, fmt.Errorf("error compiling search filter: %w", err)
 		}
-		b.Where(b.Or(c...))
+		b.Where(c)
 	}
-	return b
+	return b, nil
 }
 
 type postgresRecord struct {
-	Cursor  int
+	CNPJ    string
 	Company string
 }
 
+// liveRelease is the updated at date of the data being served, or an empty
+// string if the data was not loaded yet.
+func (p *PostgreSQL) liveRelease() (string, error) {
+	return p.releases.get(func() (string, error) {
+		r, err := p.MetaRead(updatedAtKey)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", nil
+		}
+		return r, err
+	})
+}
+
 // Search returns paginated results with JSON for companies bases on a search
 // query
 func (p *PostgreSQL) Search(ctx context.Context, q *Query) (string, error) {
-	s, a := p.searchQuery(q).Build()
+	var r string
+	var err error
+	if q.Cursor != nil && *q.Cursor != "" {
+		if r, err = p.liveRelease(); err != nil {
+			return "", err
+		}
+	}
+	c, err := q.cursor(postgresBackend, r)
+	if err != nil {
+		return "", err
+	}
+	b := p.searchQuery
+	if p.Structured {
+		b = p.structuredSearchQuery
+	}
+	sb, err := b(q, c)
+	if err != nil {
+		return "", err
+	}
+	s, a := sb.Build()
 	slog.Debug("paginated search", "query", s, "args", a)
 	rows, err := p.pool.Query(ctx, s, a...)
 	if err != nil {
@@ -600,7 +384,13 @@ func (p *PostgreSQL) Search(ctx context.Context, q *Query) (string, error) {
 	}
 	var cur string
 	if len(rs) == int(q.Limit) {
-		cur = fmt.Sprintf("%d", rs[len(rs)-1].Cursor)
+		l := rs[len(rs)-1]
+		if r, err = p.liveRelease(); err != nil {
+			return "", err
+		}
+		if cur, err = newCursor(postgresBackend, r, q, l.CNPJ, l.Company); err != nil {
+			return "", err
+		}
 	}
 	return newPage(cs, cur), nil
 
@@ -634,9 +424,7 @@ func (p *PostgreSQL) PostLoad() error {
 
 // MetaSave saves a key/value pair in the metadata table.
 func (p *PostgreSQL) MetaSave(k, v string) error {
-	if len(k) > 16 {
-		return fmt.Errorf("metatable can only take keys that are at maximum 16 chars long")
-	}
+	k = shadowMetaKey(p.shadow != "", k)
 	s, err := p.renderTemplate("meta_save")
 	if err != nil {
 		return fmt.Errorf("error rendering meta-save template: %w", err)
@@ -644,6 +432,9 @@ func (p *PostgreSQL) MetaSave(k, v string) error {
 	if _, err := p.pool.Exec(context.Background(), s, k, v); err != nil {
 		return fmt.Errorf("error saving %s to metadata: %w", k, err)
 	}
+	if k == updatedAtKey {
+		p.releases.reset()
+	}
 	return nil
 }
 
@@ -660,6 +451,18 @@ func (p *PostgreSQL) MetaRead(k string) (string, error) {
 	return v, nil
 }
 
+// MetaDelete removes a key/value pair from the metadata table.
+func (p *PostgreSQL) MetaDelete(k string) error {
+	s, err := p.renderTemplate("meta_delete")
+	if err != nil {
+		return fmt.Errorf("error rendering meta-delete template: %w", err)
+	}
+	if _, err := p.pool.Exec(context.Background(), s, k); err != nil {
+		return fmt.Errorf("error deleting %s from metadata: %w", k, err)
+	}
+	return nil
+}
+
 // CreateExtraIndexes responsible for creating additional indexes in the database
 func (p *PostgreSQL) CreateExtraIndexes(idxs []string) error {
 	if err := transform.ValidateIndexes(idxs); err != nil {
@@ -667,9 +470,10 @@ func (p *PostgreSQL) CreateExtraIndexes(idxs []string) error {
 	}
 	for _, idx := range idxs {
 		i := ExtraIndex{
-			IsRoot: !strings.Contains(idx, "."),
-			Name:   fmt.Sprintf("json.%s", idx),
-			Value:  idx,
+			IsRoot:   !strings.Contains(idx, "."),
+			Sortable: slices.Contains(sortableFields, idx),
+			Name:     fmt.Sprintf("%sjson.%s", indexPrefix(p.CompanyTableName), idx),
+			Value:    idx,
 		}
 		p.ExtraIndexes = append(p.ExtraIndexes, i)
 	}
@@ -684,6 +488,192 @@ func (p *PostgreSQL) CreateExtraIndexes(idxs []string) error {
 	return nil
 }
 
+// indexPrefix is used in the name of the indexes of a table, so tables of
+// different releases do not compete for the same index names.
+func indexPrefix(t string) string {
+	if t == companyTableName {
+		return ""
+	}
+	return t + "_"
+}
+
+type postgresRename struct {
+	From            string
+	To              string
+	FromIndexPrefix string
+	ToIndexPrefix   string
+}
+
+func newPostgresRename(from, to string) postgresRename {
+	return postgresRename{from, to, indexPrefix(from), indexPrefix(to)}
+}
+
+// postgresArchive copies the companies changed or removed by a shadow release
+// to the history table before the swap, as the incremental update does, and
+// keeps the since date of the unchanged ones.
+type postgresArchive struct {
+	Live           string
+	Shadow         string
+	History        string
+	IDFieldName    string
+	JSONFieldName  string
+	HashFieldName  string
+	SinceFieldName string
+	UntilFieldName string
+	UpdatedAt      string
+}
+
+type postgresSwap struct {
+	Schema               string
+	Meta                 string
+	Drop                 string
+	Archive              *postgresArchive
+	Renames              []postgresRename
+	Rollback             bool
+	UpdatedAtKey         string
+	NextUpdatedAtKey     string
+	PreviousUpdatedAtKey string
+}
+
+func (p *PostgreSQL) swap(s postgresSwap) error {
+	s.Schema = p.schema
+	s.Meta = p.MetaTableFullName()
+	s.UpdatedAtKey = updatedAtKey
+	s.NextUpdatedAtKey = nextUpdatedAtKey
+	s.PreviousUpdatedAtKey = previousUpdatedAtKey
+	q, err := renderSQLTemplate("postgres", "swap", s)
+	if err != nil {
+		return fmt.Errorf("error rendering swap template: %w", err)
+	}
+	ctx := context.Background()
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, q); err != nil {
+		return fmt.Errorf("error swapping tables with: %s\n%w", q, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// UseShadow makes the data load write to the table of a release instead of
+// the live one, creating it from scratch (see shadow.go).
+func (p *PostgreSQL) UseShadow(r string) error {
+	if p.Structured {
+		return fmt.Errorf("shadow releases are not supported for the structured tables")
+	}
+	n, err := shadowTableName(r)
+	if err != nil {
+		return err
+	}
+	p.shadow = r
+	p.CompanyTableName = n
+	slog.Info("Loading a shadow release", "table", p.CompanyTableFullName())
+	s, err := p.renderTemplate("shadow_drop")
+	if err != nil {
+		return fmt.Errorf("error rendering shadow drop template: %w", err)
+	}
+	if _, err := p.pool.Exec(context.Background(), s); err != nil {
+		return fmt.Errorf("error dropping shadow table with: %s\n%w", s, err)
+	}
+	return p.Create()
+}
+
+// Swap validates the shadow release and, if it is valid, atomically replaces
+// the live table with it. The former live table is kept as cnpj_previous.
+func (p *PostgreSQL) Swap() error {
+	if p.shadow == "" {
+		return fmt.Errorf("no shadow release loaded")
+	}
+	next, err := p.MetaRead(nextUpdatedAtKey)
+	if err != nil {
+		return fmt.Errorf("shadow release %s has no updated at date, was it fully loaded? %w", p.shadow, err)
+	}
+	live, err := p.MetaRead(updatedAtKey)
+	if err != nil {
+		live = "" // no live data yet
+	}
+	if err := validateShadowUpdatedAt(p.shadow, next, live); err != nil {
+		return err
+	}
+	s, err := p.renderTemplate("shadow_check")
+	if err != nil {
+		return fmt.Errorf("error rendering shadow check template: %w", err)
+	}
+	var ok bool
+	if err := p.pool.QueryRow(context.Background(), s).Scan(&ok); err != nil {
+		return fmt.Errorf("error checking shadow table %s: %w", p.CompanyTableFullName(), err)
+	}
+	if !ok {
+		return fmt.Errorf("shadow table %s is empty", p.CompanyTableFullName())
+	}
+	var exists bool
+	err = p.pool.QueryRow(context.Background(), "SELECT to_regclass($1) IS NOT NULL", p.TableFullName(companyTableName)).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("error looking for %s: %w", p.TableFullName(companyTableName), err)
+	}
+	var a *postgresArchive
+	if exists && live != "" {
+		a = &postgresArchive{
+			Live:           p.TableFullName(companyTableName),
+			Shadow:         p.CompanyTableFullName(),
+			History:        p.HistoryTableFullName(),
+			IDFieldName:    p.IDFieldName,
+			JSONFieldName:  p.JSONFieldName,
+			HashFieldName:  p.HashFieldName,
+			SinceFieldName: p.SinceFieldName,
+			UntilFieldName: p.UntilFieldName,
+			UpdatedAt:      strings.TrimSpace(next),
+		}
+	}
+	slog.Info("Swapping", "live", p.CompanyTableFullName(), "previous", p.TableFullName(previousTableName))
+	err = p.swap(postgresSwap{
+		Drop:    previousTableName,
+		Archive: a,
+		Renames: []postgresRename{
+			newPostgresRename(companyTableName, previousTableName),
+			newPostgresRename(p.CompanyTableName, companyTableName),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	p.shadow = ""
+	p.CompanyTableName = companyTableName
+	p.releases.reset()
+	return nil
+}
+
+// Rollback replaces the live table with the previous release, and vice-versa.
+func (p *PostgreSQL) Rollback() error {
+	var ok bool
+	err := p.pool.QueryRow(context.Background(), "SELECT to_regclass($1) IS NOT NULL", p.TableFullName(previousTableName)).Scan(&ok)
+	if err != nil {
+		return fmt.Errorf("error looking for %s: %w", p.TableFullName(previousTableName), err)
+	}
+	if !ok {
+		return fmt.Errorf("there is no previous release to roll back to")
+	}
+	slog.Info("Rolling back", "live", p.CompanyTableFullName(), "previous", p.TableFullName(previousTableName))
+	err = p.swap(postgresSwap{
+		Renames: []postgresRename{
+			newPostgresRename(companyTableName, swapTableName),
+			newPostgresRename(previousTableName, companyTableName),
+			newPostgresRename(swapTableName, previousTableName),
+		},
+		Rollback: true,
+	})
+	if err != nil {
+		return err
+	}
+	p.releases.reset()
+	return nil
+}
+
 // NewPostgreSQL creates a new PostgreSQL connection and ping it to make sure it works.
 func NewPostgreSQL(uri, schema string) (PostgreSQL, error) {
 	cfg, err := pgxpool.ParseConfig(uri)
@@ -707,17 +697,61 @@ func NewPostgreSQL(uri, schema string) (PostgreSQL, error) {
 		CursorFieldName:  cursorFieldName,
 		IDFieldName:      idFieldName,
 		JSONFieldName:    jsonFieldName,
+		HashFieldName:    hashFieldName,
+		SinceFieldName:   sinceFieldName,
+		UntilFieldName:   untilFieldName,
 		KeyFieldName:     keyFieldName,
 		ValueFieldName:   valueFieldName,
+		releases:         &releaseCache{},
 	}
 	p.getCompanyQuery, err = p.renderTemplate("get")
 	if err != nil {
 		return PostgreSQL{}, fmt.Errorf("error rendering get template: %w", err)
 	}
+	p.getManyQuery, err = p.renderTemplate("get_many")
+	if err != nil {
+		return PostgreSQL{}, fmt.Errorf("error rendering get-many template: %w", err)
+	}
 	p.metaReadQuery, err = p.renderTemplate("meta_read")
 	if err != nil {
 		return PostgreSQL{}, fmt.Errorf("error rendering meta-read template: %w", err)
 	}
+	p.getStructured, err = p.renderTemplate("structured_get")
+	if err != nil {
+		return PostgreSQL{}, fmt.Errorf("error rendering structured get template: %w", err)
+	}
+	p.getManyStructured, err = p.renderTemplate("structured_get_many")
+	if err != nil {
+		return PostgreSQL{}, fmt.Errorf("error rendering structured get-many template: %w", err)
+	}
+	p.stageQuery, err = p.renderTemplate("structured_stage")
+	if err != nil {
+		return PostgreSQL{}, fmt.Errorf("error rendering structured stage template: %w", err)
+	}
+	p.mergeQuery, err = p.renderTemplate("structured_merge")
+	if err != nil {
+		return PostgreSQL{}, fmt.Errorf("error rendering structured merge template: %w", err)
+	}
+	p.updateStageQuery, err = p.renderTemplate("update_stage")
+	if err != nil {
+		return PostgreSQL{}, fmt.Errorf("error rendering update stage template: %w", err)
+	}
+	p.updateMergeQuery, err = p.renderTemplate("update_merge")
+	if err != nil {
+		return PostgreSQL{}, fmt.Errorf("error rendering update merge template: %w", err)
+	}
+	p.updateRemoveQuery, err = p.renderTemplate("update_remove")
+	if err != nil {
+		return PostgreSQL{}, fmt.Errorf("error rendering update remove template: %w", err)
+	}
+	p.getAtQuery, err = p.renderTemplate("get_at")
+	if err != nil {
+		return PostgreSQL{}, fmt.Errorf("error rendering get-at template: %w", err)
+	}
+	p.historyQuery, err = p.renderTemplate("history")
+	if err != nil {
+		return PostgreSQL{}, fmt.Errorf("error rendering history template: %w", err)
+	}
 	if err := p.pool.Ping(context.Background()); err != nil {
 		return PostgreSQL{}, fmt.Errorf("could not connect to postgres: %w", err)
 	}
@@ -1,2 +1,3 @@
 DROP TABLE IF EXISTS {{ .CompanyTableFullName }} CASCADE;
 DROP TABLE IF EXISTS {{ .MetaTableFullName }} CASCADE;
+DROP TABLE IF EXISTS {{ .HistoryTableFullName }} CASCADE;
@@ -1,7 +1,9 @@
 {{ $tableName := .CompanyTableFullName }}
 {{ $jsonField := .JSONFieldName }}
 {{range .ExtraIndexes }}
-    {{ if .IsRoot }}
+    {{ if .Sortable }}
+        CREATE INDEX IF NOT EXISTS "idx_{{ .Name }}" ON {{ $tableName }} USING BTREE (({{ $jsonField }}->'{{ .Value }}'), {{ $.IDFieldName }});
+    {{ else if .IsRoot }}
         CREATE INDEX IF NOT EXISTS "idx_{{ .Name }}" ON {{ $tableName }} USING BTREE (({{ $jsonField }}->'{{ .Value }}'));
     {{ else }}
         CREATE INDEX IF NOT EXISTS "idx_{{ .Name }}" ON {{ $tableName }} USING GIN (
@@ -0,0 +1,12 @@
+SELECT {{ .JSONFieldName }}::text
+FROM (
+    SELECT {{ .JSONFieldName }}, {{ .SinceFieldName }}
+    FROM {{ .CompanyTableFullName }}
+    WHERE {{ .IDFieldName }} = $1 AND ({{ .SinceFieldName }} IS NULL OR {{ .SinceFieldName }} <= $2::date)
+    UNION ALL
+    SELECT {{ .JSONFieldName }}, {{ .SinceFieldName }}
+    FROM {{ .HistoryTableFullName }}
+    WHERE {{ .IDFieldName }} = $1 AND ({{ .SinceFieldName }} IS NULL OR {{ .SinceFieldName }} <= $2::date) AND {{ .UntilFieldName }} > $2::date
+) AS v
+ORDER BY {{ .SinceFieldName }} DESC NULLS LAST
+LIMIT 1
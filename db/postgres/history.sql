@@ -0,0 +1,8 @@
+SELECT {{ .SinceFieldName }}, {{ .UntilFieldName }}
+FROM {{ .HistoryTableFullName }}
+WHERE {{ .IDFieldName }} = $1
+UNION ALL
+SELECT {{ .SinceFieldName }}, NULL
+FROM {{ .CompanyTableFullName }}
+WHERE {{ .IDFieldName }} = $1
+ORDER BY 2 ASC NULLS LAST
@@ -0,0 +1,2 @@
+DELETE FROM {{ .MetaTableFullName }}
+WHERE {{ .KeyFieldName }} = $1;
@@ -7,4 +7,4 @@ CREATE TABLE IF NOT EXISTS {{ .MetaTableFullName }} (
     {{ .KeyFieldName }} char(16) NOT NULL PRIMARY KEY,
     {{ .ValueFieldName }} text NOT NULL
 );
-CREATE UNIQUE INDEX {{ .CompanyTableName }}_id ON {{ .CompanyTableFullName }} ({{ .IDFieldName }});
+CREATE UNIQUE INDEX IF NOT EXISTS {{ .CompanyTableName }}_id ON {{ .CompanyTableFullName }} ({{ .IDFieldName }});
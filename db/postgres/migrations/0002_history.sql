@@ -0,0 +1,9 @@
+ALTER TABLE {{ .CompanyTableFullName }} ADD COLUMN IF NOT EXISTS {{ .HashFieldName }} char(64);
+ALTER TABLE {{ .CompanyTableFullName }} ADD COLUMN IF NOT EXISTS {{ .SinceFieldName }} date;
+CREATE TABLE IF NOT EXISTS {{ .HistoryTableFullName }} (
+    {{ .IDFieldName }} char(14) NOT NULL,
+    {{ .SinceFieldName }} date,
+    {{ .UntilFieldName }} date NOT NULL,
+    {{ .JSONFieldName }} jsonb NOT NULL,
+    PRIMARY KEY ({{ .IDFieldName }}, {{ .UntilFieldName }})
+);
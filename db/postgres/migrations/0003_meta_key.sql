@@ -0,0 +1 @@
+ALTER TABLE {{ .MetaTableFullName }} ALTER COLUMN {{ .KeyFieldName }} TYPE text;
@@ -0,0 +1,219 @@
+CREATE TABLE IF NOT EXISTS {{ .TableFullName "cnae" }} (
+    codigo integer PRIMARY KEY,
+    descricao text
+);
+CREATE TABLE IF NOT EXISTS {{ .TableFullName "natureza_juridica" }} (
+    codigo integer PRIMARY KEY,
+    descricao text
+);
+CREATE TABLE IF NOT EXISTS {{ .TableFullName "qualificacao_socio" }} (
+    codigo integer PRIMARY KEY,
+    descricao text
+);
+CREATE TABLE IF NOT EXISTS {{ .TableFullName "motivo_situacao_cadastral" }} (
+    codigo integer PRIMARY KEY,
+    descricao text
+);
+CREATE TABLE IF NOT EXISTS {{ .TableFullName "porte_empresa" }} (
+    codigo integer PRIMARY KEY,
+    descricao text
+);
+CREATE TABLE IF NOT EXISTS {{ .TableFullName "pais" }} (
+    codigo integer PRIMARY KEY,
+    descricao text
+);
+CREATE TABLE IF NOT EXISTS {{ .TableFullName "faixa_etaria" }} (
+    codigo integer PRIMARY KEY,
+    descricao text
+);
+CREATE TABLE IF NOT EXISTS {{ .TableFullName "municipio" }} (
+    codigo integer PRIMARY KEY,
+    codigo_ibge integer,
+    nome text,
+    uf char(2)
+);
+CREATE TABLE IF NOT EXISTS {{ .TableFullName "business" }} (
+    id bigserial PRIMARY KEY,
+    cnpj char(14) NOT NULL UNIQUE,
+    razao_social text NOT NULL,
+    nome_fantasia text,
+    identificador_matriz_filial smallint,
+    situacao_cadastral smallint,
+    data_situacao_cadastral date,
+    motivo_situacao_cadastral integer REFERENCES {{ .TableFullName "motivo_situacao_cadastral" }} (codigo),
+    situacao_especial text,
+    data_situacao_especial date,
+    data_inicio_atividade date,
+    cnae_principal integer REFERENCES {{ .TableFullName "cnae" }} (codigo),
+    natureza_juridica integer REFERENCES {{ .TableFullName "natureza_juridica" }} (codigo),
+    qualificacao_responsavel integer REFERENCES {{ .TableFullName "qualificacao_socio" }} (codigo),
+    capital_social numeric(18, 2),
+    porte_empresa integer REFERENCES {{ .TableFullName "porte_empresa" }} (codigo),
+    ente_federativo_responsavel text,
+    email text,
+    ddd_telefone_1 text,
+    ddd_telefone_2 text,
+    ddd_fax text,
+    endereco_tipo_logradouro text,
+    endereco_logradouro text,
+    endereco_numero text,
+    endereco_complemento text,
+    endereco_bairro text,
+    endereco_cep text,
+    endereco_uf char(2),
+    endereco_municipio integer REFERENCES {{ .TableFullName "municipio" }} (codigo),
+    nome_cidade_no_exterior text,
+    codigo_pais integer REFERENCES {{ .TableFullName "pais" }} (codigo),
+    updated_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE TABLE IF NOT EXISTS {{ .TableFullName "socios_cnpj" }} (
+    id bigserial PRIMARY KEY,
+    business_id bigint NOT NULL REFERENCES {{ .TableFullName "business" }} (id) ON DELETE CASCADE,
+    cnpj char(14) NOT NULL,
+    ordem smallint NOT NULL,
+    identificador_de_socio smallint,
+    nome_socio text,
+    cnpj_cpf_do_socio text,
+    qualificacao integer REFERENCES {{ .TableFullName "qualificacao_socio" }} (codigo),
+    data_entrada_sociedade date,
+    codigo_pais integer REFERENCES {{ .TableFullName "pais" }} (codigo),
+    cpf_representante_legal text,
+    nome_representante_legal text,
+    qualificacao_representante_legal integer REFERENCES {{ .TableFullName "qualificacao_socio" }} (codigo),
+    faixa_etaria integer REFERENCES {{ .TableFullName "faixa_etaria" }} (codigo)
+);
+CREATE TABLE IF NOT EXISTS {{ .TableFullName "business_cnaes_secundarios" }} (
+    business_id bigint NOT NULL REFERENCES {{ .TableFullName "business" }} (id) ON DELETE CASCADE,
+    ordem smallint NOT NULL,
+    cnae integer NOT NULL REFERENCES {{ .TableFullName "cnae" }} (codigo),
+    PRIMARY KEY (business_id, ordem)
+);
+CREATE TABLE IF NOT EXISTS {{ .TableFullName "business_regime_tributario" }} (
+    business_id bigint NOT NULL REFERENCES {{ .TableFullName "business" }} (id) ON DELETE CASCADE,
+    ordem smallint NOT NULL,
+    ano smallint NOT NULL,
+    cnpj_da_scp text,
+    forma_de_tributacao text,
+    quantidade_de_escrituracoes integer,
+    PRIMARY KEY (business_id, ordem)
+);
+CREATE TABLE IF NOT EXISTS {{ .TableFullName "business_simples" }} (
+    business_id bigint PRIMARY KEY REFERENCES {{ .TableFullName "business" }} (id) ON DELETE CASCADE,
+    opcao_pelo_simples boolean,
+    data_opcao_pelo_simples date,
+    data_exclusao_do_simples date,
+    opcao_pelo_mei boolean,
+    data_opcao_pelo_mei date,
+    data_exclusao_do_mei date
+);
+CREATE INDEX IF NOT EXISTS business_cnae_principal ON {{ .TableFullName "business" }} (cnae_principal);
+CREATE INDEX IF NOT EXISTS business_natureza_juridica ON {{ .TableFullName "business" }} (natureza_juridica);
+CREATE INDEX IF NOT EXISTS business_endereco_uf ON {{ .TableFullName "business" }} (endereco_uf);
+CREATE INDEX IF NOT EXISTS business_endereco_municipio ON {{ .TableFullName "business" }} (endereco_municipio);
+CREATE INDEX IF NOT EXISTS socios_cnpj_business_id ON {{ .TableFullName "socios_cnpj" }} (business_id);
+CREATE INDEX IF NOT EXISTS socios_cnpj_cnpj_cpf_do_socio ON {{ .TableFullName "socios_cnpj" }} (cnpj_cpf_do_socio);
+CREATE INDEX IF NOT EXISTS business_cnaes_secundarios_cnae ON {{ .TableFullName "business_cnaes_secundarios" }} (cnae);
+CREATE OR REPLACE VIEW {{ .TableFullName "business_json" }} AS
+SELECT
+    b.id,
+    b.cnpj,
+    b.endereco_uf,
+    b.endereco_municipio,
+    m.codigo_ibge AS endereco_municipio_ibge,
+    b.natureza_juridica,
+    b.cnae_principal,
+    json_build_object(
+        'cnpj', b.cnpj::text,
+        'identificador_matriz_filial', b.identificador_matriz_filial,
+        'descricao_identificador_matriz_filial', CASE b.identificador_matriz_filial WHEN 1 THEN 'MATRIZ' WHEN 2 THEN 'FILIAL' END,
+        'nome_fantasia', b.nome_fantasia,
+        'situacao_cadastral', b.situacao_cadastral,
+        'descricao_situacao_cadastral', CASE b.situacao_cadastral WHEN 1 THEN 'NULA' WHEN 2 THEN 'ATIVA' WHEN 3 THEN 'SUSPENSA' WHEN 4 THEN 'INAPTA' WHEN 8 THEN 'BAIXADA' END,
+        'data_situacao_cadastral', b.data_situacao_cadastral,
+        'motivo_situacao_cadastral', b.motivo_situacao_cadastral,
+        'descricao_motivo_situacao_cadastral', msc.descricao,
+        'nome_cidade_no_exterior', b.nome_cidade_no_exterior,
+        'codigo_pais', b.codigo_pais,
+        'pais', pa.descricao,
+        'data_inicio_atividade', b.data_inicio_atividade,
+        'cnae_fiscal', b.cnae_principal,
+        'cnae_fiscal_descricao', c.descricao,
+        'descricao_tipo_de_logradouro', b.endereco_tipo_logradouro,
+        'logradouro', b.endereco_logradouro,
+        'numero', b.endereco_numero,
+        'complemento', b.endereco_complemento,
+        'bairro', b.endereco_bairro,
+        'cep', b.endereco_cep,
+        'uf', b.endereco_uf::text,
+        'codigo_municipio', b.endereco_municipio,
+        'codigo_municipio_ibge', m.codigo_ibge,
+        'municipio', m.nome,
+        'ddd_telefone_1', b.ddd_telefone_1,
+        'ddd_telefone_2', b.ddd_telefone_2,
+        'ddd_fax', b.ddd_fax,
+        'email', b.email,
+        'situacao_especial', b.situacao_especial,
+        'data_situacao_especial', b.data_situacao_especial,
+        'opcao_pelo_simples', s.opcao_pelo_simples,
+        'data_opcao_pelo_simples', s.data_opcao_pelo_simples,
+        'data_exclusao_do_simples', s.data_exclusao_do_simples,
+        'opcao_pelo_mei', s.opcao_pelo_mei,
+        'data_opcao_pelo_mei', s.data_opcao_pelo_mei,
+        'data_exclusao_do_mei', s.data_exclusao_do_mei,
+        'razao_social', b.razao_social,
+        'codigo_natureza_juridica', b.natureza_juridica,
+        'natureza_juridica', nj.descricao,
+        'qualificacao_do_responsavel', b.qualificacao_responsavel,
+        'capital_social', b.capital_social,
+        'codigo_porte', b.porte_empresa,
+        'porte', pe.descricao,
+        'ente_federativo_responsavel', b.ente_federativo_responsavel,
+        'qsa', COALESCE((
+            SELECT json_agg(json_build_object(
+                'identificador_de_socio', p.identificador_de_socio,
+                'nome_socio', p.nome_socio,
+                'cnpj_cpf_do_socio', p.cnpj_cpf_do_socio,
+                'codigo_qualificacao_socio', p.qualificacao,
+                'qualificacao_socio', q.descricao,
+                'data_entrada_sociedade', p.data_entrada_sociedade,
+                'codigo_pais', p.codigo_pais,
+                'pais', pp.descricao,
+                'cpf_representante_legal', p.cpf_representante_legal,
+                'nome_representante_legal', p.nome_representante_legal,
+                'codigo_qualificacao_representante_legal', p.qualificacao_representante_legal,
+                'qualificacao_representante_legal', qr.descricao,
+                'codigo_faixa_etaria', p.faixa_etaria,
+                'faixa_etaria', fe.descricao
+            ) ORDER BY p.ordem)
+            FROM {{ .TableFullName "socios_cnpj" }} p
+            LEFT JOIN {{ .TableFullName "qualificacao_socio" }} q ON q.codigo = p.qualificacao
+            LEFT JOIN {{ .TableFullName "qualificacao_socio" }} qr ON qr.codigo = p.qualificacao_representante_legal
+            LEFT JOIN {{ .TableFullName "pais" }} pp ON pp.codigo = p.codigo_pais
+            LEFT JOIN {{ .TableFullName "faixa_etaria" }} fe ON fe.codigo = p.faixa_etaria
+            WHERE p.business_id = b.id
+        ), '[]'::json),
+        'cnaes_secundarios', COALESCE((
+            SELECT json_agg(json_build_object('codigo', sc.cnae, 'descricao', scd.descricao) ORDER BY sc.ordem)
+            FROM {{ .TableFullName "business_cnaes_secundarios" }} sc
+            LEFT JOIN {{ .TableFullName "cnae" }} scd ON scd.codigo = sc.cnae
+            WHERE sc.business_id = b.id
+        ), '[]'::json),
+        'regime_tributario', COALESCE((
+            SELECT json_agg(json_build_object(
+                'ano', r.ano,
+                'cnpj_da_scp', r.cnpj_da_scp,
+                'forma_de_tributacao', r.forma_de_tributacao,
+                'quantidade_de_escrituracoes', r.quantidade_de_escrituracoes
+            ) ORDER BY r.ordem)
+            FROM {{ .TableFullName "business_regime_tributario" }} r
+            WHERE r.business_id = b.id
+        ), '[]'::json)
+    ) AS json
+FROM {{ .TableFullName "business" }} b
+LEFT JOIN {{ .TableFullName "municipio" }} m ON m.codigo = b.endereco_municipio
+LEFT JOIN {{ .TableFullName "cnae" }} c ON c.codigo = b.cnae_principal
+LEFT JOIN {{ .TableFullName "natureza_juridica" }} nj ON nj.codigo = b.natureza_juridica
+LEFT JOIN {{ .TableFullName "motivo_situacao_cadastral" }} msc ON msc.codigo = b.motivo_situacao_cadastral
+LEFT JOIN {{ .TableFullName "porte_empresa" }} pe ON pe.codigo = b.porte_empresa
+LEFT JOIN {{ .TableFullName "pais" }} pa ON pa.codigo = b.codigo_pais
+LEFT JOIN {{ .TableFullName "business_simples" }} s ON s.business_id = b.id;
@@ -0,0 +1,14 @@
+DROP VIEW IF EXISTS {{ .TableFullName "business_json" }};
+DROP TABLE IF EXISTS {{ .TableFullName "business_simples" }} CASCADE;
+DROP TABLE IF EXISTS {{ .TableFullName "business_regime_tributario" }} CASCADE;
+DROP TABLE IF EXISTS {{ .TableFullName "business_cnaes_secundarios" }} CASCADE;
+DROP TABLE IF EXISTS {{ .TableFullName "socios_cnpj" }} CASCADE;
+DROP TABLE IF EXISTS {{ .TableFullName "business" }} CASCADE;
+DROP TABLE IF EXISTS {{ .TableFullName "municipio" }} CASCADE;
+DROP TABLE IF EXISTS {{ .TableFullName "faixa_etaria" }} CASCADE;
+DROP TABLE IF EXISTS {{ .TableFullName "pais" }} CASCADE;
+DROP TABLE IF EXISTS {{ .TableFullName "porte_empresa" }} CASCADE;
+DROP TABLE IF EXISTS {{ .TableFullName "motivo_situacao_cadastral" }} CASCADE;
+DROP TABLE IF EXISTS {{ .TableFullName "qualificacao_socio" }} CASCADE;
+DROP TABLE IF EXISTS {{ .TableFullName "natureza_juridica" }} CASCADE;
+DROP TABLE IF EXISTS {{ .TableFullName "cnae" }} CASCADE;
@@ -0,0 +1,3 @@
+SELECT json::text
+FROM {{ .TableFullName "business_json" }}
+WHERE cnpj = $1;
@@ -0,0 +1,3 @@
+SELECT cnpj, json::text
+FROM {{ .TableFullName "business_json" }}
+WHERE cnpj = ANY($1);
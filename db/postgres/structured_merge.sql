@@ -0,0 +1,116 @@
+{{ range .StructuredLookups }}
+INSERT INTO {{ $.TableFullName . }} (codigo, descricao)
+SELECT DISTINCT ON (codigo) codigo, descricao
+FROM staging_lookup
+WHERE tabela = '{{ . }}'
+ORDER BY codigo
+ON CONFLICT (codigo) DO UPDATE
+SET descricao = COALESCE(EXCLUDED.descricao, {{ . }}.descricao);
+{{ end }}
+INSERT INTO {{ .TableFullName "municipio" }} (codigo, codigo_ibge, nome, uf)
+SELECT DISTINCT ON (codigo) codigo, codigo_ibge, nome, uf
+FROM staging_municipio
+ORDER BY codigo
+ON CONFLICT (codigo) DO NOTHING;
+
+INSERT INTO {{ .TableFullName "business" }} (
+    cnpj, razao_social, nome_fantasia, identificador_matriz_filial,
+    situacao_cadastral, data_situacao_cadastral, motivo_situacao_cadastral,
+    situacao_especial, data_situacao_especial, data_inicio_atividade,
+    cnae_principal, natureza_juridica, qualificacao_responsavel, capital_social,
+    porte_empresa, ente_federativo_responsavel, email, ddd_telefone_1,
+    ddd_telefone_2, ddd_fax, endereco_tipo_logradouro, endereco_logradouro,
+    endereco_numero, endereco_complemento, endereco_bairro, endereco_cep,
+    endereco_uf, endereco_municipio, nome_cidade_no_exterior, codigo_pais
+)
+SELECT
+    cnpj, razao_social, nome_fantasia, identificador_matriz_filial,
+    situacao_cadastral, data_situacao_cadastral, motivo_situacao_cadastral,
+    situacao_especial, data_situacao_especial, data_inicio_atividade,
+    cnae_principal, natureza_juridica, qualificacao_responsavel, capital_social,
+    porte_empresa, ente_federativo_responsavel, email, ddd_telefone_1,
+    ddd_telefone_2, ddd_fax, endereco_tipo_logradouro, endereco_logradouro,
+    endereco_numero, endereco_complemento, endereco_bairro, endereco_cep,
+    endereco_uf, endereco_municipio, nome_cidade_no_exterior, codigo_pais
+FROM staging_business
+ORDER BY cnpj
+ON CONFLICT (cnpj) DO UPDATE
+SET
+    razao_social = EXCLUDED.razao_social,
+    nome_fantasia = EXCLUDED.nome_fantasia,
+    identificador_matriz_filial = EXCLUDED.identificador_matriz_filial,
+    situacao_cadastral = EXCLUDED.situacao_cadastral,
+    data_situacao_cadastral = EXCLUDED.data_situacao_cadastral,
+    motivo_situacao_cadastral = EXCLUDED.motivo_situacao_cadastral,
+    situacao_especial = EXCLUDED.situacao_especial,
+    data_situacao_especial = EXCLUDED.data_situacao_especial,
+    data_inicio_atividade = EXCLUDED.data_inicio_atividade,
+    cnae_principal = EXCLUDED.cnae_principal,
+    natureza_juridica = EXCLUDED.natureza_juridica,
+    qualificacao_responsavel = EXCLUDED.qualificacao_responsavel,
+    capital_social = EXCLUDED.capital_social,
+    porte_empresa = EXCLUDED.porte_empresa,
+    ente_federativo_responsavel = EXCLUDED.ente_federativo_responsavel,
+    email = EXCLUDED.email,
+    ddd_telefone_1 = EXCLUDED.ddd_telefone_1,
+    ddd_telefone_2 = EXCLUDED.ddd_telefone_2,
+    ddd_fax = EXCLUDED.ddd_fax,
+    endereco_tipo_logradouro = EXCLUDED.endereco_tipo_logradouro,
+    endereco_logradouro = EXCLUDED.endereco_logradouro,
+    endereco_numero = EXCLUDED.endereco_numero,
+    endereco_complemento = EXCLUDED.endereco_complemento,
+    endereco_bairro = EXCLUDED.endereco_bairro,
+    endereco_cep = EXCLUDED.endereco_cep,
+    endereco_uf = EXCLUDED.endereco_uf,
+    endereco_municipio = EXCLUDED.endereco_municipio,
+    nome_cidade_no_exterior = EXCLUDED.nome_cidade_no_exterior,
+    codigo_pais = EXCLUDED.codigo_pais,
+    updated_at = now();
+
+CREATE TEMPORARY TABLE staging_ids ON COMMIT DROP AS
+SELECT b.id, b.cnpj
+FROM {{ .TableFullName "business" }} b
+JOIN staging_business s USING (cnpj);
+
+DELETE FROM {{ .TableFullName "socios_cnpj" }} WHERE business_id IN (SELECT id FROM staging_ids);
+DELETE FROM {{ .TableFullName "business_cnaes_secundarios" }} WHERE business_id IN (SELECT id FROM staging_ids);
+DELETE FROM {{ .TableFullName "business_regime_tributario" }} WHERE business_id IN (SELECT id FROM staging_ids);
+DELETE FROM {{ .TableFullName "business_simples" }} WHERE business_id IN (SELECT id FROM staging_ids);
+
+INSERT INTO {{ .TableFullName "socios_cnpj" }} (
+    business_id, cnpj, ordem, identificador_de_socio, nome_socio,
+    cnpj_cpf_do_socio, qualificacao, data_entrada_sociedade, codigo_pais,
+    cpf_representante_legal, nome_representante_legal,
+    qualificacao_representante_legal, faixa_etaria
+)
+SELECT
+    i.id, s.cnpj, s.ordem, s.identificador_de_socio, s.nome_socio,
+    s.cnpj_cpf_do_socio, s.qualificacao, s.data_entrada_sociedade, s.codigo_pais,
+    s.cpf_representante_legal, s.nome_representante_legal,
+    s.qualificacao_representante_legal, s.faixa_etaria
+FROM staging_socios_cnpj s
+JOIN staging_ids i USING (cnpj);
+
+INSERT INTO {{ .TableFullName "business_cnaes_secundarios" }} (business_id, ordem, cnae)
+SELECT i.id, s.ordem, s.cnae
+FROM staging_cnaes_secundarios s
+JOIN staging_ids i USING (cnpj);
+
+INSERT INTO {{ .TableFullName "business_regime_tributario" }} (
+    business_id, ordem, ano, cnpj_da_scp, forma_de_tributacao, quantidade_de_escrituracoes
+)
+SELECT i.id, s.ordem, s.ano, s.cnpj_da_scp, s.forma_de_tributacao, s.quantidade_de_escrituracoes
+FROM staging_regime_tributario s
+JOIN staging_ids i USING (cnpj);
+
+INSERT INTO {{ .TableFullName "business_simples" }} (
+    business_id, opcao_pelo_simples, data_opcao_pelo_simples,
+    data_exclusao_do_simples, opcao_pelo_mei, data_opcao_pelo_mei,
+    data_exclusao_do_mei
+)
+SELECT
+    i.id, s.opcao_pelo_simples, s.data_opcao_pelo_simples,
+    s.data_exclusao_do_simples, s.opcao_pelo_mei, s.data_opcao_pelo_mei,
+    s.data_exclusao_do_mei
+FROM staging_simples s
+JOIN staging_ids i USING (cnpj);
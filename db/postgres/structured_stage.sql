@@ -0,0 +1,79 @@
+CREATE TEMPORARY TABLE staging_lookup (
+    tabela text NOT NULL,
+    codigo integer NOT NULL,
+    descricao text
+) ON COMMIT DROP;
+CREATE TEMPORARY TABLE staging_municipio (
+    codigo integer NOT NULL,
+    codigo_ibge integer,
+    nome text,
+    uf char(2)
+) ON COMMIT DROP;
+CREATE TEMPORARY TABLE staging_business (
+    cnpj char(14) NOT NULL,
+    razao_social text NOT NULL,
+    nome_fantasia text,
+    identificador_matriz_filial smallint,
+    situacao_cadastral smallint,
+    data_situacao_cadastral date,
+    motivo_situacao_cadastral integer,
+    situacao_especial text,
+    data_situacao_especial date,
+    data_inicio_atividade date,
+    cnae_principal integer,
+    natureza_juridica integer,
+    qualificacao_responsavel integer,
+    capital_social numeric(18, 2),
+    porte_empresa integer,
+    ente_federativo_responsavel text,
+    email text,
+    ddd_telefone_1 text,
+    ddd_telefone_2 text,
+    ddd_fax text,
+    endereco_tipo_logradouro text,
+    endereco_logradouro text,
+    endereco_numero text,
+    endereco_complemento text,
+    endereco_bairro text,
+    endereco_cep text,
+    endereco_uf char(2),
+    endereco_municipio integer,
+    nome_cidade_no_exterior text,
+    codigo_pais integer
+) ON COMMIT DROP;
+CREATE TEMPORARY TABLE staging_socios_cnpj (
+    cnpj char(14) NOT NULL,
+    ordem smallint NOT NULL,
+    identificador_de_socio smallint,
+    nome_socio text,
+    cnpj_cpf_do_socio text,
+    qualificacao integer,
+    data_entrada_sociedade date,
+    codigo_pais integer,
+    cpf_representante_legal text,
+    nome_representante_legal text,
+    qualificacao_representante_legal integer,
+    faixa_etaria integer
+) ON COMMIT DROP;
+CREATE TEMPORARY TABLE staging_cnaes_secundarios (
+    cnpj char(14) NOT NULL,
+    ordem smallint NOT NULL,
+    cnae integer NOT NULL
+) ON COMMIT DROP;
+CREATE TEMPORARY TABLE staging_regime_tributario (
+    cnpj char(14) NOT NULL,
+    ordem smallint NOT NULL,
+    ano smallint NOT NULL,
+    cnpj_da_scp text,
+    forma_de_tributacao text,
+    quantidade_de_escrituracoes integer
+) ON COMMIT DROP;
+CREATE TEMPORARY TABLE staging_simples (
+    cnpj char(14) NOT NULL,
+    opcao_pelo_simples boolean,
+    data_opcao_pelo_simples date,
+    data_exclusao_do_simples date,
+    opcao_pelo_mei boolean,
+    data_opcao_pelo_mei date,
+    data_exclusao_do_mei date
+) ON COMMIT DROP;
@@ -0,0 +1,50 @@
+{{ if .Drop }}
+DROP TABLE IF EXISTS {{ .Schema }}.{{ .Drop }} CASCADE;
+{{ end }}
+{{ with .Archive }}
+INSERT INTO {{ .History }} ({{ .IDFieldName }}, {{ .SinceFieldName }}, {{ .UntilFieldName }}, {{ .JSONFieldName }})
+SELECT c.{{ .IDFieldName }}, c.{{ .SinceFieldName }}, '{{ .UpdatedAt }}'::date, c.{{ .JSONFieldName }}
+FROM {{ .Live }} AS c
+LEFT JOIN {{ .Shadow }} AS s ON s.{{ .IDFieldName }} = c.{{ .IDFieldName }}
+WHERE s.{{ .IDFieldName }} IS NULL OR c.{{ .HashFieldName }} IS DISTINCT FROM s.{{ .HashFieldName }}
+ON CONFLICT DO NOTHING;
+UPDATE {{ .Shadow }} AS s
+SET {{ .SinceFieldName }} = c.{{ .SinceFieldName }}
+FROM {{ .Live }} AS c
+WHERE c.{{ .IDFieldName }} = s.{{ .IDFieldName }} AND c.{{ .HashFieldName }} = s.{{ .HashFieldName }};
+UPDATE {{ .Shadow }} AS s
+SET {{ .SinceFieldName }} = '{{ .UpdatedAt }}'::date
+WHERE NOT EXISTS (SELECT 1 FROM {{ .Live }} AS c WHERE c.{{ .IDFieldName }} = s.{{ .IDFieldName }} AND c.{{ .HashFieldName }} = s.{{ .HashFieldName }});
+{{ end }}
+{{ range .Renames }}
+DO $$
+DECLARE
+    r record;
+BEGIN
+    IF to_regclass('{{ $.Schema }}.{{ .From }}') IS NULL THEN
+        RETURN;
+    END IF;
+    FOR r IN SELECT indexname FROM pg_indexes WHERE schemaname = '{{ $.Schema }}' AND tablename = '{{ .From }}' LOOP
+        IF starts_with(r.indexname, 'idx_{{ .FromIndexPrefix }}') THEN
+            EXECUTE format('ALTER INDEX %I.%I RENAME TO %I', '{{ $.Schema }}', r.indexname, 'idx_{{ .ToIndexPrefix }}' || substr(r.indexname, length('idx_{{ .FromIndexPrefix }}') + 1));
+        ELSIF starts_with(r.indexname, '{{ .From }}_') THEN
+            EXECUTE format('ALTER INDEX %I.%I RENAME TO %I', '{{ $.Schema }}', r.indexname, '{{ .To }}_' || substr(r.indexname, length('{{ .From }}_') + 1));
+        END IF;
+    END LOOP;
+    ALTER TABLE {{ $.Schema }}.{{ .From }} RENAME TO {{ .To }};
+END $$;
+{{ end }}
+{{ if .Rollback }}
+UPDATE {{ .Meta }} AS m
+SET value = o.value
+FROM {{ .Meta }} AS o
+WHERE (m.key, o.key) IN (('{{ .UpdatedAtKey }}', '{{ .PreviousUpdatedAtKey }}'), ('{{ .PreviousUpdatedAtKey }}', '{{ .UpdatedAtKey }}'));
+{{ else }}
+INSERT INTO {{ .Meta }} (key, value)
+SELECT '{{ .PreviousUpdatedAtKey }}', value FROM {{ .Meta }} WHERE key = '{{ .UpdatedAtKey }}'
+ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value;
+INSERT INTO {{ .Meta }} (key, value)
+SELECT '{{ .UpdatedAtKey }}', value FROM {{ .Meta }} WHERE key = '{{ .NextUpdatedAtKey }}'
+ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value;
+DELETE FROM {{ .Meta }} WHERE key = '{{ .NextUpdatedAtKey }}';
+{{ end }}
@@ -0,0 +1,21 @@
+WITH seen AS (
+    INSERT INTO {{ .SeenTableFullName }} ({{ .IDFieldName }})
+    SELECT {{ .IDFieldName }} FROM staging_{{ .CompanyTableName }}
+),
+archived AS (
+    INSERT INTO {{ .HistoryTableFullName }} ({{ .IDFieldName }}, {{ .SinceFieldName }}, {{ .UntilFieldName }}, {{ .JSONFieldName }})
+    SELECT c.{{ .IDFieldName }}, c.{{ .SinceFieldName }}, $1::date, c.{{ .JSONFieldName }}
+    FROM {{ .CompanyTableFullName }} AS c
+    INNER JOIN staging_{{ .CompanyTableName }} AS s ON s.{{ .IDFieldName }} = c.{{ .IDFieldName }}
+    WHERE c.{{ .HashFieldName }} IS DISTINCT FROM s.{{ .HashFieldName }}
+    ON CONFLICT DO NOTHING
+),
+upserted AS (
+    INSERT INTO {{ .CompanyTableFullName }} AS c ({{ .IDFieldName }}, {{ .JSONFieldName }}, {{ .HashFieldName }}, {{ .SinceFieldName }})
+    SELECT {{ .IDFieldName }}, {{ .JSONFieldName }}, {{ .HashFieldName }}, $1::date FROM staging_{{ .CompanyTableName }}
+    ON CONFLICT ({{ .IDFieldName }}) DO UPDATE
+    SET {{ .JSONFieldName }} = EXCLUDED.{{ .JSONFieldName }}, {{ .HashFieldName }} = EXCLUDED.{{ .HashFieldName }}, {{ .SinceFieldName }} = EXCLUDED.{{ .SinceFieldName }}
+    WHERE c.{{ .HashFieldName }} IS DISTINCT FROM EXCLUDED.{{ .HashFieldName }}
+    RETURNING xmax = 0 AS inserted
+)
+SELECT count(*) FILTER (WHERE inserted), count(*) FILTER (WHERE NOT inserted) FROM upserted
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS {{ .SeenTableFullName }};
+ANALYZE {{ .CompanyTableFullName }};
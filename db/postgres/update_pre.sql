@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS {{ .SeenTableFullName }};
+CREATE UNLOGGED TABLE {{ .SeenTableFullName }} ({{ .IDFieldName }} char(14) NOT NULL);
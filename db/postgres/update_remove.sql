@@ -0,0 +1,11 @@
+WITH removed AS (
+    DELETE FROM {{ .CompanyTableFullName }} AS c
+    WHERE NOT EXISTS (SELECT 1 FROM {{ .SeenTableFullName }} AS s WHERE s.{{ .IDFieldName }} = c.{{ .IDFieldName }})
+    RETURNING c.{{ .IDFieldName }}, c.{{ .SinceFieldName }}, c.{{ .JSONFieldName }}
+),
+archived AS (
+    INSERT INTO {{ .HistoryTableFullName }} ({{ .IDFieldName }}, {{ .SinceFieldName }}, {{ .UntilFieldName }}, {{ .JSONFieldName }})
+    SELECT {{ .IDFieldName }}, {{ .SinceFieldName }}, $1::date, {{ .JSONFieldName }} FROM removed
+    ON CONFLICT DO NOTHING
+)
+SELECT count(*) FROM removed
@@ -0,0 +1,5 @@
+CREATE TEMPORARY TABLE staging_{{ .CompanyTableName }} (
+    {{ .IDFieldName }} char(14) NOT NULL,
+    {{ .JSONFieldName }} jsonb NOT NULL,
+    {{ .HashFieldName }} char(64) NOT NULL
+) ON COMMIT DROP;
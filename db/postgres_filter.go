@@ -0,0 +1,225 @@
+package db
+
+import (
+	"encoding/json/v2"
+	"fmt"
+	"strings"
+
+	"github.com/huandu/go-sqlbuilder"
+)
+
+// jsonbVar adds a value to the query arguments as JSON, returning its
+// placeholder cast to jsonb.
+func jsonbVar(b *sqlbuilder.SelectBuilder, v any) (string, error) {
+	j, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("error serializing %v: %w", v, err)
+	}
+	return b.Var(string(j)) + "::jsonb", nil
+}
+
+func compileFilters(fs []Filter, compile func(Filter) (string, error)) ([]string, error) {
+	if len(fs) == 0 {
+		return nil, fmt.Errorf("empty list of filters")
+	}
+	cs := make([]string, len(fs))
+	for i, f := range fs {
+		c, err := compile(f)
+		if err != nil {
+			return nil, err
+		}
+		cs[i] = c
+	}
+	return cs, nil
+}
+
+// compileFilter compiles a filter into a predicate on the JSON column, using
+// the same expressions as the extra indexes, with the values as arguments.
+func (p *PostgreSQL) compileFilter(b *sqlbuilder.SelectBuilder, f Filter) (string, error) {
+	compile := func(f Filter) (string, error) { return p.compileFilter(b, f) }
+	field := func(n string) (string, error) {
+		if err := validField(n); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s -> '%s'", p.JSONFieldName, n), nil
+	}
+	switch f := f.(type) {
+	case And:
+		cs, err := compileFilters(f, compile)
+		if err != nil {
+			return "", err
+		}
+		return b.And(cs...), nil
+	case Or:
+		cs, err := compileFilters(f, compile)
+		if err != nil {
+			return "", err
+		}
+		return b.Or(cs...), nil
+	case Not:
+		c, err := compile(f.Filter)
+		if err != nil {
+			return "", err
+		}
+		return b.Not(c), nil
+	case Eq:
+		n, err := field(f.Field)
+		if err != nil {
+			return "", err
+		}
+		v, err := jsonbVar(b, f.Value)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s = %s", n, v), nil
+	case In:
+		n, err := field(f.Field)
+		if err != nil {
+			return "", err
+		}
+		vs := make([]string, len(f.Values))
+		for i, v := range f.Values {
+			if vs[i], err = jsonbVar(b, v); err != nil {
+				return "", err
+			}
+		}
+		return fmt.Sprintf("%s IN (%s)", n, strings.Join(vs, ", ")), nil
+	case Range:
+		n, err := field(f.Field)
+		if err != nil {
+			return "", err
+		}
+		var cs []string
+		for _, r := range []struct {
+			op    string
+			value any
+		}{{">", f.Gt}, {">=", f.Gte}, {"<", f.Lt}, {"<=", f.Lte}} {
+			if r.value == nil {
+				continue
+			}
+			v, err := jsonbVar(b, r.value)
+			if err != nil {
+				return "", err
+			}
+			cs = append(cs, fmt.Sprintf("%s %s %s", n, r.op, v))
+		}
+		if len(cs) == 0 {
+			return "", fmt.Errorf("range on %s without bounds", f.Field)
+		}
+		return b.And(cs...), nil
+	case Contains:
+		if err := validField(f.Array); err != nil {
+			return "", err
+		}
+		if err := validField(f.Field); err != nil {
+			return "", err
+		}
+		cs := make([]string, len(f.Values))
+		for i, v := range f.Values {
+			a, err := jsonbVar(b, []any{v})
+			if err != nil {
+				return "", err
+			}
+			cs[i] = fmt.Sprintf("jsonb_path_query_array(%s, '$.%s[*].%s') @> %s", p.JSONFieldName, f.Array, f.Field, a)
+		}
+		if len(cs) == 0 {
+			return "", fmt.Errorf("contains on %s.%s without values", f.Array, f.Field)
+		}
+		return b.Or(cs...), nil
+	}
+	return "", fmt.Errorf("unknown filter %T", f)
+}
+
+// structuredColumns maps the fields of the company JSON to the columns of the
+// business_json view.
+var structuredColumns = map[string]string{
+	"uf":                       "endereco_uf",
+	"codigo_municipio":         "endereco_municipio",
+	"codigo_municipio_ibge":    "endereco_municipio_ibge",
+	"codigo_natureza_juridica": "natureza_juridica",
+	"cnae_fiscal":              "cnae_principal",
+}
+
+// structuredArrays maps the lists of the company JSON to the tables and
+// columns holding their items.
+var structuredArrays = map[string][2]string{
+	"cnaes_secundarios.codigo": {"business_cnaes_secundarios", "cnae"},
+	"qsa.cnpj_cpf_do_socio":    {"socios_cnpj", "cnpj_cpf_do_socio"},
+}
+
+// compileStructuredFilter compiles a filter into a predicate on the structured
+// tables, with the values as arguments.
+func (p *PostgreSQL) compileStructuredFilter(b *sqlbuilder.SelectBuilder, f Filter) (string, error) {
+	compile := func(f Filter) (string, error) { return p.compileStructuredFilter(b, f) }
+	column := func(n string) (string, error) {
+		c, ok := structuredColumns[n]
+		if !ok {
+			return "", &UnsupportedQueryError{Database: structuredDatabase, Feature: "field", Field: n}
+		}
+		return c, nil
+	}
+	switch f := f.(type) {
+	case And:
+		cs, err := compileFilters(f, compile)
+		if err != nil {
+			return "", err
+		}
+		return b.And(cs...), nil
+	case Or:
+		cs, err := compileFilters(f, compile)
+		if err != nil {
+			return "", err
+		}
+		return b.Or(cs...), nil
+	case Not:
+		c, err := compile(f.Filter)
+		if err != nil {
+			return "", err
+		}
+		return b.Not(c), nil
+	case Eq:
+		c, err := column(f.Field)
+		if err != nil {
+			return "", err
+		}
+		return b.Equal(c, f.Value), nil
+	case In:
+		c, err := column(f.Field)
+		if err != nil {
+			return "", err
+		}
+		return b.In(c, f.Values...), nil
+	case Range:
+		c, err := column(f.Field)
+		if err != nil {
+			return "", err
+		}
+		var cs []string
+		if f.Gt != nil {
+			cs = append(cs, b.GreaterThan(c, f.Gt))
+		}
+		if f.Gte != nil {
+			cs = append(cs, b.GreaterEqualThan(c, f.Gte))
+		}
+		if f.Lt != nil {
+			cs = append(cs, b.LessThan(c, f.Lt))
+		}
+		if f.Lte != nil {
+			cs = append(cs, b.LessEqualThan(c, f.Lte))
+		}
+		if len(cs) == 0 {
+			return "", fmt.Errorf("range on %s without bounds", f.Field)
+		}
+		return b.And(cs...), nil
+	case Contains:
+		t, ok := structuredArrays[f.Array+"."+f.Field]
+		if !ok {
+			return "", &UnsupportedQueryError{Database: structuredDatabase, Feature: "field", Field: f.Array + "." + f.Field}
+		}
+		s := sqlbuilder.PostgreSQL.NewSelectBuilder()
+		s.Select("1").From(p.TableFullName(t[0]))
+		s.Where("business_id = v.id", s.In(t[1], f.Values...))
+		return b.Exists(s), nil
+	}
+	return "", fmt.Errorf("unknown filter %T", f)
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cuducos/minha-receita/transform"
+	"github.com/jackc/pgx/v5"
+)
+
+// SeenTableFullName is the name of the schema and of the table that keeps
+// track of the CNPJs found during an incremental update.
+func (p *PostgreSQL) SeenTableFullName() string {
+	return p.TableFullName(p.CompanyTableName + "_seen")
+}
+
+// PreUpdate prepares the companies table for an incremental update of the
+// release updated at u. Databases created before the hash and history columns
+// and tables existed need to be migrated first (see migrations.go).
+func (p *PostgreSQL) PreUpdate(u string) error {
+	if _, err := time.Parse(time.DateOnly, u); err != nil {
+		return fmt.Errorf("invalid updated at date %q: %w", u, err)
+	}
+	p.release = u
+	s, err := p.renderTemplate("update_pre")
+	if err != nil {
+		return fmt.Errorf("error rendering pre-update template: %w", err)
+	}
+	if _, err := p.pool.Exec(context.Background(), s); err != nil {
+		return fmt.Errorf("error during pre update: %s\n%w", s, err)
+	}
+	return nil
+}
+
+// UpdateCompanies upserts a batch of companies, skipping the ones whose hash
+// did not change, and keeping the previous version of the updated ones in the
+// history table. It returns the number of inserted and updated companies.
+func (p *PostgreSQL) UpdateCompanies(batch [][]string) (int, int, error) {
+	if len(batch) == 0 {
+		return 0, 0, nil
+	}
+	b := make([][]any, len(batch))
+	for i, r := range batch {
+		b[i] = []any{r[0], r[1], transform.ContentHash(r[1])}
+	}
+	ctx := context.Background()
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, p.updateStageQuery); err != nil {
+		return 0, 0, fmt.Errorf("error creating staging table: %w", err)
+	}
+	t := pgx.Identifier{"staging_" + p.CompanyTableName}
+	if _, err := tx.CopyFrom(ctx, t, []string{idFieldName, jsonFieldName, hashFieldName}, pgx.CopyFromRows(b)); err != nil {
+		return 0, 0, fmt.Errorf("error copying %d rows to %s: %w", len(b), t.Sanitize(), err)
+	}
+	var ins, upd int
+	if err := tx.QueryRow(ctx, p.updateMergeQuery, p.release).Scan(&ins, &upd); err != nil {
+		return 0, 0, fmt.Errorf("error merging staging table: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return ins, upd, nil
+}
+
+// PostUpdate removes the companies not found during the incremental update,
+// keeping their last version in the history table, and returns how many were
+// removed.
+func (p *PostgreSQL) PostUpdate() (int, error) {
+	post, err := p.renderTemplate("update_post")
+	if err != nil {
+		return 0, fmt.Errorf("error rendering post-update template: %w", err)
+	}
+	ctx := context.Background()
+	var n int
+	if err := p.pool.QueryRow(ctx, p.updateRemoveQuery, p.release).Scan(&n); err != nil {
+		return 0, fmt.Errorf("error removing companies absent from the update: %w", err)
+	}
+	if _, err := p.pool.Exec(ctx, post); err != nil {
+		return 0, fmt.Errorf("error during post update: %s\n%w", post, err)
+	}
+	return n, nil
+}
+
+// GetCompanyAt returns the JSON of a company as it was at a given date, based
+// on the history kept by the incremental updates.
+func (p *PostgreSQL) GetCompanyAt(id string, at time.Time) (string, error) {
+	rows, err := p.pool.Query(context.Background(), p.getAtQuery, id, at)
+	if err != nil {
+		return "", fmt.Errorf("error looking for cnpj %s at %s: %w", id, at.Format(time.DateOnly), err)
+	}
+	j, err := pgx.CollectOneRow(rows, pgx.RowTo[string])
+	if err != nil {
+		return "", fmt.Errorf("error reading cnpj %s at %s: %w", id, at.Format(time.DateOnly), err)
+	}
+	return j, nil
+}
+
+// GetCompanyHistory returns the JSON of the releases in which a company was
+// included, changed or excluded.
+func (p *PostgreSQL) GetCompanyHistory(id string) (string, error) {
+	rows, err := p.pool.Query(context.Background(), p.historyQuery, id)
+	if err != nil {
+		return "", fmt.Errorf("error looking for the history of cnpj %s: %w", id, err)
+	}
+	vs, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (version, error) {
+		var v version
+		err := r.Scan(&v.since, &v.until)
+		return v, err
+	})
+	if err != nil {
+		return "", fmt.Errorf("error reading the history of cnpj %s: %w", id, err)
+	}
+	return historyJSON(id, vs)
+}
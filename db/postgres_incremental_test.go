@@ -0,0 +1,29 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIncrementalTemplates(t *testing.T) {
+	p := PostgreSQL{schema: "public", CompanyTableName: "cnpj", IDFieldName: "id", JSONFieldName: "json", HashFieldName: "hash"}
+	for _, tc := range []struct {
+		key      string
+		expected string
+	}{
+		{"update_pre", "DROP TABLE IF EXISTS public.cnpj_seen;"},
+		{"update_pre", "CREATE UNLOGGED TABLE public.cnpj_seen"},
+		{"update_stage", "CREATE TEMPORARY TABLE staging_cnpj"},
+		{"update_merge", "WHERE c.hash IS DISTINCT FROM EXCLUDED.hash"},
+		{"update_remove", "DELETE FROM public.cnpj AS c"},
+		{"update_post", "DROP TABLE IF EXISTS public.cnpj_seen;"},
+	} {
+		s, err := p.renderTemplate(tc.key)
+		if err != nil {
+			t.Errorf("expected no error rendering %s, got %s", tc.key, err)
+		}
+		if !strings.Contains(s, tc.expected) {
+			t.Errorf("expected %s to contain %q, got %s", tc.key, tc.expected, s)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const postgresUndefinedTable = "42P01"
+
+func (p *PostgreSQL) renderMigration(m Migration) (string, error) {
+	t, err := template.ParseFS(migrationFiles, m.path)
+	if err != nil {
+		return "", fmt.Errorf("error parsing migration %s: %w", m, err)
+	}
+	var b bytes.Buffer
+	if err = t.Execute(&b, p); err != nil {
+		return "", fmt.Errorf("error rendering migration %s: %w", m, err)
+	}
+	return b.String(), nil
+}
+
+// migrationsSQL renders all the migrations in order, so `Create` and `MigrateUp`
+// share a single definition of the schema.
+func (p *PostgreSQL) migrationsSQL() (string, error) {
+	ms, err := loadMigrations("postgres")
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, m := range ms {
+		s, err := p.renderMigration(m)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(s)
+	}
+	return b.String(), nil
+}
+
+// schemaVersion reads the version of the last migration applied, which is 0
+// for databases created before the migrations existed (or not created yet).
+func (p *PostgreSQL) schemaVersion() (int, error) {
+	v, err := p.MetaRead(SchemaVersionKey)
+	if err != nil {
+		var pe *pgconn.PgError
+		if errors.Is(err, pgx.ErrNoRows) || (errors.As(err, &pe) && pe.Code == postgresUndefinedTable) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return parseSchemaVersion(v)
+}
+
+// saveSchemaVersion marks a database created from scratch as being in the
+// latest version.
+func (p *PostgreSQL) saveSchemaVersion() error {
+	ms, err := loadMigrations("postgres")
+	if err != nil {
+		return err
+	}
+	return p.MetaSave(SchemaVersionKey, strconv.Itoa(len(ms)))
+}
+
+// SchemaStatus compares the schema version of the database to the migrations
+// available.
+func (p *PostgreSQL) SchemaStatus() (SchemaStatus, error) {
+	ms, err := loadMigrations("postgres")
+	if err != nil {
+		return SchemaStatus{}, err
+	}
+	v, err := p.schemaVersion()
+	if err != nil {
+		return SchemaStatus{}, fmt.Errorf("error reading the schema version: %w", err)
+	}
+	return newSchemaStatus(v, ms), nil
+}
+
+func (p *PostgreSQL) applyMigration(ctx context.Context, m Migration, save string) error {
+	q, err := p.renderMigration(m)
+	if err != nil {
+		return err
+	}
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, q); err != nil {
+		return fmt.Errorf("error applying migration %s: %s\n%w", m, q, err)
+	}
+	if _, err := tx.Exec(ctx, save, SchemaVersionKey, strconv.Itoa(m.Version)); err != nil {
+		return fmt.Errorf("error saving schema version %d: %w", m.Version, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing migration %s: %w", m, err)
+	}
+	return nil
+}
+
+// MigrateUp applies the pending migrations, each one in a transaction together
+// with the update of the schema version.
+func (p *PostgreSQL) MigrateUp() error {
+	s, err := p.SchemaStatus()
+	if err != nil {
+		return err
+	}
+	if s.Current > s.Latest {
+		return s.Check()
+	}
+	save, err := p.renderTemplate("meta_save")
+	if err != nil {
+		return fmt.Errorf("error rendering meta-save template: %w", err)
+	}
+	for _, m := range s.Pending {
+		slog.Info("Applying migration", "migration", m.String())
+		if err := p.applyMigration(context.Background(), m, save); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,369 @@
+package db
+
+import (
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cuducos/minha-receita/transform"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jackc/pgx/v5"
+)
+
+// structuredDatabase names the PostgreSQL structured model in the errors of
+// unsupported search queries.
+const structuredDatabase = "the PostgreSQL structured model"
+
+// structuredLookups are the tables with a code and a description used as
+// foreign keys by the structured tables.
+var structuredLookups = []string{
+	"cnae",
+	"natureza_juridica",
+	"qualificacao_socio",
+	"motivo_situacao_cadastral",
+	"porte_empresa",
+	"pais",
+	"faixa_etaria",
+}
+
+type stagingTable struct {
+	name    string
+	columns []string
+	rows    [][]any
+}
+
+// structuredBatch holds the rows of a batch of companies for each staging
+// table (see structured_stage.sql), ready to be copied to PostgreSQL.
+type structuredBatch struct {
+	lookups   stagingTable
+	cities    stagingTable
+	companies stagingTable
+	partners  stagingTable
+	cnaes     stagingTable
+	taxes     stagingTable
+	simples   stagingTable
+	seen      map[string]int // lookup keys already in the batch and their row index
+}
+
+func (s *structuredBatch) tables() []*stagingTable {
+	return []*stagingTable{&s.lookups, &s.cities, &s.companies, &s.partners, &s.cnaes, &s.taxes, &s.simples}
+}
+
+func (s *structuredBatch) lookup(t string, c *int, d *string) {
+	if c == nil {
+		return
+	}
+	k := fmt.Sprintf("%s:%d", t, *c)
+	if i, ok := s.seen[k]; ok {
+		if d != nil && s.lookups.rows[i][2] == (*string)(nil) {
+			s.lookups.rows[i][2] = d
+		}
+		return
+	}
+	s.seen[k] = len(s.lookups.rows)
+	s.lookups.rows = append(s.lookups.rows, []any{t, *c, d})
+}
+
+func (s *structuredBatch) city(c *transform.Company) {
+	if c.CodigoMunicipio == nil {
+		return
+	}
+	k := fmt.Sprintf("municipio:%d", *c.CodigoMunicipio)
+	if _, ok := s.seen[k]; ok {
+		return
+	}
+	s.seen[k] = len(s.cities.rows)
+	s.cities.rows = append(s.cities.rows, []any{*c.CodigoMunicipio, c.CodigoMunicipioIBGE, c.Municipio, c.UF})
+}
+
+func (s *structuredBatch) add(c *transform.Company) error {
+	if len(c.CNPJ) != 14 || strings.Trim(c.CNPJ, "0123456789") != "" {
+		return fmt.Errorf("invalid cnpj %q", c.CNPJ)
+	}
+	if c.RazaoSocial == "" {
+		return fmt.Errorf("missing razao_social")
+	}
+	s.lookup("cnae", c.CNAEFiscal, c.CNAEFiscalDescricao)
+	s.lookup("natureza_juridica", c.CodigoNaturezaJuridica, c.NaturezaJuridica)
+	s.lookup("qualificacao_socio", c.QualificacaoDoResponsavel, nil)
+	s.lookup("motivo_situacao_cadastral", c.MotivoSituacaoCadastral, c.DescricaoMotivoSituacaoCadastral)
+	s.lookup("porte_empresa", c.CodigoPorte, c.Porte)
+	s.lookup("pais", c.CodigoPais, c.Pais)
+	s.city(c)
+
+	var capital *float64
+	if c.CapitalSocial != nil {
+		v := float64(*c.CapitalSocial)
+		capital = &v
+	}
+	s.companies.rows = append(s.companies.rows, []any{
+		c.CNPJ,
+		c.RazaoSocial,
+		c.NomeFantasia,
+		c.IdentificadorMatrizFilial,
+		c.SituacaoCadastral,
+		convertDate(c.DataSituacaoCadastral),
+		c.MotivoSituacaoCadastral,
+		c.SituacaoEspecial,
+		convertDate(c.DataSituacaoEspecial),
+		convertDate(c.DataInicioAtividade),
+		c.CNAEFiscal,
+		c.CodigoNaturezaJuridica,
+		c.QualificacaoDoResponsavel,
+		capital,
+		c.CodigoPorte,
+		c.EnteFederativoResponsavel,
+		c.Email,
+		c.Telefone1,
+		c.Telefone2,
+		c.Fax,
+		c.DescricaoTipoDeLogradouro,
+		c.Logradouro,
+		c.Numero,
+		c.Complemento,
+		c.Bairro,
+		c.CEP,
+		c.UF,
+		c.CodigoMunicipio,
+		c.NomeCidadeNoExterior,
+		c.CodigoPais,
+	})
+	for i, p := range c.QuadroSocietario {
+		s.lookup("qualificacao_socio", p.CodigoQualificacaoSocio, p.QualificaoSocio)
+		s.lookup("qualificacao_socio", p.CodigoQualificacaoRepresentanteLegal, p.QualificacaoRepresentanteLegal)
+		s.lookup("pais", p.CodigoPais, p.Pais)
+		s.lookup("faixa_etaria", p.CodigoFaixaEtaria, p.FaixaEtaria)
+		s.partners.rows = append(s.partners.rows, []any{
+			c.CNPJ,
+			i,
+			p.IdentificadorDeSocio,
+			p.NomeSocio,
+			p.CNPJCPFDoSocio,
+			p.CodigoQualificacaoSocio,
+			convertDate(p.DataEntradaSociedade),
+			p.CodigoPais,
+			p.CPFRepresentanteLegal,
+			p.NomeRepresentanteLegal,
+			p.CodigoQualificacaoRepresentanteLegal,
+			p.CodigoFaixaEtaria,
+		})
+	}
+	for i, a := range c.CNAESecundarios {
+		s.lookup("cnae", &a.Codigo, &a.Descricao)
+		s.cnaes.rows = append(s.cnaes.rows, []any{c.CNPJ, i, a.Codigo})
+	}
+	for i, t := range c.RegimeTributario {
+		s.taxes.rows = append(s.taxes.rows, []any{c.CNPJ, i, t.Ano, t.CNPJDaSCP, t.FormaDeTributação, t.QuantidadeDeEscrituracoes})
+	}
+	r := []any{
+		c.OpcaoPeloSimples,
+		convertDate(c.DataOpcaoPeloSimples),
+		convertDate(c.DataExclusaoDoSimples),
+		c.OpcaoPeloMEI,
+		convertDate(c.DataOpcaoPeloMEI),
+		convertDate(c.DataExclusaoDoMEI),
+	}
+	if slices.ContainsFunc(r, func(v any) bool { return !reflect.ValueOf(v).IsNil() }) {
+		s.simples.rows = append(s.simples.rows, append([]any{c.CNPJ}, r...))
+	}
+	return nil
+}
+
+// newStructuredBatch converts a batch of companies (each item is an array
+// with the CNPJ and the JSON of the company) into the rows of the staging
+// tables. Records that cannot be mapped are reported together in the error.
+func newStructuredBatch(batch [][]string) (*structuredBatch, error) {
+	s := structuredBatch{
+		lookups: stagingTable{name: "staging_lookup", columns: []string{"tabela", "codigo", "descricao"}},
+		cities:  stagingTable{name: "staging_municipio", columns: []string{"codigo", "codigo_ibge", "nome", "uf"}},
+		companies: stagingTable{name: "staging_business", columns: []string{
+			"cnpj",
+			"razao_social",
+			"nome_fantasia",
+			"identificador_matriz_filial",
+			"situacao_cadastral",
+			"data_situacao_cadastral",
+			"motivo_situacao_cadastral",
+			"situacao_especial",
+			"data_situacao_especial",
+			"data_inicio_atividade",
+			"cnae_principal",
+			"natureza_juridica",
+			"qualificacao_responsavel",
+			"capital_social",
+			"porte_empresa",
+			"ente_federativo_responsavel",
+			"email",
+			"ddd_telefone_1",
+			"ddd_telefone_2",
+			"ddd_fax",
+			"endereco_tipo_logradouro",
+			"endereco_logradouro",
+			"endereco_numero",
+			"endereco_complemento",
+			"endereco_bairro",
+			"endereco_cep",
+			"endereco_uf",
+			"endereco_municipio",
+			"nome_cidade_no_exterior",
+			"codigo_pais",
+		}},
+		partners: stagingTable{name: "staging_socios_cnpj", columns: []string{
+			"cnpj",
+			"ordem",
+			"identificador_de_socio",
+			"nome_socio",
+			"cnpj_cpf_do_socio",
+			"qualificacao",
+			"data_entrada_sociedade",
+			"codigo_pais",
+			"cpf_representante_legal",
+			"nome_representante_legal",
+			"qualificacao_representante_legal",
+			"faixa_etaria",
+		}},
+		cnaes: stagingTable{name: "staging_cnaes_secundarios", columns: []string{"cnpj", "ordem", "cnae"}},
+		taxes: stagingTable{name: "staging_regime_tributario", columns: []string{
+			"cnpj",
+			"ordem",
+			"ano",
+			"cnpj_da_scp",
+			"forma_de_tributacao",
+			"quantidade_de_escrituracoes",
+		}},
+		simples: stagingTable{name: "staging_simples", columns: []string{
+			"cnpj",
+			"opcao_pelo_simples",
+			"data_opcao_pelo_simples",
+			"data_exclusao_do_simples",
+			"opcao_pelo_mei",
+			"data_opcao_pelo_mei",
+			"data_exclusao_do_mei",
+		}},
+		seen: make(map[string]int),
+	}
+	var errs []error
+	for n, r := range batch {
+		if len(r) != 2 {
+			errs = append(errs, fmt.Errorf("record #%d: expected cnpj and json, got %d fields", n, len(r)))
+			continue
+		}
+		var c transform.Company
+		if err := json.Unmarshal([]byte(r[1]), &c); err != nil {
+			errs = append(errs, fmt.Errorf("record #%d (cnpj %s): error parsing json: %w", n, r[0], err))
+			continue
+		}
+		if err := s.add(&c); err != nil {
+			errs = append(errs, fmt.Errorf("record #%d (cnpj %s): %w", n, r[0], err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%d of %d records in the batch could not be mapped to the structured tables: %w", len(errs), len(batch), errors.Join(errs...))
+	}
+	return &s, nil
+}
+
+// StructuredLookups lists the lookup tables populated by the structured
+// mode (used in the merge template).
+func (p *PostgreSQL) StructuredLookups() []string { return structuredLookups }
+
+// CreateCompaniesStructured saves a batch of companies into the structured
+// tables (business, socios_cnpj, etc.). It expects the same input as
+// `CreateCompanies`. The batch is copied to temporary staging tables and then
+// merged into the structured tables in a single transaction, replacing any
+// existing data for these CNPJs. If any record of the batch cannot be mapped,
+// nothing is saved and the error lists all the failing records.
+func (p *PostgreSQL) CreateCompaniesStructured(batch [][]string) error {
+	s, err := newStructuredBatch(batch)
+	if err != nil {
+		return err
+	}
+	if len(s.companies.rows) == 0 {
+		return nil
+	}
+	ctx := context.Background()
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, p.stageQuery); err != nil {
+		return fmt.Errorf("error creating staging tables: %w", err)
+	}
+	for _, t := range s.tables() {
+		if len(t.rows) == 0 {
+			continue
+		}
+		if _, err := tx.CopyFrom(ctx, pgx.Identifier{t.name}, t.columns, pgx.CopyFromRows(t.rows)); err != nil {
+			return fmt.Errorf("error copying %d rows to %s: %w", len(t.rows), t.name, err)
+		}
+	}
+	if _, err := tx.Exec(ctx, p.mergeQuery); err != nil {
+		return fmt.Errorf("error merging staging tables: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+func inArgs[T any](vs []T) []any {
+	a := make([]any, len(vs))
+	for i, v := range vs {
+		a[i] = v
+	}
+	return a
+}
+
+// structuredSearchQuery translates the search query into predicates on the
+// structured tables, reading the JSON from the business_json view.
+func (p *PostgreSQL) structuredSearchQuery(q *Query, c *cursor) (*sqlbuilder.SelectBuilder, error) {
+	if q.OrderBy != "" {
+		return nil, &UnsupportedQueryError{Database: structuredDatabase, Feature: "order_by"}
+	}
+	b := sqlbuilder.PostgreSQL.NewSelectBuilder()
+	b.Select("cnpj", "json::text")
+	b.From(b.As(p.TableFullName("business_json"), "v"))
+	b.OrderByAsc("cnpj")
+	b.Limit(int(q.Limit))
+	if c != nil {
+		b.Where(b.GreaterThan("cnpj", c.CNPJ()))
+	}
+	f, err := q.Filter()
+	if err != nil {
+		return nil, err
+	}
+	if f != nil {
+		c, err := p.compileStructuredFilter(b, f)
+		if err != nil {
+			return nil, fmt.Errorf("error compiling search filter: %w", err)
+		}
+		b.Where(c)
+	}
+	return b, nil
+}
+
+// convertDate converts the transform package date type (an unexported alias
+// of time.Time) to a *time.Time, or nil.
+func convertDate(d any) *time.Time {
+	v := reflect.ValueOf(d)
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.CanConvert(reflect.TypeFor[time.Time]()) {
+		return nil
+	}
+	t := v.Convert(reflect.TypeFor[time.Time]()).Interface().(time.Time)
+	return &t
+}
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewStructuredBatch(t *testing.T) {
+	c := loadCompany(t)
+	s, err := newStructuredBatch([][]string{{"19131243000197", c}})
+	if err != nil {
+		t.Fatalf("expected no error mapping the batch, got %s", err)
+	}
+	for _, tc := range []struct {
+		table    *stagingTable
+		expected int
+	}{
+		{&s.companies, 1},
+		{&s.partners, 1},
+		{&s.cnaes, 5},
+		{&s.taxes, 7},
+		{&s.simples, 0},
+		{&s.cities, 1},
+		{&s.lookups, 12}, // 6 cnaes, 1 natureza jurídica, 2 qualificações, 1 motivo, 1 porte and 1 faixa etária
+	} {
+		if len(tc.table.rows) != tc.expected {
+			t.Errorf("expected %d rows in %s, got %d", tc.expected, tc.table.name, len(tc.table.rows))
+		}
+		for _, r := range tc.table.rows {
+			if len(r) != len(tc.table.columns) {
+				t.Errorf("expected %d values in %s row, got %d", len(tc.table.columns), tc.table.name, len(r))
+			}
+		}
+	}
+	r := s.companies.rows[0]
+	for i, exp := range map[int]string{
+		0:  "19131243000197",
+		17: "1123851939",
+		20: "AVENIDA",
+		25: "01311902",
+	} {
+		if r[i] != exp {
+			t.Errorf("expected %s to be %s, got %v", s.companies.columns[i], exp, r[i])
+		}
+	}
+	d, ok := r[5].(*time.Time)
+	if !ok || d == nil || d.Format(time.DateOnly) != "2013-10-03" {
+		t.Errorf("expected data_situacao_cadastral 2013-10-03, got %v", r[5])
+	}
+	for _, l := range s.lookups.rows {
+		if l[0] == "qualificacao_socio" && l[1] == 16 {
+			if d, ok := l[2].(*string); !ok || d == nil || *d != "Presidente" {
+				t.Errorf("expected qualificação 16 to be Presidente, got %v", l[2])
+			}
+		}
+	}
+	p := s.partners.rows[0]
+	for i, exp := range map[int]any{8: "***000000**", 11: 5} {
+		if fmt.Sprint(reflect.Indirect(reflect.ValueOf(p[i]))) != fmt.Sprint(exp) {
+			t.Errorf("expected %s to be %v, got %v", s.partners.columns[i], exp, p[i])
+		}
+	}
+}
+
+func TestNewStructuredBatchWithInvalidRecords(t *testing.T) {
+	c := loadCompany(t)
+	_, err := newStructuredBatch([][]string{
+		{"19131243000197", c},
+		{"42", "not a json"},
+		{"19131243000197"},
+		{"33683111000280", strings.Replace(c, `"19131243000197"`, `"1913124300019"`, 1)},
+	})
+	if err == nil {
+		t.Fatal("expected error mapping a batch with invalid records, got nil")
+	}
+	for _, exp := range []string{"3 of 4 records", "record #1 (cnpj 42)", "record #2", "record #3 (cnpj 33683111000280): invalid cnpj"} {
+		if !strings.Contains(err.Error(), exp) {
+			t.Errorf("expected error to contain %q, got %s", exp, err)
+		}
+	}
+}
+
+func TestStructuredTemplates(t *testing.T) {
+	p := PostgreSQL{schema: "public"}
+	for _, tc := range []struct {
+		key      string
+		expected string
+	}{
+		{"structured_create", "CREATE TABLE IF NOT EXISTS public.business_simples"},
+		{"structured_drop", "DROP TABLE IF EXISTS public.cnae CASCADE"},
+		{"structured_stage", "CREATE TEMPORARY TABLE staging_business"},
+		{"structured_merge", "INSERT INTO public.porte_empresa (codigo, descricao)"},
+		{"structured_get", "FROM public.business_json"},
+	} {
+		s, err := p.renderTemplate(tc.key)
+		if err != nil {
+			t.Errorf("expected no error rendering %s, got %s", tc.key, err)
+		}
+		if !strings.Contains(s, tc.expected) {
+			t.Errorf("expected %s to contain %q, got %s", tc.key, tc.expected, s)
+		}
+	}
+}
+
+func TestStructuredSearchQuery(t *testing.T) {
+	p := PostgreSQL{schema: "public"}
+	q := NewQuery(map[string][]string{"uf": {"sp"}, "cnae": {"6204000"}, "cnpf": {"***112108**"}})
+	b, err := p.structuredSearchQuery(q, &cursor{Key: []any{"33683111000280"}})
+	if err != nil {
+		t.Fatalf("expected no error building the query, got %s", err)
+	}
+	s, a := b.Build()
+	for _, exp := range []string{
+		"SELECT cnpj, json::text FROM public.business_json AS v",
+		"cnpj > $1",
+		"endereco_uf = $2",
+		"(cnae_principal = $3 OR EXISTS (SELECT 1 FROM public.business_cnaes_secundarios WHERE business_id = v.id AND cnae IN ($4)))",
+		"EXISTS (SELECT 1 FROM public.socios_cnpj WHERE business_id = v.id AND cnpj_cpf_do_socio IN ($5))",
+		"ORDER BY cnpj ASC LIMIT $6",
+	} {
+		if !strings.Contains(s, exp) {
+			t.Errorf("expected query to contain %s, got %s", exp, s)
+		}
+	}
+	exp := []any{"33683111000280", "SP", uint32(6204000), uint32(6204000), "***112108**", 256}
+	if fmt.Sprint(a) != fmt.Sprint(exp) {
+		t.Errorf("expected args %v, got %v", exp, a)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/cuducos/minha-receita/testutils"
 )
@@ -92,3 +93,213 @@ func TestPostgresCreateIndexes(t *testing.T) {
 	}
 	testutils.AssertArraysHaveSameItems(t, i, listIndexesPostgres(t, pg))
 }
+
+func TestPostgresStructured(t *testing.T) {
+	u := os.Getenv("TEST_POSTGRES_URL")
+	if u == "" {
+		t.Fatal("expected a posgres uri at TEST_POSTGRES_URL, found nothing")
+	}
+	pg, err := NewPostgreSQL(u, "public")
+	if err != nil {
+		t.Fatalf("expected no error connecting to postgres, got %s", err)
+	}
+	pg.Structured = true
+	defer func() {
+		if err := pg.Drop(); err != nil {
+			t.Errorf("expected no error dropping the tables, got %s", err)
+		}
+		pg.Close()
+	}()
+	if err := pg.Drop(); err != nil {
+		t.Fatalf("expected no error dropping the tables, got %s", err)
+	}
+	if err := pg.Create(); err != nil {
+		t.Fatalf("expected no error creating the tables, got %s", err)
+	}
+	c := loadCompany(t)
+	for range 2 { // the second time updates the existing rows
+		if err := pg.CreateCompaniesStructured([][]string{{"19131243000197", c}}); err != nil {
+			t.Fatalf("expected no error saving a company to the structured tables, got %s", err)
+		}
+	}
+	got, err := pg.GetCompany("19131243000197")
+	if err != nil {
+		t.Errorf("expected no error getting a company, got %s", err)
+	}
+	assertCompaniesAreEqual(t, got, c)
+	cs, err := pg.GetCompanies(context.Background(), []string{"19131243000197", "33683111000280"})
+	if err != nil {
+		t.Errorf("expected no error getting companies, got %s", err)
+	}
+	if len(cs) != 1 {
+		t.Errorf("expected 1 company, got %d", len(cs))
+	}
+	for _, tc := range searchCases {
+		t.Run(tc.name(&pg), func(t *testing.T) {
+			s, err := pg.Search(context.Background(), NewQuery(tc.params))
+			if err != nil {
+				t.Errorf("expected no error searching, got %s", err)
+				return
+			}
+			assertSearchCount(t, s, tc)
+		})
+	}
+}
+
+func TestPostgresIncremental(t *testing.T) {
+	id := "19131243000197"
+	c := loadCompany(t)
+	pg, err := setUpPostgres(id, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pg.Close()
+	if err := pg.PreUpdate("2025-10-12"); err != nil {
+		t.Fatalf("expected no error preparing the update, got %s", err)
+	}
+	other := "33683111000280"
+	changed := strings.Replace(c, `"SAO PAULO"`, `"CAMPINAS"`, 1)
+	for _, tc := range []struct {
+		batch    [][]string
+		inserted int
+		updated  int
+	}{
+		{[][]string{{id, c}}, 0, 0},
+		{[][]string{{id, changed}}, 0, 1},
+		{[][]string{{other, c}}, 1, 0},
+	} {
+		ins, upd, err := pg.UpdateCompanies(tc.batch)
+		if err != nil {
+			t.Errorf("expected no error updating companies, got %s", err)
+		}
+		if ins != tc.inserted || upd != tc.updated {
+			t.Errorf("expected %d inserted and %d updated, got %d and %d", tc.inserted, tc.updated, ins, upd)
+		}
+	}
+	if _, err := pg.pool.Exec(context.Background(), fmt.Sprintf("DELETE FROM %s WHERE id = $1", pg.SeenTableFullName()), other); err != nil {
+		t.Fatalf("expected no error forgetting a company, got %s", err)
+	}
+	n, err := pg.PostUpdate()
+	if err != nil {
+		t.Errorf("expected no error after the update, got %s", err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 company removed, got %d", n)
+	}
+	if _, err := pg.GetCompany(other); err == nil {
+		t.Errorf("expected %s to be removed", other)
+	}
+	got, err := pg.GetCompany(id)
+	if err != nil {
+		t.Errorf("expected no error getting %s, got %s", id, err)
+	}
+	if !strings.Contains(got, "CAMPINAS") {
+		t.Errorf("expected %s to be updated, got %s", id, got)
+	}
+	for at, exp := range map[string]string{"2025-09-30": "SAO PAULO", "2025-10-31": "CAMPINAS"} {
+		d, _ := time.Parse(time.DateOnly, at)
+		got, err := pg.GetCompanyAt(id, d)
+		if err != nil {
+			t.Errorf("expected no error getting %s at %s, got %s", id, at, err)
+		}
+		if !strings.Contains(got, exp) {
+			t.Errorf("expected %s at %s to contain %s, got %s", id, at, exp, got)
+		}
+	}
+	for n, exp := range map[string]string{
+		id:    `[{"data":"2025-10-12","mudanca":"alteracao"}]`,
+		other: `[{"data":"2025-10-12","mudanca":"inclusao"},{"data":"2025-10-12","mudanca":"exclusao"}]`,
+	} {
+		got, err := pg.GetCompanyHistory(n)
+		if err != nil {
+			t.Errorf("expected no error getting the history of %s, got %s", n, err)
+		}
+		if got != exp {
+			t.Errorf("expected history of %s to be %s, got %s", n, exp, got)
+		}
+	}
+}
+
+func TestPostgresShadowHistory(t *testing.T) {
+	id := "19131243000197"
+	c := loadCompany(t)
+	pg, err := setUpPostgres(id, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := pg.Drop(); err != nil {
+			t.Errorf("expected no error dropping the tables, got %s", err)
+		}
+		pg.Close()
+	}()
+	if err := pg.MetaSave(updatedAtKey, "2025-09-14"); err != nil {
+		t.Fatalf("expected no error saving the updated at date, got %s", err)
+	}
+	if err := pg.UseShadow("20251012"); err != nil {
+		t.Fatalf("expected no error creating the shadow table, got %s", err)
+	}
+	changed := strings.Replace(c, `"SAO PAULO"`, `"CAMPINAS"`, 1)
+	if err := pg.CreateCompanies([][]string{{id, changed}}); err != nil {
+		t.Fatalf("expected no error loading the shadow table, got %s", err)
+	}
+	if err := pg.MetaSave(updatedAtKey, "2025-10-12"); err != nil {
+		t.Fatalf("expected no error saving the shadow updated at date, got %s", err)
+	}
+	if err := pg.Swap(); err != nil {
+		t.Fatalf("expected no error swapping the tables, got %s", err)
+	}
+	defer pg.pool.Exec(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %s", pg.TableFullName(previousTableName)))
+	for at, exp := range map[string]string{"2025-09-30": "SAO PAULO", "2025-10-31": "CAMPINAS"} {
+		d, _ := time.Parse(time.DateOnly, at)
+		got, err := pg.GetCompanyAt(id, d)
+		if err != nil {
+			t.Errorf("expected no error getting %s at %s, got %s", id, at, err)
+		}
+		if !strings.Contains(got, exp) {
+			t.Errorf("expected %s at %s to contain %s, got %s", id, at, exp, got)
+		}
+	}
+	got, err := pg.GetCompanyHistory(id)
+	if err != nil {
+		t.Errorf("expected no error getting the history of %s, got %s", id, err)
+	}
+	if exp := `[{"data":"2025-10-12","mudanca":"alteracao"}]`; got != exp {
+		t.Errorf("expected history of %s to be %s, got %s", id, exp, got)
+	}
+}
+
+func TestPostgresMigrations(t *testing.T) {
+	pg, err := setUpPostgres("19131243000197", loadCompany(t))
+	if err != nil {
+		t.Fatalf("expected no error setting up postgres, got %s", err)
+	}
+	defer func() {
+		if err := pg.Drop(); err != nil {
+			t.Errorf("expected no error dropping the tables, got %s", err)
+		}
+		pg.Close()
+	}()
+	s, err := pg.SchemaStatus()
+	if err != nil {
+		t.Fatalf("expected no error reading the schema status, got %s", err)
+	}
+	if err := s.Check(); err != nil {
+		t.Errorf("expected a new database to be in the latest version, got %s", err)
+	}
+	if err := pg.MetaSave(SchemaVersionKey, "0"); err != nil { // as if created before the migrations
+		t.Fatalf("expected no error resetting the schema version, got %s", err)
+	}
+	if s, err = pg.SchemaStatus(); err != nil || len(s.Pending) != s.Latest {
+		t.Fatalf("expected all migrations to be pending, got %+v (%v)", s, err)
+	}
+	if err := pg.MigrateUp(); err != nil {
+		t.Fatalf("expected no error migrating up, got %s", err)
+	}
+	if s, err = pg.SchemaStatus(); err != nil || s.Check() != nil {
+		t.Errorf("expected the database to be in the latest version, got %+v (%v)", s, err)
+	}
+	if _, err := pg.GetCompany("19131243000197"); err != nil {
+		t.Errorf("expected the company to survive the migrations, got %s", err)
+	}
+}
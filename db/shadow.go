@@ -0,0 +1,75 @@
+package db
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// A shadow release is a full load of the data into a table (or collection)
+// other than the live one, named after the release, e.g. cnpj_20251012. Once
+// it is loaded and validated it replaces the live table, which is kept as
+// cnpj_previous so it can be rolled back.
+const (
+	previousTableName    = companyTableName + "_previous"
+	swapTableName        = companyTableName + "_swap"
+	updatedAtKey         = "updated-at"
+	nextUpdatedAtKey     = "next-updated-at"
+	previousUpdatedAtKey = "prev-updated-at"
+)
+
+var releaseRegex = regexp.MustCompile(`^[0-9]+$`)
+
+// shadowTableName returns the name of the table or collection of a release.
+func shadowTableName(r string) (string, error) {
+	if !releaseRegex.MatchString(r) {
+		return "", fmt.Errorf("invalid release name %q, expected only digits", r)
+	}
+	return fmt.Sprintf("%s_%s", companyTableName, r), nil
+}
+
+// ReleaseFromUpdatedAt returns the release name for an updated at date in the
+// YYYY-MM-DD format, e.g. 20251012 for 2025-10-12.
+func ReleaseFromUpdatedAt(v string) (string, error) {
+	v = strings.TrimSpace(v)
+	if _, err := time.Parse(time.DateOnly, v); err != nil {
+		return "", fmt.Errorf("invalid updated at date %q: %w", v, err)
+	}
+	return strings.ReplaceAll(v, "-", ""), nil
+}
+
+// shadowMetaKey is the metadata key to be used while loading a shadow release:
+// the updated at date is saved apart, and only replaces the live one when
+// the shadow release replaces the live table.
+func shadowMetaKey(shadow bool, k string) string {
+	if shadow && k == updatedAtKey {
+		return nextUpdatedAtKey
+	}
+	return k
+}
+
+// validateShadowUpdatedAt makes sure the updated at date saved by the shadow
+// load matches the release and is not older than the live one (which is
+// empty if there is no live data yet).
+func validateShadowUpdatedAt(release, next, live string) error {
+	r, err := ReleaseFromUpdatedAt(next)
+	if err != nil {
+		return fmt.Errorf("shadow release %s has an invalid updated at: %w", release, err)
+	}
+	if r != release {
+		return fmt.Errorf("shadow release %s was loaded with data updated at %s", release, next)
+	}
+	if live == "" {
+		return nil
+	}
+	l, err := time.Parse(time.DateOnly, strings.TrimSpace(live))
+	if err != nil {
+		return nil // nothing to compare to
+	}
+	n, _ := time.Parse(time.DateOnly, strings.TrimSpace(next))
+	if n.Before(l) {
+		return fmt.Errorf("shadow release %s is older than the live data, updated at %s", release, live)
+	}
+	return nil
+}
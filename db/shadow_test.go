@@ -0,0 +1,189 @@
+package db
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestReleaseFromUpdatedAt(t *testing.T) {
+	for _, tc := range []struct {
+		value    string
+		expected string
+		err      bool
+	}{
+		{"2025-10-12", "20251012", false},
+		{"2025-10-12\n", "20251012", false},
+		{"12/10/2025", "", true},
+		{"", "", true},
+	} {
+		got, err := ReleaseFromUpdatedAt(tc.value)
+		if tc.err && err == nil {
+			t.Errorf("expected error for %q, got nil", tc.value)
+		}
+		if !tc.err && err != nil {
+			t.Errorf("expected no error for %q, got %s", tc.value, err)
+		}
+		if got != tc.expected {
+			t.Errorf("expected release %q for %q, got %q", tc.expected, tc.value, got)
+		}
+	}
+}
+
+func TestShadowTableName(t *testing.T) {
+	n, err := shadowTableName("20251012")
+	if err != nil {
+		t.Errorf("expected no error, got %s", err)
+	}
+	if n != "cnpj_20251012" {
+		t.Errorf("expected cnpj_20251012, got %s", n)
+	}
+	for _, r := range []string{"", "previous", "swap", "2025; DROP TABLE cnpj"} {
+		if _, err := shadowTableName(r); err == nil {
+			t.Errorf("expected error for release %q, got nil", r)
+		}
+	}
+}
+
+func TestShadowMetaKey(t *testing.T) {
+	for _, tc := range []struct {
+		shadow   bool
+		key      string
+		expected string
+	}{
+		{false, "updated-at", "updated-at"},
+		{true, "updated-at", "next-updated-at"},
+		{true, "extra-indexes", "extra-indexes"},
+	} {
+		if got := shadowMetaKey(tc.shadow, tc.key); got != tc.expected {
+			t.Errorf("expected %s for %s (shadow %t), got %s", tc.expected, tc.key, tc.shadow, got)
+		}
+	}
+}
+
+func TestValidateShadowUpdatedAt(t *testing.T) {
+	for _, tc := range []struct {
+		next string
+		live string
+		err  string
+	}{
+		{"2025-10-12", "", ""},
+		{"2025-10-12", "2025-09-14", ""},
+		{"2025-10-12", "2025-10-12", ""},
+		{"2025-10-12", "2025-11-09", "older than the live data"},
+		{"2025-09-14", "", "loaded with data updated at"},
+		{"yesterday", "", "invalid updated at"},
+	} {
+		err := validateShadowUpdatedAt("20251012", tc.next, tc.live)
+		if tc.err == "" && err != nil {
+			t.Errorf("expected no error for %s (live %s), got %s", tc.next, tc.live, err)
+		}
+		if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("expected error containing %q for %s (live %s), got %v", tc.err, tc.next, tc.live, err)
+		}
+	}
+}
+
+func TestSwapTemplate(t *testing.T) {
+	s := postgresSwap{
+		Schema:           "public",
+		Meta:             "public.meta",
+		Drop:             previousTableName,
+		Renames:          []postgresRename{newPostgresRename("cnpj", previousTableName), newPostgresRename("cnpj_20251012", "cnpj")},
+		UpdatedAtKey:     updatedAtKey,
+		NextUpdatedAtKey: nextUpdatedAtKey,
+	}
+	q, err := renderSQLTemplate("postgres", "swap", s)
+	if err != nil {
+		t.Fatalf("expected no error rendering the swap template, got %s", err)
+	}
+	for _, exp := range []string{
+		"DROP TABLE IF EXISTS public.cnpj_previous CASCADE;",
+		"ALTER TABLE public.cnpj RENAME TO cnpj_previous;",
+		"ALTER TABLE public.cnpj_20251012 RENAME TO cnpj;",
+		"'idx_cnpj_20251012_'",
+		"DELETE FROM public.meta WHERE key = 'next-updated-at';",
+	} {
+		if !strings.Contains(q, exp) {
+			t.Errorf("expected swap query to contain %q, got %s", exp, q)
+		}
+	}
+	if strings.Index(q, "RENAME TO cnpj_previous") > strings.Index(q, "RENAME TO cnpj;") {
+		t.Error("expected the live table to be renamed before the shadow table")
+	}
+}
+
+func TestSwapTemplateArchive(t *testing.T) {
+	s := postgresSwap{
+		Schema: "public",
+		Meta:   "public.meta",
+		Archive: &postgresArchive{
+			Live:           "public.cnpj",
+			Shadow:         "public.cnpj_20251012",
+			History:        "public.cnpj_history",
+			IDFieldName:    "id",
+			JSONFieldName:  "json",
+			HashFieldName:  "hash",
+			SinceFieldName: "since",
+			UntilFieldName: "until",
+			UpdatedAt:      "2025-10-12",
+		},
+		Renames: []postgresRename{newPostgresRename("cnpj", previousTableName), newPostgresRename("cnpj_20251012", "cnpj")},
+	}
+	q, err := renderSQLTemplate("postgres", "swap", s)
+	if err != nil {
+		t.Fatalf("expected no error rendering the swap template, got %s", err)
+	}
+	for _, exp := range []string{
+		"INSERT INTO public.cnpj_history (id, since, until, json)",
+		"SELECT c.id, c.since, '2025-10-12'::date, c.json",
+		"WHERE s.id IS NULL OR c.hash IS DISTINCT FROM s.hash",
+		"SET since = '2025-10-12'::date",
+	} {
+		if !strings.Contains(q, exp) {
+			t.Errorf("expected swap query to contain %q, got %s", exp, q)
+		}
+	}
+	if strings.Index(q, "INSERT INTO public.cnpj_history") > strings.Index(q, "RENAME TO cnpj_previous") {
+		t.Error("expected the live table to be archived before it is renamed")
+	}
+}
+
+func TestSwapCollections(t *testing.T) {
+	boom := errors.New("boom")
+	for _, tc := range []struct {
+		name     string
+		live     bool
+		fail     string // the rename that fails, as from>to
+		expected string // the collections after the swap
+		err      bool
+	}{
+		{"first load", false, "", "cnpj_20251012>cnpj", false},
+		{"with live collection", true, "", "cnpj>cnpj_previous cnpj_20251012>cnpj", false},
+		{"first rename fails", true, "cnpj>cnpj_previous", "", true},
+		{"second rename fails", true, "cnpj_20251012>cnpj", "cnpj>cnpj_previous cnpj_previous>cnpj", true},
+		{"second rename fails on first load", false, "cnpj_20251012>cnpj", "", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			rename := func(from, to string) error {
+				r := from + ">" + to
+				if r == tc.fail {
+					return boom
+				}
+				got = append(got, r)
+				return nil
+			}
+			err := swapCollections(rename, "cnpj_20251012", tc.live)
+			if tc.err && !errors.Is(err, boom) {
+				t.Errorf("expected the rename error, got %v", err)
+			}
+			if !tc.err && err != nil {
+				t.Errorf("expected no error, got %s", err)
+			}
+			if s := strings.Join(got, " "); s != tc.expected {
+				t.Errorf("expected renames %q, got %q", tc.expected, s)
+			}
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/cuducos/minha-receita/transform"
+	"github.com/huandu/go-sqlbuilder"
+	_ "modernc.org/sqlite" // pure Go driver, so the binary does not need CGO
+)
+
+// sqlitePragmas are set in every connection: WAL allows reads while the data
+// is loaded, busy timeout and immediate transactions serialize the concurrent
+// writers instead of failing with "database is locked".
+const sqlitePragmas = "_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(60000)&_txlock=immediate"
+
+// SQLite database interface, storing everything in a single file.
+type SQLite struct {
+	db               *sql.DB
+	path             string
+	getCompanyQuery  string
+	getManyQuery     string
+	insertQuery      string
+	metaReadQuery    string
+	metaSaveQuery    string
+	metaDeleteQuery  string
+	CompanyTableName string
+	MetaTableName    string
+	CursorFieldName  string
+	IDFieldName      string
+	JSONFieldName    string
+	KeyFieldName     string
+	ValueFieldName   string
+	ExtraIndexes     []ExtraIndex
+	releases         *releaseCache
+}
+
+func (s *SQLite) renderTemplate(key string) (string, error) {
+	return renderSQLTemplate("sqlite", key, s)
+}
+
+func (s *SQLite) exec(key, desc string) error {
+	q, err := s.renderTemplate(key)
+	if err != nil {
+		return fmt.Errorf("error rendering %s template: %w", desc, err)
+	}
+	if _, err := s.db.Exec(q); err != nil {
+		return fmt.Errorf("error during %s: %s\n%w", desc, q, err)
+	}
+	return nil
+}
+
+// Close closes the SQLite connection.
+func (s *SQLite) Close() {
+	if err := s.db.Close(); err != nil {
+		slog.Error("Error closing SQLite", "path", s.path, "error", err)
+	}
+}
+
+// Create creates the required database tables.
+func (s *SQLite) Create() error {
+	slog.Info("Creating", "table", s.CompanyTableName, "path", s.path)
+	return s.exec("create", "create")
+}
+
+// Drop drops the database tables created by `Create`.
+func (s *SQLite) Drop() error {
+	slog.Info("Dropping", "table", s.CompanyTableName, "path", s.path)
+	return s.exec("drop", "drop")
+}
+
+// PreLoad runs before starting to load data into the database. Currently it
+// drops the CNPJ index, so inserts are faster.
+func (s *SQLite) PreLoad() error { return s.exec("pre_load", "pre load") }
+
+// PostLoad runs after loading data into the database. Currently it creates
+// the CNPJ index and updates the statistics used by the query planner.
+func (s *SQLite) PostLoad() error { return s.exec("post_load", "post load") }
+
+// CreateCompanies inserts a batch of companies in a single transaction. It
+// expects an array and each item should be another array with only two items:
+// the ID and the JSON field values.
+func (s *SQLite) CreateCompanies(batch [][]string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error("could not rollback sqlite transaction", "error", err)
+		}
+	}()
+	stmt, err := tx.Prepare(s.insertQuery)
+	if err != nil {
+		return fmt.Errorf("error preparing insert statement: %w", err)
+	}
+	defer stmt.Close()
+	for _, r := range batch {
+		if _, err := stmt.Exec(r[0], r[1]); err != nil {
+			return fmt.Errorf("error inserting cnpj %s into sqlite: %w", r[0], err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error while importing data to sqlite: %w", err)
+	}
+	return nil
+}
+
+// CreateCompaniesStructured is not supported for SQLite (it is implemented
+// only for PostgreSQL)
+func (s *SQLite) CreateCompaniesStructured(batch [][]string) error {
+	return fmt.Errorf("CreateCompaniesStructured is not supported for SQLite - use PostgreSQL for structured tables")
+}
+
+// GetCompany returns the JSON of a company based on a CNPJ number.
+func (s *SQLite) GetCompany(id string) (string, error) {
+	var j string
+	if err := s.db.QueryRow(s.getCompanyQuery, id).Scan(&j); err != nil {
+		return "", fmt.Errorf("error looking for cnpj %s: %w", id, err)
+	}
+	return j, nil
+}
+
+// GetCompanies returns the JSON of the companies found for a batch of CNPJ
+// numbers, indexed by CNPJ. CNPJs not found are not in the map.
+func (s *SQLite) GetCompanies(ctx context.Context, ids []string) (map[string]string, error) {
+	a, err := json.Marshal(ids)
+	if err != nil {
+		return nil, fmt.Errorf("error serializing %d cnpjs: %w", len(ids), err)
+	}
+	rows, err := s.db.QueryContext(ctx, s.getManyQuery, string(a))
+	if err != nil {
+		return nil, fmt.Errorf("error looking for %d cnpjs: %w", len(ids), err)
+	}
+	defer rows.Close()
+	cs := make(map[string]string)
+	for rows.Next() {
+		var id, j string
+		if err := rows.Scan(&id, &j); err != nil {
+			return nil, fmt.Errorf("error reading cnpjs: %w", err)
+		}
+		cs[id] = j
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %d cnpjs: %w", len(ids), err)
+	}
+	return cs, nil
+}
+
+func jsonField(f, path string) string { return fmt.Sprintf("json_extract(%s, '$.%s')", f, path) }
+
+func asArgs[T any](vs []T) []any {
+	r := make([]any, len(vs))
+	for i, v := range vs {
+		r[i] = v
+	}
+	return r
+}
+
+// inArray checks if any item of a JSON array has a field with one of the
+// values (e.g. any partner in the `qsa` with one of the CPFs). The JSON column
+// is qualified by the table name because `json_each` has a hidden column also
+// called `json`.
+func (s *SQLite) inArray(b *sqlbuilder.SelectBuilder, array, field string, vs []any) string {
+	sub := sqlbuilder.SQLite.NewSelectBuilder()
+	sub.Select("1")
+	sub.From(fmt.Sprintf("json_each(%s.%s, '$.%s')", s.CompanyTableName, s.JSONFieldName, array))
+	sub.Where(sub.In(jsonField("value", field), vs...))
+	return b.Exists(sub)
+}
+
+// sqliteBackend identifies SQLite in the search cursors.
+const sqliteBackend = "sqlite"
+
+// liveRelease is the updated at date of the data being served, or an empty
+// string if the data was not loaded yet.
+func (s *SQLite) liveRelease() (string, error) {
+	return s.releases.get(func() (string, error) {
+		r, err := s.MetaRead(updatedAtKey)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return r, err
+	})
+}
+
+// searchQuery sorts the results by CNPJ, which (unlike the auto-increment
+// cursor column) points to the same company after the data is reloaded.
+func (s *SQLite) searchQuery(q *Query, c *cursor) *sqlbuilder.SelectBuilder {
+	j := s.JSONFieldName
+	b := sqlbuilder.SQLite.NewSelectBuilder()
+	b.Select(s.IDFieldName, j)
+	b.From(s.CompanyTableName)
+	b.OrderByAsc(s.IDFieldName)
+	b.Limit(int(q.Limit))
+	if c != nil {
+		b.Where(b.GreaterThan(s.IDFieldName, c.CNPJ()))
+	}
+	if len(q.UF) > 0 {
+		b.Where(b.In(jsonField(j, "uf"), asArgs(q.UF)...))
+	}
+	if len(q.Municipio) > 0 {
+		vs := asArgs(q.Municipio)
+		b.Where(b.Or(
+			b.In(jsonField(j, "codigo_municipio"), vs...),
+			b.In(jsonField(j, "codigo_municipio_ibge"), vs...),
+		))
+	}
+	if len(q.NaturezaJuridica) > 0 {
+		b.Where(b.In(jsonField(j, "codigo_natureza_juridica"), asArgs(q.NaturezaJuridica)...))
+	}
+	if len(q.CNAEFiscal) > 0 {
+		b.Where(b.In(jsonField(j, "cnae_fiscal"), asArgs(q.CNAEFiscal)...))
+	}
+	if len(q.CNAE) > 0 {
+		vs := asArgs(q.CNAE)
+		b.Where(b.Or(
+			b.In(jsonField(j, "cnae_fiscal"), vs...),
+			s.inArray(b, "cnaes_secundarios", "codigo", vs),
+		))
+	}
+	if len(q.CNPF) > 0 {
+		b.Where(s.inArray(b, "qsa", "cnpj_cpf_do_socio", asArgs(q.CNPF)))
+	}
+	return b
+}
+
+// Search returns paginated results with JSON for companies bases on a search
+// query
+func (s *SQLite) Search(ctx context.Context, q *Query) (string, error) {
+	if err := q.checkSupported("SQLite"); err != nil {
+		return "", err
+	}
+	var r string
+	var err error
+	if q.Cursor != nil && *q.Cursor != "" {
+		if r, err = s.liveRelease(); err != nil {
+			return "", err
+		}
+	}
+	c, err := q.cursor(sqliteBackend, r)
+	if err != nil {
+		return "", err
+	}
+	sq, a := s.searchQuery(q, c).Build()
+	slog.Debug("paginated search", "query", sq, "args", a)
+	rows, err := s.db.QueryContext(ctx, sq, a...)
+	if err != nil {
+		return "", fmt.Errorf("error searching for %#v: %w", q, err)
+	}
+	defer rows.Close()
+	var cs []string
+	var id string
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&id, &c); err != nil {
+			return "", fmt.Errorf("error reading search result for %#v: %w", q, err)
+		}
+		cs = append(cs, c)
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("error reading search result for %#v: %w", q, err)
+	}
+	var cur string
+	if len(cs) == int(q.Limit) {
+		if r, err = s.liveRelease(); err != nil {
+			return "", err
+		}
+		if cur, err = newCursor(sqliteBackend, r, q, id, cs[len(cs)-1]); err != nil {
+			return "", err
+		}
+	}
+	return newPage(cs, cur), nil
+}
+
+// MetaSave saves a key/value pair in the metadata table.
+func (s *SQLite) MetaSave(k, v string) error {
+	if _, err := s.db.Exec(s.metaSaveQuery, k, v); err != nil {
+		return fmt.Errorf("error saving %s to metadata: %w", k, err)
+	}
+	if k == updatedAtKey {
+		s.releases.reset()
+	}
+	return nil
+}
+
+// MetaRead reads a key/value pair from the metadata table.
+func (s *SQLite) MetaRead(k string) (string, error) {
+	var v string
+	if err := s.db.QueryRow(s.metaReadQuery, k).Scan(&v); err != nil {
+		return "", fmt.Errorf("error reading for metadata key %s: %w", k, err)
+	}
+	return v, nil
+}
+
+// MetaDelete removes a key/value pair from the metadata table.
+func (s *SQLite) MetaDelete(k string) error {
+	if _, err := s.db.Exec(s.metaDeleteQuery, k); err != nil {
+		return fmt.Errorf("error deleting %s from metadata: %w", k, err)
+	}
+	return nil
+}
+
+// CreateExtraIndexes creates JSON expression indexes. SQLite cannot index
+// values inside JSON arrays, so nested indexes (e.g. `qsa.nome_socio`) are
+// skipped and searches on them scan the table.
+func (s *SQLite) CreateExtraIndexes(idxs []string) error {
+	if err := transform.ValidateIndexes(idxs); err != nil {
+		return fmt.Errorf("index name error: %w", err)
+	}
+	var n int
+	for _, idx := range idxs {
+		if strings.Contains(idx, ".") {
+			slog.Warn("SQLite cannot index values inside JSON arrays, skipping", "index", idx)
+			continue
+		}
+		s.ExtraIndexes = append(s.ExtraIndexes, ExtraIndex{
+			IsRoot: true,
+			Name:   fmt.Sprintf("json.%s", idx),
+			Value:  idx,
+		})
+		n++
+	}
+	if err := s.exec("extra_indexes", "extra indexes"); err != nil {
+		return err
+	}
+	slog.Info(fmt.Sprintf("%d Indexes successfully created in the table %s", n, s.CompanyTableName))
+	return nil
+}
+
+// NewSQLite opens (or creates) a SQLite database file. The URI is the path to
+// the file prefixed by `sqlite://` (e.g. `sqlite://minha-receita.db` or
+// `sqlite:///var/lib/minha-receita.db`).
+func NewSQLite(uri string) (SQLite, error) {
+	pth := strings.TrimPrefix(uri, "sqlite://")
+	if pth == "" {
+		return SQLite{}, fmt.Errorf("missing the path to the sqlite file in %s", uri)
+	}
+	conn, err := sql.Open("sqlite", fmt.Sprintf("file:%s?%s", pth, sqlitePragmas))
+	if err != nil {
+		return SQLite{}, fmt.Errorf("could not open sqlite database %s: %w", pth, err)
+	}
+	s := SQLite{
+		db:               conn,
+		path:             pth,
+		CompanyTableName: companyTableName,
+		MetaTableName:    metaTableName,
+		CursorFieldName:  cursorFieldName,
+		IDFieldName:      idFieldName,
+		JSONFieldName:    jsonFieldName,
+		KeyFieldName:     keyFieldName,
+		ValueFieldName:   valueFieldName,
+		releases:         &releaseCache{},
+	}
+	for _, t := range []struct {
+		key   string
+		query *string
+	}{
+		{"get", &s.getCompanyQuery},
+		{"get_many", &s.getManyQuery},
+		{"insert", &s.insertQuery},
+		{"meta_read", &s.metaReadQuery},
+		{"meta_save", &s.metaSaveQuery},
+		{"meta_delete", &s.metaDeleteQuery},
+	} {
+		if *t.query, err = s.renderTemplate(t.key); err != nil {
+			return SQLite{}, fmt.Errorf("error rendering %s template: %w", t.key, err)
+		}
+	}
+	if err := conn.Ping(); err != nil {
+		return SQLite{}, fmt.Errorf("could not connect to sqlite: %w", err)
+	}
+	return s, nil
+}
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS {{ .CompanyTableName }} (
+    {{ .CursorFieldName }} INTEGER PRIMARY KEY AUTOINCREMENT,
+    {{ .IDFieldName }} TEXT NOT NULL,
+    {{ .JSONFieldName }} TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS {{ .MetaTableName }} (
+    {{ .KeyFieldName }} TEXT NOT NULL PRIMARY KEY,
+    {{ .ValueFieldName }} TEXT NOT NULL
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS {{ .CompanyTableName }};
+DROP TABLE IF EXISTS {{ .MetaTableName }};
@@ -0,0 +1,7 @@
+{{ $tableName := .CompanyTableName }}
+{{ $jsonField := .JSONFieldName }}
+{{ range .ExtraIndexes }}
+    {{ if .IsRoot }}
+        CREATE INDEX IF NOT EXISTS "idx_{{ .Name }}" ON {{ $tableName }} (json_extract({{ $jsonField }}, '$.{{ .Value }}'));
+    {{ end }}
+{{ end }}
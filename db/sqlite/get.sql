@@ -0,0 +1,3 @@
+SELECT {{ .JSONFieldName }}
+FROM {{ .CompanyTableName }}
+WHERE {{ .IDFieldName }} = ?;
@@ -0,0 +1,2 @@
+CREATE UNIQUE INDEX IF NOT EXISTS {{ .CompanyTableName }}_id ON {{ .CompanyTableName }} ({{ .IDFieldName }});
+ANALYZE;
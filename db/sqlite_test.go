@@ -0,0 +1,197 @@
+package db
+
+import (
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func setUpSQLite(t *testing.T, id, c string) *SQLite {
+	db, err := NewSQLite("sqlite://" + filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("expected no error connecting to sqlite, got %s", err)
+	}
+	t.Cleanup(db.Close)
+	if err := db.Create(); err != nil {
+		t.Fatalf("expected no error creating the tables, got %s", err)
+	}
+	if err := db.PreLoad(); err != nil {
+		t.Fatalf("expected no error pre load on sqlite, got %s", err)
+	}
+	if err := db.CreateCompanies([][]string{{id, c}}); err != nil {
+		t.Fatalf("expected no error saving a company to sqlite, got %s", err)
+	}
+	if err := db.PostLoad(); err != nil {
+		t.Fatalf("expected no error post load on sqlite, got %s", err)
+	}
+	return &db
+}
+
+func loadCompany(t *testing.T) string {
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		t.Fatalf("error reading company JSON file: %s", err)
+	}
+	return string(b)
+}
+
+func TestSQLiteRetrieve(t *testing.T) {
+	c := loadCompany(t)
+	db := setUpSQLite(t, "33683111000280", c)
+	got, err := db.GetCompany("33683111000280")
+	if err != nil {
+		t.Errorf("expected no error getting a company, got %s", err)
+	}
+	assertCompaniesAreEqual(t, got, c)
+	if _, err := db.GetCompany("19131243000197"); err == nil {
+		t.Error("expected error getting a company that does not exist, got nil")
+	}
+	cs, err := db.GetCompanies(context.Background(), []string{"33683111000280", "19131243000197"})
+	if err != nil {
+		t.Errorf("expected no error getting companies, got %s", err)
+	}
+	if len(cs) != 1 {
+		t.Errorf("expected 1 company, got %d", len(cs))
+	}
+	assertCompaniesAreEqual(t, cs["33683111000280"], c)
+	if err := db.MetaSave("answer", "42"); err != nil {
+		t.Errorf("expected no error writing to the metadata table, got %s", err)
+	}
+	if err := db.MetaSave("answer", "forty-two"); err != nil {
+		t.Errorf("expected no error re-writing to the metadata table, got %s", err)
+	}
+	m, err := db.MetaRead("answer")
+	if err != nil {
+		t.Errorf("expected no error getting metadata, got %s", err)
+	}
+	if m != "forty-two" {
+		t.Errorf("expected forty-two as the answer, got %s", m)
+	}
+	if _, err := db.MetaRead("question"); err == nil {
+		t.Error("expected error reading a missing metadata key, got nil")
+	}
+	if err := db.MetaDelete("answer"); err != nil {
+		t.Errorf("expected no error deleting metadata, got %s", err)
+	}
+	if _, err := db.MetaRead("answer"); err == nil {
+		t.Error("expected error reading a deleted metadata key, got nil")
+	}
+	if err := db.MetaDelete("question"); err != nil {
+		t.Errorf("expected no error deleting a missing metadata key, got %s", err)
+	}
+	if err := db.MetaSave("the-ultimate-question", "forty-two"); err != nil {
+		t.Errorf("expected no error saving a long metadata key, got %s", err)
+	}
+	if m, err := db.MetaRead("the-ultimate-question"); err != nil || m != "forty-two" {
+		t.Errorf("expected forty-two as the answer to the long key, got %s (%v)", m, err)
+	}
+}
+
+func TestSQLiteSearch(t *testing.T) {
+	db := setUpSQLite(t, "33683111000280", loadCompany(t))
+	for _, tc := range searchCases {
+		t.Run(tc.name(db), func(t *testing.T) {
+			s, err := db.Search(context.Background(), NewQuery(tc.params))
+			if err != nil {
+				t.Errorf("expected no error searching, got %s", err)
+				return
+			}
+			assertSearchCount(t, s, tc)
+		})
+	}
+}
+
+func TestSQLiteSearchPagination(t *testing.T) {
+	c := loadCompany(t)
+	db := setUpSQLite(t, "33683111000280", c)
+	if err := db.CreateCompanies([][]string{{"33683111000281", c}}); err != nil {
+		t.Fatalf("expected no error saving a company to sqlite, got %s", err)
+	}
+	q := NewQuery(map[string][]string{"uf": {"sp"}, "limit": {"1"}})
+	for i, exp := range []int{1, 1, 0} {
+		s, err := db.Search(context.Background(), q)
+		if err != nil {
+			t.Fatalf("expected no error searching page %d, got %s", i+1, err)
+		}
+		var p page
+		if err := json.Unmarshal([]byte(s), &p); err != nil {
+			t.Fatalf("expected no error deserializing page %d, got %s", i+1, err)
+		}
+		if len(p.Data) != exp {
+			t.Errorf("expected %d results in page %d, got %d", exp, i+1, len(p.Data))
+		}
+		if exp == 0 && p.Cursor != nil {
+			t.Errorf("expected no cursor in the last page, got %s", *p.Cursor)
+		}
+		if exp == 1 && p.Cursor == nil {
+			t.Fatalf("expected a cursor in page %d, got nil", i+1)
+		}
+		q.Cursor = p.Cursor
+	}
+	invalid := "forty-two"
+	q.Cursor = &invalid
+	if _, err := db.Search(context.Background(), q); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor for an invalid cursor, got %v", err)
+	}
+}
+
+func TestSQLiteSearchExpiredCursor(t *testing.T) {
+	c := loadCompany(t)
+	db := setUpSQLite(t, "33683111000280", c)
+	load := func(updatedAt string, ids ...string) {
+		for _, id := range ids {
+			if err := db.CreateCompanies([][]string{{id, c}}); err != nil {
+				t.Fatalf("expected no error saving %s to sqlite, got %s", id, err)
+			}
+		}
+		if err := db.MetaSave("updated-at", updatedAt); err != nil {
+			t.Fatalf("expected no error saving updated at, got %s", err)
+		}
+	}
+	load("2026-09-13", "33683111000281")
+	q := NewQuery(map[string][]string{"uf": {"sp"}, "limit": {"1"}})
+	s, err := db.Search(context.Background(), q)
+	if err != nil {
+		t.Fatalf("expected no error searching, got %s", err)
+	}
+	var p page
+	if err := json.Unmarshal([]byte(s), &p); err != nil {
+		t.Fatalf("expected no error deserializing the page, got %s", err)
+	}
+	if p.Cursor == nil {
+		t.Fatal("expected a cursor in the first page, got nil")
+	}
+	if err := db.Drop(); err != nil {
+		t.Fatalf("expected no error dropping the tables, got %s", err)
+	}
+	if err := db.Create(); err != nil {
+		t.Fatalf("expected no error creating the tables, got %s", err)
+	}
+	load("2026-10-11", "33683111000281", "33683111000280") // same companies, different cursor column
+	q.Cursor = p.Cursor
+	if _, err := db.Search(context.Background(), q); !errors.Is(err, ErrExpiredCursor) {
+		t.Errorf("expected ErrExpiredCursor after reloading the data, got %v", err)
+	}
+}
+
+func TestSQLiteCreateExtraIndexes(t *testing.T) {
+	db := setUpSQLite(t, "33683111000280", loadCompany(t))
+	if err := db.CreateExtraIndexes([]string{"teste.index1"}); err == nil {
+		t.Error("expected errors running extra indexes, got nil")
+	}
+	if err := db.CreateExtraIndexes([]string{"uf", "qsa.cnpj_cpf_do_socio"}); err != nil {
+		t.Fatalf("expected no error creating extra indexes, got %s", err)
+	}
+	var n int
+	q := fmt.Sprintf("SELECT count(*) FROM sqlite_master WHERE type = 'index' AND tbl_name = '%s' AND name LIKE 'idx_json.%%'", db.CompanyTableName)
+	if err := db.db.QueryRow(q).Scan(&n); err != nil {
+		t.Fatalf("expected no error counting indexes, got %s", err)
+	}
+	if n != 1 {
+		t.Errorf("expected only the root index to be created, got %d indexes", n)
+	}
+}
@@ -0,0 +1,431 @@
+// Package export runs long searches in the background, writing all the
+// companies matching a `db.Query` to a file in the local disk (CSV, NDJSON or
+// Parquet). Jobs go through a bounded queue consumed by a pool of workers, and
+// their state is persisted in the database meta storage so they survive
+// restarts.
+package export
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cuducos/minha-receita/db"
+)
+
+const (
+	pageSize        = 1024 // companies fetched from the database at once
+	pageTimeout     = 90 * time.Second
+	cleanupInterval = time.Minute
+	metaKeyPrefix   = "export-"
+	metaIndexKey    = "export-jobs"
+)
+
+var (
+	ErrQueueFull     = errors.New("export queue is full")
+	ErrInvalidFormat = errors.New("invalid export format")
+)
+
+type Format string
+
+const (
+	CSV     Format = "csv"
+	NDJSON  Format = "ndjson"
+	Parquet Format = "parquet"
+)
+
+// ParseFormat validates an export format, defaulting to CSV.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case "":
+		return CSV, nil
+	case CSV, NDJSON, Parquet:
+		return f, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrInvalidFormat, s)
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case NDJSON:
+		return "application/x-ndjson"
+	case Parquet:
+		return "application/vnd.apache.parquet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+type Status string
+
+const (
+	Queued  Status = "queued"
+	Running Status = "running"
+	Done    Status = "done"
+	Failed  Status = "failed"
+)
+
+// Job is an export request and its progress.
+type Job struct {
+	ID         string     `json:"id"`
+	Format     Format     `json:"format"`
+	Query      db.Query   `json:"query"`
+	Status     Status     `json:"status"`
+	Exported   int        `json:"exported"` // number of companies written so far
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Finished is true when the job is not going to change anymore.
+func (j *Job) Finished() bool { return j.Status == Done || j.Status == Failed }
+
+// FileName is the name of the exported file (e.g. `minha-receita-1a2b3c4d.csv`).
+func (j *Job) FileName() string {
+	return fmt.Sprintf("minha-receita-%s.%s", j.ID, j.Format)
+}
+
+type database interface {
+	Search(context.Context, *db.Query) (string, error)
+	MetaSave(string, string) error
+	MetaRead(string) (string, error)
+	MetaDelete(string) error
+}
+
+type Config struct {
+	Dir       string        // where exported files are saved
+	Workers   int           // number of jobs running at the same time
+	QueueSize int           // maximum number of jobs waiting for a worker
+	Retention time.Duration // how long finished jobs (and their files) are kept
+}
+
+// Manager queues, runs and keeps track of export jobs.
+type Manager struct {
+	db    database
+	cfg   Config
+	queue chan string
+	mu    sync.RWMutex
+	jobs  map[string]*Job
+}
+
+// New creates a manager, loading the jobs persisted in the meta storage.
+func New(db database, cfg Config) (*Manager, error) {
+	if cfg.Workers < 1 {
+		return nil, fmt.Errorf("export needs at least one worker, got %d", cfg.Workers)
+	}
+	if cfg.QueueSize < 1 {
+		return nil, fmt.Errorf("export queue size must be positive, got %d", cfg.QueueSize)
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("could not create export directory %s: %w", cfg.Dir, err)
+	}
+	m := Manager{db: db, cfg: cfg, queue: make(chan string, cfg.QueueSize), jobs: make(map[string]*Job)}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (m *Manager) load() error {
+	s, err := m.db.MetaRead(metaIndexKey)
+	if err != nil || s == "" {
+		slog.Info("No previous export jobs found", "error", err)
+		return nil
+	}
+	var ids []string
+	if err := json.Unmarshal([]byte(s), &ids); err != nil {
+		return fmt.Errorf("could not parse the export jobs index: %w", err)
+	}
+	for _, id := range ids {
+		s, err := m.db.MetaRead(metaKeyPrefix + id)
+		if err != nil {
+			slog.Warn("Could not load export job", "id", id, "error", err)
+			continue
+		}
+		var j Job
+		if err := json.Unmarshal([]byte(s), &j); err != nil {
+			slog.Warn("Could not parse export job", "id", id, "error", err)
+			continue
+		}
+		m.jobs[j.ID] = &j
+	}
+	return nil
+}
+
+// save persists a job, and the index of jobs if idx is true. It should be
+// called with the lock held.
+func (m *Manager) save(j *Job, idx bool) error {
+	b, err := json.Marshal(j)
+	if err != nil {
+		return fmt.Errorf("could not serialize export job %s: %w", j.ID, err)
+	}
+	if err := m.db.MetaSave(metaKeyPrefix+j.ID, string(b)); err != nil {
+		return fmt.Errorf("could not save export job %s: %w", j.ID, err)
+	}
+	if idx {
+		return m.saveIndex()
+	}
+	return nil
+}
+
+func (m *Manager) saveIndex() error {
+	ids := make([]string, 0, len(m.jobs))
+	for id := range m.jobs {
+		ids = append(ids, id)
+	}
+	b, err := json.Marshal(ids)
+	if err != nil {
+		return fmt.Errorf("could not serialize the export jobs index: %w", err)
+	}
+	if err := m.db.MetaSave(metaIndexKey, string(b)); err != nil {
+		return fmt.Errorf("could not save the export jobs index: %w", err)
+	}
+	return nil
+}
+
+func (m *Manager) newID() (string, error) {
+	for {
+		b := make([]byte, 4)
+		if _, err := rand.Read(b); err != nil {
+			return "", fmt.Errorf("could not create export job id: %w", err)
+		}
+		id := hex.EncodeToString(b)
+		if _, ok := m.jobs[id]; !ok {
+			return id, nil
+		}
+	}
+}
+
+// Submit creates a job and puts it in the queue. It fails with ErrQueueFull
+// when there are already too many jobs waiting.
+func (m *Manager) Submit(q db.Query, f Format) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.queue) == cap(m.queue) {
+		return Job{}, ErrQueueFull
+	}
+	id, err := m.newID()
+	if err != nil {
+		return Job{}, err
+	}
+	q.Cursor = nil
+	q.Limit = 0
+	j := Job{ID: id, Format: f, Query: q, Status: Queued, CreatedAt: time.Now()}
+	m.jobs[id] = &j
+	if err := m.save(&j, true); err != nil {
+		delete(m.jobs, id)
+		return Job{}, err
+	}
+	select {
+	case m.queue <- id:
+	default: // jobs resumed by Start are queued without the lock
+		delete(m.jobs, id)
+		if err := m.db.MetaDelete(metaKeyPrefix + id); err != nil {
+			slog.Warn("Could not clear export job", "id", id, "error", err)
+		}
+		if err := m.saveIndex(); err != nil {
+			slog.Warn("Could not update export jobs index", "error", err)
+		}
+		return Job{}, ErrQueueFull
+	}
+	return j, nil
+}
+
+// Job returns a copy of a job.
+func (m *Manager) Job(id string) (Job, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *j, true
+}
+
+// Path is the location of the exported file of a job in the local disk.
+func (m *Manager) Path(j Job) string {
+	return filepath.Join(m.cfg.Dir, j.FileName())
+}
+
+func (m *Manager) update(id string, f func(*Job)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return
+	}
+	f(j)
+	if err := m.save(j, false); err != nil {
+		slog.Error("Could not persist export job", "id", id, "error", err)
+	}
+}
+
+func (m *Manager) finish(id string, err error) {
+	m.update(id, func(j *Job) {
+		t := time.Now()
+		j.FinishedAt = &t
+		j.Status = Done
+		if err != nil {
+			j.Status = Failed
+			j.Error = err.Error()
+		}
+	})
+}
+
+func (m *Manager) run(ctx context.Context, id string) error {
+	var j Job
+	m.update(id, func(p *Job) {
+		p.Status = Running
+		p.Exported = 0
+		j = *p
+	})
+	pth := m.Path(j)
+	tmp := pth + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("could not create %s: %w", tmp, err)
+	}
+	defer func() {
+		if err := os.Remove(tmp); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("Could not remove temporary export file", "path", tmp, "error", err)
+		}
+	}()
+	defer f.Close()
+	w, err := newRowWriter(j.Format, f)
+	if err != nil {
+		return err
+	}
+	q := j.Query
+	q.Limit = pageSize
+	for {
+		ctx, cancel := context.WithTimeout(ctx, pageTimeout)
+		s, err := m.db.Search(ctx, &q)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("error searching companies: %w", err)
+		}
+		var p struct {
+			Data   []jsontext.Value `json:"data"`
+			Cursor *string          `json:"cursor"`
+		}
+		if err := json.Unmarshal([]byte(s), &p); err != nil {
+			return fmt.Errorf("could not parse search results: %w", err)
+		}
+		for _, c := range p.Data {
+			if err := w.write(c); err != nil {
+				return fmt.Errorf("could not write company to %s: %w", tmp, err)
+			}
+		}
+		m.update(id, func(j *Job) { j.Exported += len(p.Data) })
+		if p.Cursor == nil || len(p.Data) == 0 {
+			break
+		}
+		q.Cursor = p.Cursor
+	}
+	if err := w.close(); err != nil {
+		return fmt.Errorf("could not finish writing %s: %w", tmp, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("could not close %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, pth); err != nil {
+		return fmt.Errorf("could not move %s to %s: %w", tmp, pth, err)
+	}
+	return nil
+}
+
+func (m *Manager) worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-m.queue:
+			slog.Info("Starting export job", "id", id)
+			err := m.run(ctx, id)
+			if ctx.Err() != nil { // interrupted, it will run again after restart
+				return
+			}
+			if err != nil {
+				slog.Error("Export job failed", "id", id, "error", err)
+			}
+			m.finish(id, err)
+		}
+	}
+}
+
+// cleanup removes the jobs (and their files) finished for longer than the
+// retention period.
+func (m *Manager) cleanup() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int
+	for id, j := range m.jobs {
+		if !j.Finished() || j.FinishedAt == nil || time.Since(*j.FinishedAt) < m.cfg.Retention {
+			continue
+		}
+		if err := os.Remove(m.Path(*j)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("Could not remove exported file", "id", id, "error", err)
+			continue
+		}
+		if err := m.db.MetaDelete(metaKeyPrefix + id); err != nil {
+			slog.Warn("Could not clear export job", "id", id, "error", err)
+		}
+		delete(m.jobs, id)
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	if err := m.saveIndex(); err != nil {
+		slog.Error("Could not update export jobs index", "error", err)
+	}
+	slog.Info("Removed expired export jobs", "count", n)
+}
+
+// Start spins up the workers and the clean up routine, and re-queues jobs that
+// were not finished before the last shutdown. It returns immediately; the
+// goroutines stop when ctx is canceled.
+func (m *Manager) Start(ctx context.Context) {
+	m.mu.Lock()
+	var pending []*Job
+	for _, j := range m.jobs {
+		if !j.Finished() {
+			pending = append(pending, j)
+		}
+	}
+	m.mu.Unlock()
+	for range m.cfg.Workers {
+		go m.worker(ctx)
+	}
+	go func() {
+		for _, j := range pending {
+			slog.Info("Resuming export job", "id", j.ID)
+			select {
+			case m.queue <- j.ID:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		t := time.NewTicker(cleanupInterval)
+		defer t.Stop()
+		m.cleanup()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				m.cleanup()
+			}
+		}
+	}()
+}
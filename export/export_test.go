@@ -0,0 +1,326 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cuducos/minha-receita/db"
+	"github.com/parquet-go/parquet-go"
+)
+
+// fakeDatabase returns the company in the test data twice, in two pages, and
+// keeps the meta storage in memory.
+type fakeDatabase struct {
+	mu     sync.Mutex
+	meta   map[string]string
+	fail   bool
+	onSave func(string) // called after saving a meta key, without the lock
+}
+
+func newFakeDatabase() *fakeDatabase { return &fakeDatabase{meta: make(map[string]string)} }
+
+func (f *fakeDatabase) Search(_ context.Context, q *db.Query) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail {
+		return "", errors.New("boom")
+	}
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		return "", err
+	}
+	if q.Cursor == nil {
+		return fmt.Sprintf(`{"data":[%s],"cursor":"1"}`, b), nil
+	}
+	return fmt.Sprintf(`{"data":[%s],"cursor":null}`, b), nil
+}
+
+func (f *fakeDatabase) MetaSave(k, v string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.meta[k] = v
+	if f.onSave != nil {
+		defer f.onSave(k)
+	}
+	return nil
+}
+
+func (f *fakeDatabase) MetaRead(k string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v, ok := f.meta[k]
+	if !ok {
+		return "", fmt.Errorf("metadata key %s not found", k)
+	}
+	return v, nil
+}
+
+func (f *fakeDatabase) MetaDelete(k string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.meta, k)
+	return nil
+}
+
+func newTestManager(t *testing.T, d *fakeDatabase, dir string) *Manager {
+	m, err := New(d, Config{Dir: dir, Workers: 1, QueueSize: 2, Retention: time.Hour})
+	if err != nil {
+		t.Fatalf("expected no error creating manager, got %s", err)
+	}
+	return m
+}
+
+func waitFor(t *testing.T, m *Manager, id string) Job {
+	for range 100 {
+		j, ok := m.Job(id)
+		if !ok {
+			t.Fatalf("expected job %s to exist", id)
+		}
+		if j.Finished() {
+			return j
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("expected job %s to finish", id)
+	return Job{}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, c := range []struct {
+		value    string
+		expected Format
+		err      bool
+	}{
+		{"", CSV, false},
+		{"csv", CSV, false},
+		{"ndjson", NDJSON, false},
+		{"parquet", Parquet, false},
+		{"xlsx", "", true},
+	} {
+		got, err := ParseFormat(c.value)
+		if c.err != (err != nil) {
+			t.Errorf("expected error for %q to be %t, got %v", c.value, c.err, err)
+		}
+		if got != c.expected {
+			t.Errorf("expected %q to be parsed as %q, got %q", c.value, c.expected, got)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	q := db.Query{Params: db.Params{UF: []string{"SP"}}}
+	for _, c := range []struct {
+		format Format
+		check  func(*testing.T, []byte)
+	}{
+		{
+			CSV,
+			func(t *testing.T, b []byte) {
+				rs, err := csv.NewReader(bytes.NewReader(b)).ReadAll()
+				if err != nil {
+					t.Fatalf("expected no error reading csv, got %s", err)
+				}
+				if len(rs) != 3 {
+					t.Fatalf("expected header and 2 rows, got %d rows", len(rs))
+				}
+				if rs[0][0] != "cnpj" || rs[1][0] != "19131243000197" {
+					t.Errorf("expected first column to be cnpj with 19131243000197, got %s with %s", rs[0][0], rs[1][0])
+				}
+				for i, h := range rs[0] {
+					if h == "qsa" && !strings.HasPrefix(rs[1][i], `[{"pais":null`) {
+						t.Errorf("expected qsa to be written as json, got %s", rs[1][i])
+					}
+					if h == "opcao_pelo_mei" && rs[1][i] != "" {
+						t.Errorf("expected null to be written as an empty string, got %s", rs[1][i])
+					}
+				}
+			},
+		},
+		{
+			NDJSON,
+			func(t *testing.T, b []byte) {
+				ls := strings.Split(strings.TrimSpace(string(b)), "\n")
+				if len(ls) != 2 {
+					t.Fatalf("expected 2 lines, got %d", len(ls))
+				}
+				if !strings.HasPrefix(ls[0], `{"uf":"SP","cep":"01311902"`) {
+					t.Errorf("expected compact json, got %s", ls[0])
+				}
+			},
+		},
+		{
+			Parquet,
+			func(t *testing.T, b []byte) {
+				f, err := parquet.OpenFile(bytes.NewReader(b), int64(len(b)))
+				if err != nil {
+					t.Fatalf("expected no error opening parquet, got %s", err)
+				}
+				if f.NumRows() != 2 {
+					t.Errorf("expected 2 rows, got %d", f.NumRows())
+				}
+				if _, ok := f.Schema().Lookup("razao_social"); !ok {
+					t.Error("expected razao_social column in parquet schema")
+				}
+			},
+		},
+	} {
+		t.Run(string(c.format), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			m := newTestManager(t, newFakeDatabase(), t.TempDir())
+			m.Start(ctx)
+			j, err := m.Submit(q, c.format)
+			if err != nil {
+				t.Fatalf("expected no error submitting job, got %s", err)
+			}
+			j = waitFor(t, m, j.ID)
+			if j.Status != Done {
+				t.Fatalf("expected job to be done, got %s (%s)", j.Status, j.Error)
+			}
+			if j.Exported != 2 {
+				t.Errorf("expected 2 companies exported, got %d", j.Exported)
+			}
+			b, err := os.ReadFile(m.Path(j))
+			if err != nil {
+				t.Fatalf("expected no error reading exported file, got %s", err)
+			}
+			c.check(t, b)
+		})
+	}
+}
+
+func TestExportFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := newFakeDatabase()
+	d.fail = true
+	m := newTestManager(t, d, t.TempDir())
+	m.Start(ctx)
+	j, err := m.Submit(db.Query{Params: db.Params{UF: []string{"SP"}}}, NDJSON)
+	if err != nil {
+		t.Fatalf("expected no error submitting job, got %s", err)
+	}
+	j = waitFor(t, m, j.ID)
+	if j.Status != Failed || !strings.Contains(j.Error, "boom") {
+		t.Errorf("expected job to fail with boom, got %s (%s)", j.Status, j.Error)
+	}
+	if _, err := os.Stat(m.Path(j)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected no exported file, got %v", err)
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	m := newTestManager(t, newFakeDatabase(), t.TempDir()) // not started, so nothing consumes the queue
+	q := db.Query{Params: db.Params{UF: []string{"SP"}}}
+	for range 2 {
+		if _, err := m.Submit(q, CSV); err != nil {
+			t.Fatalf("expected no error submitting job, got %s", err)
+		}
+	}
+	if _, err := m.Submit(q, CSV); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+}
+
+func TestQueueFilledByResumedJobs(t *testing.T) {
+	d := newFakeDatabase()
+	m := newTestManager(t, d, t.TempDir()) // not started, so nothing consumes the queue
+	d.onSave = func(k string) {
+		if k == metaIndexKey && len(m.queue) < cap(m.queue) {
+			for len(m.queue) < cap(m.queue) { // as Start does, without the lock
+				m.queue <- "resumed"
+			}
+		}
+	}
+	errs := make(chan error)
+	go func() {
+		_, err := m.Submit(db.Query{Params: db.Params{UF: []string{"SP"}}}, CSV)
+		errs <- err
+	}()
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrQueueFull) {
+			t.Errorf("expected ErrQueueFull, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected submit not to block when the queue is filled by resumed jobs")
+	}
+	if n := len(m.jobs); n != 0 {
+		t.Errorf("expected the rejected job to be rolled back, got %d jobs", n)
+	}
+	if s := d.meta[metaIndexKey]; s != "[]" {
+		t.Errorf("expected empty export jobs index, got %s", s)
+	}
+	for k := range d.meta {
+		if k != metaIndexKey && strings.HasPrefix(k, metaKeyPrefix) {
+			t.Errorf("expected the rejected job to be removed from the meta storage, got %s", k)
+		}
+	}
+}
+
+func TestJobsSurviveRestart(t *testing.T) {
+	d := newFakeDatabase()
+	dir := t.TempDir()
+	m := newTestManager(t, d, dir) // not started, as if it stopped before running the job
+	j, err := m.Submit(db.Query{Params: db.Params{UF: []string{"SP"}}}, NDJSON)
+	if err != nil {
+		t.Fatalf("expected no error submitting job, got %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m = newTestManager(t, d, dir)
+	got, ok := m.Job(j.ID)
+	if !ok {
+		t.Fatalf("expected job %s to be loaded from the meta storage", j.ID)
+	}
+	if got.Query.UF[0] != "SP" || got.Status != Queued {
+		t.Errorf("expected queued job with query uf=SP, got %+v", got)
+	}
+	m.Start(ctx)
+	if got = waitFor(t, m, j.ID); got.Status != Done {
+		t.Errorf("expected job to be done after restart, got %s (%s)", got.Status, got.Error)
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := newFakeDatabase()
+	m := newTestManager(t, d, t.TempDir())
+	m.Start(ctx)
+	j, err := m.Submit(db.Query{Params: db.Params{UF: []string{"SP"}}}, CSV)
+	if err != nil {
+		t.Fatalf("expected no error submitting job, got %s", err)
+	}
+	j = waitFor(t, m, j.ID)
+	m.cleanup()
+	if _, ok := m.Job(j.ID); !ok {
+		t.Fatal("expected job to be kept within the retention period")
+	}
+	m.update(j.ID, func(j *Job) {
+		t := time.Now().Add(-2 * time.Hour)
+		j.FinishedAt = &t
+	})
+	m.cleanup()
+	if _, ok := m.Job(j.ID); ok {
+		t.Error("expected job to be removed after the retention period")
+	}
+	if _, err := os.Stat(m.Path(j)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected exported file to be removed, got %v", err)
+	}
+	if s := d.meta[metaIndexKey]; s != "[]" {
+		t.Errorf("expected empty jobs index, got %s", s)
+	}
+	if _, ok := d.meta[metaKeyPrefix+j.ID]; ok {
+		t.Errorf("expected job %s to be removed from the meta storage", j.ID)
+	}
+}
@@ -0,0 +1,169 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/cuducos/minha-receita/transform"
+	"github.com/parquet-go/parquet-go"
+)
+
+// rowWriter writes one company (as the JSON stored in the database) at a time.
+type rowWriter interface {
+	write(jsontext.Value) error
+	close() error
+}
+
+func newRowWriter(f Format, w io.Writer) (rowWriter, error) {
+	switch f {
+	case CSV:
+		return newCSVWriter(w)
+	case NDJSON:
+		return &ndjsonWriter{w}, nil
+	case Parquet:
+		return newParquetWriter(w), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrInvalidFormat, f)
+}
+
+// columns are the top-level keys of the company JSON. In tabular formats,
+// nested values (e.g. `qsa`, `cnaes_secundarios`) are written as JSON.
+func columns() []string {
+	t := reflect.TypeFor[transform.Company]()
+	cs := make([]string, 0, t.NumField())
+	for i := range t.NumField() {
+		n, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		cs = append(cs, n)
+	}
+	return cs
+}
+
+// flatten returns the value of each column as text, or nil for null or missing
+// values.
+func flatten(cs []string, v jsontext.Value) ([]*string, error) {
+	var m map[string]jsontext.Value
+	if err := json.Unmarshal(v, &m); err != nil {
+		return nil, fmt.Errorf("could not parse company json: %w", err)
+	}
+	r := make([]*string, len(cs))
+	for i, c := range cs {
+		v, ok := m[c]
+		if !ok {
+			continue
+		}
+		switch v.Kind() {
+		case 'n':
+			continue
+		case '"':
+			var s string
+			if err := json.Unmarshal(v, &s); err != nil {
+				return nil, fmt.Errorf("could not parse %s: %w", c, err)
+			}
+			r[i] = &s
+		default:
+			if err := v.Compact(); err != nil {
+				return nil, fmt.Errorf("could not compact %s: %w", c, err)
+			}
+			s := string(v)
+			r[i] = &s
+		}
+	}
+	return r, nil
+}
+
+type ndjsonWriter struct{ w io.Writer }
+
+func (n *ndjsonWriter) write(v jsontext.Value) error {
+	v = v.Clone()
+	if err := v.Compact(); err != nil {
+		return fmt.Errorf("could not compact company json: %w", err)
+	}
+	_, err := n.w.Write(append(v, '\n'))
+	return err
+}
+
+func (n *ndjsonWriter) close() error { return nil }
+
+type csvWriter struct {
+	w    *csv.Writer
+	cols []string
+	row  []string
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	c := csvWriter{w: csv.NewWriter(w), cols: columns()}
+	c.row = make([]string, len(c.cols))
+	if err := c.w.Write(c.cols); err != nil {
+		return nil, fmt.Errorf("could not write csv header: %w", err)
+	}
+	return &c, nil
+}
+
+func (c *csvWriter) write(v jsontext.Value) error {
+	vs, err := flatten(c.cols, v)
+	if err != nil {
+		return err
+	}
+	for i, v := range vs {
+		c.row[i] = ""
+		if v != nil {
+			c.row[i] = *v
+		}
+	}
+	return c.w.Write(c.row)
+}
+
+func (c *csvWriter) close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// parquetWriter writes every column as an optional string, the same values
+// used in the CSV.
+type parquetWriter struct {
+	w    *parquet.Writer
+	cols []string
+	idx  []int // position of each column in the parquet schema (sorted by name)
+}
+
+func newParquetWriter(w io.Writer) *parquetWriter {
+	cs := columns()
+	g := make(parquet.Group, len(cs))
+	for _, c := range cs {
+		g[c] = parquet.Optional(parquet.String())
+	}
+	s := parquet.NewSchema("company", g)
+	pos := make(map[string]int, len(cs))
+	for i, f := range s.Fields() {
+		pos[f.Name()] = i
+	}
+	idx := make([]int, len(cs))
+	for i, c := range cs {
+		idx[i] = pos[c]
+	}
+	return &parquetWriter{w: parquet.NewWriter(w, s), cols: cs, idx: idx}
+}
+
+func (p *parquetWriter) write(v jsontext.Value) error {
+	vs, err := flatten(p.cols, v)
+	if err != nil {
+		return err
+	}
+	r := make(parquet.Row, len(vs))
+	for i, v := range vs {
+		if v == nil {
+			r[p.idx[i]] = parquet.NullValue().Level(0, 0, p.idx[i])
+			continue
+		}
+		r[p.idx[i]] = parquet.ByteArrayValue([]byte(*v)).Level(0, 1, p.idx[i])
+	}
+	_, err = p.w.WriteRows([]parquet.Row{r})
+	return err
+}
+
+func (p *parquetWriter) close() error { return p.w.Close() }
@@ -86,6 +86,10 @@ func (d *date) MarshalJSON() ([]byte, error) {
 	return []byte(`"` + t.Format(dateOutputFormat) + `"`), nil
 }
 
+func (d date) String() string {
+	return time.Time(d).Format(dateOutputFormat)
+}
+
 func (d date) MarshalBSONValue() (bsontype.Type, []byte, error) {
 	t := time.Time(d)
 	return bson.TypeString, bsoncore.AppendString(nil, t.Format(dateOutputFormat)), nil
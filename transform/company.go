@@ -17,54 +17,54 @@ func companyNameClenup(n string) string {
 }
 
 type Company struct {
-	CNPJ                             string        `json:"cnpj" bson:"cnpj"`
-	IdentificadorMatrizFilial        *int          `json:"identificador_matriz_filial" bson:"identificador_matriz_filial"`
-	DescricaoMatrizFilial            *string       `json:"descricao_identificador_matriz_filial" bson:"descricao_identificador_matriz_filial"`
-	NomeFantasia                     string        `json:"nome_fantasia" bson:"nome_fantasia"`
-	SituacaoCadastral                *int          `json:"situacao_cadastral" bson:"situacao_cadastral"`
-	DescricaoSituacaoCadastral       *string       `json:"descricao_situacao_cadastral" bson:"descricao_situacao_cadastral"`
-	DataSituacaoCadastral            *date         `json:"data_situacao_cadastral" bson:"data_situacao_cadastral"`
-	MotivoSituacaoCadastral          *int          `json:"motivo_situacao_cadastral" bson:"motivo_situacao_cadastral"`
-	DescricaoMotivoSituacaoCadastral *string       `json:"descricao_motivo_situacao_cadastral" bson:"descricao_motivo_situacao_cadastral"`
-	NomeCidadeNoExterior             string        `json:"nome_cidade_no_exterior" bson:"nome_cidade_no_exterior"`
-	CodigoPais                       *int          `json:"codigo_pais" bson:"codigo_pais"`
-	Pais                             *string       `json:"pais" bson:"pais"`
-	DataInicioAtividade              *date         `json:"data_inicio_atividade" bson:"data_inicio_atividade"`
-	CNAEFiscal                       *int          `json:"cnae_fiscal" bson:"cnae_fiscal"`
-	CNAEFiscalDescricao              *string       `json:"cnae_fiscal_descricao" bson:"cnae_fiscal_descricao"`
-	DescricaoTipoDeLogradouro        string        `json:"descricao_tipo_de_logradouro" bson:"descricao_tipo_de_logradouro"`
-	Logradouro                       string        `json:"logradouro" bson:"logradouro"`
-	Numero                           string        `json:"numero" bson:"numero"`
-	Complemento                      string        `json:"complemento" bson:"complemento"`
-	Bairro                           string        `json:"bairro" bson:"bairro"`
-	CEP                              string        `json:"cep" bson:"cep"`
-	UF                               string        `json:"uf" bson:"uf"`
-	CodigoMunicipio                  *int          `json:"codigo_municipio" bson:"codigo_municipio"`
-	CodigoMunicipioIBGE              *int          `json:"codigo_municipio_ibge" bson:"codigo_municipio_ibge"`
-	Municipio                        *string       `json:"municipio" bson:"municipio"`
-	Telefone1                        string        `json:"ddd_telefone_1" bson:"ddd_telefone_1"`
-	Telefone2                        string        `json:"ddd_telefone_2" bson:"ddd_telefone_2"`
-	Fax                              string        `json:"ddd_fax" bson:"ddd_fax"`
-	Email                            *string       `json:"email" bson:"email"`
-	SituacaoEspecial                 string        `json:"situacao_especial" bson:"situacao_especial"`
-	DataSituacaoEspecial             *date         `json:"data_situacao_especial" bson:"data_situacao_especial"`
-	OpcaoPeloSimples                 *bool         `json:"opcao_pelo_simples" bson:"opcao_pelo_simples"`
-	DataOpcaoPeloSimples             *date         `json:"data_opcao_pelo_simples" bson:"data_opcao_pelo_simples"`
-	DataExclusaoDoSimples            *date         `json:"data_exclusao_do_simples" bson:"data_exclusao_do_simples"`
-	OpcaoPeloMEI                     *bool         `json:"opcao_pelo_mei" bson:"opcao_pelo_mei"`
-	DataOpcaoPeloMEI                 *date         `json:"data_opcao_pelo_mei" bson:"data_opcao_pelo_mei"`
-	DataExclusaoDoMEI                *date         `json:"data_exclusao_do_mei" bson:"data_exclusao_do_mei"`
-	RazaoSocial                      string        `json:"razao_social" bson:"razao_social"`
-	CodigoNaturezaJuridica           *int          `json:"codigo_natureza_juridica" bson:"codigo_natureza_juridica"`
-	NaturezaJuridica                 *string       `json:"natureza_juridica" bson:"natureza_juridica"`
-	QualificacaoDoResponsavel        *int          `json:"qualificacao_do_responsavel" bson:"qualificacao_do_responsavel"`
-	CapitalSocial                    *float32      `json:"capital_social" bson:"capital_social"`
-	CodigoPorte                      *int          `json:"codigo_porte" bson:"codigo_porte"`
-	Porte                            *string       `json:"porte" bson:"porte"`
-	EnteFederativoResponsavel        string        `json:"ente_federativo_responsavel" bson:"ente_federativo_responsavel"`
-	QuadroSocietario                 []PartnerData `json:"qsa" bson:"qsa"`
-	CNAESecundarios                  []CNAE        `json:"cnaes_secundarios" bson:"cnaes_secundarios"`
-	RegimeTributario                 TaxRegimes    `json:"regime_tributario" bson:"regime_tributario"`
+	CNPJ                             string        `json:"cnpj" bson:"cnpj" en:"cnpj"`
+	IdentificadorMatrizFilial        *int          `json:"identificador_matriz_filial" bson:"identificador_matriz_filial" en:"headquarters_or_branch_code"`
+	DescricaoMatrizFilial            *string       `json:"descricao_identificador_matriz_filial" bson:"descricao_identificador_matriz_filial" en:"headquarters_or_branch"`
+	NomeFantasia                     string        `json:"nome_fantasia" bson:"nome_fantasia" en:"trade_name"`
+	SituacaoCadastral                *int          `json:"situacao_cadastral" bson:"situacao_cadastral" en:"registration_status_code"`
+	DescricaoSituacaoCadastral       *string       `json:"descricao_situacao_cadastral" bson:"descricao_situacao_cadastral" en:"registration_status"`
+	DataSituacaoCadastral            *date         `json:"data_situacao_cadastral" bson:"data_situacao_cadastral" en:"registration_status_date"`
+	MotivoSituacaoCadastral          *int          `json:"motivo_situacao_cadastral" bson:"motivo_situacao_cadastral" en:"registration_status_reason_code"`
+	DescricaoMotivoSituacaoCadastral *string       `json:"descricao_motivo_situacao_cadastral" bson:"descricao_motivo_situacao_cadastral" en:"registration_status_reason"`
+	NomeCidadeNoExterior             string        `json:"nome_cidade_no_exterior" bson:"nome_cidade_no_exterior" en:"foreign_city_name"`
+	CodigoPais                       *int          `json:"codigo_pais" bson:"codigo_pais" en:"country_code"`
+	Pais                             *string       `json:"pais" bson:"pais" en:"country"`
+	DataInicioAtividade              *date         `json:"data_inicio_atividade" bson:"data_inicio_atividade" en:"activity_start_date"`
+	CNAEFiscal                       *int          `json:"cnae_fiscal" bson:"cnae_fiscal" en:"main_cnae"`
+	CNAEFiscalDescricao              *string       `json:"cnae_fiscal_descricao" bson:"cnae_fiscal_descricao" en:"main_cnae_description"`
+	DescricaoTipoDeLogradouro        string        `json:"descricao_tipo_de_logradouro" bson:"descricao_tipo_de_logradouro" en:"street_type"`
+	Logradouro                       string        `json:"logradouro" bson:"logradouro" en:"street"`
+	Numero                           string        `json:"numero" bson:"numero" en:"number"`
+	Complemento                      string        `json:"complemento" bson:"complemento" en:"address_complement"`
+	Bairro                           string        `json:"bairro" bson:"bairro" en:"neighborhood"`
+	CEP                              string        `json:"cep" bson:"cep" en:"zip_code"`
+	UF                               string        `json:"uf" bson:"uf" en:"state"`
+	CodigoMunicipio                  *int          `json:"codigo_municipio" bson:"codigo_municipio" en:"city_code"`
+	CodigoMunicipioIBGE              *int          `json:"codigo_municipio_ibge" bson:"codigo_municipio_ibge" en:"city_code_ibge"`
+	Municipio                        *string       `json:"municipio" bson:"municipio" en:"city"`
+	Telefone1                        string        `json:"ddd_telefone_1" bson:"ddd_telefone_1" en:"phone_1"`
+	Telefone2                        string        `json:"ddd_telefone_2" bson:"ddd_telefone_2" en:"phone_2"`
+	Fax                              string        `json:"ddd_fax" bson:"ddd_fax" en:"fax"`
+	Email                            *string       `json:"email" bson:"email" en:"email"`
+	SituacaoEspecial                 string        `json:"situacao_especial" bson:"situacao_especial" en:"special_status"`
+	DataSituacaoEspecial             *date         `json:"data_situacao_especial" bson:"data_situacao_especial" en:"special_status_date"`
+	OpcaoPeloSimples                 *bool         `json:"opcao_pelo_simples" bson:"opcao_pelo_simples" en:"simples_option"`
+	DataOpcaoPeloSimples             *date         `json:"data_opcao_pelo_simples" bson:"data_opcao_pelo_simples" en:"simples_option_date"`
+	DataExclusaoDoSimples            *date         `json:"data_exclusao_do_simples" bson:"data_exclusao_do_simples" en:"simples_exclusion_date"`
+	OpcaoPeloMEI                     *bool         `json:"opcao_pelo_mei" bson:"opcao_pelo_mei" en:"mei_option"`
+	DataOpcaoPeloMEI                 *date         `json:"data_opcao_pelo_mei" bson:"data_opcao_pelo_mei" en:"mei_option_date"`
+	DataExclusaoDoMEI                *date         `json:"data_exclusao_do_mei" bson:"data_exclusao_do_mei" en:"mei_exclusion_date"`
+	RazaoSocial                      string        `json:"razao_social" bson:"razao_social" en:"legal_name"`
+	CodigoNaturezaJuridica           *int          `json:"codigo_natureza_juridica" bson:"codigo_natureza_juridica" en:"legal_nature_code"`
+	NaturezaJuridica                 *string       `json:"natureza_juridica" bson:"natureza_juridica" en:"legal_nature"`
+	QualificacaoDoResponsavel        *int          `json:"qualificacao_do_responsavel" bson:"qualificacao_do_responsavel" en:"responsible_qualification_code"`
+	CapitalSocial                    *float32      `json:"capital_social" bson:"capital_social" en:"share_capital"`
+	CodigoPorte                      *int          `json:"codigo_porte" bson:"codigo_porte" en:"size_code"`
+	Porte                            *string       `json:"porte" bson:"porte" en:"size"`
+	EnteFederativoResponsavel        string        `json:"ente_federativo_responsavel" bson:"ente_federativo_responsavel" en:"responsible_federative_entity"`
+	QuadroSocietario                 []PartnerData `json:"qsa" bson:"qsa" en:"partners"`
+	CNAESecundarios                  []CNAE        `json:"cnaes_secundarios" bson:"cnaes_secundarios" en:"secondary_cnaes"`
+	RegimeTributario                 TaxRegimes    `json:"regime_tributario" bson:"regime_tributario" en:"tax_regimes"`
 }
 
 func (c *Company) situacaoCadastral(v string) error {
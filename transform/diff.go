@@ -0,0 +1,302 @@
+package transform
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// ContentHash identifies a version of the JSON of a company. It is stored by
+// the incremental updates and by the watchlists, so they can tell which
+// companies changed without keeping the previous JSON.
+func ContentHash(j string) string {
+	h := sha256.Sum256([]byte(j))
+	return hex.EncodeToString(h[:])
+}
+
+// Kinds of change between two releases.
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// FieldChange is the difference in a single field of a company. For lists
+// (e.g. qsa) it also includes the items added to and removed from the list.
+type FieldChange struct {
+	Field   string `json:"field"`
+	Old     any    `json:"old"`
+	New     any    `json:"new"`
+	Added   []any  `json:"added,omitempty"`
+	Removed []any  `json:"removed,omitempty"`
+}
+
+// Change is an entry in the change log between two releases. Added companies
+// include the new data, changed companies include the changed fields (or the
+// new data, when the previous version is not available).
+type Change struct {
+	CNPJ    string        `json:"cnpj"`
+	Kind    string        `json:"change"`
+	Fields  []FieldChange `json:"fields,omitempty"`
+	Company *Company      `json:"company,omitempty"`
+}
+
+func diffList(o, n reflect.Value) ([]any, []any, error) {
+	count := make(map[string]int)
+	for i := range o.Len() {
+		b, err := json.Marshal(o.Index(i).Interface())
+		if err != nil {
+			return nil, nil, err
+		}
+		count[string(b)]++
+	}
+	var add, rm []any
+	for i := range n.Len() {
+		b, err := json.Marshal(n.Index(i).Interface())
+		if err != nil {
+			return nil, nil, err
+		}
+		if count[string(b)] > 0 {
+			count[string(b)]--
+			continue
+		}
+		add = append(add, n.Index(i).Interface())
+	}
+	for i := range o.Len() {
+		b, err := json.Marshal(o.Index(i).Interface())
+		if err != nil {
+			return nil, nil, err
+		}
+		if count[string(b)] > 0 {
+			count[string(b)]--
+			rm = append(rm, o.Index(i).Interface())
+		}
+	}
+	return add, rm, nil
+}
+
+// diffCompanies lists the fields that differ between two versions of a
+// company, in the order they are declared in Company.
+func diffCompanies(o, n Company) ([]FieldChange, error) {
+	var cs []FieldChange
+	ov, nv := reflect.ValueOf(o), reflect.ValueOf(n)
+	for i := range ov.NumField() {
+		f := ov.Type().Field(i)
+		if reflect.DeepEqual(ov.Field(i).Interface(), nv.Field(i).Interface()) {
+			continue
+		}
+		c := FieldChange{Field: f.Tag.Get("json"), Old: ov.Field(i).Interface(), New: nv.Field(i).Interface()}
+		if f.Type.Kind() == reflect.Slice {
+			var err error
+			c.Added, c.Removed, err = diffList(ov.Field(i), nv.Field(i))
+			if err != nil {
+				return nil, fmt.Errorf("error comparing %s: %w", c.Field, err)
+			}
+		}
+		cs = append(cs, c)
+	}
+	return cs, nil
+}
+
+// CompareJSON compares two versions of a company serialized as JSON, where an
+// empty string means the company does not exist in that version. It returns
+// nil if nothing changed.
+func CompareJSON(id, o, n string) (*Change, error) {
+	if o == n {
+		return nil, nil
+	}
+	if o == "" {
+		var c Company
+		if err := json.Unmarshal([]byte(n), &c); err != nil {
+			return nil, fmt.Errorf("error parsing %s: %w", id, err)
+		}
+		return &Change{CNPJ: id, Kind: Added, Company: &c}, nil
+	}
+	if n == "" {
+		return &Change{CNPJ: id, Kind: Removed}, nil
+	}
+	var oc, nc Company
+	if err := json.Unmarshal([]byte(o), &oc); err != nil {
+		return nil, fmt.Errorf("error parsing the previous version of %s: %w", id, err)
+	}
+	if err := json.Unmarshal([]byte(n), &nc); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", id, err)
+	}
+	fs, err := diffCompanies(oc, nc)
+	if err != nil {
+		return nil, fmt.Errorf("error comparing %s: %w", id, err)
+	}
+	if len(fs) == 0 {
+		return nil, nil
+	}
+	return &Change{CNPJ: id, Kind: Changed, Fields: fs}, nil
+}
+
+// diffStore implements the database interface so the companies of a release
+// can be created by the same pipeline used by Transform: in the first pass it
+// stores the companies of the older release, in the second pass it compares
+// the companies of the newer release to them.
+type diffStore struct {
+	db      *badger.DB
+	compare bool
+	out     io.Writer
+	lock    sync.Mutex
+}
+
+func (*diffStore) PreLoad() error                    { return nil }
+func (*diffStore) PostLoad() error                   { return nil }
+func (*diffStore) CreateExtraIndexes([]string) error { return nil }
+func (*diffStore) MetaSave(string, string) error     { return nil }
+
+func (d *diffStore) CreateCompaniesStructured(cs [][]string) error {
+	return d.CreateCompanies(cs)
+}
+
+func (d *diffStore) write(c Change) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("error serializing change for %s: %w", c.CNPJ, err)
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if _, err := d.out.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("error writing change for %s: %w", c.CNPJ, err)
+	}
+	return nil
+}
+
+func (d *diffStore) old(id string) (string, error) {
+	var j string
+	err := d.db.View(func(txn *badger.Txn) error {
+		i, err := txn.Get([]byte(id))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		v, err := i.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		j = string(v)
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("error reading %s from the older release: %w", id, err)
+	}
+	return j, nil
+}
+
+func (d *diffStore) compareCompany(id, j string) error {
+	o, err := d.old(id)
+	if err != nil {
+		return err
+	}
+	c, err := CompareJSON(id, o, j)
+	if err != nil || c == nil {
+		return err
+	}
+	return d.write(*c)
+}
+
+// CreateCompanies stores the companies of the older release or, in the
+// second pass, compares the companies of the newer release to them, removing
+// them from the storage so only the removed companies are left in it.
+func (d *diffStore) CreateCompanies(cs [][]string) error {
+	w := d.db.NewWriteBatch()
+	defer w.Cancel()
+	for _, c := range cs {
+		if !d.compare {
+			if err := w.Set([]byte(c[0]), []byte(c[1])); err != nil {
+				return fmt.Errorf("error storing %s: %w", c[0], err)
+			}
+			continue
+		}
+		if err := d.compareCompany(c[0], c[1]); err != nil {
+			return err
+		}
+		if err := w.Delete([]byte(c[0])); err != nil {
+			return fmt.Errorf("error deleting %s: %w", c[0], err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error writing to the key-value storage: %w", err)
+	}
+	return nil
+}
+
+func (d *diffStore) writeRemoved() error {
+	return d.db.View(func(txn *badger.Txn) error {
+		opt := badger.DefaultIteratorOptions
+		opt.PrefetchValues = false
+		it := txn.NewIterator(opt)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			if err := d.write(Change{CNPJ: string(it.Item().KeyCopy(nil)), Kind: Removed}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func loadRelease(dir, pth string, db database, maxDB, maxKV, batchSize int, privacy bool) error {
+	l, err := newLookups(dir)
+	if err != nil {
+		return fmt.Errorf("error creating look up tables from %s: %w", dir, err)
+	}
+	if err := createKeyValueStorage(dir, pth, l, maxKV); err != nil {
+		return err
+	}
+	return createJSONs(dir, pth, db, l, maxDB, batchSize, privacy, false, nil)
+}
+
+// Diff compares the companies of two directories with downloaded files, an
+// older and a newer release, writing the change log to w as NDJSON (one
+// Change per line).
+func Diff(older, newer string, w io.Writer, maxDB, maxKV, batchSize int, privacy bool) error {
+	pth, err := os.MkdirTemp("", fmt.Sprintf("minha-receita-diff-%s-*", time.Now().Format("20060102150405")))
+	if err != nil {
+		return fmt.Errorf("error creating temporary key-value storage: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(pth); err != nil {
+			slog.Error("could not remove temporary", "directory", pth, "error", err)
+		}
+	}()
+	kv, err := newBadgerStorage(filepath.Join(pth, "companies"), false)
+	if err != nil {
+		return fmt.Errorf("could not create badger storage: %w", err)
+	}
+	defer func() {
+		if err := kv.close(); err != nil {
+			slog.Warn("could not close key-value storage", "path", kv.path, "error", err)
+		}
+	}()
+	d := diffStore{db: kv.db, out: w}
+	slog.Info("Loading the older release…", "directory", older)
+	if err := loadRelease(older, filepath.Join(pth, "older"), &d, maxDB, maxKV, batchSize, privacy); err != nil {
+		return fmt.Errorf("error loading %s: %w", older, err)
+	}
+	d.compare = true
+	slog.Info("Comparing the newer release…", "directory", newer)
+	if err := loadRelease(newer, filepath.Join(pth, "newer"), &d, maxDB, maxKV, batchSize, privacy); err != nil {
+		return fmt.Errorf("error comparing %s: %w", newer, err)
+	}
+	if err := d.writeRemoved(); err != nil {
+		return fmt.Errorf("error writing removed companies: %w", err)
+	}
+	return nil
+}
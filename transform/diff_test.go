@@ -0,0 +1,136 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func loadResponse(t *testing.T) Company {
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		t.Fatalf("error reading company JSON file: %s", err)
+	}
+	c, err := companyFromString(string(b))
+	if err != nil {
+		t.Fatalf("error parsing company JSON file: %s", err)
+	}
+	return c
+}
+
+func TestDiffCompanies(t *testing.T) {
+	o := loadResponse(t)
+	n := loadResponse(t)
+	s := "BAIXADA"
+	n.DescricaoSituacaoCadastral = &s
+	n.QuadroSocietario = append(slices.Clone(n.QuadroSocietario), PartnerData{NomeSocio: "FULANA DE TAL"})
+	n.CNAESecundarios = n.CNAESecundarios[1:]
+	cs, err := diffCompanies(o, n)
+	if err != nil {
+		t.Fatalf("expected no error comparing companies, got %s", err)
+	}
+	var fs []string
+	for _, c := range cs {
+		fs = append(fs, c.Field)
+	}
+	exp := []string{"descricao_situacao_cadastral", "qsa", "cnaes_secundarios"}
+	if !slices.Equal(fs, exp) {
+		t.Fatalf("expected changed fields to be %v, got %v", exp, fs)
+	}
+	if *cs[0].Old.(*string) != "ATIVA" || *cs[0].New.(*string) != "BAIXADA" {
+		t.Errorf("expected situação cadastral to change from ATIVA to BAIXADA, got %v", cs[0])
+	}
+	if len(cs[1].Added) != 1 || len(cs[1].Removed) != 0 || cs[1].Added[0].(PartnerData).NomeSocio != "FULANA DE TAL" {
+		t.Errorf("expected one partner added, got %v added and %v removed", cs[1].Added, cs[1].Removed)
+	}
+	if len(cs[2].Added) != 0 || len(cs[2].Removed) != 1 {
+		t.Errorf("expected one secondary cnae removed, got %v added and %v removed", cs[2].Added, cs[2].Removed)
+	}
+	cs, err = diffCompanies(o, o)
+	if err != nil {
+		t.Errorf("expected no error comparing a company to itself, got %s", err)
+	}
+	if len(cs) != 0 {
+		t.Errorf("expected no changes comparing a company to itself, got %v", cs)
+	}
+}
+
+func TestDiffStore(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions(t.TempDir()).WithLogger(&noLogger{}))
+	if err != nil {
+		t.Fatalf("expected no error creating badger, got %s", err)
+	}
+	defer db.Close()
+	c := loadResponse(t)
+	j, err := c.JSON()
+	if err != nil {
+		t.Fatalf("expected no error serializing company, got %s", err)
+	}
+	c.CEP = "01001000"
+	changed, err := c.JSON()
+	if err != nil {
+		t.Fatalf("expected no error serializing company, got %s", err)
+	}
+	var out bytes.Buffer
+	d := diffStore{db: db, out: &out}
+	if err := d.CreateCompanies([][]string{{"1", j}, {"2", j}, {"3", j}}); err != nil {
+		t.Fatalf("expected no error storing companies, got %s", err)
+	}
+	d.compare = true
+	if err := d.CreateCompanies([][]string{{"1", j}, {"2", changed}, {"4", j}}); err != nil {
+		t.Fatalf("expected no error comparing companies, got %s", err)
+	}
+	if err := d.writeRemoved(); err != nil {
+		t.Fatalf("expected no error writing removed companies, got %s", err)
+	}
+	var got []string
+	for l := range strings.Lines(out.String()) {
+		var c Change
+		if err := json.Unmarshal([]byte(l), &c); err != nil {
+			t.Fatalf("expected no error parsing %s, got %s", l, err)
+		}
+		s := c.CNPJ + " " + c.Kind
+		for _, f := range c.Fields {
+			s += " " + f.Field
+		}
+		got = append(got, s)
+	}
+	exp := []string{"2 changed cep", "4 added", "3 removed"}
+	if !slices.Equal(got, exp) {
+		t.Errorf("expected change log to be %v, got %v", exp, got)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	var out bytes.Buffer
+	if err := Diff(testdata, testdata, &out, 2, MaxParallelKVWrites, 2, true); err != nil {
+		t.Fatalf("expected no error comparing releases, got %s", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected no changes comparing a release to itself, got %s", out.String())
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		t.Fatalf("error reading company JSON file: %s", err)
+	}
+	c := string(b)
+	h := ContentHash(c)
+	if len(h) != 64 {
+		t.Errorf("expected hash to have 64 chars, got %d", len(h))
+	}
+	if ContentHash(c) != h {
+		t.Error("expected the same content to have the same hash")
+	}
+	if ContentHash(strings.Replace(c, "19131243000197", "19131243000278", 1)) == h {
+		t.Error("expected different content to have different hashes")
+	}
+}
@@ -0,0 +1,177 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json/jsontext"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// englishValues translates the enumerations created in this package (e.g. in
+// situacaoCadastral, identificadorMatrizFilial, porte and faixaEtaria), keyed
+// by the JSON path of the field they belong to.
+var englishValues = map[string]map[string]string{
+	"descricao_situacao_cadastral": {
+		"NULA":     "NULL",
+		"ATIVA":    "ACTIVE",
+		"SUSPENSA": "SUSPENDED",
+		"INAPTA":   "UNFIT",
+		"BAIXADA":  "CLOSED",
+	},
+	"descricao_identificador_matriz_filial": {
+		"MATRIZ": "HEADQUARTERS",
+		"FILIAL": "BRANCH",
+	},
+	"porte": {
+		"NÃO INFORMADO":            "NOT INFORMED",
+		"MICRO EMPRESA":            "MICRO ENTERPRISE",
+		"EMPRESA DE PEQUENO PORTE": "SMALL ENTERPRISE",
+		"DEMAIS":                   "OTHERS",
+	},
+	"qsa.faixa_etaria": {
+		"para os intervalos entre 0 a 12 anos": "Between 0 and 12 years old",
+		"Entre 13 a 20 ano":                    "Between 13 and 20 years old",
+		"Entre 21 a 30 anos":                   "Between 21 and 30 years old",
+		"Entre 31 a 40 anos":                   "Between 31 and 40 years old",
+		"Entre 41 a 50 anos":                   "Between 41 and 50 years old",
+		"Entre 51 a 60 anos":                   "Between 51 and 60 years old",
+		"Entre 61 a 70 anos":                   "Between 61 and 70 years old",
+		"Entre 71 a 80 anos":                   "Between 71 and 80 years old",
+		"Maiores de 80 anos":                   "Over 80 years old",
+		"Não se aplica":                        "Not applicable",
+	},
+}
+
+// englishValuesV2 are the same enumerations as englishValues, keyed by their
+// JSON path in the second version of the company JSON.
+var englishValuesV2 = map[string]map[string]string{
+	"situacao_cadastral.descricao": englishValues["descricao_situacao_cadastral"],
+	"matriz_filial.descricao":      englishValues["descricao_identificador_matriz_filial"],
+	"porte.descricao":              englishValues["porte"],
+	"qsa.faixa_etaria.descricao":   englishValues["qsa.faixa_etaria"],
+	"contatos.telefones.tipo": {
+		"telefone": "phone",
+		"fax":      "fax",
+	},
+}
+
+func englishFields(t reflect.Type, prefix string, m map[string]string) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		k := f.Tag.Get("json")
+		if prefix != "" {
+			k = prefix + "." + k
+		}
+		m[k] = f.Tag.Get("en")
+		n := f.Type
+		if n.Kind() == reflect.Slice || n.Kind() == reflect.Pointer {
+			n = n.Elem()
+		}
+		if n.Kind() == reflect.Struct && n.PkgPath() == t.PkgPath() && n != reflect.TypeFor[date]() {
+			englishFields(n, k, m)
+		}
+	}
+}
+
+func englishNamesFor[T any]() func() map[string]string {
+	return sync.OnceValue(func() map[string]string {
+		m := make(map[string]string)
+		englishFields(reflect.TypeFor[T](), "", m)
+		return m
+	})
+}
+
+// englishNames maps the JSON path of each field of a company (e.g.
+// `qsa.nome_socio`) to its English name, as declared in the `en` struct tags.
+var englishNames = englishNamesFor[Company]()
+
+// englishNamesV2 is the same as englishNames for the second version of the
+// company JSON (e.g. `endereco.municipio.nome`).
+var englishNamesV2 = englishNamesFor[CompanyV2]()
+
+func translateValue(dec *jsontext.Decoder, enc *jsontext.Encoder, pth string, names map[string]string, values map[string]map[string]string) error {
+	switch dec.PeekKind() {
+	case '{', '[':
+		t, err := dec.ReadToken()
+		if err != nil {
+			return err
+		}
+		if err := enc.WriteToken(t); err != nil {
+			return err
+		}
+		isObj := t.Kind() == '{'
+		for dec.PeekKind() != '}' && dec.PeekKind() != ']' {
+			p := pth
+			if isObj {
+				n, err := dec.ReadToken()
+				if err != nil {
+					return err
+				}
+				p = n.String()
+				if pth != "" {
+					p = pth + "." + p
+				}
+				name := n.String()
+				if en := names[p]; en != "" {
+					name = en
+				}
+				if err := enc.WriteToken(jsontext.String(name)); err != nil {
+					return err
+				}
+			}
+			if err := translateValue(dec, enc, p, names, values); err != nil {
+				return err
+			}
+		}
+		t, err = dec.ReadToken()
+		if err != nil {
+			return err
+		}
+		return enc.WriteToken(t)
+	case '"':
+		t, err := dec.ReadToken()
+		if err != nil {
+			return err
+		}
+		if v, ok := values[pth][t.String()]; ok {
+			t = jsontext.String(v)
+		}
+		return enc.WriteToken(t)
+	default:
+		v, err := dec.ReadValue()
+		if err != nil {
+			return err
+		}
+		return enc.WriteValue(v)
+	}
+}
+
+func translate(b []byte, names map[string]string, values map[string]map[string]string) ([]byte, error) {
+	var buf bytes.Buffer
+	dec := jsontext.NewDecoder(bytes.NewReader(b))
+	enc := jsontext.NewEncoder(&buf)
+	if err := translateValue(dec, enc, "", names, values); err != nil {
+		return nil, fmt.Errorf("error translating company json: %w", err)
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// EnglishJSON takes the JSON of a company (as created by Company.JSON) and
+// rewrites it using English field names (from the `en` struct tags) and
+// English values for the enumerations created by this package. Unknown fields
+// are kept as they are.
+func EnglishJSON(b []byte) ([]byte, error) {
+	return translate(b, englishNames(), englishValues)
+}
+
+// EnglishV2JSON takes the JSON of a company (as created by Company.JSON) and
+// returns the second version of the JSON structure for the same company, with
+// English field names and enumerations like EnglishJSON.
+func EnglishV2JSON(b []byte) ([]byte, error) {
+	v, err := V2JSON(b)
+	if err != nil {
+		return nil, err
+	}
+	return translate(v, englishNamesV2(), englishValuesV2)
+}
@@ -0,0 +1,143 @@
+package transform
+
+import (
+	"encoding/json/v2"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEnglishTags(t *testing.T) {
+	for _, typ := range []reflect.Type{
+		reflect.TypeFor[Company](),
+		reflect.TypeFor[PartnerData](),
+		reflect.TypeFor[CNAE](),
+		reflect.TypeFor[TaxRegime](),
+		reflect.TypeFor[CompanyV2](),
+		reflect.TypeFor[CodeDescription](),
+		reflect.TypeFor[SituacaoCadastralV2](),
+		reflect.TypeFor[SituacaoEspecialV2](),
+		reflect.TypeFor[MunicipioV2](),
+		reflect.TypeFor[PaisV2](),
+		reflect.TypeFor[EnderecoV2](),
+		reflect.TypeFor[TelefoneV2](),
+		reflect.TypeFor[ContatosV2](),
+		reflect.TypeFor[OpcaoTributariaV2](),
+		reflect.TypeFor[RepresentanteLegalV2](),
+		reflect.TypeFor[SocioV2](),
+	} {
+		seen := make(map[string]string)
+		for i := range typ.NumField() {
+			f := typ.Field(i)
+			en := f.Tag.Get("en")
+			if en == "" {
+				t.Errorf("expected %s.%s to have an `en` struct tag", typ.Name(), f.Name)
+				continue
+			}
+			if o, ok := seen[en]; ok {
+				t.Errorf("expected unique `en` tags in %s, got %s for both %s and %s", typ.Name(), en, o, f.Name)
+			}
+			seen[en] = f.Name
+		}
+	}
+	for _, f := range CompanyJSONFields() {
+		if englishNames()[f] == "" {
+			t.Errorf("expected %s to have an English name", f)
+		}
+	}
+}
+
+func TestEnglishJSON(t *testing.T) {
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		t.Fatalf("error reading company JSON file: %s", err)
+	}
+	got, err := EnglishJSON(b)
+	if err != nil {
+		t.Fatalf("expected no error translating the JSON, got %s", err)
+	}
+	var c map[string]any
+	if err := json.Unmarshal(got, &c); err != nil {
+		t.Fatalf("expected no error parsing the translated JSON, got %s", err)
+	}
+	for k, v := range map[string]any{
+		"cnpj":                   "19131243000197",
+		"legal_name":             "OPEN KNOWLEDGE BRASIL",
+		"registration_status":    "ACTIVE",
+		"headquarters_or_branch": "HEADQUARTERS",
+		"size":                   "OTHERS",
+		"state":                  "SP",
+		"main_cnae":              float64(9430800),
+		"descricao_porte":        "", // unknown fields are kept as they are
+	} {
+		if c[k] != v {
+			t.Errorf("expected %s to be %v, got %v", k, v, c[k])
+		}
+	}
+	for _, k := range []string{"razao_social", "uf", "qsa", "cnaes_secundarios"} {
+		if _, ok := c[k]; ok {
+			t.Errorf("expected %s not to be in the translated JSON", k)
+		}
+	}
+	p := c["partners"].([]any)[0].(map[string]any)
+	if p["name"] != "HAYDEE SVAB" {
+		t.Errorf("expected partner name to be HAYDEE SVAB, got %v", p["name"])
+	}
+	if p["age_range"] != "Between 41 and 50 years old" {
+		t.Errorf("expected partner age range to be translated, got %v", p["age_range"])
+	}
+	s := c["secondary_cnaes"].([]any)[0].(map[string]any)
+	if s["code"] != float64(9493600) {
+		t.Errorf("expected secondary CNAE code to be 9493600, got %v", s["code"])
+	}
+	r := c["tax_regimes"].([]any)[0].(map[string]any)
+	if r["year"] != float64(2017) || r["taxation_method"] != "ISENTA DO IRPJ" {
+		t.Errorf("expected tax regime to be translated, got %v", r)
+	}
+}
+
+func TestEnglishV2JSON(t *testing.T) {
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		t.Fatalf("error reading company JSON file: %s", err)
+	}
+	got, err := EnglishV2JSON(b)
+	if err != nil {
+		t.Fatalf("expected no error translating the JSON, got %s", err)
+	}
+	var c map[string]any
+	if err := json.Unmarshal(got, &c); err != nil {
+		t.Fatalf("expected no error parsing the translated JSON, got %s", err)
+	}
+	if c["legal_name"] != "OPEN KNOWLEDGE BRASIL" {
+		t.Errorf("expected legal_name to be OPEN KNOWLEDGE BRASIL, got %v", c["legal_name"])
+	}
+	for _, k := range []string{"razao_social", "endereco", "contatos", "qsa"} {
+		if _, ok := c[k]; ok {
+			t.Errorf("expected %s not to be in the translated JSON", k)
+		}
+	}
+	s := c["registration_status"].(map[string]any)
+	if s["description"] != "ACTIVE" {
+		t.Errorf("expected registration status to be ACTIVE, got %v", s["description"])
+	}
+	a := c["address"].(map[string]any)
+	if a["state"] != "SP" || a["city"].(map[string]any)["name"] != "SAO PAULO" {
+		t.Errorf("expected address in São Paulo, got %v", a)
+	}
+	p := c["contacts"].(map[string]any)["phones"].([]any)[0].(map[string]any)
+	if p["type"] != "phone" || p["area_code"] != "11" {
+		t.Errorf("expected phone to be translated, got %v", p)
+	}
+	r := c["partners"].([]any)[0].(map[string]any)["age_range"].(map[string]any)
+	if r["description"] != "Between 41 and 50 years old" {
+		t.Errorf("expected partner age range to be translated, got %v", r)
+	}
+}
+
+func TestEnglishJSONInvalid(t *testing.T) {
+	if _, err := EnglishJSON([]byte(`{"cnpj":`)); err == nil {
+		t.Error("expected an error translating invalid JSON, got nil")
+	}
+}
@@ -2,9 +2,15 @@ package transform
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 )
 
+// ExtraIndexes lists the fields of the company JSON indexed for searches.
+func ExtraIndexes() []string {
+	return slices.Clone(extraIdexes[:])
+}
+
 func ValidateIndexes(idxs []string) error {
 	m := make(map[string]struct{})
 	var errs []string
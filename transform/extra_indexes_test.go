@@ -1,6 +1,9 @@
 package transform
 
-import "testing"
+import (
+	"slices"
+	"testing"
+)
 
 func TestIndexValidator(t *testing.T) {
 	err := ValidateIndexes([]string{"qsa.nome_socio"})
@@ -12,3 +15,28 @@ func TestIndexValidator(t *testing.T) {
 		t.Errorf("expected error for index1 index, got nil")
 	}
 }
+
+type indexesDB struct {
+	inMemoryDB
+	idxs []string
+}
+
+func (i *indexesDB) CreateExtraIndexes(idxs []string) error {
+	i.idxs = idxs
+	return nil
+}
+
+func TestPostLoadSortIndexes(t *testing.T) {
+	for _, sort := range []bool{false, true} {
+		db := &indexesDB{}
+		if err := postLoad(db, true, sort); err != nil {
+			t.Fatalf("expected no error creating indexes, got %s", err)
+		}
+		if got := slices.Contains(db.idxs, "razao_social"); got != sort {
+			t.Errorf("expected the razao_social index only with sort, got %v with sort %t", db.idxs, sort)
+		}
+		if !slices.Contains(db.idxs, "uf") {
+			t.Errorf("expected search indexes to be created with sort %t, got %v", sort, db.idxs)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package transform
+
+import (
+	"encoding/json/v2"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+)
+
+// UpdateSummaryKey is the metadata key where the summary of the last
+// incremental update is saved.
+const UpdateSummaryKey = "update-summary"
+
+// incrementalDatabase is implemented by the databases that can update the
+// companies of a previous load instead of loading them from scratch.
+type incrementalDatabase interface {
+	// PreUpdate prepares the database to receive the companies of a release,
+	// identified by its updated at date (YYYY-MM-DD).
+	PreUpdate(string) error
+
+	// UpdateCompanies inserts new companies and updates the ones whose
+	// content changed, returning the number of inserted and updated ones.
+	UpdateCompanies([][]string) (int, int, error)
+
+	// PostUpdate removes the companies absent from the release, returning how
+	// many were removed.
+	PostUpdate() (int, error)
+}
+
+// UpdateSummary counts what an incremental update did to the companies.
+type UpdateSummary struct {
+	Inserted  int64 `json:"inserted"`
+	Updated   int64 `json:"updated"`
+	Unchanged int64 `json:"unchanged"`
+	Removed   int64 `json:"removed"`
+}
+
+func (s *UpdateSummary) add(total, inserted, updated int) {
+	atomic.AddInt64(&s.Inserted, int64(inserted))
+	atomic.AddInt64(&s.Updated, int64(updated))
+	atomic.AddInt64(&s.Unchanged, int64(total-inserted-updated))
+}
+
+func saveUpdateSummary(db database, u incrementalDatabase, s *UpdateSummary) error {
+	slog.Info("Removing companies absent from this release…")
+	r, err := u.PostUpdate()
+	if err != nil {
+		return fmt.Errorf("error removing companies absent from this release: %w", err)
+	}
+	s.Removed = int64(r)
+	slog.Info("Incremental update summary", "inserted", s.Inserted, "updated", s.Updated, "unchanged", s.Unchanged, "removed", s.Removed)
+	b, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("error serializing the update summary: %w", err)
+	}
+	return db.MetaSave(UpdateSummaryKey, string(b))
+}
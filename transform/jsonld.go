@@ -0,0 +1,161 @@
+package transform
+
+import (
+	"encoding/json/v2"
+	"fmt"
+	"strings"
+
+	"github.com/cuducos/go-cnpj"
+)
+
+const (
+	baixada = 8   // situação cadastral code for closed companies
+	brazil  = 105 // country code for Brazil in the Federal Revenue tables
+)
+
+type PropertyValueLD struct {
+	Type       string `json:"@type"`
+	PropertyID string `json:"propertyID"`
+	Value      string `json:"value"`
+	Name       string `json:"name,omitempty"`
+}
+
+type PostalAddressLD struct {
+	Type            string `json:"@type"`
+	StreetAddress   string `json:"streetAddress,omitempty"`
+	AddressLocality string `json:"addressLocality,omitempty"`
+	AddressRegion   string `json:"addressRegion,omitempty"`
+	PostalCode      string `json:"postalCode,omitempty"`
+	AddressCountry  string `json:"addressCountry,omitempty"`
+}
+
+// OrganizationLD is a schema.org Organization, serialized as JSON-LD.
+type OrganizationLD struct {
+	Context         string            `json:"@context"`
+	Type            string            `json:"@type"`
+	Name            string            `json:"name"`
+	LegalName       string            `json:"legalName"`
+	AlternateName   string            `json:"alternateName,omitempty"`
+	TaxID           string            `json:"taxID"`
+	Description     string            `json:"description,omitempty"`
+	Identifier      []PropertyValueLD `json:"identifier"`
+	FoundingDate    *date             `json:"foundingDate,omitempty"`
+	DissolutionDate *date             `json:"dissolutionDate,omitempty"`
+	Address         PostalAddressLD   `json:"address"`
+	Telephone       []string          `json:"telephone,omitempty"`
+	Email           string            `json:"email,omitempty"`
+}
+
+func joinNonEmpty(sep string, vs ...string) string {
+	var ps []string
+	for _, v := range vs {
+		if v = strings.TrimSpace(v); v != "" {
+			ps = append(ps, v)
+		}
+	}
+	return strings.Join(ps, sep)
+}
+
+// formatCEP adds the hyphen to a CEP with 8 digits (e.g. 01311-902).
+func formatCEP(v string) string {
+	if len(v) != 8 {
+		return v
+	}
+	return v[:5] + "-" + v[5:]
+}
+
+// phones lists the phone numbers of a company in the E.164 format.
+func (c *Company) phones() []string {
+	var ps []string
+	for _, v := range []string{c.Telefone1, c.Telefone2} {
+		t, ok := newTelefoneV2("telefone", v)
+		if !ok || t.DDD == "" {
+			continue
+		}
+		ps = append(ps, "+55"+t.DDD+t.Numero)
+	}
+	return ps
+}
+
+// cnaeLD is a CNAE as an identifier. schema.org has isicV4 for activities,
+// but a CNAE is not an ISIC Rev. 4 code: CNAE 2.0 derives from ISIC, with
+// classes of its own and others split or merged, so truncating it gives wrong
+// or non-existent ISIC classes (e.g. CNAE 9430-8/00 would become 9430, which
+// is not in ISIC). Converting it requires the IBGE correspondence table, which
+// is not part of the Federal Revenue data.
+func cnaeLD(v *int, d *string) PropertyValueLD {
+	p := PropertyValueLD{Type: "PropertyValue", PropertyID: "CNAE", Value: fmt.Sprintf("%07d", *v)}
+	if d != nil {
+		p.Name = *d
+	}
+	return p
+}
+
+// JSONLD converts a company to a schema.org Organization. The CNAEs (the
+// Brazilian equivalent to NAICS) are listed as identifiers, not as isicV4 (see
+// cnaeLD).
+func (c *Company) JSONLD() OrganizationLD {
+	o := OrganizationLD{
+		Context:       "https://schema.org",
+		Type:          "Organization",
+		Name:          c.RazaoSocial,
+		LegalName:     c.RazaoSocial,
+		AlternateName: c.NomeFantasia,
+		TaxID:         cnpj.Mask(c.CNPJ),
+		Identifier: []PropertyValueLD{
+			{Type: "PropertyValue", PropertyID: "CNPJ", Value: c.CNPJ},
+		},
+		FoundingDate: c.DataInicioAtividade,
+		Address: PostalAddressLD{
+			Type:          "PostalAddress",
+			StreetAddress: joinNonEmpty(", ", joinNonEmpty(" ", c.DescricaoTipoDeLogradouro, c.Logradouro), c.Numero, c.Complemento, c.Bairro),
+			AddressRegion: c.UF,
+			PostalCode:    formatCEP(c.CEP),
+		},
+		Telephone: c.phones(),
+	}
+	if c.NomeFantasia != "" {
+		o.Name = c.NomeFantasia
+	}
+	if c.CNAEFiscal != nil {
+		o.Identifier = append(o.Identifier, cnaeLD(c.CNAEFiscal, c.CNAEFiscalDescricao))
+		if c.CNAEFiscalDescricao != nil {
+			o.Description = *c.CNAEFiscalDescricao
+		}
+	}
+	for _, s := range c.CNAESecundarios {
+		o.Identifier = append(o.Identifier, cnaeLD(&s.Codigo, &s.Descricao))
+	}
+	if c.SituacaoCadastral != nil && *c.SituacaoCadastral == baixada {
+		o.DissolutionDate = c.DataSituacaoCadastral
+	}
+	if c.Municipio != nil {
+		o.Address.AddressLocality = *c.Municipio
+	}
+	if c.NomeCidadeNoExterior != "" {
+		o.Address.AddressLocality = c.NomeCidadeNoExterior
+	}
+	if c.Pais != nil && c.CodigoPais != nil && *c.CodigoPais != brazil {
+		o.Address.AddressCountry = *c.Pais
+	} else if c.UF != "" && c.UF != "EX" {
+		o.Address.AddressCountry = "BR"
+	}
+	if c.Email != nil {
+		o.Email = *c.Email
+	}
+	return o
+}
+
+// JSONLD takes the JSON of a company (as created by Company.JSON) and
+// returns its JSON-LD representation.
+func JSONLD(b []byte) ([]byte, error) {
+	var c Company
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("error parsing company json: %w", err)
+	}
+	v, err := json.Marshal(c.JSONLD())
+	if err != nil {
+		return nil, fmt.Errorf("error serializing company %s as json-ld: %w", c.CNPJ, err)
+	}
+	return v, nil
+}
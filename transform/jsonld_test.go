@@ -0,0 +1,81 @@
+package transform
+
+import (
+	"encoding/json/v2"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJSONLD(t *testing.T) {
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		t.Fatalf("error reading company JSON file: %s", err)
+	}
+	got, err := JSONLD(b)
+	if err != nil {
+		t.Fatalf("expected no error converting to json-ld, got %s", err)
+	}
+	var o map[string]any
+	if err := json.Unmarshal(got, &o); err != nil {
+		t.Fatalf("expected no error parsing json-ld, got %s", err)
+	}
+	for k, v := range map[string]any{
+		"@context":     "https://schema.org",
+		"@type":        "Organization",
+		"name":         "OPEN KNOWLEDGE BRASIL",
+		"legalName":    "OPEN KNOWLEDGE BRASIL",
+		"taxID":        "19.131.243/0001-97",
+		"foundingDate": "2013-10-03",
+	} {
+		if o[k] != v {
+			t.Errorf("expected %s to be %v, got %v", k, v, o[k])
+		}
+	}
+	for _, k := range []string{"alternateName", "dissolutionDate", "email"} {
+		if _, ok := o[k]; ok {
+			t.Errorf("expected %s to be omitted, got %v", k, o[k])
+		}
+	}
+	a := o["address"].(map[string]any)
+	for k, v := range map[string]string{
+		"@type":           "PostalAddress",
+		"streetAddress":   "AVENIDA PAULISTA 37, 37, ANDAR 4, BELA VISTA",
+		"addressLocality": "SAO PAULO",
+		"addressRegion":   "SP",
+		"postalCode":      "01311-902",
+		"addressCountry":  "BR",
+	} {
+		if a[k] != v {
+			t.Errorf("expected address %s to be %s, got %v", k, v, a[k])
+		}
+	}
+	if ts := o["telephone"].([]any); len(ts) != 1 || ts[0] != "+551123851939" {
+		t.Errorf("expected telephone to be +551123851939, got %v", ts)
+	}
+	ids := o["identifier"].([]any)
+	if len(ids) != 7 { // CNPJ, CNAE fiscal and 5 secundary CNAEs
+		t.Errorf("expected 7 identifiers, got %d", len(ids))
+	}
+	cnae := ids[1].(map[string]any)
+	if cnae["propertyID"] != "CNAE" || cnae["value"] != "9430800" {
+		t.Errorf("expected second identifier to be CNAE 9430800, got %v", cnae)
+	}
+	if v, ok := o["isicV4"]; ok {
+		t.Errorf("expected no isicV4, as CNAE codes are not ISIC codes, got %v", v)
+	}
+}
+
+func TestJSONLDDissolutionDate(t *testing.T) {
+	got, err := JSONLD([]byte(`{"cnpj":"19131243000197","situacao_cadastral":8,"data_situacao_cadastral":"2020-01-31"}`))
+	if err != nil {
+		t.Fatalf("expected no error converting to json-ld, got %s", err)
+	}
+	var o map[string]any
+	if err := json.Unmarshal(got, &o); err != nil {
+		t.Fatalf("expected no error parsing json-ld, got %s", err)
+	}
+	if o["dissolutionDate"] != "2020-01-31" {
+		t.Errorf("expected dissolutionDate to be 2020-01-31, got %v", o["dissolutionDate"])
+	}
+}
@@ -163,8 +163,8 @@ func (c *Company) municipio(l *lookups, v string) error {
 }
 
 type CNAE struct {
-	Codigo    int    `json:"codigo" bson:"codigo"`
-	Descricao string `json:"descricao" bson:"descricao"`
+	Codigo    int    `json:"codigo" bson:"codigo" en:"code"`
+	Descricao string `json:"descricao" bson:"descricao" en:"description"`
 }
 
 func newCnae(l *lookups, v string) (CNAE, error) {
@@ -7,20 +7,20 @@ import (
 )
 
 type PartnerData struct {
-	IdentificadorDeSocio                 *int    `json:"identificador_de_socio" bson:"identificador_de_socio"`
-	NomeSocio                            string  `json:"nome_socio" bson:"nome_socio"`
-	CNPJCPFDoSocio                       string  `json:"cnpj_cpf_do_socio" bson:"cnpj_cpf_do_socio"`
-	CodigoQualificacaoSocio              *int    `json:"codigo_qualificacao_socio" bson:"codigo_qualificacao_socio"`
-	QualificaoSocio                      *string `json:"qualificacao_socio" bson:"qualificacao_socio"`
-	DataEntradaSociedade                 *date   `json:"data_entrada_sociedade" bson:"data_entrada_sociedade"`
-	CodigoPais                           *int    `json:"codigo_pais" bson:"codigo_pais"`
-	Pais                                 *string `json:"pais" bson:"pais"`
-	CPFRepresentanteLegal                string  `json:"cpf_representante_legal" bson:"cpf_representante_legal"`
-	NomeRepresentanteLegal               string  `json:"nome_representante_legal" bson:"nome_representante_legal"`
-	CodigoQualificacaoRepresentanteLegal *int    `json:"codigo_qualificacao_representante_legal" bson:"codigo_qualificacao_representante_legal"`
-	QualificacaoRepresentanteLegal       *string `json:"qualificacao_representante_legal" bson:"qualificacao_representante_legal"`
-	CodigoFaixaEtaria                    *int    `json:"codigo_faixa_etaria" bson:"codigo_faixa_etaria"`
-	FaixaEtaria                          *string `json:"faixa_etaria" bson:"faixa_etaria"`
+	IdentificadorDeSocio                 *int    `json:"identificador_de_socio" bson:"identificador_de_socio" en:"partner_type_code"`
+	NomeSocio                            string  `json:"nome_socio" bson:"nome_socio" en:"name"`
+	CNPJCPFDoSocio                       string  `json:"cnpj_cpf_do_socio" bson:"cnpj_cpf_do_socio" en:"cnpj_cpf"`
+	CodigoQualificacaoSocio              *int    `json:"codigo_qualificacao_socio" bson:"codigo_qualificacao_socio" en:"qualification_code"`
+	QualificaoSocio                      *string `json:"qualificacao_socio" bson:"qualificacao_socio" en:"qualification"`
+	DataEntradaSociedade                 *date   `json:"data_entrada_sociedade" bson:"data_entrada_sociedade" en:"joined_at"`
+	CodigoPais                           *int    `json:"codigo_pais" bson:"codigo_pais" en:"country_code"`
+	Pais                                 *string `json:"pais" bson:"pais" en:"country"`
+	CPFRepresentanteLegal                string  `json:"cpf_representante_legal" bson:"cpf_representante_legal" en:"legal_representative_cpf"`
+	NomeRepresentanteLegal               string  `json:"nome_representante_legal" bson:"nome_representante_legal" en:"legal_representative_name"`
+	CodigoQualificacaoRepresentanteLegal *int    `json:"codigo_qualificacao_representante_legal" bson:"codigo_qualificacao_representante_legal" en:"legal_representative_qualification_code"`
+	QualificacaoRepresentanteLegal       *string `json:"qualificacao_representante_legal" bson:"qualificacao_representante_legal" en:"legal_representative_qualification"`
+	CodigoFaixaEtaria                    *int    `json:"codigo_faixa_etaria" bson:"codigo_faixa_etaria" en:"age_range_code"`
+	FaixaEtaria                          *string `json:"faixa_etaria" bson:"faixa_etaria" en:"age_range"`
 }
 
 func (p *PartnerData) faixaEtaria(v string) {
@@ -16,10 +16,10 @@ type simpleTaxesData struct {
 }
 
 type TaxRegime struct {
-	Ano                       int     `json:"ano" bson:"ano"`
-	CNPJDaSCP                 *string `json:"cnpj_da_scp" bson:"cnpj_da_scp"`
-	FormaDeTributação         string  `json:"forma_de_tributacao" bson:"forma_de_tributacao"`
-	QuantidadeDeEscrituracoes int     `json:"quantidade_de_escrituracoes" bson:"quantidade_de_escrituracoes"`
+	Ano                       int     `json:"ano" bson:"ano" en:"year"`
+	CNPJDaSCP                 *string `json:"cnpj_da_scp" bson:"cnpj_da_scp" en:"scp_cnpj"`
+	FormaDeTributação         string  `json:"forma_de_tributacao" bson:"forma_de_tributacao" en:"taxation_method"`
+	QuantidadeDeEscrituracoes int     `json:"quantidade_de_escrituracoes" bson:"quantidade_de_escrituracoes" en:"bookkeeping_count"`
 }
 
 type TaxRegimes []TaxRegime
@@ -25,15 +25,26 @@ const (
 )
 
 var extraIdexes = [...]string{
+	"capital_social",
 	"cnae_fiscal",
 	"cnaes_secundarios.codigo",
 	"codigo_municipio",
 	"codigo_municipio_ibge",
 	"codigo_natureza_juridica",
 	"qsa.cnpj_cpf_do_socio",
+	"situacao_cadastral",
 	"uf",
 }
 
+// sortIndexes are only used to sort search results (order_by) in PostgreSQL
+// and MongoDB, so they are opt-in: each one reads the whole table and takes
+// disk space proportional to the number of CNPJs. Sorting by capital_social
+// uses its extra index.
+var sortIndexes = [...]string{
+	"data_inicio_atividade",
+	"razao_social",
+}
+
 type database interface {
 	PreLoad() error
 	CreateCompanies([][]string) error
@@ -49,15 +60,22 @@ type kvStorage interface {
 	close() error
 }
 
-func saveUpdatedAt(db database, dir string) error {
-	slog.Info("Saving the updated at date to the database…")
+func readUpdatedAt(dir string) (string, error) {
 	p := filepath.Join(dir, download.FederalRevenueUpdatedAt)
 	v, err := os.ReadFile(p)
 	if err != nil {
-		return fmt.Errorf("error reading %s: %w", p, err)
+		return "", fmt.Errorf("error reading %s: %w", p, err)
+	}
+	return string(v), nil
+}
 
+func saveUpdatedAt(db database, dir string) error {
+	slog.Info("Saving the updated at date to the database…")
+	v, err := readUpdatedAt(dir)
+	if err != nil {
+		return err
 	}
-	return db.MetaSave("updated-at", string(v))
+	return db.MetaSave("updated-at", v)
 }
 
 func createKeyValueStorage(dir string, pth string, l lookups, maxKV int) (err error) { // using named return so we can set it in the defer call
@@ -76,7 +94,7 @@ func createKeyValueStorage(dir string, pth string, l lookups, maxKV int) (err er
 	return nil
 }
 
-func createJSONs(dir string, pth string, db database, l lookups, maxDB, batchSize int, privacy bool, structured bool) error {
+func createJSONs(dir string, pth string, db database, l lookups, maxDB, batchSize int, privacy bool, structured bool, u incrementalDatabase) error {
 	kv, err := newBadgerStorage(pth, true)
 	if err != nil {
 		return fmt.Errorf("could not create badger storage: %w", err)
@@ -86,33 +104,58 @@ func createJSONs(dir string, pth string, db database, l lookups, maxDB, batchSiz
 			slog.Warn("could not close key-value storage", "path", pth, "error", err)
 		}
 	}()
-	j, err := createJSONRecordsTask(dir, db, &l, kv, batchSize, privacy, structured)
+	j, err := createJSONRecordsTask(dir, db, &l, kv, batchSize, privacy, structured, u)
 	if err != nil {
 		return fmt.Errorf("error creating new task for venues in %s: %w", dir, err)
 	}
 	if err := j.run(maxDB); err != nil {
 		return fmt.Errorf("error writing venues to database: %w", err)
 	}
+	if u != nil {
+		if err := saveUpdateSummary(db, u, &j.summary); err != nil {
+			return err
+		}
+	}
 	return saveUpdatedAt(db, dir)
 }
 
-func postLoad(db database) error {
-	slog.Info("Consolidating the database…")
-	if err := db.PostLoad(); err != nil {
-		return err
+func postLoad(db database, incremental, sort bool) error {
+	if !incremental {
+		slog.Info("Consolidating the database…")
+		if err := db.PostLoad(); err != nil {
+			return err
+		}
+		slog.Info("Database consolidated!")
 	}
-	slog.Info("Database consolidated!")
 	slog.Info("Creating indexes…")
-	if err := db.CreateExtraIndexes(extraIdexes[:]); err != nil {
+	idxs := extraIdexes[:]
+	if sort {
+		idxs = append(idxs, sortIndexes[:]...)
+	}
+	if err := db.CreateExtraIndexes(idxs); err != nil {
 		return err
 	}
 	slog.Info("Indexes created!")
 	return nil
 }
 
+// Hook is a function called once the data is loaded (e.g. to notify the
+// changes in watched companies).
+type Hook func() error
+
 // Transform the downloaded files for company venues creating a database record
-// per CNPJ
-func Transform(dir string, db database, maxDB, maxKV, s int, p bool, structured bool) error {
+// per CNPJ. In incremental mode, it updates the records of a previous load:
+// only new and changed companies are written, and companies absent from the
+// downloaded files are removed. With sort, the indexes used only to sort the
+// search results are created too. Hooks are called, in order, after the load.
+func Transform(dir string, db database, maxDB, maxKV, s int, p bool, structured bool, incremental bool, sort bool, hooks ...Hook) error {
+	var u incrementalDatabase
+	if incremental {
+		var ok bool
+		if u, ok = db.(incrementalDatabase); !ok {
+			return fmt.Errorf("incremental updates are only supported by PostgreSQL")
+		}
+	}
 	pth, err := os.MkdirTemp("", fmt.Sprintf("minha-receita-%s-*", time.Now().Format("20060102150405")))
 	if err != nil {
 		return fmt.Errorf("error creating temporary key-value storage: %w", err)
@@ -129,8 +172,16 @@ func Transform(dir string, db database, maxDB, maxKV, s int, p bool, structured
 	if err := createKeyValueStorage(dir, pth, l, 1024); err != nil {
 		return err
 	}
-	if err := createJSONs(dir, pth, db, l, maxDB, s, p, structured); err != nil {
+	if err := createJSONs(dir, pth, db, l, maxDB, s, p, structured, u); err != nil {
 		return err
 	}
-	return postLoad(db)
+	if err := postLoad(db, incremental, sort); err != nil {
+		return err
+	}
+	for _, h := range hooks {
+		if err := h(); err != nil {
+			return fmt.Errorf("error running post load hook: %w", err)
+		}
+	}
+	return nil
 }
@@ -63,6 +63,49 @@ func (i inMemoryDB) GetCompany(n string) (string, error) {
 	return "", fmt.Errorf("company %s not found", n)
 }
 
+// incrementalInMemoryDB compares the JSON itself instead of a hash
+type incrementalInMemoryDB struct {
+	inMemoryDB
+	seen *storage
+}
+
+func (i incrementalInMemoryDB) PreUpdate(string) error { return nil }
+
+func (i incrementalInMemoryDB) UpdateCompanies(cs [][]string) (int, int, error) {
+	i.cnpj.lock.Lock()
+	defer i.cnpj.lock.Unlock()
+	i.seen.lock.Lock()
+	defer i.seen.lock.Unlock()
+	var ins, upd int
+	for _, c := range cs {
+		i.seen.data[c[0]] = ""
+		j, ok := i.cnpj.data[c[0]]
+		if ok && j == c[1] {
+			continue
+		}
+		if ok {
+			upd++
+		} else {
+			ins++
+		}
+		i.cnpj.data[c[0]] = c[1]
+	}
+	return ins, upd, nil
+}
+
+func (i incrementalInMemoryDB) PostUpdate() (int, error) {
+	i.cnpj.lock.Lock()
+	defer i.cnpj.lock.Unlock()
+	var n int
+	for k := range i.cnpj.data {
+		if _, ok := i.seen.data[k]; !ok {
+			delete(i.cnpj.data, k)
+			n++
+		}
+	}
+	return n, nil
+}
+
 func newTestDB() inMemoryDB {
 	return inMemoryDB{
 		cnpj: &storage{data: make(map[string]string)},
@@ -0,0 +1,218 @@
+package transform
+
+import (
+	"encoding/json/v2"
+	"fmt"
+	"strings"
+)
+
+// The types in this file describe the second version of the company JSON: the
+// same data as Company, but nested in groups (address, contacts, taxes etc.)
+// and with typed phone numbers. It is derived from the stored document (the
+// first version), so there is no need to reload the database to serve it.
+
+type CodeDescription struct {
+	Codigo    *int    `json:"codigo" en:"code"`
+	Descricao *string `json:"descricao" en:"description"`
+}
+
+type SituacaoCadastralV2 struct {
+	Codigo    *int             `json:"codigo" en:"code"`
+	Descricao *string          `json:"descricao" en:"description"`
+	Data      *date            `json:"data" en:"date"`
+	Motivo    *CodeDescription `json:"motivo" en:"reason"`
+}
+
+type SituacaoEspecialV2 struct {
+	Descricao string `json:"descricao" en:"description"`
+	Data      *date  `json:"data" en:"date"`
+}
+
+type MunicipioV2 struct {
+	Codigo     *int    `json:"codigo" en:"code"`
+	CodigoIBGE *int    `json:"codigo_ibge" en:"code_ibge"`
+	Nome       *string `json:"nome" en:"name"`
+}
+
+type PaisV2 struct {
+	Codigo *int    `json:"codigo" en:"code"`
+	Nome   *string `json:"nome" en:"name"`
+}
+
+type EnderecoV2 struct {
+	TipoDeLogradouro     string      `json:"tipo_de_logradouro" en:"street_type"`
+	Logradouro           string      `json:"logradouro" en:"street"`
+	Numero               string      `json:"numero" en:"number"`
+	Complemento          string      `json:"complemento" en:"complement"`
+	Bairro               string      `json:"bairro" en:"neighborhood"`
+	CEP                  string      `json:"cep" en:"zip_code"`
+	UF                   string      `json:"uf" en:"state"`
+	Municipio            MunicipioV2 `json:"municipio" en:"city"`
+	Pais                 PaisV2      `json:"pais" en:"country"`
+	NomeCidadeNoExterior string      `json:"nome_cidade_no_exterior" en:"foreign_city_name"`
+}
+
+type TelefoneV2 struct {
+	Tipo   string `json:"tipo" en:"type"` // telefone or fax
+	DDD    string `json:"ddd" en:"area_code"`
+	Numero string `json:"numero" en:"number"`
+}
+
+type ContatosV2 struct {
+	Telefones []TelefoneV2 `json:"telefones" en:"phones"`
+	Email     *string      `json:"email" en:"email"`
+}
+
+type OpcaoTributariaV2 struct {
+	Optante      *bool `json:"optante" en:"opted"`
+	DataOpcao    *date `json:"data_opcao" en:"option_date"`
+	DataExclusao *date `json:"data_exclusao" en:"exclusion_date"`
+}
+
+type RepresentanteLegalV2 struct {
+	CPF          string          `json:"cpf" en:"cpf"`
+	Nome         string          `json:"nome" en:"name"`
+	Qualificacao CodeDescription `json:"qualificacao" en:"qualification"`
+}
+
+type SocioV2 struct {
+	Identificador        *int                 `json:"identificador" en:"partner_type"`
+	Nome                 string               `json:"nome" en:"name"`
+	CNPJCPF              string               `json:"cnpj_cpf" en:"cnpj_cpf"`
+	Qualificacao         CodeDescription      `json:"qualificacao" en:"qualification"`
+	DataEntradaSociedade *date                `json:"data_entrada_sociedade" en:"joined_at"`
+	Pais                 PaisV2               `json:"pais" en:"country"`
+	RepresentanteLegal   RepresentanteLegalV2 `json:"representante_legal" en:"legal_representative"`
+	FaixaEtaria          CodeDescription      `json:"faixa_etaria" en:"age_range"`
+}
+
+type CompanyV2 struct {
+	CNPJ                      string              `json:"cnpj" en:"cnpj"`
+	RazaoSocial               string              `json:"razao_social" en:"legal_name"`
+	NomeFantasia              string              `json:"nome_fantasia" en:"trade_name"`
+	MatrizFilial              CodeDescription     `json:"matriz_filial" en:"headquarters_or_branch"`
+	SituacaoCadastral         SituacaoCadastralV2 `json:"situacao_cadastral" en:"registration_status"`
+	SituacaoEspecial          SituacaoEspecialV2  `json:"situacao_especial" en:"special_status"`
+	DataInicioAtividade       *date               `json:"data_inicio_atividade" en:"activity_start_date"`
+	NaturezaJuridica          CodeDescription     `json:"natureza_juridica" en:"legal_nature"`
+	Porte                     CodeDescription     `json:"porte" en:"size"`
+	CapitalSocial             *float32            `json:"capital_social" en:"share_capital"`
+	QualificacaoDoResponsavel *int                `json:"qualificacao_do_responsavel" en:"responsible_qualification_code"`
+	EnteFederativoResponsavel string              `json:"ente_federativo_responsavel" en:"responsible_federative_entity"`
+	CNAEFiscal                CodeDescription     `json:"cnae_fiscal" en:"main_cnae"`
+	CNAESecundarios           []CNAE              `json:"cnaes_secundarios" en:"secondary_cnaes"`
+	Endereco                  EnderecoV2          `json:"endereco" en:"address"`
+	Contatos                  ContatosV2          `json:"contatos" en:"contacts"`
+	Simples                   OpcaoTributariaV2   `json:"simples" en:"simples"`
+	MEI                       OpcaoTributariaV2   `json:"mei" en:"mei"`
+	QuadroSocietario          []SocioV2           `json:"qsa" en:"partners"`
+	RegimeTributario          TaxRegimes          `json:"regime_tributario" en:"tax_regimes"`
+}
+
+// newTelefoneV2 splits the DDD from the number, since the first version of
+// the JSON has them concatenated (e.g. 1123851939). Brazilian DDDs have two
+// digits and numbers have eight (landlines) or nine (mobile) digits.
+func newTelefoneV2(t, v string) (TelefoneV2, bool) {
+	var b strings.Builder
+	for _, r := range v {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	n := strings.TrimLeft(b.String(), "0")
+	if n == "" {
+		return TelefoneV2{}, false
+	}
+	if len(n) < 10 {
+		return TelefoneV2{Tipo: t, Numero: n}, true
+	}
+	return TelefoneV2{Tipo: t, DDD: n[:2], Numero: n[2:]}, true
+}
+
+func newSocioV2(p PartnerData) SocioV2 {
+	return SocioV2{
+		Identificador:        p.IdentificadorDeSocio,
+		Nome:                 p.NomeSocio,
+		CNPJCPF:              p.CNPJCPFDoSocio,
+		Qualificacao:         CodeDescription{p.CodigoQualificacaoSocio, p.QualificaoSocio},
+		DataEntradaSociedade: p.DataEntradaSociedade,
+		Pais:                 PaisV2{p.CodigoPais, p.Pais},
+		RepresentanteLegal: RepresentanteLegalV2{
+			CPF:          p.CPFRepresentanteLegal,
+			Nome:         p.NomeRepresentanteLegal,
+			Qualificacao: CodeDescription{p.CodigoQualificacaoRepresentanteLegal, p.QualificacaoRepresentanteLegal},
+		},
+		FaixaEtaria: CodeDescription{p.CodigoFaixaEtaria, p.FaixaEtaria},
+	}
+}
+
+// V2 converts a company to the second version of the JSON structure.
+func (c *Company) V2() CompanyV2 {
+	v := CompanyV2{
+		CNPJ:                      c.CNPJ,
+		RazaoSocial:               c.RazaoSocial,
+		NomeFantasia:              c.NomeFantasia,
+		MatrizFilial:              CodeDescription{c.IdentificadorMatrizFilial, c.DescricaoMatrizFilial},
+		SituacaoEspecial:          SituacaoEspecialV2{c.SituacaoEspecial, c.DataSituacaoEspecial},
+		DataInicioAtividade:       c.DataInicioAtividade,
+		NaturezaJuridica:          CodeDescription{c.CodigoNaturezaJuridica, c.NaturezaJuridica},
+		Porte:                     CodeDescription{c.CodigoPorte, c.Porte},
+		CapitalSocial:             c.CapitalSocial,
+		QualificacaoDoResponsavel: c.QualificacaoDoResponsavel,
+		EnteFederativoResponsavel: c.EnteFederativoResponsavel,
+		CNAEFiscal:                CodeDescription{c.CNAEFiscal, c.CNAEFiscalDescricao},
+		CNAESecundarios:           c.CNAESecundarios,
+		Endereco: EnderecoV2{
+			TipoDeLogradouro:     c.DescricaoTipoDeLogradouro,
+			Logradouro:           c.Logradouro,
+			Numero:               c.Numero,
+			Complemento:          c.Complemento,
+			Bairro:               c.Bairro,
+			CEP:                  c.CEP,
+			UF:                   c.UF,
+			Municipio:            MunicipioV2{c.CodigoMunicipio, c.CodigoMunicipioIBGE, c.Municipio},
+			Pais:                 PaisV2{c.CodigoPais, c.Pais},
+			NomeCidadeNoExterior: c.NomeCidadeNoExterior,
+		},
+		Contatos:         ContatosV2{Telefones: []TelefoneV2{}, Email: c.Email},
+		Simples:          OpcaoTributariaV2{c.OpcaoPeloSimples, c.DataOpcaoPeloSimples, c.DataExclusaoDoSimples},
+		MEI:              OpcaoTributariaV2{c.OpcaoPeloMEI, c.DataOpcaoPeloMEI, c.DataExclusaoDoMEI},
+		QuadroSocietario: make([]SocioV2, len(c.QuadroSocietario)),
+		RegimeTributario: c.RegimeTributario,
+	}
+	v.SituacaoCadastral = SituacaoCadastralV2{
+		Codigo:    c.SituacaoCadastral,
+		Descricao: c.DescricaoSituacaoCadastral,
+		Data:      c.DataSituacaoCadastral,
+	}
+	if c.MotivoSituacaoCadastral != nil {
+		v.SituacaoCadastral.Motivo = &CodeDescription{c.MotivoSituacaoCadastral, c.DescricaoMotivoSituacaoCadastral}
+	}
+	for _, t := range []struct{ kind, value string }{
+		{"telefone", c.Telefone1},
+		{"telefone", c.Telefone2},
+		{"fax", c.Fax},
+	} {
+		if p, ok := newTelefoneV2(t.kind, t.value); ok {
+			v.Contatos.Telefones = append(v.Contatos.Telefones, p)
+		}
+	}
+	for i, p := range c.QuadroSocietario {
+		v.QuadroSocietario[i] = newSocioV2(p)
+	}
+	return v
+}
+
+// V2JSON takes the JSON of a company (as created by Company.JSON) and returns
+// the second version of the JSON structure for the same company.
+func V2JSON(b []byte) ([]byte, error) {
+	var c Company
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("error parsing company json: %w", err)
+	}
+	v, err := json.Marshal(c.V2())
+	if err != nil {
+		return nil, fmt.Errorf("error serializing company %s json v2: %w", c.CNPJ, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,91 @@
+package transform
+
+import (
+	"encoding/json/v2"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNewTelefoneV2(t *testing.T) {
+	for _, c := range []struct {
+		value    string
+		expected TelefoneV2
+		ok       bool
+	}{
+		{"", TelefoneV2{}, false},
+		{"0000", TelefoneV2{}, false},
+		{"1123851939", TelefoneV2{"telefone", "11", "23851939"}, true},
+		{"61987654321", TelefoneV2{"telefone", "61", "987654321"}, true},
+		{"  6133334444", TelefoneV2{"telefone", "61", "33334444"}, true},
+		{"0061 33334444", TelefoneV2{"telefone", "61", "33334444"}, true},
+		{"33334444", TelefoneV2{"telefone", "", "33334444"}, true},
+	} {
+		got, ok := newTelefoneV2("telefone", c.value)
+		if ok != c.ok {
+			t.Errorf("expected ok to be %t for %q, got %t", c.ok, c.value, ok)
+		}
+		if got != c.expected {
+			t.Errorf("expected %#v for %q, got %#v", c.expected, c.value, got)
+		}
+	}
+}
+
+func TestV2JSON(t *testing.T) {
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		t.Fatalf("error reading company JSON file: %s", err)
+	}
+	got, err := V2JSON(b)
+	if err != nil {
+		t.Fatalf("expected no error converting to v2, got %s", err)
+	}
+	var c CompanyV2
+	if err := json.Unmarshal(got, &c); err != nil {
+		t.Fatalf("expected no error parsing v2 json, got %s", err)
+	}
+	if c.CNPJ != "19131243000197" {
+		t.Errorf("expected cnpj to be 19131243000197, got %s", c.CNPJ)
+	}
+	if c.Endereco.UF != "SP" || *c.Endereco.Municipio.CodigoIBGE != 3550308 || *c.Endereco.Municipio.Nome != "SAO PAULO" {
+		t.Errorf("expected address in São Paulo, got %#v", c.Endereco)
+	}
+	exp := []TelefoneV2{{"telefone", "11", "23851939"}}
+	if !reflect.DeepEqual(c.Contatos.Telefones, exp) {
+		t.Errorf("expected phones to be %#v, got %#v", exp, c.Contatos.Telefones)
+	}
+	if *c.SituacaoCadastral.Descricao != "ATIVA" || *c.SituacaoCadastral.Motivo.Descricao != "SEM MOTIVO" {
+		t.Errorf("expected situacao cadastral to be ATIVA (SEM MOTIVO), got %#v", c.SituacaoCadastral)
+	}
+	if *c.CNAEFiscal.Codigo != 9430800 || len(c.CNAESecundarios) != 5 {
+		t.Errorf("expected CNAEs to be preserved, got %#v and %#v", c.CNAEFiscal, c.CNAESecundarios)
+	}
+	if c.Simples.Optante != nil || c.MEI.Optante != nil {
+		t.Errorf("expected simples and mei to be null, got %#v and %#v", c.Simples, c.MEI)
+	}
+	if len(c.QuadroSocietario) != 1 || *c.QuadroSocietario[0].FaixaEtaria.Codigo != 5 {
+		t.Errorf("expected one partner with faixa etaria 5, got %#v", c.QuadroSocietario)
+	}
+	if len(c.RegimeTributario) != 7 {
+		t.Errorf("expected 7 tax regimes, got %d", len(c.RegimeTributario))
+	}
+}
+
+func TestV2JSONWithoutPhones(t *testing.T) {
+	got, err := V2JSON([]byte(`{"cnpj":"19131243000197","qsa":null}`))
+	if err != nil {
+		t.Fatalf("expected no error converting to v2, got %s", err)
+	}
+	var c map[string]any
+	if err := json.Unmarshal(got, &c); err != nil {
+		t.Fatalf("expected no error parsing v2 json, got %s", err)
+	}
+	ts := c["contatos"].(map[string]any)["telefones"]
+	if ts == nil || len(ts.([]any)) != 0 {
+		t.Errorf("expected phones to be an empty array, got %v", ts)
+	}
+	if qsa := c["qsa"]; qsa == nil || len(qsa.([]any)) != 0 {
+		t.Errorf("expected qsa to be an empty array, got %v", qsa)
+	}
+}
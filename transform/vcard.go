@@ -0,0 +1,95 @@
+package transform
+
+import (
+	"encoding/json/v2"
+	"fmt"
+	"strings"
+
+	"github.com/cuducos/go-cnpj"
+)
+
+const vCardMaxLineLength = 75 // in octets, as in RFC 6350
+
+var vCardEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\n", `\n`, "\r", "")
+
+// foldVCardLine splits lines longer than 75 octets, continuing them in the
+// next line starting with a space, without breaking UTF-8 characters.
+func foldVCardLine(l string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range l {
+		s := len(string(r))
+		if n+s > vCardMaxLineLength {
+			b.WriteString("\r\n ")
+			n = 1
+		}
+		b.WriteRune(r)
+		n += s
+	}
+	return b.String()
+}
+
+// VCard converts a company to a vCard 4.0 (RFC 6350) of kind `org`.
+func (c *Company) VCard() string {
+	var ls []string
+	add := func(l string) { ls = append(ls, foldVCardLine(l)) }
+	add("BEGIN:VCARD")
+	add("VERSION:4.0")
+	add("KIND:org")
+	n := c.RazaoSocial
+	if c.NomeFantasia != "" {
+		n = c.NomeFantasia
+	}
+	add("FN:" + vCardEscaper.Replace(n))
+	add("ORG:" + vCardEscaper.Replace(c.RazaoSocial))
+	if c.NomeFantasia != "" {
+		add("NICKNAME:" + vCardEscaper.Replace(c.NomeFantasia))
+	}
+	var city, country string
+	if c.Municipio != nil {
+		city = *c.Municipio
+	}
+	if c.NomeCidadeNoExterior != "" {
+		city = c.NomeCidadeNoExterior
+	}
+	if c.Pais != nil && c.CodigoPais != nil && *c.CodigoPais != brazil {
+		country = *c.Pais
+	} else if c.UF != "" && c.UF != "EX" {
+		country = "Brasil"
+	}
+	adr := []string{ // PO box, extended address, street, locality, region, postal code, country
+		"",
+		joinNonEmpty(" ", c.Complemento, c.Bairro),
+		joinNonEmpty(" ", joinNonEmpty(" ", c.DescricaoTipoDeLogradouro, c.Logradouro), c.Numero),
+		city,
+		c.UF,
+		formatCEP(c.CEP),
+		country,
+	}
+	for i, v := range adr {
+		adr[i] = vCardEscaper.Replace(v)
+	}
+	add("ADR;TYPE=work:" + strings.Join(adr, ";"))
+	for _, p := range c.phones() {
+		add("TEL;TYPE=work,voice;VALUE=uri:tel:" + p)
+	}
+	if t, ok := newTelefoneV2("fax", c.Fax); ok && t.DDD != "" {
+		add("TEL;TYPE=work,fax;VALUE=uri:tel:+55" + t.DDD + t.Numero)
+	}
+	if c.Email != nil && *c.Email != "" {
+		add("EMAIL;TYPE=work:" + vCardEscaper.Replace(*c.Email))
+	}
+	add("NOTE:CNPJ " + cnpj.Mask(c.CNPJ))
+	add("END:VCARD")
+	return strings.Join(ls, "\r\n") + "\r\n"
+}
+
+// VCard takes the JSON of a company (as created by Company.JSON) and returns
+// its vCard representation.
+func VCard(b []byte) ([]byte, error) {
+	var c Company
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("error parsing company json: %w", err)
+	}
+	return []byte(c.VCard()), nil
+}
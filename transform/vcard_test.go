@@ -0,0 +1,55 @@
+package transform
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVCard(t *testing.T) {
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "response.json"))
+	if err != nil {
+		t.Fatalf("error reading company JSON file: %s", err)
+	}
+	got, err := VCard(b)
+	if err != nil {
+		t.Fatalf("expected no error converting to vcard, got %s", err)
+	}
+	exp := strings.Join([]string{
+		"BEGIN:VCARD",
+		"VERSION:4.0",
+		"KIND:org",
+		"FN:OPEN KNOWLEDGE BRASIL",
+		"ORG:OPEN KNOWLEDGE BRASIL",
+		"ADR;TYPE=work:;ANDAR 4 BELA VISTA;AVENIDA PAULISTA 37 37;SAO PAULO;SP;01311",
+		" -902;Brasil", // folded line
+		"TEL;TYPE=work,voice;VALUE=uri:tel:+551123851939",
+		"NOTE:CNPJ 19.131.243/0001-97",
+		"END:VCARD",
+		"",
+	}, "\r\n")
+	if string(got) != exp {
+		t.Errorf("expected vcard to be:\n%s\ngot:\n%s", exp, got)
+	}
+}
+
+func TestVCardEscapingAndFolding(t *testing.T) {
+	c := Company{
+		CNPJ:         "19131243000197",
+		RazaoSocial:  "FOO, BAR; BAZ",
+		NomeFantasia: strings.Repeat("Á", 50),
+	}
+	got := c.VCard()
+	if !strings.Contains(got, `ORG:FOO\, BAR\; BAZ`) {
+		t.Errorf("expected commas and semicolons to be escaped, got %s", got)
+	}
+	for l := range strings.SplitSeq(got, "\r\n") {
+		if len(l) > vCardMaxLineLength {
+			t.Errorf("expected lines to have at most %d octets, got %d: %s", vCardMaxLineLength, len(l), l)
+		}
+	}
+	if !strings.Contains(got, "\r\n Á") {
+		t.Errorf("expected long lines to be folded, got %s", got)
+	}
+}
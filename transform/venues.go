@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"strings"
 
 	"github.com/cuducos/go-cnpj"
 	"github.com/schollz/progressbar/v3"
@@ -19,6 +20,11 @@ type venuesTask struct {
 	dir        string
 	db         database
 	batchSize  int
+
+	// incremental is set when updating a previous load instead of loading
+	// the companies from scratch
+	incremental incrementalDatabase
+	summary     UpdateSummary
 }
 
 func (t *venuesTask) saveBatch(b []Company) (int, error) {
@@ -33,6 +39,14 @@ func (t *venuesTask) saveBatch(b []Company) (int, error) {
 		}
 		s[i] = []string{c.CNPJ, j}
 	}
+	if t.incremental != nil {
+		i, u, err := t.incremental.UpdateCompanies(s)
+		if err != nil {
+			return 0, fmt.Errorf("error updating companies: %w", err)
+		}
+		t.summary.add(len(s), i, u)
+		return len(s), nil
+	}
 	var err error
 	if t.structured {
 		err = t.db.CreateCompaniesStructured(s)
@@ -112,7 +126,17 @@ func (t *venuesTask) run(m int) error {
 	if err := bar.RenderBlank(); err != nil {
 		return fmt.Errorf("error rendering the progress bar: %w", err)
 	}
-	if err := t.db.PreLoad(); err != nil {
+	prepare := t.db.PreLoad
+	if t.incremental != nil {
+		prepare = func() error {
+			v, err := readUpdatedAt(t.dir)
+			if err != nil {
+				return err
+			}
+			return t.incremental.PreUpdate(strings.TrimSpace(v))
+		}
+	}
+	if err := prepare(); err != nil {
 		return fmt.Errorf("error preparing the database: %w", err)
 	}
 	ctx, cancel := context.WithCancel(context.Background())
@@ -155,7 +179,7 @@ func (t *venuesTask) run(m int) error {
 	}
 }
 
-func createJSONRecordsTask(dir string, db database, l *lookups, kv kvStorage, b int, p bool, structured bool) (*venuesTask, error) {
+func createJSONRecordsTask(dir string, db database, l *lookups, kv kvStorage, b int, p bool, structured bool, u incrementalDatabase) (*venuesTask, error) {
 	v, err := newSource(context.Background(), venues, dir)
 	if err != nil {
 		return nil, fmt.Errorf("error creating a source for venues from %s: %w", dir, err)
@@ -169,6 +193,8 @@ func createJSONRecordsTask(dir string, db database, l *lookups, kv kvStorage, b
 		dir:        dir,
 		db:         db,
 		batchSize:  b,
+
+		incremental: u,
 	}
 	return &t, nil
 }
@@ -1,6 +1,9 @@
 package transform
 
-import "testing"
+import (
+	"fmt"
+	"testing"
+)
 
 func TestTaskRun(t *testing.T) {
 	db := newTestDB()
@@ -20,7 +23,7 @@ func TestTaskRun(t *testing.T) {
 	if err := kv.load(testdata, &lookups, 1024); err != nil {
 		t.Errorf("expected no error loading values to badger, got %s", err)
 	}
-	r, err := createJSONRecordsTask(testdata, db, &lookups, kv, 2, false, false)
+	r, err := createJSONRecordsTask(testdata, db, &lookups, kv, 2, false, false, nil)
 	if err != nil {
 		t.Errorf("expected no error creating task, got %s", err)
 	}
@@ -40,3 +43,46 @@ func TestTaskRun(t *testing.T) {
 		t.Errorf("expected cnpj to be %s, got %s", expected, c.CNPJ)
 	}
 }
+
+func TestTaskRunIncremental(t *testing.T) {
+	db := incrementalInMemoryDB{newTestDB(), &storage{data: make(map[string]string)}}
+	db.cnpj.data["33683111000280"] = "{}"
+	db.cnpj.data["00000000000191"] = "{}"
+	kv, err := newBadgerStorage(t.TempDir(), false)
+	if err != nil {
+		t.Errorf("expected no error creating badger, got %s", err)
+	}
+	defer func() {
+		if err := kv.close(); err != nil {
+			t.Errorf("expected no error closing key-value storage, got %s", err)
+		}
+	}()
+	lookups, err := newLookups(testdata)
+	if err != nil {
+		t.Errorf("expected no errors creating look up tables, got %v", err)
+	}
+	if err := kv.load(testdata, &lookups, 1024); err != nil {
+		t.Errorf("expected no error loading values to badger, got %s", err)
+	}
+	r, err := createJSONRecordsTask(testdata, db, &lookups, kv, 2, false, false, db)
+	if err != nil {
+		t.Errorf("expected no error creating task, got %s", err)
+	}
+	if err = r.run(2); err != nil {
+		t.Errorf("expected no error running task, got %s", err)
+	}
+	if err := saveUpdateSummary(db, db, &r.summary); err != nil {
+		t.Errorf("expected no error saving the update summary, got %s", err)
+	}
+	n := int64(len(db.cnpj.data))
+	exp := fmt.Sprintf(`{"inserted":%d,"updated":1,"unchanged":0,"removed":1}`, n-1)
+	if got := db.meta.data[UpdateSummaryKey]; got != exp {
+		t.Errorf("expected update summary to be %s, got %s", exp, got)
+	}
+	if _, err := db.GetCompany("00000000000191"); err == nil {
+		t.Error("expected company absent from the release to be removed")
+	}
+	if s, _ := db.GetCompany("33683111000280"); s == "{}" {
+		t.Error("expected changed company to be updated")
+	}
+}
@@ -0,0 +1,328 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/avast/retry-go/v4"
+	"github.com/cuducos/minha-receita/transform"
+)
+
+const (
+	// SignatureHeader carries the HMAC-SHA256 of the request body, signed with
+	// the watchlist secret, as sha256=<hex digest>.
+	SignatureHeader = "X-Minha-Receita-Signature"
+
+	batchSize      = 1_000
+	Retries        = 5
+	Backoff        = 1 * time.Second
+	requestTimeout = 30 * time.Second
+)
+
+// Config sets how the changes are delivered.
+type Config struct {
+	Outbox  string // NDJSON file for watchlists without webhook or failed deliveries
+	Retries uint
+	Backoff time.Duration
+	Client  *http.Client
+}
+
+// Event is the payload delivered for a watchlist with changes.
+type Event struct {
+	Watchlist string             `json:"watchlist"`
+	Name      string             `json:"name"`
+	UpdatedAt string             `json:"updated_at,omitempty"`
+	SentAt    time.Time          `json:"sent_at"`
+	Changes   []transform.Change `json:"changes"`
+}
+
+// Sign returns the value of the signature header for a body.
+func Sign(secret string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(body)
+	return "sha256=" + hex.EncodeToString(h.Sum(nil))
+}
+
+type httpError struct{ status int }
+
+func (e httpError) Error() string { return fmt.Sprintf("webhook responded with http %d", e.status) }
+
+func retryable(err error) bool {
+	var h httpError
+	if errors.As(err, &h) {
+		return h.status >= 500 || h.status == http.StatusTooManyRequests
+	}
+	return true // network errors
+}
+
+func post(ctx context.Context, c *http.Client, w Watchlist, b []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.Webhook, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("could not create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(w.Secret, b))
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		slog.Debug("could not read webhook response", "watchlist", w.ID, "error", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return httpError{resp.StatusCode}
+	}
+	return nil
+}
+
+func deliver(ctx context.Context, cfg Config, w Watchlist, b []byte) error {
+	c := cfg.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	err := retry.Do(
+		func() error { return post(ctx, c, w, b) },
+		retry.Context(ctx),
+		retry.Attempts(cfg.Retries+1),
+		retry.Delay(cfg.Backoff),
+		retry.DelayType(retry.BackOffDelay),
+		retry.RetryIf(retryable),
+		retry.LastErrorOnly(true),
+	)
+	if err != nil {
+		return fmt.Errorf("could not deliver changes of watchlist %s to %s: %w", w.ID, w.Webhook, err)
+	}
+	return nil
+}
+
+func writeOutbox(pth string, evs [][]byte) error {
+	f, err := os.OpenFile(pth, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("could not open outbox %s: %w", pth, err)
+	}
+	defer f.Close()
+	for _, b := range evs {
+		if _, err := f.Write(append(b, '\n')); err != nil {
+			return fmt.Errorf("could not write to outbox %s: %w", pth, err)
+		}
+	}
+	return nil
+}
+
+// snapshot is the version of the companies of a watchlist seen in its last
+// check: the content hash of each CNPJ (empty if the company was not found)
+// and the updated at date of the data.
+type snapshot struct {
+	UpdatedAt string            `json:"updated_at,omitempty"`
+	Hashes    map[string]string `json:"hashes"`
+}
+
+func readSnapshot(db database, id string) (*snapshot, error) {
+	v, err := db.MetaRead(metaSnapshotPrefix + id)
+	if err != nil || v == "" {
+		return nil, nil // first check
+	}
+	var s snapshot
+	if err := json.Unmarshal([]byte(v), &s); err != nil {
+		return nil, fmt.Errorf("could not parse the snapshot of watchlist %s: %w", id, err)
+	}
+	return &s, nil
+}
+
+func saveSnapshot(db database, id string, s snapshot) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("could not serialize the snapshot of watchlist %s: %w", id, err)
+	}
+	if err := db.MetaSave(metaSnapshotPrefix+id, string(b)); err != nil {
+		return fmt.Errorf("could not save the snapshot of watchlist %s: %w", id, err)
+	}
+	return nil
+}
+
+func current(ctx context.Context, db database, ids []string) (map[string]string, error) {
+	s := make(map[string]string, len(ids))
+	for c := range slices.Chunk(ids, batchSize) {
+		m, err := db.GetCompanies(ctx, c)
+		if err != nil {
+			return nil, fmt.Errorf("could not get watched companies: %w", err)
+		}
+		for _, id := range c {
+			s[id] = m[id] // empty if the company was not found
+		}
+	}
+	return s, nil
+}
+
+// historyDatabase is implemented by the databases that keep the previous
+// versions of the companies (e.g. PostgreSQL).
+type historyDatabase interface {
+	GetCompanyAt(string, time.Time) (string, error)
+}
+
+// previous returns the version of a company with the hash h seen at the
+// updated at date u, if the database keeps the history.
+func previous(db database, id, h, u string) (string, bool) {
+	hdb, ok := db.(historyDatabase)
+	if !ok {
+		return "", false
+	}
+	at, err := time.Parse(time.DateOnly, u)
+	if err != nil {
+		return "", false
+	}
+	j, err := hdb.GetCompanyAt(id, at)
+	if err != nil || transform.ContentHash(j) != h {
+		return "", false
+	}
+	return j, true
+}
+
+// changes compares the companies of a watchlist with its snapshot. Changed
+// companies include the changed fields when the database keeps the previous
+// version of the company, or the new version of the company otherwise.
+func changes(db database, w Watchlist, s *snapshot, now map[string]string) ([]transform.Change, error) {
+	var chs []transform.Change
+	for _, id := range w.CNPJs {
+		o, ok := s.Hashes[id]
+		if !ok {
+			continue // CNPJ added to the watchlist after the last check
+		}
+		n := now[id]
+		if o == hash(n) {
+			continue
+		}
+		var c *transform.Change
+		var err error
+		switch {
+		case o == "":
+			c, err = transform.CompareJSON(id, "", n)
+		case n == "":
+			c = &transform.Change{CNPJ: id, Kind: transform.Removed}
+		default:
+			j, ok := previous(db, id, o, s.UpdatedAt)
+			if ok {
+				c, err = transform.CompareJSON(id, j, n)
+				break
+			}
+			c, err = transform.CompareJSON(id, "", n)
+			if c != nil {
+				c.Kind = transform.Changed
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if c != nil {
+			chs = append(chs, *c)
+		}
+	}
+	return chs, nil
+}
+
+// hash is the content hash of a company, or empty if it was not found.
+func hash(j string) string {
+	if j == "" {
+		return ""
+	}
+	return transform.ContentHash(j)
+}
+
+// Check compares the companies of each watchlist with their version seen in
+// the previous check and delivers the changes. Watchlists checked for the first
+// time, and CNPJs added since the last check, are only recorded. Each watchlist
+// keeps its own snapshot, updated only once its changes are delivered (to the
+// webhook or to the outbox), so failed deliveries are retried in the next
+// check without sending the changes of the other watchlists again.
+func Check(ctx context.Context, db database, cfg Config) error {
+	ws, err := NewStore(db).List()
+	if err != nil {
+		return err
+	}
+	if len(ws) == 0 {
+		return nil
+	}
+	ids := make(map[string]struct{})
+	for _, w := range ws {
+		for _, n := range w.CNPJs {
+			ids[n] = struct{}{}
+		}
+	}
+	now, err := current(ctx, db, slices.Sorted(maps.Keys(ids)))
+	if err != nil {
+		return err
+	}
+	u, err := db.MetaRead("updated-at")
+	if err != nil {
+		slog.Warn("could not read the updated at date", "error", err)
+	}
+	var errs []error
+	for _, w := range ws {
+		s := snapshot{UpdatedAt: u, Hashes: make(map[string]string, len(w.CNPJs))}
+		for _, n := range w.CNPJs {
+			s.Hashes[n] = hash(now[n])
+		}
+		old, err := readSnapshot(db, w.ID)
+		if err != nil {
+			return err
+		}
+		if old != nil {
+			if err := notify(ctx, db, cfg, w, old, now, u); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		if err := saveSnapshot(db, w.ID, s); err != nil {
+			return err
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// notify delivers the changes of a watchlist to its webhook or to the outbox,
+// returning an error only if they were not delivered anywhere.
+func notify(ctx context.Context, db database, cfg Config, w Watchlist, old *snapshot, now map[string]string, u string) error {
+	chs, err := changes(db, w, old, now)
+	if err != nil {
+		return err
+	}
+	if len(chs) == 0 {
+		return nil
+	}
+	e := Event{Watchlist: w.ID, Name: w.Name, UpdatedAt: u, SentAt: time.Now(), Changes: chs}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("could not serialize changes of watchlist %s: %w", w.ID, err)
+	}
+	slog.Info("Watched companies changed", "watchlist", w.ID, "changes", len(e.Changes))
+	if w.Webhook != "" {
+		err := deliver(ctx, cfg, w, b)
+		if err == nil {
+			return nil
+		}
+		if cfg.Outbox == "" {
+			return err
+		}
+		slog.Warn("writing changes to the outbox instead", "error", err)
+	} else if cfg.Outbox == "" {
+		slog.Warn("watchlist without webhook and no outbox configured, changes discarded", "watchlist", w.ID)
+		return nil
+	}
+	return writeOutbox(cfg.Outbox, [][]byte{b})
+}
@@ -0,0 +1,236 @@
+// Package watch keeps watchlists of CNPJs and, after each data load, compares
+// the watched companies with the version seen in the previous load, delivering
+// the changes as signed webhooks or writing them to a local outbox file.
+// Watchlists and the last seen version of the watched companies are persisted
+// in the database meta storage.
+package watch
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cuducos/go-cnpj"
+)
+
+const (
+	metaKeyPrefix      = "watch-"
+	metaIndexKey       = "watchlists"
+	metaSnapshotPrefix = "watch-snapshot-"
+	maxCNPJs           = 10_000
+)
+
+var (
+	ErrNotFound = errors.New("watchlist not found")
+	ErrInvalid  = errors.New("invalid watchlist")
+)
+
+// Watchlist is a list of CNPJs whose changes are delivered to a webhook (or to
+// the outbox file, when there is no webhook).
+type Watchlist struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CNPJs     []string  `json:"cnpjs"`
+	Webhook   string    `json:"webhook,omitempty"`
+	Secret    string    `json:"secret,omitempty"` // signs the webhook requests
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WithoutSecret is a copy of the watchlist safe to be listed.
+func (w Watchlist) WithoutSecret() Watchlist {
+	w.Secret = ""
+	return w
+}
+
+type database interface {
+	GetCompanies(context.Context, []string) (map[string]string, error)
+	MetaSave(string, string) error
+	MetaRead(string) (string, error)
+	MetaDelete(string) error
+}
+
+// Store creates, lists and deletes watchlists.
+type Store struct {
+	db database
+	mu sync.Mutex
+}
+
+// NewStore creates a store using the database meta storage.
+func NewStore(db database) *Store { return &Store{db: db} }
+
+func (s *Store) ids() ([]string, error) {
+	v, err := s.db.MetaRead(metaIndexKey)
+	if err != nil || v == "" {
+		return nil, nil // no watchlists yet
+	}
+	var ids []string
+	if err := json.Unmarshal([]byte(v), &ids); err != nil {
+		return nil, fmt.Errorf("could not parse the watchlists index: %w", err)
+	}
+	return ids, nil
+}
+
+func (s *Store) saveIDs(ids []string) error {
+	b, err := json.Marshal(ids)
+	if err != nil {
+		return fmt.Errorf("could not serialize the watchlists index: %w", err)
+	}
+	if err := s.db.MetaSave(metaIndexKey, string(b)); err != nil {
+		return fmt.Errorf("could not save the watchlists index: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) get(id string) (Watchlist, error) {
+	v, err := s.db.MetaRead(metaKeyPrefix + id)
+	if err != nil || v == "" {
+		return Watchlist{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	var w Watchlist
+	if err := json.Unmarshal([]byte(v), &w); err != nil {
+		return Watchlist{}, fmt.Errorf("could not parse watchlist %s: %w", id, err)
+	}
+	return w, nil
+}
+
+// Get returns a watchlist by its ID.
+func (s *Store) Get(id string) (Watchlist, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids, err := s.ids()
+	if err != nil {
+		return Watchlist{}, err
+	}
+	if !slices.Contains(ids, id) {
+		return Watchlist{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return s.get(id)
+}
+
+// List returns all the watchlists, oldest first.
+func (s *Store) List() ([]Watchlist, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+	ws := make([]Watchlist, 0, len(ids))
+	for _, id := range ids {
+		w, err := s.get(id)
+		if err != nil {
+			return nil, err
+		}
+		ws = append(ws, w)
+	}
+	return ws, nil
+}
+
+func newSecret(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not create random value: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func validate(w *Watchlist) error {
+	if w.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+	if len(w.CNPJs) == 0 {
+		return fmt.Errorf("%w: at least one cnpj is required", ErrInvalid)
+	}
+	if len(w.CNPJs) > maxCNPJs {
+		return fmt.Errorf("%w: %d cnpjs, the maximum is %d", ErrInvalid, len(w.CNPJs), maxCNPJs)
+	}
+	ns := make([]string, 0, len(w.CNPJs))
+	for _, n := range w.CNPJs {
+		if !cnpj.IsValid(n) {
+			return fmt.Errorf("%w: invalid cnpj %s", ErrInvalid, n)
+		}
+		n = cnpj.Unmask(n)
+		if !slices.Contains(ns, n) {
+			ns = append(ns, n)
+		}
+	}
+	w.CNPJs = ns
+	if w.Webhook == "" {
+		return nil
+	}
+	u, err := url.Parse(w.Webhook)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: invalid webhook url %s", ErrInvalid, w.Webhook)
+	}
+	return nil
+}
+
+// Create validates and saves a new watchlist, creating its ID and, if it has
+// a webhook without a secret, its secret.
+func (s *Store) Create(w Watchlist) (Watchlist, error) {
+	if err := validate(&w); err != nil {
+		return Watchlist{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids, err := s.ids()
+	if err != nil {
+		return Watchlist{}, err
+	}
+	for {
+		if w.ID, err = newSecret(4); err != nil {
+			return Watchlist{}, err
+		}
+		if !slices.Contains(ids, w.ID) {
+			break
+		}
+	}
+	if w.Webhook != "" && w.Secret == "" {
+		if w.Secret, err = newSecret(32); err != nil {
+			return Watchlist{}, err
+		}
+	}
+	w.CreatedAt = time.Now()
+	b, err := json.Marshal(w)
+	if err != nil {
+		return Watchlist{}, fmt.Errorf("could not serialize watchlist %s: %w", w.ID, err)
+	}
+	if err := s.db.MetaSave(metaKeyPrefix+w.ID, string(b)); err != nil {
+		return Watchlist{}, fmt.Errorf("could not save watchlist %s: %w", w.ID, err)
+	}
+	if err := s.saveIDs(append(ids, w.ID)); err != nil {
+		return Watchlist{}, err
+	}
+	return w, nil
+}
+
+// Delete removes a watchlist.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids, err := s.ids()
+	if err != nil {
+		return err
+	}
+	i := slices.Index(ids, id)
+	if i == -1 {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err := s.saveIDs(slices.Delete(ids, i, i+1)); err != nil {
+		return err
+	}
+	if err := s.db.MetaDelete(metaKeyPrefix + id); err != nil {
+		return fmt.Errorf("could not clear watchlist %s: %w", id, err)
+	}
+	if err := s.db.MetaDelete(metaSnapshotPrefix + id); err != nil {
+		return fmt.Errorf("could not clear the snapshot of watchlist %s: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cuducos/minha-receita/transform"
+)
+
+const (
+	watched = "19131243000197"
+	other   = "33683111000280"
+)
+
+// fakeDatabase keeps the companies and the meta storage in memory.
+type fakeDatabase struct {
+	mu        sync.Mutex
+	companies map[string]string
+	previous  map[string]string
+	meta      map[string]string
+}
+
+func newFakeDatabase() *fakeDatabase {
+	return &fakeDatabase{
+		companies: map[string]string{watched: `{"cnpj":"19131243000197","razao_social":"OPEN KNOWLEDGE BRASIL"}`},
+		previous:  make(map[string]string),
+		meta:      map[string]string{"updated-at": "2025-10-12"},
+	}
+}
+
+// fakeHistoryDatabase also returns the version of the companies before the
+// last rename, like the databases that keep the history.
+type fakeHistoryDatabase struct{ *fakeDatabase }
+
+func (f fakeHistoryDatabase) GetCompanyAt(id string, _ time.Time) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if c, ok := f.previous[id]; ok {
+		return c, nil
+	}
+	return f.companies[id], nil
+}
+
+func (f *fakeDatabase) GetCompanies(_ context.Context, ids []string) (map[string]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cs := make(map[string]string)
+	for _, id := range ids {
+		if c, ok := f.companies[id]; ok {
+			cs[id] = c
+		}
+	}
+	return cs, nil
+}
+
+func (f *fakeDatabase) MetaSave(k, v string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.meta[k] = v
+	return nil
+}
+
+func (f *fakeDatabase) MetaRead(k string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v, ok := f.meta[k]
+	if !ok {
+		return "", fmt.Errorf("metadata key %s not found", k)
+	}
+	return v, nil
+}
+
+func (f *fakeDatabase) MetaDelete(k string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.meta, k)
+	return nil
+}
+
+func (f *fakeDatabase) rename(n string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.previous[watched] = f.companies[watched]
+	f.companies[watched] = fmt.Sprintf(`{"cnpj":"19131243000197","razao_social":"%s"}`, n)
+}
+
+func TestStore(t *testing.T) {
+	d := newFakeDatabase()
+	s := NewStore(d)
+	for _, w := range []Watchlist{
+		{CNPJs: []string{watched}},
+		{Name: "suppliers"},
+		{Name: "suppliers", CNPJs: []string{"42"}},
+		{Name: "suppliers", CNPJs: []string{watched}, Webhook: "ftp://example.com"},
+	} {
+		if _, err := s.Create(w); !errors.Is(err, ErrInvalid) {
+			t.Errorf("expected invalid watchlist error for %+v, got %v", w, err)
+		}
+	}
+	w, err := s.Create(Watchlist{Name: "suppliers", CNPJs: []string{"19.131.243/0001-97", watched}, Webhook: "https://example.com/hook"})
+	if err != nil {
+		t.Fatalf("expected no error creating watchlist, got %s", err)
+	}
+	if len(w.ID) != 8 {
+		t.Errorf("expected an 8-char id, got %s", w.ID)
+	}
+	if len(w.CNPJs) != 1 || w.CNPJs[0] != watched {
+		t.Errorf("expected unmasked and unique cnpjs, got %v", w.CNPJs)
+	}
+	if w.Secret == "" {
+		t.Error("expected a secret to be created for the webhook")
+	}
+	got, err := s.Get(w.ID)
+	if err != nil {
+		t.Fatalf("expected no error getting watchlist, got %s", err)
+	}
+	if got.Secret != w.Secret || got.Name != w.Name {
+		t.Errorf("expected %+v, got %+v", w, got)
+	}
+	if got.WithoutSecret().Secret != "" {
+		t.Error("expected watchlist without secret")
+	}
+	ws, err := s.List()
+	if err != nil {
+		t.Fatalf("expected no error listing watchlists, got %s", err)
+	}
+	if len(ws) != 1 {
+		t.Errorf("expected 1 watchlist, got %d", len(ws))
+	}
+	if err := s.Delete(w.ID); err != nil {
+		t.Fatalf("expected no error deleting watchlist, got %s", err)
+	}
+	if _, err := s.Get(w.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected not found error after deletion, got %v", err)
+	}
+	for _, k := range []string{metaKeyPrefix + w.ID, metaSnapshotPrefix + w.ID} {
+		if _, ok := d.meta[k]; ok {
+			t.Errorf("expected %s to be removed from the meta storage", k)
+		}
+	}
+	if err := s.Delete(w.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected not found error deleting twice, got %v", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	var mu sync.Mutex
+	var reqs []*http.Request
+	var bodies [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("expected no error reading the request body, got %s", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		reqs = append(reqs, r)
+		bodies = append(bodies, b)
+		if len(reqs) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable) // first attempt fails
+		}
+	}))
+	defer srv.Close()
+	f := newFakeDatabase()
+	db := fakeHistoryDatabase{f}
+	w, err := NewStore(db).Create(Watchlist{Name: "suppliers", CNPJs: []string{watched, other}, Webhook: srv.URL})
+	if err != nil {
+		t.Fatalf("expected no error creating watchlist, got %s", err)
+	}
+	cfg := Config{Retries: 2, Backoff: time.Millisecond, Client: srv.Client()}
+	if err := Check(context.Background(), db, cfg); err != nil {
+		t.Fatalf("expected no error in the first check, got %s", err)
+	}
+	if len(reqs) != 0 {
+		t.Errorf("expected no request in the first check, got %d", len(reqs))
+	}
+	if s := f.meta[metaSnapshotPrefix+w.ID]; strings.Contains(s, "OPEN KNOWLEDGE") {
+		t.Errorf("expected the snapshot to keep hashes, not the companies, got %s", s)
+	}
+
+	f.rename("OKBR")
+	if err := Check(context.Background(), db, cfg); err != nil {
+		t.Fatalf("expected no error in the second check, got %s", err)
+	}
+	if len(reqs) != 2 {
+		t.Fatalf("expected 2 requests (one retry), got %d", len(reqs))
+	}
+	if s := reqs[1].Header.Get(SignatureHeader); s != Sign(w.Secret, bodies[1]) {
+		t.Errorf("expected signature %s, got %s", Sign(w.Secret, bodies[1]), s)
+	}
+	var e Event
+	if err := json.Unmarshal(bodies[1], &e); err != nil {
+		t.Fatalf("expected no error parsing the event, got %s", err)
+	}
+	if e.Watchlist != w.ID || e.UpdatedAt != "2025-10-12" || len(e.Changes) != 1 {
+		t.Fatalf("unexpected event %+v", e)
+	}
+	c := e.Changes[0]
+	if c.CNPJ != watched || c.Kind != transform.Changed || len(c.Fields) != 1 || c.Fields[0].Field != "razao_social" {
+		t.Errorf("unexpected change %+v", c)
+	}
+
+	if err := Check(context.Background(), db, cfg); err != nil {
+		t.Fatalf("expected no error in the third check, got %s", err)
+	}
+	if len(reqs) != 2 {
+		t.Errorf("expected no request without changes, got %d requests", len(reqs))
+	}
+}
+
+func TestCheckWithoutHistory(t *testing.T) {
+	db := newFakeDatabase()
+	if _, err := NewStore(db).Create(Watchlist{Name: "suppliers", CNPJs: []string{watched}}); err != nil {
+		t.Fatalf("expected no error creating watchlist, got %s", err)
+	}
+	cfg := Config{Outbox: filepath.Join(t.TempDir(), "outbox.ndjson")}
+	if err := Check(context.Background(), db, cfg); err != nil {
+		t.Fatalf("expected no error in the first check, got %s", err)
+	}
+	db.rename("OKBR")
+	if err := Check(context.Background(), db, cfg); err != nil {
+		t.Fatalf("expected no error in the second check, got %s", err)
+	}
+	b, err := os.ReadFile(cfg.Outbox)
+	if err != nil {
+		t.Fatalf("expected no error reading the outbox, got %s", err)
+	}
+	var e Event
+	if err := json.Unmarshal(bytes.TrimSpace(b), &e); err != nil {
+		t.Fatalf("expected no error parsing the event, got %s", err)
+	}
+	if len(e.Changes) != 1 {
+		t.Fatalf("expected 1 change, got %+v", e)
+	}
+	c := e.Changes[0]
+	if c.Kind != transform.Changed || len(c.Fields) != 0 || c.Company == nil || c.Company.RazaoSocial != "OKBR" {
+		t.Errorf("expected the new version of the company without the previous one, got %+v", c)
+	}
+}
+
+func TestCheckOutbox(t *testing.T) {
+	var mu sync.Mutex
+	var delivered int
+	ok := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		delivered++
+	}))
+	defer ok.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest) // not retried
+	}))
+	defer failing.Close()
+	db := fakeHistoryDatabase{newFakeDatabase()}
+	s := NewStore(db)
+	for _, w := range []Watchlist{
+		{Name: "working webhook", CNPJs: []string{watched}, Webhook: ok.URL},
+		{Name: "failing webhook", CNPJs: []string{watched}, Webhook: failing.URL},
+		{Name: "without webhook", CNPJs: []string{watched}},
+	} {
+		if _, err := s.Create(w); err != nil {
+			t.Fatalf("expected no error creating watchlist, got %s", err)
+		}
+	}
+	cfg := Config{Retries: 2, Backoff: time.Millisecond}
+	if err := Check(context.Background(), db, cfg); err != nil {
+		t.Fatalf("expected no error in the first check, got %s", err)
+	}
+
+	db.rename("OKBR")
+	if err := Check(context.Background(), db, cfg); err == nil {
+		t.Error("expected an error delivering to the failing webhook without outbox")
+	}
+	if delivered != 1 {
+		t.Errorf("expected the working webhook to be called once, got %d", delivered)
+	}
+	cfg.Outbox = filepath.Join(t.TempDir(), "outbox.ndjson")
+	if err := Check(context.Background(), db, cfg); err != nil {
+		t.Fatalf("expected no error with the outbox, got %s", err)
+	}
+	if delivered != 1 {
+		t.Errorf("expected no duplicate delivery to the working webhook, got %d", delivered)
+	}
+	b, err := os.ReadFile(cfg.Outbox)
+	if err != nil {
+		t.Fatalf("expected no error reading the outbox, got %s", err)
+	}
+	ls := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(ls) != 1 {
+		t.Fatalf("expected only the failed event in the outbox, got %d: %s", len(ls), b)
+	}
+	if !strings.Contains(ls[0], `"name":"failing webhook"`) || !strings.Contains(ls[0], `"new":"OKBR"`) {
+		t.Errorf("expected the changes of the failing webhook in the outbox, got %s", ls[0])
+	}
+
+	if err := Check(context.Background(), db, cfg); err != nil {
+		t.Fatalf("expected no error in the last check, got %s", err)
+	}
+	if b2, _ := os.ReadFile(cfg.Outbox); len(b2) != len(b) {
+		t.Errorf("expected no new events once the changes were delivered, got %s", b2)
+	}
+}